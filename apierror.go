@@ -0,0 +1,43 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+)
+
+// ErrorResponse is the body of every API error.
+type ErrorResponse struct {
+	Error ErrorDetail `json:"error"`
+}
+
+// ErrorDetail describes an API error. Code is a stable, machine-readable
+// identifier such as "instance_not_found"; Message is meant for humans and
+// may change.
+type ErrorDetail struct {
+	Code      string `json:"code"`
+	Message   string `json:"message"`
+	RequestID string `json:"request_id,omitempty"`
+}
+
+// writeJSONError writes an error envelope. The request ID is taken from the
+// X-Request-ID response header set by withRequestID.
+func writeJSONError(w http.ResponseWriter, status int, code, message string) {
+	header := w.Header()
+	header.Del("Content-Length")
+	header.Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	writeJSON(w, ErrorResponse{Error: ErrorDetail{
+		Code:      code,
+		Message:   message,
+		RequestID: header.Get(RequestIDHeader),
+	}})
+}
+
+// writeJSON encodes v as the response body, logging failures since the
+// status has already been sent.
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Printf("Failed to encode response: %v", err)
+	}
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"strings"
+	"testing"
+)
+
+func decodeError(t *testing.T, rec *httptest.ResponseRecorder) ErrorDetail {
+	t.Helper()
+
+	if got := rec.Header().Get("Content-Type"); got != "application/json" {
+		t.Errorf("Content-Type = %q, want application/json", got)
+	}
+	var body ErrorResponse
+	if err := json.NewDecoder(rec.Body).Decode(&body); err != nil {
+		t.Fatalf("failed to decode error: %v", err)
+	}
+	return body.Error
+}
+
+func TestErrorEnvelope(t *testing.T) {
+	client := netip.MustParseAddr("192.0.2.1")
+
+	tests := []struct {
+		name   string
+		setup  func(*Server)
+		method string
+		path   string
+		header map[string]string
+		body   string
+		status int
+		code   string
+	}{
+		{"unknown instance route", nil, http.MethodGet, "/api/instances/https%3A%2F%2Fa.example/other", nil, "", http.StatusNotFound, "not_found"},
+		{"invalid sort", nil, http.MethodGet, "/api/instances?sort=bogus", nil, "", http.StatusBadRequest, "invalid_sort"},
+		{"invalid order", nil, http.MethodGet, "/api/instances?order=up", nil, "", http.StatusBadRequest, "invalid_order"},
+		{"invalid limit", nil, http.MethodGet, "/api/instances/search?limit=0", nil, "", http.StatusBadRequest, "invalid_limit"},
+		{"unknown instance histogram", nil, http.MethodGet, "/api/instances/https%3A%2F%2Fmissing.example/histogram", nil, "", http.StatusNotFound, "instance_not_found"},
+		{"unknown instance days", nil, http.MethodGet, "/api/instances/https%3A%2F%2Fmissing.example/days", nil, "", http.StatusNotFound, "instance_not_found"},
+		{"unknown group", nil, http.MethodGet, "/api/groups/missing", nil, "", http.StatusNotFound, "group_not_found"},
+		{"invalid checks", nil, http.MethodGet, "/api/stream?checks=maybe", nil, "", http.StatusBadRequest, "invalid_checks"},
+		{"invalid format", nil, http.MethodGet, "/api/instances?format=xml", nil, "", http.StatusBadRequest, "invalid_format"},
+		{"invalid window", nil, http.MethodGet, "/api/instances/https%3A%2F%2Fa.example/response-time-history?window=0s", nil, "", http.StatusBadRequest, "invalid_window"},
+		{"invalid since", nil, http.MethodGet, "/api/stats/histogram?since=yesterday", nil, "", http.StatusBadRequest, "invalid_since"},
+		{"invalid badge list", nil, http.MethodGet, "/api/badges?urls=https://a.example&group=beta", nil, "", http.StatusBadRequest, "invalid_badge_list"},
+		{"too many badges", nil, http.MethodGet, "/api/badges?urls=" + strings.Repeat("https://a.example,", maxBulkBadges+1), nil, "", http.StatusBadRequest, "too_many_badges"},
+		{"invalid badge url", nil, http.MethodGet, "/api/badge/%25zz", nil, "", http.StatusBadRequest, "invalid_url"},
+		{"invalid buckets", nil, http.MethodGet, "/api/stats/histogram?buckets=0", nil, "", http.StatusBadRequest, "invalid_buckets"},
+		{"method not allowed", nil, http.MethodPost, "/api/instances", nil, "", http.StatusMethodNotAllowed, "method_not_allowed"},
+		{
+			"admin disabled", func(s *Server) { s.config.APIKey = "" },
+			http.MethodPost, "/api/refresh", nil, "", http.StatusForbidden, "admin_disabled",
+		},
+		{
+			"wrong api key", nil,
+			http.MethodPost, "/api/refresh", map[string]string{"X-API-Key": "wrong"}, "", http.StatusUnauthorized, "unauthorized",
+		},
+		{
+			"unknown instance delete", nil,
+			http.MethodDelete, "/api/instances/https%3A%2F%2Fmissing.example", map[string]string{"X-API-Key": "secret"}, "", http.StatusNotFound, "instance_not_found",
+		},
+		{
+			"refresh in progress", func(s *Server) { s.monitor.refreshing.Store(true) },
+			http.MethodPost, "/api/refresh", map[string]string{"X-API-Key": "secret"}, "", http.StatusConflict, "refresh_in_progress",
+		},
+		{
+			"refresh failed", func(s *Server) { s.monitor.source = &FileSource{Path: "/nonexistent/instances.json"} },
+			http.MethodPost, "/api/refresh", map[string]string{"X-API-Key": "secret"}, "", http.StatusBadGateway, "refresh_failed",
+		},
+		{
+			"body too large", func(s *Server) { s.config.HTTPMaxBodyBytes = 16 },
+			http.MethodPatch, "/api/config", map[string]string{"X-API-Key": "secret"}, `{"log_level": "debug", "padding": "` + strings.Repeat("a", 64) + `"}`, http.StatusRequestEntityTooLarge, "body_too_large",
+		},
+		{
+			"invalid json", nil,
+			http.MethodPatch, "/api/config", map[string]string{"X-API-Key": "secret"}, "{", http.StatusBadRequest, "invalid_json",
+		},
+		{
+			"invalid config", nil,
+			http.MethodPatch, "/api/config", map[string]string{"X-API-Key": "secret"}, `{"check_interval_minutes": 0}`, http.StatusBadRequest, "invalid_config",
+		},
+		{
+			"webhook disabled", nil,
+			http.MethodPost, "/api/webhook/github", nil, "{}", http.StatusForbidden, "webhook_disabled",
+		},
+		{
+			"invalid signature", func(s *Server) { s.config.GitHubWebhookSecret = "secret" },
+			http.MethodPost, "/api/webhook/github", map[string]string{"X-Hub-Signature-256": "sha256=00"}, "{}", http.StatusUnauthorized, "invalid_signature",
+		},
+		{
+			"missing delivery id", func(s *Server) { s.config.GitHubWebhookSecret = "secret" },
+			http.MethodPost, "/api/webhook/github", map[string]string{"X-Hub-Signature-256": signGitHub("secret", "{}")}, "{}", http.StatusBadRequest, "missing_delivery_id",
+		},
+		{
+			"rate limited", func(s *Server) {
+				s.limiter = newRateLimiter(0.001, 1)
+				s.limiter.allow(client)
+			},
+			http.MethodGet, "/api/stats", nil, "", http.StatusTooManyRequests, "rate_limited",
+		},
+		{
+			"too many streams", func(s *Server) {
+				s.streams = newStreamLimiter(1)
+				s.streams.acquire(client)
+			},
+			http.MethodGet, "/api/stream", nil, "", http.StatusTooManyRequests, "too_many_streams",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newSortTestServer()
+			s.config.APIKey = "secret"
+			if tt.setup != nil {
+				tt.setup(s)
+			}
+
+			req := httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+			for name, value := range tt.header {
+				req.Header.Set(name, value)
+			}
+			rec := httptest.NewRecorder()
+			s.SetupRoutes().ServeHTTP(rec, req)
+
+			if rec.Code != tt.status {
+				t.Fatalf("status %d, want %d", rec.Code, tt.status)
+			}
+			detail := decodeError(t, rec)
+			if detail.Code != tt.code || detail.Message == "" {
+				t.Errorf("error = %+v, want code %s and a message", detail, tt.code)
+			}
+			if id := rec.Header().Get(RequestIDHeader); id == "" || detail.RequestID != id {
+				t.Errorf("request_id = %q, want the X-Request-ID header %q", detail.RequestID, id)
+			}
+		})
+	}
+}
+
+func TestErrorStreamingUnsupported(t *testing.T) {
+	s := newSortTestServer()
+
+	rec := httptest.NewRecorder()
+	// Hide the recorder's Flush method.
+	w := struct{ http.ResponseWriter }{rec}
+	s.handleSSE(w, httptest.NewRequest(http.MethodGet, "/api/stream", nil))
+
+	if rec.Code != http.StatusInternalServerError {
+		t.Fatalf("status %d, want 500", rec.Code)
+	}
+	if detail := decodeError(t, rec); detail.Code != "streaming_unsupported" {
+		t.Errorf("code = %q, want streaming_unsupported", detail.Code)
+	}
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"slices"
+	"sort"
+	"time"
+)
+
+// lifetimeStats counts every check of an instance since it was first seen,
+// unlike its history, which is trimmed.
+type lifetimeStats struct {
+	checks    int64
+	successes int64
+
+	// incidents counts the times the instance went down.
+	incidents int64
+}
+
+func (l lifetimeStats) uptime() float64 {
+	if l.checks == 0 {
+		return 0
+	}
+	return float64(l.successes) / float64(l.checks) * 100
+}
+
+// ArchivedInstance is the record kept of an instance removed from the list.
+type ArchivedInstance struct {
+	URL           string  `json:"url"`
+	Group         string  `json:"group"`
+	InstanceType  string  `json:"instance_type"`
+	FirstSeenUnix int64   `json:"first_seen_unix"`
+	LastSeenUnix  int64   `json:"last_seen_unix"`
+	ArchivedUnix  int64   `json:"archived_unix"`
+	Checks        int64   `json:"checks"`
+	Uptime        float64 `json:"uptime"`
+	Incidents     int64   `json:"incidents"`
+
+	firstSeen time.Time
+	lifetime  lifetimeStats
+}
+
+// archived summarizes the instance for the archive. LastSeen is its latest
+// check, or when it was first seen if it was never checked. The caller holds
+// the instance lock.
+func (instance *Instance) archived(now time.Time) ArchivedInstance {
+	lastSeen := instance.firstSeen
+	if n := len(instance.Checks); n > 0 {
+		lastSeen = instance.Checks[n-1].Timestamp
+	}
+	return ArchivedInstance{
+		URL:           instance.URL,
+		Group:         instance.Group,
+		InstanceType:  instance.InstanceType,
+		FirstSeenUnix: instance.firstSeen.Unix(),
+		LastSeenUnix:  lastSeen.Unix(),
+		ArchivedUnix:  now.Unix(),
+		Checks:        instance.lifetime.checks,
+		Uptime:        instance.lifetime.uptime(),
+		Incidents:     instance.lifetime.incidents,
+
+		firstSeen: instance.firstSeen,
+		lifetime:  instance.lifetime,
+	}
+}
+
+// archiveInstances adds removed instances to the archive, most recently
+// removed first, keeping at most ArchiveMaxInstances. The caller holds m.mu.
+func (m *Monitor) archiveInstances(removed []*Instance, now time.Time) {
+	limit := m.config.ArchiveMaxInstances
+	if limit == 0 || len(removed) == 0 {
+		return
+	}
+
+	entries := make([]ArchivedInstance, 0, len(removed))
+	for _, instance := range removed {
+		instance.mu.RLock()
+		entries = append(entries, instance.archived(now))
+		instance.mu.RUnlock()
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].URL < entries[j].URL })
+
+	m.archive = slices.DeleteFunc(m.archive, func(a ArchivedInstance) bool {
+		return slices.ContainsFunc(entries, func(e ArchivedInstance) bool { return e.URL == a.URL })
+	})
+	m.archive = append(entries, m.archive...)
+	if len(m.archive) > limit {
+		m.archive = m.archive[:limit]
+	}
+}
+
+// restoreArchived takes an instance added to the list out of the archive if
+// it was there, giving it back when it was first seen and its lifetime
+// counters. The caller holds m.mu, and the instance is not shared yet.
+func (m *Monitor) restoreArchived(instance *Instance) {
+	i := slices.IndexFunc(m.archive, func(a ArchivedInstance) bool { return a.URL == instance.URL })
+	if i < 0 {
+		return
+	}
+	instance.firstSeen = m.archive[i].firstSeen
+	instance.lifetime = m.archive[i].lifetime
+	m.archive = slices.Delete(m.archive, i, i+1)
+}
+
+// Archive returns the instances removed from the list, most recently
+// removed first.
+func (m *Monitor) Archive() []ArchivedInstance {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return append([]ArchivedInstance{}, m.archive...)
+}
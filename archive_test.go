@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestArchive(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "instances.json")
+	setList := func(list string) {
+		t.Helper()
+		if err := os.WriteFile(path, []byte(list), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	both := `{"ui": {"g": ["https://a.example", "https://b.example"]}}`
+
+	m := NewTestMonitor(nil, DefaultConfig())
+	m.source = &FileSource{Path: path}
+	// A cancelled context keeps new instances from being checked.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	refresh := func() {
+		t.Helper()
+		if _, err := m.updateInstances(ctx); err != nil {
+			t.Fatalf("updateInstances: %v", err)
+		}
+	}
+
+	setList(both)
+	refresh()
+	b := m.findInstance("https://b.example")
+	firstSeen := b.firstSeen
+	start := time.Now().Add(-time.Hour)
+	for i, success := range []bool{true, false, false, true} {
+		b.appendCheck(Check{Timestamp: start.Add(time.Duration(i) * time.Minute), Success: success})
+	}
+
+	setList(`{"ui": {"g": ["https://a.example"]}}`)
+	refresh()
+	archive := m.Archive()
+	if len(archive) != 1 {
+		t.Fatalf("archive = %+v, want b", archive)
+	}
+	if a := archive[0]; a.URL != b.URL || a.Group != "g" || a.Checks != 4 || a.Uptime != 50 ||
+		a.FirstSeenUnix != firstSeen.Unix() || a.LastSeenUnix != start.Add(3*time.Minute).Unix() {
+		t.Errorf("archived b = %+v", a)
+	}
+
+	// Added back, b carries on where it left off.
+	setList(both)
+	refresh()
+	restored := m.findInstance("https://b.example")
+	if restored == b || !restored.firstSeen.Equal(firstSeen) || restored.lifetime.checks != 4 || restored.lifetime.successes != 2 {
+		t.Errorf("restored b: first seen %v, lifetime %+v; want %v and 4 checks", restored.firstSeen, restored.lifetime, firstSeen)
+	}
+	if archive := m.Archive(); len(archive) != 0 {
+		t.Errorf("archive = %+v after b came back, want empty", archive)
+	}
+
+	m.config.ArchiveMaxInstances = 1
+	setList(`{"ui": {"g": []}}`)
+	refresh()
+	if archive := m.Archive(); len(archive) != 1 || archive[0].URL != "https://a.example" {
+		t.Errorf("archive = %+v, want only the first of the removed instances", archive)
+	}
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"fmt"
+	"hash/fnv"
+	"sync"
+)
+
+// maxCachedBadges bounds the badge cache, since requests for unknown
+// instances are cached too.
+const maxCachedBadges = 1024
+
+// badgeCache holds rendered badges until the monitor's data changes.
+type badgeCache struct {
+	mu      sync.RWMutex
+	version uint64
+	entries map[string]cachedBadge
+}
+
+type cachedBadge struct {
+	status int
+	body   []byte
+	etag   string
+
+	// matchedURL is the instance a badge URL was loosely matched to, and
+	// suggestions the instances offered for one that matched none.
+	matchedURL  string
+	suggestions []string
+
+	// label, message and color are what a status badge shows, kept so it
+	// can be drawn again as part of a sprite.
+	label   string
+	message string
+	color   string
+}
+
+func newCachedBadge(status int, svg string) cachedBadge {
+	h := fnv.New64a()
+	h.Write([]byte(svg))
+	return cachedBadge{
+		status: status,
+		body:   []byte(svg),
+		etag:   fmt.Sprintf(`"%x"`, h.Sum64()),
+	}
+}
+
+// newStatusBadge renders a status badge and keeps what it shows.
+func newStatusBadge(status int, label, message, color string) cachedBadge {
+	badge := newCachedBadge(status, generateBadge(label, message, color))
+	badge.label, badge.message, badge.color = label, message, color
+	return badge
+}
+
+func newBadgeCache() *badgeCache {
+	return &badgeCache{entries: make(map[string]cachedBadge)}
+}
+
+// get returns the badge cached for key if it was rendered from data of the
+// given version.
+func (c *badgeCache) get(key string, version uint64) (cachedBadge, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	if c.version != version {
+		return cachedBadge{}, false
+	}
+	badge, ok := c.entries[key]
+	return badge, ok
+}
+
+func (c *badgeCache) put(key string, version uint64, badge cachedBadge) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if version != c.version {
+		if version < c.version {
+			return
+		}
+		c.version = version
+		clear(c.entries)
+	}
+	if len(c.entries) < maxCachedBadges {
+		c.entries[key] = badge
+	}
+}
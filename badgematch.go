@@ -0,0 +1,109 @@
+package main
+
+import (
+	"net/url"
+	"slices"
+	"strings"
+)
+
+// maxBadgeSuggestions bounds the instances suggested for an unknown badge
+// URL.
+const maxBadgeSuggestions = 3
+
+// maxSuggestionDistance is the edit distance up to which an instance is
+// suggested for an unknown badge URL.
+const maxSuggestionDistance = 3
+
+// badgeMatchKey reduces a URL to what badge lookups compare when the exact
+// URL is unknown: the normalized URL without its scheme and a leading
+// "www.". A URL without a scheme is taken as https.
+func badgeMatchKey(rawURL string) (string, bool) {
+	if !strings.Contains(rawURL, "://") {
+		rawURL = "https://" + strings.TrimSpace(rawURL)
+	}
+	normalized, err := normalizeInstanceURL(rawURL)
+	if err != nil {
+		return "", false
+	}
+	u, err := url.Parse(normalized)
+	if err != nil {
+		return "", false
+	}
+	u.Host = strings.TrimPrefix(u.Host, "www.")
+	return strings.TrimPrefix(u.String(), u.Scheme+"://"), true
+}
+
+// matchInstance looks up a badge URL that is not monitored as given. It
+// returns the one instance it matches loosely, or if there is none or more
+// than one, the instances to suggest instead: the loose matches, or else
+// the closest URLs.
+func (m *Monitor) matchInstance(rawURL string) (*Instance, []string) {
+	key, ok := badgeMatchKey(rawURL)
+	if !ok {
+		return nil, nil
+	}
+
+	type candidate struct {
+		url      string
+		distance int
+	}
+	var matches []*Instance
+	var candidates []candidate
+
+	m.mu.RLock()
+	for _, instance := range m.instances {
+		instanceKey, ok := badgeMatchKey(instance.URL)
+		if !ok {
+			continue
+		}
+		if instanceKey == key {
+			matches = append(matches, instance)
+		} else if distance := editDistance(instanceKey, key); distance <= maxSuggestionDistance {
+			candidates = append(candidates, candidate{instance.URL, distance})
+		}
+	}
+	m.mu.RUnlock()
+
+	if len(matches) == 1 {
+		return matches[0], nil
+	}
+
+	var suggestions []string
+	if len(matches) > 1 {
+		for _, instance := range matches {
+			suggestions = append(suggestions, instance.URL)
+		}
+	} else {
+		slices.SortStableFunc(candidates, func(a, b candidate) int {
+			return a.distance - b.distance
+		})
+		for _, c := range candidates {
+			suggestions = append(suggestions, c.url)
+		}
+	}
+	if len(suggestions) > maxBadgeSuggestions {
+		suggestions = suggestions[:maxBadgeSuggestions]
+	}
+	return nil, suggestions
+}
+
+// editDistance is the Levenshtein distance between a and b, in bytes.
+func editDistance(a, b string) int {
+	previous := make([]int, len(b)+1)
+	current := make([]int, len(b)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		current[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			current[j] = min(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+		}
+		previous, current = current, previous
+	}
+	return previous[len(b)]
+}
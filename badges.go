@@ -0,0 +1,117 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// maxBulkBadges bounds the badges served by one /api/badges request.
+const maxBulkBadges = 20
+
+// badgeSpriteGap is the space between the badges of a sprite.
+const badgeSpriteGap = 4
+
+// BadgeDescriptor is what the badge of an instance shows, for clients that
+// draw badges themselves.
+type BadgeDescriptor struct {
+	URL         string   `json:"url"`
+	Found       bool     `json:"found"`
+	MatchedURL  string   `json:"matched_url,omitempty"`
+	Suggestions []string `json:"suggestions,omitempty"`
+	Label       string   `json:"label"`
+	Message     string   `json:"message"`
+	Color       string   `json:"color"`
+	Width       int      `json:"width"`
+}
+
+// handleBadges serves the badges of several instances in one response: a
+// single SVG with the badges stacked vertically, or their descriptors with
+// format=json. The instances are listed in urls, separated by commas, or
+// are those of a group.
+func (s *Server) handleBadges(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	format := query.Get("format")
+	if format == "" {
+		format = "svg"
+	}
+	if format != "svg" && format != FormatJSON {
+		writeJSONError(w, http.StatusBadRequest, "invalid_format", "format must be svg or json")
+		return
+	}
+
+	var urls []string
+	rawURLs, group := query.Get("urls"), query.Get("group")
+	switch {
+	case rawURLs != "" && group != "":
+		writeJSONError(w, http.StatusBadRequest, "invalid_badge_list", "Use either urls or group")
+		return
+	case group != "":
+		urls = s.monitor.GroupURLs(group)
+		if len(urls) == 0 {
+			writeJSONError(w, http.StatusNotFound, "group_not_found", "Group not found")
+			return
+		}
+	default:
+		for _, u := range strings.Split(rawURLs, ",") {
+			if u = strings.TrimSpace(u); u != "" {
+				urls = append(urls, u)
+			}
+		}
+		if len(urls) == 0 {
+			writeJSONError(w, http.StatusBadRequest, "invalid_badge_list", "urls or group is required")
+			return
+		}
+	}
+	if len(urls) > maxBulkBadges {
+		writeJSONError(w, http.StatusBadRequest, "too_many_badges",
+			fmt.Sprintf("At most %d badges can be requested at once", maxBulkBadges))
+		return
+	}
+
+	badges := make([]cachedBadge, len(urls))
+	for i, u := range urls {
+		badges[i] = s.badge(u, "")
+	}
+
+	if format == FormatJSON {
+		descriptors := make([]BadgeDescriptor, len(urls))
+		for i, badge := range badges {
+			descriptors[i] = BadgeDescriptor{
+				URL:         urls[i],
+				Found:       badge.status == http.StatusOK,
+				MatchedURL:  badge.matchedURL,
+				Suggestions: badge.suggestions,
+				Label:       badge.label,
+				Message:     badge.message,
+				Color:       badge.color,
+				Width:       badgeWidth(badge.label, badge.message),
+			}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		writeJSON(w, descriptors)
+		return
+	}
+
+	writeSVG(w, r, newCachedBadge(http.StatusOK, generateBadgeSprite(badges)), s.config.BadgeCacheSeconds)
+}
+
+// generateBadgeSprite draws badges below each other in one SVG, each as the
+// single badge renderer draws it.
+func generateBadgeSprite(badges []cachedBadge) string {
+	width := 0
+	for _, badge := range badges {
+		width = max(width, badgeWidth(badge.label, badge.message))
+	}
+	height := len(badges)*(20+badgeSpriteGap) - badgeSpriteGap
+
+	var b strings.Builder
+	fmt.Fprintf(&b, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d">`+"\n", width, height)
+	for i, badge := range badges {
+		fmt.Fprintf(&b, "<g transform=\"translate(0 %d)\">\n%s\n</g>\n",
+			i*(20+badgeSpriteGap), badgeLayers(badge.label, badge.message, badge.color, strconv.Itoa(i)))
+	}
+	b.WriteString("</svg>")
+	return b.String()
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"slices"
+	"time"
+)
+
+// removalRetention is how long ChangesSince remembers removed instances.
+const removalRetention = 24 * time.Hour
+
+// Changes lists the instances whose data changed since a point in time.
+type Changes struct {
+	Version   uint64         `json:"version"`
+	Timestamp int64          `json:"timestamp"`
+	Total     int            `json:"total"`
+	Instances []InstanceData `json:"instances"`
+
+	// Removed lists the URLs of the instances removed at or after since.
+	Removed []string `json:"removed"`
+}
+
+// ChangesSince returns the instances that were checked or updated at or
+// after since, and those removed since then. Timestamp is taken before the
+// instances are read, so passing it back as since never misses a change.
+func (m *Monitor) ChangesSince(since time.Time) Changes {
+	changes := Changes{
+		Version:   m.DataVersion(),
+		Timestamp: time.Now().Unix(),
+		Instances: []InstanceData{},
+		Removed:   []string{},
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	changes.Total = len(m.instances)
+	for _, instance := range m.instances {
+		instance.mu.RLock()
+		modified := !instance.modified.Before(since)
+		instance.mu.RUnlock()
+
+		if modified {
+			changes.Instances = append(changes.Instances, instance.data())
+		}
+	}
+
+	for instanceURL, removedAt := range m.removals {
+		if !removedAt.Before(since) {
+			changes.Removed = append(changes.Removed, instanceURL)
+		}
+	}
+	slices.Sort(changes.Removed)
+	return changes
+}
+
+// recordRemovals notes when instances were removed, for ChangesSince, and
+// forgets removals older than removalRetention. The caller holds m.mu.
+func (m *Monitor) recordRemovals(urls []string, now time.Time) {
+	if m.removals == nil {
+		m.removals = make(map[string]time.Time)
+	}
+	for instanceURL, removedAt := range m.removals {
+		if now.Sub(removedAt) > removalRetention {
+			delete(m.removals, instanceURL)
+		}
+	}
+	for _, instanceURL := range urls {
+		m.removals[instanceURL] = now
+	}
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestChanges(t *testing.T) {
+	s := newSortTestServer()
+	now := time.Now()
+	s.monitor.instances[0].modified = now.Add(-time.Hour)
+	s.monitor.instances[1].modified = now.Add(-time.Minute)
+	s.monitor.instances[2].modified = now
+	handler := s.SetupRoutes()
+
+	get := func(since int64) Changes {
+		t.Helper()
+		rec := serveRoute(t, handler, http.MethodGet, "/api/changes?since="+strconv.FormatInt(since, 10))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("since=%d: status %d", since, rec.Code)
+		}
+		if since > now.Unix() && !bytes.Contains(rec.Body.Bytes(), []byte(`"instances":[]`)) {
+			t.Errorf("since=%d: body %s, want an empty instances array", since, rec.Body)
+		}
+		var changes Changes
+		if err := json.NewDecoder(rec.Body).Decode(&changes); err != nil {
+			t.Fatalf("failed to decode: %v", err)
+		}
+		return changes
+	}
+
+	changes := get(now.Add(-5 * time.Minute).Unix())
+	if len(changes.Instances) != 2 || changes.Instances[0].URL != "https://a.example" || changes.Instances[1].URL != "https://b.example" {
+		t.Errorf("changes = %+v, want a.example and b.example", changes.Instances)
+	}
+	if changes.Total != 4 || changes.Version != s.monitor.DataVersion() || changes.Timestamp < now.Unix() {
+		t.Errorf("changes = %+v, want total 4, the data version and the current time", changes)
+	}
+
+	// since is inclusive, so the returned timestamp can be passed back
+	// without missing changes made in the same second.
+	if changes := get(now.Unix()); len(changes.Instances) != 1 {
+		t.Errorf("since=now: %d instances, want 1", len(changes.Instances))
+	}
+	if changes := get(now.Unix() + 1); len(changes.Instances) != 0 {
+		t.Errorf("since=now+1: %d instances, want 0", len(changes.Instances))
+	}
+
+	for _, since := range []string{"", "yesterday", "1.5", "-1"} {
+		rec := serveRoute(t, handler, http.MethodGet, "/api/changes?since="+since)
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("since=%q: status %d, want 400", since, rec.Code)
+		}
+	}
+}
+
+func TestChangesRemovals(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "instances.json")
+	writeList := func(urls string) {
+		if err := os.WriteFile(path, []byte(`{"ui": {"Main": {"urls": [`+urls+`]}}}`), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	writeList(`"https://a.example", "https://b.example", "https://c.example"`)
+
+	m := NewTestMonitor(nil, nil)
+	m.source = &FileSource{Path: path}
+	if _, err := m.updateInstances(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	since := time.Now()
+	removed := func(since time.Time) []string {
+		t.Helper()
+		return m.ChangesSince(since).Removed
+	}
+	if got := removed(since); len(got) != 0 {
+		t.Errorf("removed before any removal = %v, want none", got)
+	}
+
+	// Removals through the API and through the instance list both count.
+	m.RemoveInstance("https://a.example")
+	writeList(`"https://a.example", "https://c.example"`)
+	if _, err := m.updateInstances(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if got := removed(since); !slices.Equal(got, []string{"https://b.example"}) {
+		t.Errorf("removed = %v, want b.example, a.example being back", got)
+	}
+	if got := removed(time.Now().Add(time.Second)); len(got) != 0 {
+		t.Errorf("removed after the removals = %v, want none", got)
+	}
+
+	// Old removals are forgotten.
+	m.mu.Lock()
+	m.recordRemovals([]string{"https://c.example"}, time.Now().Add(removalRetention+time.Minute))
+	m.mu.Unlock()
+	if got := removed(time.Time{}); !slices.Equal(got, []string{"https://c.example"}) {
+		t.Errorf("removed after the retention = %v, want only c.example", got)
+	}
+}
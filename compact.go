@@ -0,0 +1,89 @@
+package main
+
+import (
+	"log"
+	"time"
+)
+
+// weight returns the number of raw checks a Check represents.
+func (c Check) weight() int {
+	if c.Compacted && c.Count > 0 {
+		return c.Count
+	}
+	return 1
+}
+
+// successes returns the number of successful raw checks a Check represents.
+func (c Check) successes() int {
+	if c.Compacted {
+		return c.SuccessCount
+	}
+	if c.Success {
+		return 1
+	}
+	return 0
+}
+
+func (m *Monitor) compactAll() {
+	cutoff := time.Now().Add(-m.config.CompactAfter)
+
+	m.mu.RLock()
+	instances := m.instances
+	m.mu.RUnlock()
+
+	compacted := 0
+	for _, instance := range instances {
+		instance.mu.Lock()
+		before := len(instance.Checks)
+		instance.Checks = compactChecks(instance.Checks, cutoff)
+		instance.uptime.reset(instance.Checks)
+		compacted += before - len(instance.Checks)
+		instance.mu.Unlock()
+	}
+
+	if compacted > 0 {
+		log.Printf("Compacted check history, freed %d check records", compacted)
+	}
+}
+
+// compactChecks replaces raw checks older than cutoff with one aggregate
+// check per hour. Checks that are already compacted are kept as they are.
+func compactChecks(checks []Check, cutoff time.Time) []Check {
+	result := make([]Check, 0, len(checks))
+
+	var bucket *Check
+	var totalResponseTime int64
+	flush := func() {
+		if bucket == nil {
+			return
+		}
+		bucket.ResponseTime = totalResponseTime / int64(bucket.Count)
+		bucket.Success = bucket.SuccessCount == bucket.Count
+		result = append(result, *bucket)
+		bucket = nil
+		totalResponseTime = 0
+	}
+
+	for _, check := range checks {
+		if check.Compacted || !check.Timestamp.Before(cutoff) {
+			flush()
+			result = append(result, check)
+			continue
+		}
+
+		hour := check.Timestamp.Truncate(time.Hour)
+		if bucket != nil && !bucket.Timestamp.Equal(hour) {
+			flush()
+		}
+		if bucket == nil {
+			bucket = &Check{Timestamp: hour, InstanceType: check.InstanceType, Compacted: true}
+		}
+
+		bucket.Count++
+		bucket.SuccessCount += check.successes()
+		totalResponseTime += check.ResponseTime
+	}
+	flush()
+
+	return result
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestCompactChecks(t *testing.T) {
+	base := time.Date(2026, 3, 1, 10, 0, 0, 0, time.UTC)
+	at := func(d time.Duration) time.Time { return base.Add(d) }
+	checks := []Check{
+		{Timestamp: at(0), Success: true, ResponseTime: 100},
+		{Timestamp: at(59*time.Minute + 59*time.Second), Success: false, ResponseTime: 300},
+		{Timestamp: at(time.Hour), Success: true, ResponseTime: 50},
+		{Timestamp: at(90 * time.Minute), Success: true, ResponseTime: 70},
+	}
+
+	// The cutoff is exclusive: the check at the cutoff stays raw.
+	got := compactChecks(checks, at(90*time.Minute))
+	want := []Check{
+		{Timestamp: at(0), Compacted: true, Count: 2, SuccessCount: 1, Success: false, ResponseTime: 200},
+		{Timestamp: at(time.Hour), Compacted: true, Count: 1, SuccessCount: 1, Success: true, ResponseTime: 50},
+		checks[3],
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("compactChecks = %+v, want %+v", got, want)
+	}
+
+	// Compacting again, later, keeps the aggregates and the totals.
+	again := compactChecks(append(got, Check{Timestamp: at(3 * time.Hour), Success: false}), at(4*time.Hour))
+	total, successes := 0, 0
+	for _, check := range again {
+		total += check.weight()
+		successes += check.successes()
+	}
+	if len(again) != 4 || total != 5 || successes != 3 {
+		t.Errorf("recompacted to %d checks weighing %d with %d successes, want 4, 5 and 3", len(again), total, successes)
+	}
+	if !reflect.DeepEqual(again[:2], want[:2]) {
+		t.Errorf("recompacting changed the existing aggregates: %+v", again[:2])
+	}
+}
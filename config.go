@@ -1,41 +1,496 @@
 package main
 
 import (
+	"encoding/json"
+	"fmt"
 	"log"
+	"net"
+	"net/url"
 	"os"
+	"reflect"
+	"slices"
+	"sort"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
+
+	"gopkg.in/yaml.v3"
 )
 
 type Config struct {
-	Port                    string
-	CheckInterval           time.Duration
-	InstancesURL            string
-	RequestTimeout          time.Duration
-	MaxCheckHistory         int
-	SSEKeepaliveSeconds     int
-	LogLevel                string
-	InstanceRefreshInterval time.Duration
+	Port                    string            `yaml:"port"`
+	CheckInterval           time.Duration     `yaml:"check_interval"`
+	InstancesURL            string            `yaml:"instances_url"`
+	RequestTimeout          time.Duration     `yaml:"request_timeout"`
+	InstancesRequestTimeout time.Duration     `yaml:"instances_request_timeout"`
+	InstancesRequestHeaders map[string]string `yaml:"instances_request_headers"`
+	InstancesAuthUser       string            `yaml:"instances_auth_user"`
+	InstancesAuthPass       string            `yaml:"instances_auth_pass"`
+	MaxCheckHistory         int               `yaml:"max_check_history"`
+	SSEKeepaliveSeconds     int               `yaml:"sse_keepalive_seconds"`
+	LogLevel                string            `yaml:"log_level"`
+	InstanceRefreshInterval time.Duration     `yaml:"instance_refresh_interval"`
+	KumaPushURLs            map[string]string `yaml:"kuma_push_urls"`
+	NotifyWebhookURLs       []string          `yaml:"notify_webhook_urls"`
+	CompactAfter            time.Duration     `yaml:"compact_after"`
+	UIBodyReadLimit         int64             `yaml:"ui_body_read_limit"`
+	APIKey                  string            `yaml:"api_key"`
+	DNSServers              []string          `yaml:"check_dns_servers"`
+	IPFamily                string            `yaml:"check_ip_family"`
+	DualStackSuccess        string            `yaml:"check_dual_success"`
+	HostConcurrency         int               `yaml:"check_host_concurrency"`
+	HostRequestsPerSecond   float64           `yaml:"check_host_rps"`
+	UptimeTimezone          string            `yaml:"uptime_timezone"`
+	DegradedUptimePercent   float64           `yaml:"degraded_uptime_percent"`
+	RateLimitRPS            float64           `yaml:"rate_limit_rps"`
+	RateLimitBurst          int               `yaml:"rate_limit_burst"`
+	RateLimitAllowlist      []string          `yaml:"rate_limit_allowlist"`
+	SSEMaxConnectionsPerIP  int               `yaml:"sse_max_connections_per_ip"`
+	TrustedProxies          []string          `yaml:"trusted_proxies"`
+	ClientIPHeader          string            `yaml:"client_ip_header"`
+	BadgeCacheSeconds       int               `yaml:"badge_cache_seconds"`
+	FrameAncestors          []string          `yaml:"frame_ancestors"`
+	ContentSecurityPolicy   string            `yaml:"content_security_policy"`
+	ReferrerPolicy          string            `yaml:"referrer_policy"`
+	AllowedOrigins          []string          `yaml:"allowed_origins"`
+	StatusPageURL           string            `yaml:"status_page_url"`
+	DryRun                  bool              `yaml:"dry_run"`
+	HTTPReadHeaderTimeout   time.Duration     `yaml:"http_read_header_timeout"`
+	HTTPReadTimeout         time.Duration     `yaml:"http_read_timeout"`
+	HTTPWriteTimeout        time.Duration     `yaml:"http_write_timeout"`
+	HTTPIdleTimeout         time.Duration     `yaml:"http_idle_timeout"`
+	HTTPMaxHeaderBytes      int               `yaml:"http_max_header_bytes"`
+	HTTPMaxBodyBytes        int64             `yaml:"http_max_body_bytes"`
+
+	InstancesAPIRateLimitRPS   float64 `yaml:"instances_api_rate_limit_rps"`
+	InstancesAPIRateLimitBurst int     `yaml:"instances_api_rate_limit_burst"`
+
+	CheckRetries      int           `yaml:"check_retries"`
+	CheckRetryBackoff time.Duration `yaml:"check_retry_backoff"`
+
+	LogTimestampFormat string `yaml:"log_timestamp_format"`
+	LogHTTPBodies      bool   `yaml:"log_http_bodies"`
+
+	GitHubWebhookSecret string `yaml:"github_webhook_secret"`
+	GitHubWebhookPath   string `yaml:"github_webhook_path"`
+
+	CheckErrorMaxLength int `yaml:"check_error_max_length"`
+
+	SelfCheck       bool          `yaml:"self_check"`
+	SelfCheckBudget time.Duration `yaml:"self_check_budget"`
+
+	GroupOrder []string `yaml:"group_order"`
+
+	ExcludeURLs       []string `yaml:"exclude_urls"`
+	ExcludeGroups     []string `yaml:"exclude_groups"`
+	IncludeOnlyGroups []string `yaml:"include_only_groups"`
+
+	LatencyAlert       LatencyRule            `yaml:"latency_alert"`
+	LatencyAlertGroups map[string]LatencyRule `yaml:"latency_alert_groups"`
+
+	ContentChangeChecks int  `yaml:"content_change_checks"`
+	ContentChangeNotify bool `yaml:"content_change_notify"`
+
+	MaxStartupWait time.Duration `yaml:"max_startup_wait"`
+
+	ArchiveMaxInstances int `yaml:"archive_max_instances"`
+
+	// uptimeLocation is UptimeTimezone resolved by normalize.
+	uptimeLocation *time.Location
+
+	// mu guards the fields that can be changed at runtime through
+	// PATCH /api/config.
+	mu sync.RWMutex
+}
+
+// ConfigUpdate holds the subset of config values that can be changed at
+// runtime. Nil fields are left unchanged.
+type ConfigUpdate struct {
+	CheckIntervalMinutes           *int    `json:"check_interval_minutes"`
+	InstanceRefreshIntervalMinutes *int    `json:"instance_refresh_interval_minutes"`
+	InstanceRefreshIntervalSeconds *int    `json:"instance_refresh_interval_seconds"`
+	MaxCheckHistory                *int    `json:"max_check_history"`
+	SSEKeepaliveSeconds            *int    `json:"sse_keepalive_seconds"`
+	LogLevel                       *string `json:"log_level"`
+
+	ExcludeURLs       *[]string `json:"exclude_urls"`
+	ExcludeGroups     *[]string `json:"exclude_groups"`
+	IncludeOnlyGroups *[]string `json:"include_only_groups"`
+}
+
+func DefaultConfig() *Config {
+	return &Config{
+		Port:                    "8080",
+		CheckInterval:           60 * time.Minute,
+		InstancesURL:            "https://raw.githubusercontent.com/EduardPrigoana/hifi-instances/refs/heads/main/instances.json",
+		RequestTimeout:          30 * time.Second,
+		InstancesRequestTimeout: 10 * time.Second,
+		MaxCheckHistory:         168,
+		SSEKeepaliveSeconds:     30,
+		LogLevel:                "info",
+		InstanceRefreshInterval: 10 * time.Minute,
+		KumaPushURLs:            map[string]string{},
+		CompactAfter:            0,
+		UIBodyReadLimit:         2 << 20,
+		IPFamily:                IPFamilyAuto,
+		DualStackSuccess:        "either",
+		HostConcurrency:         0,
+		HostRequestsPerSecond:   0,
+		UptimeTimezone:          "UTC",
+		DegradedUptimePercent:   99,
+		RateLimitRPS:            0,
+		RateLimitBurst:          20,
+		RateLimitAllowlist:      []string{"127.0.0.0/8", "::1"},
+		SSEMaxConnectionsPerIP:  0,
+		ClientIPHeader:          "X-Forwarded-For",
+		BadgeCacheSeconds:       60,
+		FrameAncestors:          []string{"'self'"},
+		ContentSecurityPolicy:   defaultContentSecurityPolicy,
+		ReferrerPolicy:          "strict-origin-when-cross-origin",
+		AllowedOrigins:          []string{"*"},
+		HTTPReadHeaderTimeout:   5 * time.Second,
+		HTTPReadTimeout:         15 * time.Second,
+		HTTPWriteTimeout:        15 * time.Second,
+		HTTPIdleTimeout:         60 * time.Second,
+		HTTPMaxHeaderBytes:      64 << 10,
+		HTTPMaxBodyBytes:        1 << 20,
+
+		InstancesAPIRateLimitRPS:   0,
+		InstancesAPIRateLimitBurst: 5,
+
+		CheckRetries:      0,
+		CheckRetryBackoff: time.Second,
+
+		LogTimestampFormat: LogTimestampDefault,
+
+		GitHubWebhookPath: "instances.json",
+
+		CheckErrorMaxLength: 256,
+
+		LatencyAlert: LatencyRule{Window: 10, Statistic: LatencyP95, Hysteresis: 0.2},
+
+		ContentChangeChecks: 3,
+
+		ArchiveMaxInstances: 100,
+	}
 }
 
 func LoadConfig() *Config {
-	config := &Config{
-		Port:                    getEnv("PORT", "8080"),
-		CheckInterval:           getCheckInterval(),
-		InstancesURL:            getEnv("INSTANCES_URL", "https://raw.githubusercontent.com/EduardPrigoana/hifi-instances/refs/heads/main/instances.json"),
-		RequestTimeout:          getTimeout(),
-		MaxCheckHistory:         getMaxHistory(),
-		SSEKeepaliveSeconds:     getSSEKeepalive(),
-		LogLevel:                getEnv("LOG_LEVEL", "info"),
-		InstanceRefreshInterval: getInstanceRefreshInterval(),
+	config := DefaultConfig()
+	config.applyEnv()
+	config.normalize()
+	return config
+}
+
+// LoadConfigFromFile reads a YAML config file on top of the defaults.
+// Environment variables still take precedence over values from the file.
+func LoadConfigFromFile(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file: %w", err)
 	}
 
-	if !strings.HasPrefix(config.Port, ":") {
-		config.Port = ":" + config.Port
+	var root yaml.Node
+	if err := yaml.Unmarshal(data, &root); err != nil {
+		return nil, fmt.Errorf("failed to parse config file: %w", err)
+	}
+	if len(root.Content) > 0 {
+		if err := checkDurationValues(root.Content[0]); err != nil {
+			return nil, err
+		}
 	}
 
-	return config
+	config := DefaultConfig()
+	if err := yaml.Unmarshal(data, config); err != nil {
+		return nil, fmt.Errorf("failed to parse config file: %w", err)
+	}
+
+	config.applyEnv()
+	config.normalize()
+	return config, nil
+}
+
+// durationKeys holds the YAML keys of the Config fields that are durations.
+var durationKeys = func() map[string]bool {
+	keys := make(map[string]bool)
+	t := reflect.TypeOf(Config{})
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if key := field.Tag.Get("yaml"); key != "" && field.Type == reflect.TypeOf(time.Duration(0)) {
+			keys[key] = true
+		}
+	}
+	return keys
+}()
+
+// checkDurationValues rejects bare numbers for the durations in a mapping
+// of config values, which YAML would read as nanoseconds.
+func checkDurationValues(node *yaml.Node) error {
+	if node.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		key, value := node.Content[i], node.Content[i+1]
+		if durationKeys[key.Value] && (value.Tag == "!!int" || value.Tag == "!!float") {
+			return fmt.Errorf("invalid %s value %s at line %d: expected a duration with a unit, such as %ss",
+				key.Value, value.Value, value.Line, value.Value)
+		}
+	}
+	return nil
+}
+
+// Page is one independent status page, served under Path.
+type Page struct {
+	Path   string
+	Config *Config
+}
+
+// LoadPagesFromFile reads the pages listed under "pages" in a YAML config
+// file, or returns nil if there are none. Each page starts from the file's
+// top-level settings and environment variables, and the settings in its own
+// entry take precedence over both.
+func LoadPagesFromFile(path string) ([]Page, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	var file struct {
+		Pages []yaml.Node `yaml:"pages"`
+	}
+	if err := yaml.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("failed to parse config file: %w", err)
+	}
+
+	pages := make([]Page, 0, len(file.Pages))
+	seen := make(map[string]bool)
+	for i, node := range file.Pages {
+		var entry struct {
+			Path string `yaml:"path"`
+		}
+		if err := node.Decode(&entry); err != nil {
+			return nil, fmt.Errorf("failed to parse page %d: %w", i+1, err)
+		}
+		pagePath, err := normalizePagePath(entry.Path)
+		if err != nil {
+			return nil, fmt.Errorf("invalid path for page %d: %w", i+1, err)
+		}
+		if seen[pagePath] {
+			return nil, fmt.Errorf("duplicate page path %s", pagePath)
+		}
+		seen[pagePath] = true
+		if err := checkDurationValues(&node); err != nil {
+			return nil, fmt.Errorf("invalid page %s: %w", pagePath, err)
+		}
+
+		config := DefaultConfig()
+		if err := yaml.Unmarshal(data, config); err != nil {
+			return nil, fmt.Errorf("failed to parse config file: %w", err)
+		}
+		config.applyEnv()
+		if err := node.Decode(config); err != nil {
+			return nil, fmt.Errorf("failed to parse page %s: %w", pagePath, err)
+		}
+		config.normalize()
+
+		pages = append(pages, Page{Path: pagePath, Config: config})
+	}
+
+	return pages, nil
+}
+
+// normalizePagePath turns "hifi" or "/hifi" into "/hifi/". The root and the
+// paths of the aggregated /health and /ready endpoints are reserved.
+func normalizePagePath(pagePath string) (string, error) {
+	pagePath = "/" + strings.Trim(pagePath, "/") + "/"
+	switch {
+	case pagePath == "//":
+		return "", fmt.Errorf("path is required and cannot be /")
+	case pagePath == "/health/" || pagePath == "/ready/":
+		return "", fmt.Errorf("%s is reserved", pagePath)
+	case strings.ContainsAny(pagePath, "?#% "):
+		return "", fmt.Errorf("%q contains reserved characters", pagePath)
+	}
+	return pagePath, nil
+}
+
+func (c *Config) applyEnv() {
+	c.Port = getEnv("PORT", c.Port)
+	c.CheckInterval = getCheckInterval(c.CheckInterval)
+	c.InstancesURL = getEnv("INSTANCES_URL", c.InstancesURL)
+	c.RequestTimeout = getTimeout(c.RequestTimeout)
+	c.InstancesRequestTimeout = getInstancesRequestTimeout(c.InstancesRequestTimeout)
+	c.InstancesRequestHeaders = getInstancesRequestHeaders(c.InstancesRequestHeaders)
+	c.InstancesAuthUser = getEnv("INSTANCES_AUTH_USER", c.InstancesAuthUser)
+	c.InstancesAuthPass = getEnv("INSTANCES_AUTH_PASS", c.InstancesAuthPass)
+	c.MaxCheckHistory = getMaxHistory(c.MaxCheckHistory)
+	c.SSEKeepaliveSeconds = getSSEKeepalive(c.SSEKeepaliveSeconds)
+	c.LogLevel = getEnv("LOG_LEVEL", c.LogLevel)
+	c.InstanceRefreshInterval = getInstanceRefreshInterval(c.InstanceRefreshInterval)
+	c.KumaPushURLs = getKumaPushURLs(c.KumaPushURLs)
+	c.NotifyWebhookURLs = getNotifyWebhookURLs(c.NotifyWebhookURLs)
+	c.CompactAfter = getCompactAfter(c.CompactAfter)
+	c.UIBodyReadLimit = getUIBodyReadLimit(c.UIBodyReadLimit)
+	c.APIKey = getEnv("API_KEY", c.APIKey)
+	c.DNSServers = getDNSServers(c.DNSServers)
+	c.IPFamily = getIPFamily(c.IPFamily)
+	c.DualStackSuccess = getDualStackSuccess(c.DualStackSuccess)
+	c.HostConcurrency = getHostConcurrency(c.HostConcurrency)
+	c.HostRequestsPerSecond = getHostRequestsPerSecond(c.HostRequestsPerSecond)
+	c.UptimeTimezone = getEnv("UPTIME_TIMEZONE", c.UptimeTimezone)
+	c.DegradedUptimePercent = getDegradedUptimePercent(c.DegradedUptimePercent)
+	c.RateLimitRPS = getRateLimitRPS("RATE_LIMIT_RPS", c.RateLimitRPS)
+	c.RateLimitBurst = getRateLimitBurst("RATE_LIMIT_BURST", c.RateLimitBurst)
+	c.InstancesAPIRateLimitRPS = getRateLimitRPS("INSTANCES_API_RATE_LIMIT_RPS", c.InstancesAPIRateLimitRPS)
+	c.InstancesAPIRateLimitBurst = getRateLimitBurst("INSTANCES_API_RATE_LIMIT_BURST", c.InstancesAPIRateLimitBurst)
+	c.RateLimitAllowlist = getIPPrefixes("RATE_LIMIT_ALLOWLIST", c.RateLimitAllowlist)
+	c.SSEMaxConnectionsPerIP = getSSEMaxConnectionsPerIP(c.SSEMaxConnectionsPerIP)
+	c.TrustedProxies = getIPPrefixes("TRUSTED_PROXIES", getIPPrefixes("TRUSTED_PROXY_CIDRS", c.TrustedProxies))
+	c.ClientIPHeader = getEnv("CLIENT_IP_HEADER", c.ClientIPHeader)
+	c.BadgeCacheSeconds = getBadgeCacheSeconds(c.BadgeCacheSeconds)
+	c.FrameAncestors = getFrameAncestors(c.FrameAncestors)
+	c.ContentSecurityPolicy = getOptionalEnv("CONTENT_SECURITY_POLICY", c.ContentSecurityPolicy)
+	c.ReferrerPolicy = getOptionalEnv("REFERRER_POLICY", c.ReferrerPolicy)
+	c.AllowedOrigins = getAllowedOrigins(c.AllowedOrigins)
+	c.StatusPageURL = strings.TrimSuffix(getEnv("STATUS_PAGE_URL", c.StatusPageURL), "/")
+	c.DryRun = getBool("DRY_RUN", c.DryRun)
+	c.HTTPReadHeaderTimeout = getSeconds("HTTP_READ_HEADER_TIMEOUT_SECONDS", c.HTTPReadHeaderTimeout)
+	c.HTTPReadTimeout = getSeconds("HTTP_READ_TIMEOUT_SECONDS", c.HTTPReadTimeout)
+	c.HTTPWriteTimeout = getSeconds("HTTP_WRITE_TIMEOUT_SECONDS", c.HTTPWriteTimeout)
+	c.HTTPIdleTimeout = getSeconds("HTTP_IDLE_TIMEOUT_SECONDS", c.HTTPIdleTimeout)
+	c.HTTPMaxHeaderBytes = int(getBytes("HTTP_MAX_HEADER_BYTES", int64(c.HTTPMaxHeaderBytes)))
+	c.HTTPMaxBodyBytes = getBytes("HTTP_MAX_BODY_BYTES", c.HTTPMaxBodyBytes)
+	c.CheckRetries = getCheckRetries(c.CheckRetries)
+	c.CheckRetryBackoff = getMilliseconds("CHECK_RETRY_BACKOFF_MS", c.CheckRetryBackoff)
+	c.LogTimestampFormat = getLogTimestampFormat(c.LogTimestampFormat)
+	c.LogHTTPBodies = getBool("LOG_HTTP_BODIES", c.LogHTTPBodies)
+	c.GitHubWebhookSecret = getEnv("GITHUB_WEBHOOK_SECRET", c.GitHubWebhookSecret)
+	c.GitHubWebhookPath = getEnv("GITHUB_WEBHOOK_PATH", c.GitHubWebhookPath)
+	c.CheckErrorMaxLength = getCheckErrorMaxLength(c.CheckErrorMaxLength)
+	c.SelfCheck = getBool("SELF_CHECK", c.SelfCheck)
+	c.SelfCheckBudget = getSeconds("SELF_CHECK_BUDGET_SECONDS", c.SelfCheckBudget)
+	c.GroupOrder = getList("GROUP_ORDER", c.GroupOrder)
+	c.ExcludeURLs = getPatterns("EXCLUDE_URLS", c.ExcludeURLs)
+	c.ExcludeGroups = getPatterns("EXCLUDE_GROUPS", c.ExcludeGroups)
+	c.IncludeOnlyGroups = getPatterns("INCLUDE_ONLY_GROUPS", c.IncludeOnlyGroups)
+	c.LatencyAlert = getLatencyRule(c.LatencyAlert)
+	c.LatencyAlertGroups = getLatencyAlertGroups(c.LatencyAlertGroups)
+	c.ContentChangeChecks = getContentChangeChecks(c.ContentChangeChecks)
+	c.ContentChangeNotify = getBool("CONTENT_CHANGE_NOTIFY", c.ContentChangeNotify)
+	c.MaxStartupWait = getSeconds("MAX_STARTUP_WAIT_SECONDS", c.MaxStartupWait)
+	c.ArchiveMaxInstances = getArchiveMaxInstances(c.ArchiveMaxInstances)
+}
+
+// normalize fills in derived values and checks the ranges and choices that
+// the environment parsers enforce, so that values from a config file get
+// the same checks. Invalid values fall back to the defaults.
+func (c *Config) normalize() {
+	if !strings.HasPrefix(c.Port, ":") {
+		c.Port = ":" + c.Port
+	}
+
+	defaults := DefaultConfig()
+	atLeast("check_interval", &c.CheckInterval, minCheckInterval, defaults.CheckInterval)
+	atLeast("request_timeout", &c.RequestTimeout, minRequestTimeout, defaults.RequestTimeout)
+	atLeast("instances_request_timeout", &c.InstancesRequestTimeout, time.Second, defaults.InstancesRequestTimeout)
+	atLeast("instance_refresh_interval", &c.InstanceRefreshInterval, time.Second, defaults.InstanceRefreshInterval)
+	atLeast("max_check_history", &c.MaxCheckHistory, 1, defaults.MaxCheckHistory)
+	atLeast("sse_keepalive_seconds", &c.SSEKeepaliveSeconds, 1, defaults.SSEKeepaliveSeconds)
+	atLeast("ui_body_read_limit", &c.UIBodyReadLimit, 1, defaults.UIBodyReadLimit)
+	atLeast("check_host_concurrency", &c.HostConcurrency, 0, defaults.HostConcurrency)
+	atLeast("check_host_rps", &c.HostRequestsPerSecond, 0, defaults.HostRequestsPerSecond)
+	atLeast("rate_limit_rps", &c.RateLimitRPS, 0, defaults.RateLimitRPS)
+	atLeast("rate_limit_burst", &c.RateLimitBurst, 1, defaults.RateLimitBurst)
+	atLeast("instances_api_rate_limit_rps", &c.InstancesAPIRateLimitRPS, 0, defaults.InstancesAPIRateLimitRPS)
+	atLeast("instances_api_rate_limit_burst", &c.InstancesAPIRateLimitBurst, 1, defaults.InstancesAPIRateLimitBurst)
+	atLeast("sse_max_connections_per_ip", &c.SSEMaxConnectionsPerIP, 0, defaults.SSEMaxConnectionsPerIP)
+	atLeast("badge_cache_seconds", &c.BadgeCacheSeconds, 0, defaults.BadgeCacheSeconds)
+	atLeast("http_read_header_timeout", &c.HTTPReadHeaderTimeout, 0, defaults.HTTPReadHeaderTimeout)
+	atLeast("http_read_timeout", &c.HTTPReadTimeout, 0, defaults.HTTPReadTimeout)
+	atLeast("http_write_timeout", &c.HTTPWriteTimeout, 0, defaults.HTTPWriteTimeout)
+	atLeast("http_idle_timeout", &c.HTTPIdleTimeout, 0, defaults.HTTPIdleTimeout)
+	atLeast("http_max_header_bytes", &c.HTTPMaxHeaderBytes, 1, defaults.HTTPMaxHeaderBytes)
+	atLeast("http_max_body_bytes", &c.HTTPMaxBodyBytes, 1, defaults.HTTPMaxBodyBytes)
+	atLeast("check_retries", &c.CheckRetries, 0, defaults.CheckRetries)
+	atLeast("check_retry_backoff", &c.CheckRetryBackoff, 0, defaults.CheckRetryBackoff)
+	atLeast("check_error_max_length", &c.CheckErrorMaxLength, 16, defaults.CheckErrorMaxLength)
+	atLeast("self_check_budget", &c.SelfCheckBudget, 0, defaults.SelfCheckBudget)
+	atLeast("content_change_checks", &c.ContentChangeChecks, 0, defaults.ContentChangeChecks)
+	atLeast("max_startup_wait", &c.MaxStartupWait, 0, defaults.MaxStartupWait)
+	atLeast("archive_max_instances", &c.ArchiveMaxInstances, 0, defaults.ArchiveMaxInstances)
+	if c.DegradedUptimePercent < 0 || c.DegradedUptimePercent > 100 {
+		log.Printf("Invalid degraded_uptime_percent value %v, using %v", c.DegradedUptimePercent, defaults.DegradedUptimePercent)
+		c.DegradedUptimePercent = defaults.DegradedUptimePercent
+	}
+	if c.CompactAfter != 0 && c.CompactAfter < time.Hour {
+		log.Printf("Invalid compact_after value %v, compaction disabled", c.CompactAfter)
+		c.CompactAfter = 0
+	}
+	for i, server := range c.DNSServers {
+		if _, _, err := net.SplitHostPort(server); err != nil {
+			c.DNSServers[i] = net.JoinHostPort(server, "53")
+		}
+	}
+	oneOf("check_ip_family", &c.IPFamily, []string{IPFamilyAuto, IPFamilyV4, IPFamilyV6, IPFamilyDual}, defaults.IPFamily)
+	oneOf("check_dual_success", &c.DualStackSuccess, []string{"either", "both"}, defaults.DualStackSuccess)
+	oneOf("log_level", &c.LogLevel, []string{"info", "debug"}, defaults.LogLevel)
+	oneOf("log_timestamp_format", &c.LogTimestampFormat,
+		[]string{LogTimestampDefault, LogTimestampUnix, LogTimestampRFC3339, LogTimestampNone}, defaults.LogTimestampFormat)
+	if c.KumaPushURLs == nil {
+		c.KumaPushURLs = map[string]string{}
+	}
+	c.GitHubWebhookPath = strings.TrimPrefix(c.GitHubWebhookPath, "/")
+
+	// Credentials in the instances URL are kept apart so that the URL can be
+	// logged. INSTANCES_AUTH_USER and INSTANCES_AUTH_PASS take precedence.
+	instancesURL, auth := stripURLCredentials(c.InstancesURL)
+	c.InstancesURL = instancesURL
+	if auth != nil && c.InstancesAuthUser == "" {
+		c.InstancesAuthUser = auth.Username()
+		c.InstancesAuthPass, _ = auth.Password()
+	}
+
+	location, err := time.LoadLocation(c.UptimeTimezone)
+	if err != nil {
+		log.Printf("Invalid UPTIME_TIMEZONE value '%s', using UTC", c.UptimeTimezone)
+		c.UptimeTimezone = "UTC"
+		location = time.UTC
+	}
+	c.uptimeLocation = location
+}
+
+// InstancesAuth returns the Basic Auth credentials for the instances URL, or
+// nil if there are none.
+func (c *Config) InstancesAuth() *url.Userinfo {
+	if c.InstancesAuthUser == "" {
+		return nil
+	}
+	return url.UserPassword(c.InstancesAuthUser, c.InstancesAuthPass)
+}
+
+// UptimeLocation returns the time zone that daily uptime is bucketed in.
+func (c *Config) UptimeLocation() *time.Location {
+	if c.uptimeLocation == nil {
+		return time.UTC
+	}
+	return c.uptimeLocation
+}
+
+// atLeast resets *value to defaultValue if it is below min.
+func atLeast[T int | int64 | float64 | time.Duration](key string, value *T, min, defaultValue T) {
+	if *value < min {
+		log.Printf("Invalid %s value %v, must be at least %v; using %v", key, *value, min, defaultValue)
+		*value = defaultValue
+	}
+}
+
+// oneOf resets *value to defaultValue if it is not one of choices.
+func oneOf(key string, value *string, choices []string, defaultValue string) {
+	if !slices.Contains(choices, *value) {
+		log.Printf("Invalid %s value '%s', expected one of %s; using %s", key, *value, strings.Join(choices, ", "), defaultValue)
+		*value = defaultValue
+	}
 }
 
 func getEnv(key, defaultValue string) string {
@@ -45,99 +500,998 @@ func getEnv(key, defaultValue string) string {
 	return defaultValue
 }
 
-func getCheckInterval() time.Duration {
+// getOptionalEnv is getEnv for values that can be disabled by setting the
+// variable to an empty string.
+func getOptionalEnv(key, defaultValue string) string {
+	if value, ok := os.LookupEnv(key); ok {
+		return strings.TrimSpace(value)
+	}
+	return defaultValue
+}
+
+// minCheckInterval is the shortest check interval CHECK_INTERVAL_SECONDS
+// and the config file accept.
+const minCheckInterval = 10 * time.Second
+
+func getCheckInterval(defaultValue time.Duration) time.Duration {
+	if secondsStr := os.Getenv("CHECK_INTERVAL_SECONDS"); secondsStr != "" {
+		seconds, err := strconv.Atoi(secondsStr)
+		if err != nil {
+			log.Printf("Invalid CHECK_INTERVAL_SECONDS value '%s', ignoring", secondsStr)
+		} else if time.Duration(seconds)*time.Second < minCheckInterval {
+			log.Printf("CHECK_INTERVAL_SECONDS must be at least %d, ignoring", int(minCheckInterval.Seconds()))
+		} else {
+			return time.Duration(seconds) * time.Second
+		}
+	}
+
 	intervalStr := os.Getenv("CHECK_INTERVAL_MINUTES")
 	if intervalStr == "" {
-		return 60 * time.Minute
+		return defaultValue
 	}
 
 	minutes, err := strconv.Atoi(intervalStr)
 	if err != nil {
-		log.Printf("Invalid CHECK_INTERVAL_MINUTES value '%s', using default 60 minutes", intervalStr)
-		return 60 * time.Minute
+		log.Printf("Invalid CHECK_INTERVAL_MINUTES value '%s', using %v", intervalStr, defaultValue)
+		return defaultValue
 	}
 
 	if minutes < 1 {
-		log.Printf("CHECK_INTERVAL_MINUTES must be at least 1, using default 60 minutes")
-		return 60 * time.Minute
+		log.Printf("CHECK_INTERVAL_MINUTES must be at least 1, using %v", defaultValue)
+		return defaultValue
 	}
 
 	return time.Duration(minutes) * time.Minute
 }
 
-func getInstanceRefreshInterval() time.Duration {
+func getInstanceRefreshInterval(defaultValue time.Duration) time.Duration {
 	intervalStr := os.Getenv("INSTANCE_REFRESH_INTERVAL_MINUTES")
 	if intervalStr == "" {
-		return 10 * time.Minute
+		return defaultValue
 	}
 
 	minutes, err := strconv.Atoi(intervalStr)
 	if err != nil {
-		log.Printf("Invalid INSTANCE_REFRESH_INTERVAL_MINUTES value '%s', using default 10 minutes", intervalStr)
-		return 10 * time.Minute
+		log.Printf("Invalid INSTANCE_REFRESH_INTERVAL_MINUTES value '%s', using %v", intervalStr, defaultValue)
+		return defaultValue
 	}
 
 	if minutes < 1 {
-		log.Printf("INSTANCE_REFRESH_INTERVAL_MINUTES must be at least 1, using default 10 minutes")
-		return 10 * time.Minute
+		log.Printf("INSTANCE_REFRESH_INTERVAL_MINUTES must be at least 1, using %v", defaultValue)
+		return defaultValue
 	}
 
 	return time.Duration(minutes) * time.Minute
 }
 
-func getTimeout() time.Duration {
+// minRequestTimeout keeps REQUEST_TIMEOUT_MS above normal network jitter.
+const minRequestTimeout = 100 * time.Millisecond
+
+// getTimeout reads REQUEST_TIMEOUT_MS, falling back to
+// REQUEST_TIMEOUT_SECONDS.
+func getTimeout(defaultValue time.Duration) time.Duration {
+	if msStr := os.Getenv("REQUEST_TIMEOUT_MS"); msStr != "" {
+		ms, err := strconv.Atoi(msStr)
+		if err == nil && time.Duration(ms)*time.Millisecond >= minRequestTimeout {
+			return time.Duration(ms) * time.Millisecond
+		}
+		log.Printf("Invalid REQUEST_TIMEOUT_MS, must be at least %dms; ignoring it", minRequestTimeout.Milliseconds())
+	}
+
 	timeoutStr := os.Getenv("REQUEST_TIMEOUT_SECONDS")
 	if timeoutStr == "" {
-		return 30 * time.Second
+		return defaultValue
+	}
+
+	seconds, err := strconv.Atoi(timeoutStr)
+	if err != nil || seconds < 1 {
+		log.Printf("Invalid REQUEST_TIMEOUT_SECONDS, using %v", defaultValue)
+		return defaultValue
+	}
+
+	return time.Duration(seconds) * time.Second
+}
+
+func getInstancesRequestTimeout(defaultValue time.Duration) time.Duration {
+	timeoutStr := os.Getenv("INSTANCES_REQUEST_TIMEOUT_SECONDS")
+	if timeoutStr == "" {
+		return defaultValue
 	}
 
 	seconds, err := strconv.Atoi(timeoutStr)
 	if err != nil || seconds < 1 {
-		log.Printf("Invalid REQUEST_TIMEOUT_SECONDS, using default 30 seconds")
-		return 30 * time.Second
+		log.Printf("Invalid INSTANCES_REQUEST_TIMEOUT_SECONDS, using %v", defaultValue)
+		return defaultValue
 	}
 
 	return time.Duration(seconds) * time.Second
 }
 
-func getMaxHistory() int {
+func getMaxHistory(defaultValue int) int {
 	historyStr := os.Getenv("MAX_CHECK_HISTORY")
 	if historyStr == "" {
-		return 168
+		return defaultValue
 	}
 
 	history, err := strconv.Atoi(historyStr)
 	if err != nil || history < 1 {
-		log.Printf("Invalid MAX_CHECK_HISTORY, using default 168")
-		return 168
+		log.Printf("Invalid MAX_CHECK_HISTORY, using %d", defaultValue)
+		return defaultValue
 	}
 
 	return history
 }
 
-func getSSEKeepalive() int {
+func getSSEKeepalive(defaultValue int) int {
 	keepaliveStr := os.Getenv("SSE_KEEPALIVE_SECONDS")
 	if keepaliveStr == "" {
-		return 30
+		return defaultValue
 	}
 
 	seconds, err := strconv.Atoi(keepaliveStr)
 	if err != nil || seconds < 1 {
-		log.Printf("Invalid SSE_KEEPALIVE_SECONDS, using default 30")
-		return 30
+		log.Printf("Invalid SSE_KEEPALIVE_SECONDS, using %d", defaultValue)
+		return defaultValue
+	}
+
+	return seconds
+}
+
+func getKumaPushURLs(defaultValue map[string]string) map[string]string {
+	mappingStr := os.Getenv("KUMA_PUSH_URLS")
+	if mappingStr == "" {
+		return defaultValue
+	}
+
+	var mapping map[string]string
+	if err := json.Unmarshal([]byte(mappingStr), &mapping); err != nil {
+		log.Printf("Invalid KUMA_PUSH_URLS, expected a JSON object of instance URL to push URL: %v", err)
+		return defaultValue
+	}
+
+	return mapping
+}
+
+func getNotifyWebhookURLs(defaultValue []string) []string {
+	urlsStr := os.Getenv("NOTIFY_WEBHOOK_URLS")
+	if urlsStr == "" {
+		return defaultValue
+	}
+
+	var urls []string
+	for _, u := range strings.Split(urlsStr, ",") {
+		if u = strings.TrimSpace(u); u != "" {
+			urls = append(urls, u)
+		}
+	}
+	return urls
+}
+
+func getInstancesRequestHeaders(defaultValue map[string]string) map[string]string {
+	headersStr := os.Getenv("INSTANCES_REQUEST_HEADERS")
+	if headersStr == "" {
+		return defaultValue
+	}
+
+	var headers map[string]string
+	if err := json.Unmarshal([]byte(headersStr), &headers); err != nil {
+		log.Printf("Invalid INSTANCES_REQUEST_HEADERS, expected a JSON object of header name to value: %v", err)
+		return defaultValue
+	}
+
+	return headers
+}
+
+func getCompactAfter(defaultValue time.Duration) time.Duration {
+	compactStr := os.Getenv("COMPACT_AFTER")
+	if compactStr == "" {
+		return defaultValue
+	}
+	if compactStr == "0" {
+		return 0
+	}
+
+	duration, err := time.ParseDuration(compactStr)
+	if err != nil || duration < time.Hour {
+		log.Printf("Invalid COMPACT_AFTER value '%s', compaction disabled", compactStr)
+		return 0
+	}
+
+	return duration
+}
+
+func getUIBodyReadLimit(defaultValue int64) int64 {
+	limitStr := os.Getenv("UI_BODY_READ_LIMIT_BYTES")
+	if limitStr == "" {
+		return defaultValue
+	}
+
+	limit, err := strconv.ParseInt(limitStr, 10, 64)
+	if err != nil || limit < 1 {
+		log.Printf("Invalid UI_BODY_READ_LIMIT_BYTES, using %d", defaultValue)
+		return defaultValue
+	}
+
+	return limit
+}
+
+func getDNSServers(defaultValue []string) []string {
+	serversStr := os.Getenv("CHECK_DNS_SERVERS")
+	if serversStr == "" {
+		return defaultValue
+	}
+
+	var servers []string
+	for _, server := range strings.Split(serversStr, ",") {
+		server = strings.TrimSpace(server)
+		if server == "" {
+			continue
+		}
+		servers = append(servers, server)
+	}
+
+	return servers
+}
+
+func getIPFamily(defaultValue string) string {
+	family := os.Getenv("CHECK_IP_FAMILY")
+	if family == "" {
+		return defaultValue
+	}
+
+	switch family {
+	case IPFamilyAuto, IPFamilyV4, IPFamilyV6, IPFamilyDual:
+		return family
+	default:
+		log.Printf("Invalid CHECK_IP_FAMILY value '%s', using %s", family, defaultValue)
+		return defaultValue
+	}
+}
+
+func getDualStackSuccess(defaultValue string) string {
+	policy := os.Getenv("CHECK_DUAL_SUCCESS")
+	if policy == "" {
+		return defaultValue
+	}
+
+	if policy != "either" && policy != "both" {
+		log.Printf("Invalid CHECK_DUAL_SUCCESS value '%s', using %s", policy, defaultValue)
+		return defaultValue
+	}
+
+	return policy
+}
+
+func getHostConcurrency(defaultValue int) int {
+	concurrencyStr := os.Getenv("CHECK_HOST_CONCURRENCY")
+	if concurrencyStr == "" {
+		return defaultValue
+	}
+
+	concurrency, err := strconv.Atoi(concurrencyStr)
+	if err != nil || concurrency < 0 {
+		log.Printf("Invalid CHECK_HOST_CONCURRENCY, using %d", defaultValue)
+		return defaultValue
+	}
+
+	return concurrency
+}
+
+func getHostRequestsPerSecond(defaultValue float64) float64 {
+	rpsStr := os.Getenv("CHECK_HOST_RPS")
+	if rpsStr == "" {
+		return defaultValue
+	}
+
+	rps, err := strconv.ParseFloat(rpsStr, 64)
+	if err != nil || rps < 0 {
+		log.Printf("Invalid CHECK_HOST_RPS, using %v", defaultValue)
+		return defaultValue
+	}
+
+	return rps
+}
+
+func getDegradedUptimePercent(defaultValue float64) float64 {
+	percentStr := os.Getenv("DEGRADED_UPTIME_PERCENT")
+	if percentStr == "" {
+		return defaultValue
+	}
+
+	percent, err := strconv.ParseFloat(percentStr, 64)
+	if err != nil || percent < 0 || percent > 100 {
+		log.Printf("Invalid DEGRADED_UPTIME_PERCENT, using %v", defaultValue)
+		return defaultValue
+	}
+
+	return percent
+}
+
+func getRateLimitRPS(key string, defaultValue float64) float64 {
+	rpsStr := os.Getenv(key)
+	if rpsStr == "" {
+		return defaultValue
+	}
+
+	rps, err := strconv.ParseFloat(rpsStr, 64)
+	if err != nil || rps < 0 {
+		log.Printf("Invalid %s, using %v", key, defaultValue)
+		return defaultValue
+	}
+
+	return rps
+}
+
+func getRateLimitBurst(key string, defaultValue int) int {
+	burstStr := os.Getenv(key)
+	if burstStr == "" {
+		return defaultValue
+	}
+
+	burst, err := strconv.Atoi(burstStr)
+	if err != nil || burst < 1 {
+		log.Printf("Invalid %s, using %d", key, defaultValue)
+		return defaultValue
+	}
+
+	return burst
+}
+
+func getSSEMaxConnectionsPerIP(defaultValue int) int {
+	maxStr := os.Getenv("SSE_MAX_CONNECTIONS_PER_IP")
+	if maxStr == "" {
+		return defaultValue
+	}
+
+	max, err := strconv.Atoi(maxStr)
+	if err != nil || max < 0 {
+		log.Printf("Invalid SSE_MAX_CONNECTIONS_PER_IP, using %d", defaultValue)
+		return defaultValue
+	}
+
+	return max
+}
+
+func getBadgeCacheSeconds(defaultValue int) int {
+	secondsStr := os.Getenv("BADGE_CACHE_SECONDS")
+	if secondsStr == "" {
+		return defaultValue
+	}
+
+	seconds, err := strconv.Atoi(secondsStr)
+	if err != nil || seconds < 0 {
+		log.Printf("Invalid BADGE_CACHE_SECONDS, using %d", defaultValue)
+		return defaultValue
 	}
 
 	return seconds
 }
 
+// getIPPrefixes reads a comma-separated list of IP addresses and CIDRs,
+// skipping invalid entries.
+func getIPPrefixes(key string, defaultValue []string) []string {
+	listStr, ok := os.LookupEnv(key)
+	if !ok {
+		return defaultValue
+	}
+
+	var prefixes []string
+	for _, entry := range strings.Split(listStr, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		if _, err := parseIPPrefix(entry); err != nil {
+			log.Printf("Invalid %s entry '%s', ignoring", key, entry)
+			continue
+		}
+		prefixes = append(prefixes, entry)
+	}
+
+	return prefixes
+}
+
+// getFrameAncestors reads the origins allowed to embed the dashboard in a
+// frame. The keywords self and none may be given with or without quotes.
+func getFrameAncestors(defaultValue []string) []string {
+	listStr, ok := os.LookupEnv("FRAME_ANCESTORS")
+	if !ok {
+		return defaultValue
+	}
+
+	var ancestors []string
+	for _, entry := range strings.Split(listStr, ",") {
+		entry = strings.TrimSpace(entry)
+		switch strings.Trim(entry, "'") {
+		case "":
+			continue
+		case "self", "none":
+			entry = "'" + strings.Trim(entry, "'") + "'"
+		default:
+			if strings.ContainsAny(entry, " ;'\"") {
+				log.Printf("Invalid FRAME_ANCESTORS entry '%s', ignoring", entry)
+				continue
+			}
+		}
+		ancestors = append(ancestors, entry)
+	}
+
+	return ancestors
+}
+
+// getSeconds reads a non-negative number of seconds; 0 disables the
+// timeout it configures.
+func getSeconds(key string, defaultValue time.Duration) time.Duration {
+	secondsStr := os.Getenv(key)
+	if secondsStr == "" {
+		return defaultValue
+	}
+
+	seconds, err := strconv.Atoi(secondsStr)
+	if err != nil || seconds < 0 {
+		log.Printf("Invalid %s, using %v", key, defaultValue)
+		return defaultValue
+	}
+
+	return time.Duration(seconds) * time.Second
+}
+
+// getMilliseconds reads a non-negative number of milliseconds.
+func getMilliseconds(key string, defaultValue time.Duration) time.Duration {
+	msStr := os.Getenv(key)
+	if msStr == "" {
+		return defaultValue
+	}
+
+	ms, err := strconv.Atoi(msStr)
+	if err != nil || ms < 0 {
+		log.Printf("Invalid %s, using %dms", key, defaultValue.Milliseconds())
+		return defaultValue
+	}
+
+	return time.Duration(ms) * time.Millisecond
+}
+
+func getCheckRetries(defaultValue int) int {
+	retriesStr := os.Getenv("CHECK_RETRIES")
+	if retriesStr == "" {
+		return defaultValue
+	}
+
+	retries, err := strconv.Atoi(retriesStr)
+	if err != nil || retries < 0 {
+		log.Printf("Invalid CHECK_RETRIES, using %d", defaultValue)
+		return defaultValue
+	}
+
+	return retries
+}
+
+func getContentChangeChecks(defaultValue int) int {
+	checksStr := os.Getenv("CONTENT_CHANGE_CHECKS")
+	if checksStr == "" {
+		return defaultValue
+	}
+
+	checks, err := strconv.Atoi(checksStr)
+	if err != nil || checks < 0 {
+		log.Printf("Invalid CONTENT_CHANGE_CHECKS, using %d", defaultValue)
+		return defaultValue
+	}
+
+	return checks
+}
+
+func getArchiveMaxInstances(defaultValue int) int {
+	limitStr := os.Getenv("ARCHIVE_MAX_INSTANCES")
+	if limitStr == "" {
+		return defaultValue
+	}
+
+	limit, err := strconv.Atoi(limitStr)
+	if err != nil || limit < 0 {
+		log.Printf("Invalid ARCHIVE_MAX_INSTANCES, using %d", defaultValue)
+		return defaultValue
+	}
+
+	return limit
+}
+
+func getCheckErrorMaxLength(defaultValue int) int {
+	lengthStr := os.Getenv("CHECK_ERROR_MAX_LENGTH")
+	if lengthStr == "" {
+		return defaultValue
+	}
+
+	length, err := strconv.Atoi(lengthStr)
+	if err != nil || length < 16 {
+		log.Printf("Invalid CHECK_ERROR_MAX_LENGTH, using %d", defaultValue)
+		return defaultValue
+	}
+
+	return length
+}
+
+// getBytes reads a positive size in bytes.
+func getBytes(key string, defaultValue int64) int64 {
+	bytesStr := os.Getenv(key)
+	if bytesStr == "" {
+		return defaultValue
+	}
+
+	bytes, err := strconv.ParseInt(bytesStr, 10, 64)
+	if err != nil || bytes < 1 {
+		log.Printf("Invalid %s, using %d", key, defaultValue)
+		return defaultValue
+	}
+
+	return bytes
+}
+
+func getLogTimestampFormat(defaultValue string) string {
+	format := os.Getenv("LOG_TIMESTAMP_FORMAT")
+	if format == "" {
+		return defaultValue
+	}
+
+	switch format {
+	case LogTimestampDefault, LogTimestampUnix, LogTimestampRFC3339, LogTimestampNone:
+		return format
+	default:
+		log.Printf("Invalid LOG_TIMESTAMP_FORMAT value '%s', using %s", format, defaultValue)
+		return defaultValue
+	}
+}
+
+// getList reads a comma-separated list, dropping empty and repeated
+// entries.
+func getList(key string, defaultValue []string) []string {
+	listStr := os.Getenv(key)
+	if listStr == "" {
+		return defaultValue
+	}
+
+	var list []string
+	for _, entry := range strings.Split(listStr, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry != "" && !slices.Contains(list, entry) {
+			list = append(list, entry)
+		}
+	}
+	return list
+}
+
+// getPatterns reads a list of InstanceFilter patterns, skipping invalid
+// ones. Patterns from the config file are checked as well.
+func getPatterns(key string, defaultValue []string) []string {
+	var patterns []string
+	for _, pattern := range getList(key, defaultValue) {
+		if err := validatePatterns([]string{pattern}); err != nil {
+			log.Printf("Invalid %s value: %v, skipping it", key, err)
+			continue
+		}
+		patterns = append(patterns, pattern)
+	}
+	return patterns
+}
+
+// getLatencyRule reads the global latency alert rule. Invalid values fall
+// back to the defaults.
+func getLatencyRule(defaultValue LatencyRule) LatencyRule {
+	defaults := DefaultConfig().LatencyAlert
+	rule := defaultValue
+
+	if windowStr := os.Getenv("LATENCY_ALERT_WINDOW"); windowStr != "" {
+		window, err := strconv.Atoi(windowStr)
+		if err != nil {
+			log.Printf("Invalid LATENCY_ALERT_WINDOW value '%s', using %d", windowStr, rule.Window)
+		} else {
+			rule.Window = window
+		}
+	}
+	if rule.Window < 1 {
+		log.Printf("Invalid LATENCY_ALERT_WINDOW value %d, using %d", rule.Window, defaults.Window)
+		rule.Window = defaults.Window
+	}
+
+	rule.Statistic = getEnv("LATENCY_ALERT_STATISTIC", rule.Statistic)
+	if rule.Statistic != LatencyAvg && rule.Statistic != LatencyP95 {
+		log.Printf("Invalid LATENCY_ALERT_STATISTIC value '%s', using %s", rule.Statistic, defaults.Statistic)
+		rule.Statistic = defaults.Statistic
+	}
+
+	if thresholdStr := os.Getenv("LATENCY_ALERT_THRESHOLD_MS"); thresholdStr != "" {
+		threshold, err := strconv.ParseInt(thresholdStr, 10, 64)
+		if err != nil || threshold < 0 {
+			log.Printf("Invalid LATENCY_ALERT_THRESHOLD_MS value '%s', using %d", thresholdStr, rule.ThresholdMs)
+		} else {
+			rule.ThresholdMs = threshold
+		}
+	}
+
+	if multipleStr := os.Getenv("LATENCY_ALERT_BASELINE_MULTIPLE"); multipleStr != "" {
+		multiple, err := strconv.ParseFloat(multipleStr, 64)
+		if err != nil || (multiple != 0 && multiple <= 1) {
+			log.Printf("Invalid LATENCY_ALERT_BASELINE_MULTIPLE value '%s', expected 0 or more than 1, using %v", multipleStr, rule.BaselineMultiple)
+		} else {
+			rule.BaselineMultiple = multiple
+		}
+	}
+
+	if hysteresisStr := os.Getenv("LATENCY_ALERT_HYSTERESIS"); hysteresisStr != "" {
+		hysteresis, err := strconv.ParseFloat(hysteresisStr, 64)
+		if err != nil {
+			log.Printf("Invalid LATENCY_ALERT_HYSTERESIS value '%s', using %v", hysteresisStr, rule.Hysteresis)
+		} else {
+			rule.Hysteresis = hysteresis
+		}
+	}
+	if rule.Hysteresis < 0 || rule.Hysteresis >= 1 {
+		log.Printf("Invalid LATENCY_ALERT_HYSTERESIS value %v, expected at least 0 and below 1, using %v", rule.Hysteresis, defaults.Hysteresis)
+		rule.Hysteresis = defaults.Hysteresis
+	}
+
+	return rule
+}
+
+// getLatencyAlertGroups reads the per-group latency alert rules, a JSON
+// object of group name to rule.
+func getLatencyAlertGroups(defaultValue map[string]LatencyRule) map[string]LatencyRule {
+	groupsStr := os.Getenv("LATENCY_ALERT_GROUPS")
+	if groupsStr == "" {
+		return defaultValue
+	}
+
+	var groups map[string]LatencyRule
+	if err := json.Unmarshal([]byte(groupsStr), &groups); err != nil {
+		log.Printf("Invalid LATENCY_ALERT_GROUPS, expected a JSON object of group name to rule: %v", err)
+		return defaultValue
+	}
+
+	return groups
+}
+
+func getBool(key string, defaultValue bool) bool {
+	valueStr := os.Getenv(key)
+	if valueStr == "" {
+		return defaultValue
+	}
+
+	value, err := strconv.ParseBool(valueStr)
+	if err != nil {
+		log.Printf("Invalid %s value '%s', using %v", key, valueStr, defaultValue)
+		return defaultValue
+	}
+
+	return value
+}
+
+// getAllowedOrigins reads the comma-separated origins allowed by CORS,
+// skipping entries that are not * or a scheme://host[:port] origin.
+func getAllowedOrigins(defaultValue []string) []string {
+	listStr, ok := os.LookupEnv("ALLOWED_ORIGINS")
+	if !ok {
+		return defaultValue
+	}
+
+	var origins []string
+	for _, entry := range strings.Split(listStr, ",") {
+		entry = strings.TrimSuffix(strings.TrimSpace(entry), "/")
+		if entry == "" {
+			continue
+		}
+		if !validOrigin(entry) {
+			log.Printf("Invalid ALLOWED_ORIGINS entry '%s', ignoring", entry)
+			continue
+		}
+		origins = append(origins, entry)
+	}
+
+	return origins
+}
+
+// Meta is the subset of the configuration exposed to the dashboard. Fields
+// are listed explicitly so that secrets never end up in it.
+type Meta struct {
+	CheckIntervalSeconds           int       `json:"check_interval_seconds"`
+	InstanceRefreshIntervalSeconds int       `json:"instance_refresh_interval_seconds"`
+	MaxCheckHistory                int       `json:"max_check_history"`
+	DegradedUptimePercent          float64   `json:"degraded_uptime_percent"`
+	ServerTime                     time.Time `json:"server_time"`
+
+	// GroupOrder is the display order of the groups, set by the server
+	// from the instance list.
+	GroupOrder []string `json:"group_order"`
+}
+
+func (c *Config) Meta() Meta {
+	return Meta{
+		CheckIntervalSeconds:           int(c.CurrentCheckInterval().Seconds()),
+		InstanceRefreshIntervalSeconds: int(c.CurrentInstanceRefreshInterval().Seconds()),
+		MaxCheckHistory:                c.CurrentMaxCheckHistory(),
+		DegradedUptimePercent:          c.DegradedUptimePercent,
+		ServerTime:                     time.Now(),
+	}
+}
+
+// Apply validates the update using the same rules as the environment
+// variables and swaps the values in.
+func (c *Config) Apply(update ConfigUpdate) error {
+	if update.CheckIntervalMinutes != nil && *update.CheckIntervalMinutes < 1 {
+		return fmt.Errorf("check_interval_minutes must be at least 1")
+	}
+	if update.InstanceRefreshIntervalMinutes != nil && *update.InstanceRefreshIntervalMinutes < 1 {
+		return fmt.Errorf("instance_refresh_interval_minutes must be at least 1")
+	}
+	if update.InstanceRefreshIntervalSeconds != nil {
+		if update.InstanceRefreshIntervalMinutes != nil {
+			return fmt.Errorf("use either instance_refresh_interval_minutes or instance_refresh_interval_seconds")
+		}
+		if *update.InstanceRefreshIntervalSeconds < 1 {
+			return fmt.Errorf("instance_refresh_interval_seconds must be at least 1")
+		}
+	}
+	if update.MaxCheckHistory != nil && *update.MaxCheckHistory < 1 {
+		return fmt.Errorf("max_check_history must be at least 1")
+	}
+	if update.SSEKeepaliveSeconds != nil && *update.SSEKeepaliveSeconds < 1 {
+		return fmt.Errorf("sse_keepalive_seconds must be at least 1")
+	}
+	if update.LogLevel != nil && *update.LogLevel != "info" && *update.LogLevel != "debug" {
+		return fmt.Errorf("log_level must be info or debug")
+	}
+	for _, field := range []struct {
+		name     string
+		patterns *[]string
+	}{
+		{"exclude_urls", update.ExcludeURLs},
+		{"exclude_groups", update.ExcludeGroups},
+		{"include_only_groups", update.IncludeOnlyGroups},
+	} {
+		if field.patterns == nil {
+			continue
+		}
+		if err := validatePatterns(*field.patterns); err != nil {
+			return fmt.Errorf("%s: %w", field.name, err)
+		}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if update.CheckIntervalMinutes != nil {
+		c.CheckInterval = time.Duration(*update.CheckIntervalMinutes) * time.Minute
+	}
+	if update.InstanceRefreshIntervalMinutes != nil {
+		c.InstanceRefreshInterval = time.Duration(*update.InstanceRefreshIntervalMinutes) * time.Minute
+	}
+	if update.InstanceRefreshIntervalSeconds != nil {
+		c.InstanceRefreshInterval = time.Duration(*update.InstanceRefreshIntervalSeconds) * time.Second
+	}
+	if update.MaxCheckHistory != nil {
+		c.MaxCheckHistory = *update.MaxCheckHistory
+	}
+	if update.SSEKeepaliveSeconds != nil {
+		c.SSEKeepaliveSeconds = *update.SSEKeepaliveSeconds
+	}
+	if update.LogLevel != nil {
+		c.LogLevel = *update.LogLevel
+	}
+	if update.ExcludeURLs != nil {
+		c.ExcludeURLs = *update.ExcludeURLs
+	}
+	if update.ExcludeGroups != nil {
+		c.ExcludeGroups = *update.ExcludeGroups
+	}
+	if update.IncludeOnlyGroups != nil {
+		c.IncludeOnlyGroups = *update.IncludeOnlyGroups
+	}
+
+	return nil
+}
+
+func (c *Config) CurrentCheckInterval() time.Duration {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.CheckInterval
+}
+
+// CurrentSelfCheckBudget is how long a check cycle may take before the self
+// check fails, the check interval unless SELF_CHECK_BUDGET_SECONDS is set.
+func (c *Config) CurrentSelfCheckBudget() time.Duration {
+	if c.SelfCheckBudget > 0 {
+		return c.SelfCheckBudget
+	}
+	return c.CurrentCheckInterval()
+}
+
+// SelfURL is the URL the self check instance is listed under.
+func (c *Config) SelfURL() string {
+	if c.StatusPageURL != "" {
+		return c.StatusPageURL
+	}
+	return "http://localhost" + c.Port
+}
+
+func (c *Config) CurrentInstanceRefreshInterval() time.Duration {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.InstanceRefreshInterval
+}
+
+func (c *Config) CurrentMaxCheckHistory() int {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.MaxCheckHistory
+}
+
+// CurrentInstanceFilter is the filter applied to the instance list, which
+// can be changed through PATCH /api/config.
+func (c *Config) CurrentInstanceFilter() InstanceFilter {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return InstanceFilter{
+		ExcludeURLs:       c.ExcludeURLs,
+		ExcludeGroups:     c.ExcludeGroups,
+		IncludeOnlyGroups: c.IncludeOnlyGroups,
+	}
+}
+
+// LatencyRuleFor returns the latency alert rule of a group: its own rule
+// from LATENCY_ALERT_GROUPS, with unset fields taken from the global rule,
+// or the global rule.
+func (c *Config) LatencyRuleFor(group string) LatencyRule {
+	if rule, ok := c.LatencyAlertGroups[group]; ok {
+		return rule.inherit(c.LatencyAlert)
+	}
+	return c.LatencyAlert
+}
+
+func (c *Config) CurrentSSEKeepalive() time.Duration {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return time.Duration(c.SSEKeepaliveSeconds) * time.Second
+}
+
+func (c *Config) IsDebug() bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.LogLevel == "debug"
+}
+
 func (c *Config) LogConfig() {
+	if c.DryRun {
+		log.Printf("*** DRY_RUN=true: notifications and Kuma pushes are logged, not sent ***")
+	}
 	log.Printf("Configuration:")
 	log.Printf("  Port: %s", c.Port)
-	log.Printf("  Check Interval: %v", c.CheckInterval)
+	log.Printf("  Check Interval: %ds", int(c.CheckInterval/time.Second))
 	log.Printf("  Instances URL: %s", c.InstancesURL)
+	if c.InstancesAuthUser != "" {
+		log.Printf("  Instances URL uses basic auth")
+		if strings.HasPrefix(c.InstancesURL, "http://") {
+			log.Printf("Warning: sending basic auth credentials over plain HTTP to %s", c.InstancesURL)
+		}
+	}
+	if c.MaxStartupWait > 0 {
+		log.Printf("  Max Startup Wait: %v", c.MaxStartupWait)
+	}
 	log.Printf("  Instance Refresh Interval: %v", c.InstanceRefreshInterval)
-	log.Printf("  Request Timeout: %v", c.RequestTimeout)
+	log.Printf("  Request Timeout: %dms", c.RequestTimeout.Milliseconds())
+	log.Printf("  Instances Request Timeout: %v", c.InstancesRequestTimeout)
+	if len(c.InstancesRequestHeaders) > 0 {
+		names := make([]string, 0, len(c.InstancesRequestHeaders))
+		auth := false
+		for name := range c.InstancesRequestHeaders {
+			names = append(names, name)
+			auth = auth || strings.EqualFold(name, "Authorization")
+		}
+		sort.Strings(names)
+		log.Printf("  Instances Request Headers: %s", strings.Join(names, ", "))
+		if auth {
+			log.Printf("Warning: sending an Authorization header with instance list requests to %s", c.InstancesURL)
+		}
+	}
 	log.Printf("  Max Check History: %d", c.MaxCheckHistory)
 	log.Printf("  SSE Keepalive: %ds", c.SSEKeepaliveSeconds)
+	log.Printf("  UI Body Read Limit: %d bytes", c.UIBodyReadLimit)
+	if len(c.DNSServers) > 0 {
+		log.Printf("  DNS Servers: %s", strings.Join(c.DNSServers, ", "))
+	}
+	if c.IPFamily == IPFamilyDual {
+		log.Printf("  IP Family: %s (success requires %s)", c.IPFamily, c.DualStackSuccess)
+	} else {
+		log.Printf("  IP Family: %s", c.IPFamily)
+	}
+	if c.CheckRetries > 0 {
+		log.Printf("  Check Retries: %d, backoff from %dms", c.CheckRetries, c.CheckRetryBackoff.Milliseconds())
+	}
+	log.Printf("  Check Error Max Length: %d characters", c.CheckErrorMaxLength)
+	if c.HostConcurrency > 0 || c.HostRequestsPerSecond > 0 {
+		log.Printf("  Per-Host Limits: %d concurrent, %v req/s", c.HostConcurrency, c.HostRequestsPerSecond)
+	}
+	log.Printf("  Uptime Timezone: %s", c.UptimeTimezone)
+	log.Printf("  Degraded Below: %v%% uptime", c.DegradedUptimePercent)
+	if c.RateLimitRPS > 0 {
+		log.Printf("  Rate Limit: %v req/s per client, burst %d", c.RateLimitRPS, c.RateLimitBurst)
+	}
+	if c.InstancesAPIRateLimitRPS > 0 {
+		log.Printf("  Instances API Rate Limit: %v req/s per client, burst %d", c.InstancesAPIRateLimitRPS, c.InstancesAPIRateLimitBurst)
+	}
+	if c.SSEMaxConnectionsPerIP > 0 {
+		log.Printf("  SSE Connections: at most %d per client", c.SSEMaxConnectionsPerIP)
+	}
+	if len(c.TrustedProxies) > 0 {
+		log.Printf("  Trusted Proxies: %s (client IP from %s)", strings.Join(c.TrustedProxies, ", "), c.ClientIPHeader)
+	}
+	log.Printf("  Badge Cache: %ds", c.BadgeCacheSeconds)
+	if len(c.FrameAncestors) > 0 {
+		log.Printf("  Frame Ancestors: %s", strings.Join(c.FrameAncestors, " "))
+	} else {
+		log.Printf("  Frame Ancestors: 'none'")
+	}
+	if len(c.AllowedOrigins) > 0 {
+		log.Printf("  Allowed Origins: %s", strings.Join(c.AllowedOrigins, ", "))
+	} else {
+		log.Printf("  Allowed Origins: none (CORS disabled)")
+	}
+	if c.ContentSecurityPolicy == "" {
+		log.Printf("  Content-Security-Policy: disabled")
+	}
+	log.Printf("  HTTP Timeouts: read header %v, read %v, write %v, idle %v",
+		c.HTTPReadHeaderTimeout, c.HTTPReadTimeout, c.HTTPWriteTimeout, c.HTTPIdleTimeout)
+	log.Printf("  HTTP Limits: %d header bytes, %d body bytes", c.HTTPMaxHeaderBytes, c.HTTPMaxBodyBytes)
+	if c.StatusPageURL != "" {
+		log.Printf("  Status Page URL: %s", c.StatusPageURL)
+	}
+	if len(c.GroupOrder) > 0 {
+		log.Printf("  Group Order: %s first", strings.Join(c.GroupOrder, ", "))
+	}
+	if len(c.IncludeOnlyGroups) > 0 {
+		log.Printf("  Include Only Groups: %s", strings.Join(c.IncludeOnlyGroups, ", "))
+	}
+	if len(c.ExcludeGroups) > 0 {
+		log.Printf("  Exclude Groups: %s", strings.Join(c.ExcludeGroups, ", "))
+	}
+	if len(c.ExcludeURLs) > 0 {
+		log.Printf("  Exclude URLs: %s", strings.Join(c.ExcludeURLs, ", "))
+	}
+	if rule := c.LatencyAlert; rule.enabled() {
+		log.Printf("  Latency Alert: %s of the last %d checks over %dms or %vx baseline, %v%% hysteresis",
+			rule.Statistic, rule.Window, rule.ThresholdMs, rule.BaselineMultiple, rule.Hysteresis*100)
+	}
+	if len(c.LatencyAlertGroups) > 0 {
+		log.Printf("  Latency Alert Groups: %d", len(c.LatencyAlertGroups))
+	}
+	if c.ContentChangeChecks > 0 {
+		log.Printf("  Content Change: flagged after %d checks, notify %v", c.ContentChangeChecks, c.ContentChangeNotify)
+	} else {
+		log.Printf("  Content Change: disabled")
+	}
+	log.Printf("  Archive: up to %d removed instances", c.ArchiveMaxInstances)
+	if c.SelfCheck {
+		log.Printf("  Self Check: %s, cycle budget %v", c.SelfURL(), c.CurrentSelfCheckBudget())
+	}
 	log.Printf("  Log Level: %s", c.LogLevel)
+	log.Printf("  Log Timestamps: %s", c.LogTimestampFormat)
+	if c.LogHTTPBodies {
+		log.Printf("  Log HTTP Bodies: start of failed check responses, at debug level")
+	}
+	if c.APIKey != "" {
+		log.Printf("  API Key: configured")
+	} else {
+		log.Printf("  API Key: not set (admin endpoints disabled)")
+	}
+	if c.GitHubWebhookSecret != "" {
+		log.Printf("  GitHub Webhook: refresh on pushes to %s", c.GitHubWebhookPath)
+	} else {
+		log.Printf("  GitHub Webhook: disabled")
+	}
+	log.Printf("  Kuma Push Monitors: %d", len(c.KumaPushURLs))
+	log.Printf("  Notification Webhooks: %d", len(c.NotifyWebhookURLs))
+	if c.CompactAfter > 0 {
+		log.Printf("  Compact After: %v", c.CompactAfter)
+	} else {
+		log.Printf("  Compact After: disabled")
+	}
 }
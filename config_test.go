@@ -0,0 +1,166 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestGetTimeout(t *testing.T) {
+	tests := []struct {
+		ms, seconds string
+		want        time.Duration
+	}{
+		{"", "", 30 * time.Second},
+		{"", "5", 5 * time.Second},
+		{"500", "5", 500 * time.Millisecond},
+		{"100", "", 100 * time.Millisecond},
+		{"99", "5", 5 * time.Second},
+		{"fast", "", 30 * time.Second},
+	}
+
+	for _, tt := range tests {
+		t.Setenv("REQUEST_TIMEOUT_MS", tt.ms)
+		t.Setenv("REQUEST_TIMEOUT_SECONDS", tt.seconds)
+		if got := getTimeout(30 * time.Second); got != tt.want {
+			t.Errorf("REQUEST_TIMEOUT_MS=%q REQUEST_TIMEOUT_SECONDS=%q: got %v, want %v", tt.ms, tt.seconds, got, tt.want)
+		}
+	}
+}
+
+func TestTimestampWriter(t *testing.T) {
+	var buf bytes.Buffer
+	logger := log.New(&timestampWriter{w: &buf, format: LogTimestampUnix}, "", 0)
+	logger.Print("hello")
+
+	stamp, rest, _ := strings.Cut(buf.String(), " ")
+	if _, err := strconv.ParseInt(stamp, 10, 64); err != nil || rest != "hello\n" {
+		t.Errorf("unix line = %q, want a Unix timestamp then the message", buf.String())
+	}
+
+	buf.Reset()
+	logger.SetOutput(&timestampWriter{w: &buf, format: LogTimestampRFC3339})
+	logger.Print("hello")
+
+	stamp, rest, _ = strings.Cut(buf.String(), " ")
+	if _, err := time.Parse(time.RFC3339, stamp); err != nil || rest != "hello\n" {
+		t.Errorf("rfc3339 line = %q, want an RFC 3339 timestamp then the message", buf.String())
+	}
+}
+
+func TestInstancesURLCredentials(t *testing.T) {
+	var gotUser, gotPass string
+	var gotAuth bool
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotUser, gotPass, gotAuth = r.BasicAuth()
+		w.Write([]byte(`{}`))
+	}))
+	defer server.Close()
+
+	config := DefaultConfig()
+	config.InstancesURL = strings.Replace(server.URL, "http://", "http://reader:s%40cret@", 1) + "/instances.json"
+	config.normalize()
+	if strings.Contains(config.InstancesURL, "reader") || config.InstancesAuthUser != "reader" || config.InstancesAuthPass != "s@cret" {
+		t.Fatalf("normalized URL %q, user %q, password %q; want the credentials moved out of the URL",
+			config.InstancesURL, config.InstancesAuthUser, config.InstancesAuthPass)
+	}
+
+	source, err := NewSourceReader(config.InstancesURL, nil, config.InstancesAuth())
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, err := source.Open(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	body.Close()
+	if !gotAuth || gotUser != "reader" || gotPass != "s@cret" {
+		t.Errorf("request auth = %q, %q, %v; want reader's basic auth", gotUser, gotPass, gotAuth)
+	}
+
+	// Credentials are not sent to other sources.
+	if _, auth := stripURLCredentials("s3://key:secret@bucket/instances.json"); auth != nil {
+		t.Errorf("credentials taken from an S3 URL")
+	}
+}
+
+func TestLoadConfigFromFileChecksValues(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	os.WriteFile(path, []byte(`
+check_interval: 1s
+request_timeout: 10ms
+max_check_history: 0
+rate_limit_burst: 0
+log_level: verbose
+check_ip_family: IPv4
+check_dual_success: all
+degraded_uptime_percent: 150
+compact_after: 5m
+`), 0o644)
+
+	config, err := LoadConfigFromFile(path)
+	if err != nil {
+		t.Fatalf("LoadConfigFromFile: %v", err)
+	}
+	defaults := DefaultConfig()
+	if config.CheckInterval != defaults.CheckInterval || config.RequestTimeout != defaults.RequestTimeout {
+		t.Errorf("check interval %v, request timeout %v, want the defaults", config.CheckInterval, config.RequestTimeout)
+	}
+	if config.MaxCheckHistory != defaults.MaxCheckHistory || config.RateLimitBurst != defaults.RateLimitBurst {
+		t.Errorf("history %d, burst %d, want the defaults", config.MaxCheckHistory, config.RateLimitBurst)
+	}
+	if config.LogLevel != defaults.LogLevel || config.DegradedUptimePercent != defaults.DegradedUptimePercent {
+		t.Errorf("log level %q, degraded percent %v, want the defaults", config.LogLevel, config.DegradedUptimePercent)
+	}
+	if config.IPFamily != IPFamilyAuto || config.DualStackSuccess != "either" {
+		t.Errorf("ip family %q, dual success %q, want auto and either", config.IPFamily, config.DualStackSuccess)
+	}
+	if config.CompactAfter != 0 {
+		t.Errorf("compact after %v, want 0", config.CompactAfter)
+	}
+
+	for _, bad := range []string{"check_interval: 600", "request_timeout: 1.5"} {
+		os.WriteFile(path, []byte(bad), 0o644)
+		if _, err := LoadConfigFromFile(path); err == nil {
+			t.Errorf("%s: got no error", bad)
+		}
+	}
+	os.WriteFile(path, []byte("check_interval: 90s"), 0o644)
+	if config, err := LoadConfigFromFile(path); err != nil {
+		t.Errorf("check_interval: 90s: %v", err)
+	} else if config.CheckInterval != 90*time.Second {
+		t.Errorf("check_interval: 90s = %v", config.CheckInterval)
+	}
+}
+
+func TestDNSServersDefaultPort(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	os.WriteFile(path, []byte(`check_dns_servers: ["1.1.1.1", "9.9.9.9:5353", "2606:4700::1111"]`), 0o644)
+
+	config, err := LoadConfigFromFile(path)
+	if err != nil {
+		t.Fatalf("LoadConfigFromFile: %v", err)
+	}
+	want := []string{"1.1.1.1:53", "9.9.9.9:5353", "[2606:4700::1111]:53"}
+	if !slices.Equal(config.DNSServers, want) {
+		t.Errorf("file servers = %v, want %v", config.DNSServers, want)
+	}
+
+	t.Setenv("CHECK_DNS_SERVERS", "8.8.8.8, 8.8.4.4:53")
+	config, err = LoadConfigFromFile(path)
+	if err != nil {
+		t.Fatalf("LoadConfigFromFile: %v", err)
+	}
+	if want := []string{"8.8.8.8:53", "8.8.4.4:53"}; !slices.Equal(config.DNSServers, want) {
+		t.Errorf("env servers = %v, want %v", config.DNSServers, want)
+	}
+}
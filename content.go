@@ -0,0 +1,122 @@
+package main
+
+import (
+	"fmt"
+	"hash/fnv"
+	"log"
+	"math/bits"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// EventContentChanged is sent when a UI instance keeps serving a page that
+// looks different from the one it used to, for example after its domain
+// was parked.
+const EventContentChanged = "content_changed"
+
+// fingerprintPrefixBytes is how much of a UI body is kept for its
+// fingerprint. The body itself is never stored.
+const fingerprintPrefixBytes = 8 << 10
+
+// fingerprintSampleBytes is how much of the normalized body is hashed when
+// the page has no title.
+const fingerprintSampleBytes = 512
+
+var titlePattern = regexp.MustCompile(`(?is)<title[^>]*>(.*?)</title>`)
+
+// fingerprinter is an io.Writer that keeps the start of a body and discards
+// the rest.
+type fingerprinter struct {
+	head []byte
+}
+
+func (f *fingerprinter) Write(p []byte) (int, error) {
+	if room := fingerprintPrefixBytes - len(f.head); room > 0 {
+		f.head = append(f.head, p[:min(room, len(p))]...)
+	}
+	return len(p), nil
+}
+
+// contentFingerprint identifies a page cheaply: the bucket of its size, each
+// twice as large as the previous, and a hash of its <title>, or of its
+// first bytes with whitespace collapsed if it has none.
+func contentFingerprint(head []byte, size int64) string {
+	sample := head
+	if match := titlePattern.FindSubmatch(head); match != nil {
+		sample = match[1]
+	}
+	normalized := strings.Join(strings.Fields(string(sample)), " ")
+	if len(normalized) > fingerprintSampleBytes {
+		normalized = normalized[:fingerprintSampleBytes]
+	}
+
+	hash := fnv.New64a()
+	hash.Write([]byte(normalized))
+	return fmt.Sprintf("%d-%016x", bits.Len64(uint64(size)), hash.Sum64())
+}
+
+// updateContent compares the fingerprint of a check with the one the
+// instance is known to serve, which is the first one seen until a change is
+// acknowledged. The instance is flagged once the same new fingerprint was
+// seen for ContentChangeChecks checks in a row, and unflagged if the known
+// one comes back. It returns the event to send, if any. The caller holds the
+// instance lock.
+func (m *Monitor) updateContent(instance *Instance, check Check) *NotificationEvent {
+	threshold := m.config.ContentChangeChecks
+	if threshold < 1 || check.Fingerprint == "" {
+		return nil
+	}
+
+	switch {
+	case instance.contentBaseline == "":
+		instance.contentBaseline = check.Fingerprint
+	case check.Fingerprint == instance.contentBaseline:
+		instance.contentCandidate = ""
+		instance.contentMismatches = 0
+		instance.contentChanged = false
+	case check.Fingerprint != instance.contentCandidate:
+		instance.contentCandidate = check.Fingerprint
+		instance.contentMismatches = 1
+	default:
+		instance.contentMismatches++
+	}
+
+	if instance.contentChanged || instance.contentCandidate == "" || instance.contentMismatches < threshold {
+		return nil
+	}
+	instance.contentChanged = true
+	log.Printf("%s content changed: fingerprint %s for %d checks, was %s",
+		instance.URL, instance.contentCandidate, instance.contentMismatches, instance.contentBaseline)
+
+	if !m.config.ContentChangeNotify {
+		return nil
+	}
+	event := m.newNotificationEvent(instance, EventContentChanged)
+	return &event
+}
+
+// AcknowledgeContent accepts the page an instance serves now as its known
+// content and clears its content_changed flag. It returns false if the
+// instance is not monitored.
+func (m *Monitor) AcknowledgeContent(url string) bool {
+	instance := m.findInstance(url)
+	if instance == nil {
+		return false
+	}
+
+	instance.mu.Lock()
+	if instance.contentCandidate != "" {
+		instance.contentBaseline = instance.contentCandidate
+	}
+	instance.contentCandidate = ""
+	instance.contentMismatches = 0
+	if instance.contentChanged {
+		instance.contentChanged = false
+		instance.modified = time.Now()
+	}
+	instance.mu.Unlock()
+
+	m.broadcastInstance(instance)
+	return true
+}
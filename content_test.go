@@ -0,0 +1,104 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestContentFingerprint(t *testing.T) {
+	page := func(title, body string) []byte {
+		return []byte("<html><head><title>" + title + "</title></head><body>" + body + "</body></html>")
+	}
+
+	same := [][2][]byte{
+		{page("Monochrome", "a"), page("Monochrome", "b")},
+		{page("Monochrome", ""), page("  Monochrome\n", "")},
+		{[]byte("<p>no   title\n here</p>"), []byte("<p>no title here</p>")},
+	}
+	for _, pair := range same {
+		if a, b := contentFingerprint(pair[0], 1000), contentFingerprint(pair[1], 1000); a != b {
+			t.Errorf("%q and %q: fingerprints %s and %s, want the same", pair[0], pair[1], a, b)
+		}
+	}
+
+	base := contentFingerprint(page("Monochrome", ""), 1000)
+	for name, fingerprint := range map[string]string{
+		"parked":       contentFingerprint(page("example.com is for sale", ""), 1000),
+		"much smaller": contentFingerprint(page("Monochrome", ""), 100),
+	} {
+		if fingerprint == base {
+			t.Errorf("%s page has the fingerprint of the original", name)
+		}
+	}
+
+	var f fingerprinter
+	f.Write(make([]byte, fingerprintPrefixBytes+100))
+	if len(f.head) != fingerprintPrefixBytes {
+		t.Errorf("fingerprinter kept %d bytes, want %d", len(f.head), fingerprintPrefixBytes)
+	}
+}
+
+func TestUpdateContent(t *testing.T) {
+	config := DefaultConfig()
+	config.ContentChangeNotify = true
+	instance := &Instance{Group: "g", URL: "https://a.example", InstanceType: InstanceTypeUI}
+	m := NewTestMonitor([]*Instance{instance}, config)
+
+	check := func(fingerprint string) *NotificationEvent {
+		c := Check{Success: true, Fingerprint: fingerprint}
+		instance.Checks = append(instance.Checks, c)
+		return m.updateContent(instance, c)
+	}
+
+	steps := []struct {
+		fingerprint string
+		changed     bool
+		event       bool
+	}{
+		{"a", false, false},
+		{"b", false, false},
+		{"c", false, false}, // a page that differs every time is not flagged
+		{"c", false, false},
+		{"a", false, false},
+		{"p", false, false},
+		{"p", false, false},
+		{"p", true, true},
+		{"p", true, false},
+		{"a", false, false}, // the original page came back
+		{"p", false, false},
+		{"p", false, false},
+		{"p", true, true},
+	}
+	for i, step := range steps {
+		event := check(step.fingerprint)
+		if instance.contentChanged != step.changed || (event != nil) != step.event {
+			t.Fatalf("step %d (%s): changed %v, event %+v; want %v, event %v", i, step.fingerprint, instance.contentChanged, event, step.changed, step.event)
+		}
+		if event != nil && event.Event != EventContentChanged {
+			t.Errorf("step %d: event %s, want %s", i, event.Event, EventContentChanged)
+		}
+	}
+
+	// Acknowledging makes the new page the known one.
+	s := NewServer(m, config)
+	s.config.APIKey = "secret"
+	req := httptest.NewRequest(http.MethodPost, "/api/instances/"+url.PathEscape(instance.URL)+"/content/ack", nil)
+	req.Header.Set("Authorization", "Bearer secret")
+	rec := httptest.NewRecorder()
+	s.SetupRoutes().ServeHTTP(rec, req)
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("ack: status %d, want 204: %s", rec.Code, strings.TrimSpace(rec.Body.String()))
+	}
+	if instance.data().ContentChanged {
+		t.Error("content_changed still set after the ack")
+	}
+	if check("p"); instance.contentChanged || instance.contentBaseline != "p" {
+		t.Errorf("after the ack: changed %v, baseline %q; want the new page accepted", instance.contentChanged, instance.contentBaseline)
+	}
+	if m.AcknowledgeContent("https://missing.example") {
+		t.Error("acknowledged an instance that is not monitored")
+	}
+}
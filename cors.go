@@ -0,0 +1,99 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	corsAllowMethods  = "GET, POST, PATCH, DELETE, OPTIONS"
+	corsAllowHeaders  = "Authorization, Content-Type, X-API-Key, X-Request-ID"
+	corsExposeHeaders = "X-Request-ID, X-Monitor-State, Retry-After, X-Status-Matched-URL, X-Status-Suggestions"
+	corsMaxAge        = 10 * time.Minute
+)
+
+// corsPolicy decides which origins may read /api responses from a browser.
+type corsPolicy struct {
+	any     bool
+	origins map[string]bool
+}
+
+func newCORSPolicy(allowed []string) corsPolicy {
+	p := corsPolicy{origins: make(map[string]bool)}
+	for _, origin := range allowed {
+		if origin == "*" {
+			p.any = true
+			continue
+		}
+		p.origins[strings.ToLower(origin)] = true
+	}
+	return p
+}
+
+// allowOrigin returns the Access-Control-Allow-Origin value for origin, or
+// "" if the origin is not allowed.
+func (p corsPolicy) allowOrigin(origin string) string {
+	if p.origins[strings.ToLower(origin)] {
+		return origin
+	}
+	if p.any {
+		return "*"
+	}
+	return ""
+}
+
+// withCORS adds CORS headers to /api responses and answers preflight
+// requests. Listed origins are echoed back and may send credentials; with *
+// every origin gets a wildcard response without credentials.
+func (s *Server) withCORS(next http.Handler) http.Handler {
+	policy := newCORSPolicy(s.config.AllowedOrigins)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.URL.Path, "/api/") {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		header := w.Header()
+		if len(policy.origins) > 0 {
+			header.Add("Vary", "Origin")
+		}
+
+		allowed := policy.allowOrigin(r.Header.Get("Origin"))
+		if allowed != "" {
+			header.Set("Access-Control-Allow-Origin", allowed)
+			header.Set("Access-Control-Expose-Headers", corsExposeHeaders)
+			if allowed != "*" {
+				header.Set("Access-Control-Allow-Credentials", "true")
+			}
+		}
+
+		if r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != "" {
+			if allowed != "" {
+				header.Set("Access-Control-Allow-Methods", corsAllowMethods)
+				header.Set("Access-Control-Allow-Headers", corsAllowHeaders)
+				header.Set("Access-Control-Max-Age", strconv.Itoa(int(corsMaxAge.Seconds())))
+			}
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// validOrigin reports whether s is * or a bare scheme://host[:port] origin.
+func validOrigin(s string) bool {
+	if s == "*" {
+		return true
+	}
+	u, err := url.Parse(s)
+	if err != nil {
+		return false
+	}
+	return (u.Scheme == "http" || u.Scheme == "https") && u.Host != "" &&
+		u.Path == "" && u.RawQuery == "" && u.Fragment == "" && u.User == nil
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func serveCORS(t *testing.T, allowed []string, method, path, origin string, header map[string]string) *httptest.ResponseRecorder {
+	t.Helper()
+
+	s := newSortTestServer()
+	s.config.AllowedOrigins = allowed
+
+	req := httptest.NewRequest(method, path, nil)
+	if origin != "" {
+		req.Header.Set("Origin", origin)
+	}
+	for name, value := range header {
+		req.Header.Set(name, value)
+	}
+	if path == "/api/stream" {
+		ctx, cancel := context.WithCancel(req.Context())
+		cancel()
+		req = req.WithContext(ctx)
+	}
+
+	rec := httptest.NewRecorder()
+	s.SetupRoutes().ServeHTTP(rec, req)
+	return rec
+}
+
+func TestCORSWildcard(t *testing.T) {
+	for _, path := range []string{"/api/instances", "/api/stats", "/api/meta", "/api/stream", "/api/openapi.json"} {
+		rec := serveCORS(t, []string{"*"}, http.MethodGet, path, "https://anywhere.example", nil)
+
+		if got := rec.Header().Get("Access-Control-Allow-Origin"); got != "*" {
+			t.Errorf("%s: Access-Control-Allow-Origin = %q, want *", path, got)
+		}
+		if got := rec.Header().Get("Access-Control-Allow-Credentials"); got != "" {
+			t.Errorf("%s: Access-Control-Allow-Credentials = %q, want none with a wildcard", path, got)
+		}
+	}
+
+	rec := serveCORS(t, []string{"*"}, http.MethodGet, "/health", "https://anywhere.example", nil)
+	if got := rec.Header().Get("Access-Control-Allow-Origin"); got != "" {
+		t.Errorf("/health: Access-Control-Allow-Origin = %q, want none outside /api", got)
+	}
+}
+
+func TestCORSExactMatch(t *testing.T) {
+	allowed := []string{"https://status.example.com", "https://admin.example.com"}
+
+	for _, path := range []string{"/api/instances", "/api/stream"} {
+		rec := serveCORS(t, allowed, http.MethodGet, path, "https://admin.example.com", nil)
+
+		if got := rec.Header().Get("Access-Control-Allow-Origin"); got != "https://admin.example.com" {
+			t.Errorf("%s: Access-Control-Allow-Origin = %q, want the request origin", path, got)
+		}
+		if got := rec.Header().Get("Access-Control-Allow-Credentials"); got != "true" {
+			t.Errorf("%s: Access-Control-Allow-Credentials = %q, want true", path, got)
+		}
+		if got := rec.Header().Get("Vary"); !strings.Contains(got, "Origin") {
+			t.Errorf("%s: Vary = %q, want Origin", path, got)
+		}
+	}
+
+	// A listed origin is echoed even when * is also allowed.
+	rec := serveCORS(t, []string{"*", "https://admin.example.com"}, http.MethodGet, "/api/stats", "https://admin.example.com", nil)
+	if got := rec.Header().Get("Access-Control-Allow-Origin"); got != "https://admin.example.com" {
+		t.Errorf("Access-Control-Allow-Origin = %q, want the request origin", got)
+	}
+}
+
+func TestCORSMismatch(t *testing.T) {
+	allowed := []string{"https://status.example.com"}
+
+	for _, origin := range []string{"https://evil.example", "https://status.example.com.evil.example", ""} {
+		rec := serveCORS(t, allowed, http.MethodGet, "/api/instances", origin, nil)
+
+		if rec.Code != http.StatusOK {
+			t.Errorf("origin %q: status %d, want 200", origin, rec.Code)
+		}
+		for _, name := range []string{"Access-Control-Allow-Origin", "Access-Control-Allow-Credentials"} {
+			if got := rec.Header().Get(name); got != "" {
+				t.Errorf("origin %q: %s = %q, want none", origin, name, got)
+			}
+		}
+	}
+}
+
+func TestCORSPreflight(t *testing.T) {
+	allowed := []string{"https://admin.example.com"}
+	preflight := map[string]string{
+		"Access-Control-Request-Method":  http.MethodPatch,
+		"Access-Control-Request-Headers": "authorization, content-type",
+	}
+
+	// Preflights are answered before the API key check.
+	rec := serveCORS(t, allowed, http.MethodOptions, "/api/config", "https://admin.example.com", preflight)
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("status %d, want 204", rec.Code)
+	}
+	if got := rec.Header().Get("Access-Control-Allow-Origin"); got != "https://admin.example.com" {
+		t.Errorf("Access-Control-Allow-Origin = %q", got)
+	}
+	if got := rec.Header().Get("Access-Control-Allow-Methods"); !strings.Contains(got, http.MethodPatch) {
+		t.Errorf("Access-Control-Allow-Methods = %q, want PATCH", got)
+	}
+	if got := rec.Header().Get("Access-Control-Allow-Headers"); !strings.Contains(got, "Authorization") || !strings.Contains(got, "Content-Type") {
+		t.Errorf("Access-Control-Allow-Headers = %q", got)
+	}
+	if got := rec.Header().Get("Access-Control-Max-Age"); got != "600" {
+		t.Errorf("Access-Control-Max-Age = %q, want 600", got)
+	}
+
+	rec = serveCORS(t, allowed, http.MethodOptions, "/api/config", "https://evil.example", preflight)
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("mismatched preflight: status %d, want 204", rec.Code)
+	}
+	for _, name := range []string{"Access-Control-Allow-Origin", "Access-Control-Allow-Methods", "Access-Control-Max-Age"} {
+		if got := rec.Header().Get(name); got != "" {
+			t.Errorf("mismatched preflight: %s = %q, want none", name, got)
+		}
+	}
+}
+
+func TestGetAllowedOrigins(t *testing.T) {
+	t.Setenv("ALLOWED_ORIGINS", "https://a.example/, *, http://localhost:3000, ftp://b.example, https://c.example/path")
+
+	got := getAllowedOrigins(nil)
+	want := []string{"https://a.example", "*", "http://localhost:3000"}
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("getAllowedOrigins = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"sort"
+	"time"
+)
+
+// uptimeDays is how many days of daily uptime are kept per instance.
+const uptimeDays = 90
+
+const dayLayout = "2006-01-02"
+
+// DayStats aggregates the checks of an instance on one day.
+type DayStats struct {
+	Total      int    `json:"total"`
+	Failed     int    `json:"failed"`
+	WorstState string `json:"worst_state"`
+}
+
+// DayUptime is the API representation of a day of checks.
+type DayUptime struct {
+	Date       string  `json:"date"`
+	Total      int     `json:"total"`
+	Failed     int     `json:"failed"`
+	Uptime     float64 `json:"uptime"`
+	WorstState string  `json:"worst_state"`
+}
+
+// DaysSummary condenses the daily uptime of an instance for the instance
+// list and stream events, which would otherwise carry up to 90 days per
+// instance. The days themselves are served by /api/instances/{url}/days.
+type DaysSummary struct {
+	Days     int     `json:"days"`
+	Uptime   float64 `json:"uptime"`
+	DownDays int     `json:"down_days"`
+	Since    string  `json:"since,omitempty"`
+}
+
+// summarizeDays returns the number of days with checks, the uptime over all
+// of their checks, how many of them had a failure and the first of them.
+func summarizeDays(days map[string]DayStats) DaysSummary {
+	summary := DaysSummary{Days: len(days)}
+	total, failed := 0, 0
+	for date, day := range days {
+		total += day.Total
+		failed += day.Failed
+		if day.WorstState == StatusDown {
+			summary.DownDays++
+		}
+		if summary.Since == "" || date < summary.Since {
+			summary.Since = date
+		}
+	}
+	if total > 0 {
+		summary.Uptime = float64(total-failed) / float64(total) * 100
+	}
+	return summary
+}
+
+// recordDay adds check to the day it was taken on in loc and drops days older
+// than uptimeDays. The caller must hold instance.mu.
+func (instance *Instance) recordDay(check Check, loc *time.Location) {
+	if instance.Days == nil {
+		instance.Days = make(map[string]DayStats)
+	}
+
+	taken := check.Timestamp.In(loc)
+	key := taken.Format(dayLayout)
+
+	day := instance.Days[key]
+	day.Total++
+	if check.Success {
+		if day.WorstState == "" {
+			day.WorstState = StatusUp
+		}
+	} else {
+		day.Failed++
+		day.WorstState = StatusDown
+	}
+	instance.Days[key] = day
+
+	cutoff := taken.AddDate(0, 0, -(uptimeDays - 1)).Format(dayLayout)
+	for date := range instance.Days {
+		if date < cutoff {
+			delete(instance.Days, date)
+		}
+	}
+}
+
+// dayUptimes returns days in date order.
+func dayUptimes(days map[string]DayStats) []DayUptime {
+	result := make([]DayUptime, 0, len(days))
+	for date, day := range days {
+		uptime := 0.0
+		if day.Total > 0 {
+			uptime = float64(day.Total-day.Failed) / float64(day.Total) * 100
+		}
+		result = append(result, DayUptime{
+			Date:       date,
+			Total:      day.Total,
+			Failed:     day.Failed,
+			Uptime:     uptime,
+			WorstState: day.WorstState,
+		})
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Date < result[j].Date
+	})
+	return result
+}
+
+// InstanceDays returns the daily uptime of the instance with the given URL,
+// or false if it is not monitored.
+func (m *Monitor) InstanceDays(url string) ([]DayUptime, bool) {
+	instance := m.findInstance(url)
+	if instance == nil {
+		return nil, false
+	}
+
+	instance.mu.RLock()
+	defer instance.mu.RUnlock()
+
+	return dayUptimes(instance.Days), true
+}
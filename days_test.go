@@ -0,0 +1,93 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRecordDayMidnightUTC(t *testing.T) {
+	instance := &Instance{}
+	midnight := time.Date(2026, 3, 10, 0, 0, 0, 0, time.UTC)
+
+	instance.recordDay(Check{Timestamp: midnight.Add(-time.Nanosecond), Success: false}, time.UTC)
+	instance.recordDay(Check{Timestamp: midnight, Success: true}, time.UTC)
+	instance.recordDay(Check{Timestamp: midnight.Add(time.Minute), Success: true}, time.UTC)
+
+	want := map[string]DayStats{
+		"2026-03-09": {Total: 1, Failed: 1, WorstState: StatusDown},
+		"2026-03-10": {Total: 2, Failed: 0, WorstState: StatusUp},
+	}
+	if len(instance.Days) != len(want) {
+		t.Fatalf("days = %+v, want %+v", instance.Days, want)
+	}
+	for date, day := range want {
+		if instance.Days[date] != day {
+			t.Errorf("day %s = %+v, want %+v", date, instance.Days[date], day)
+		}
+	}
+}
+
+func TestRecordDayTimezone(t *testing.T) {
+	loc := time.FixedZone("UTC+2", 2*60*60)
+	instance := &Instance{}
+
+	// 23:30 UTC on the 9th is already the 10th two hours east.
+	instance.recordDay(Check{Timestamp: time.Date(2026, 3, 9, 21, 59, 0, 0, time.UTC), Success: true}, loc)
+	instance.recordDay(Check{Timestamp: time.Date(2026, 3, 9, 23, 30, 0, 0, time.UTC), Success: true}, loc)
+
+	if got := instance.Days["2026-03-09"].Total; got != 1 {
+		t.Errorf("2026-03-09 total = %d, want 1", got)
+	}
+	if got := instance.Days["2026-03-10"].Total; got != 1 {
+		t.Errorf("2026-03-10 total = %d, want 1", got)
+	}
+}
+
+func TestRecordDayWorstStateSticks(t *testing.T) {
+	instance := &Instance{}
+	start := time.Date(2026, 3, 10, 8, 0, 0, 0, time.UTC)
+
+	instance.recordDay(Check{Timestamp: start, Success: false}, time.UTC)
+	instance.recordDay(Check{Timestamp: start.Add(time.Hour), Success: true}, time.UTC)
+
+	if got := instance.Days["2026-03-10"].WorstState; got != StatusDown {
+		t.Errorf("worst state = %q, want %q", got, StatusDown)
+	}
+}
+
+func TestRecordDayKeepsNinetyDays(t *testing.T) {
+	instance := &Instance{}
+	start := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	for i := 0; i < uptimeDays+5; i++ {
+		instance.recordDay(Check{Timestamp: start.AddDate(0, 0, i), Success: true}, time.UTC)
+	}
+
+	if len(instance.Days) != uptimeDays {
+		t.Fatalf("kept %d days, want %d", len(instance.Days), uptimeDays)
+	}
+
+	days := dayUptimes(instance.Days)
+	if first := start.AddDate(0, 0, 5).Format(dayLayout); days[0].Date != first {
+		t.Errorf("oldest day = %s, want %s", days[0].Date, first)
+	}
+	if days[0].Uptime != 100 {
+		t.Errorf("uptime = %v, want 100", days[0].Uptime)
+	}
+}
+
+func TestSummarizeDays(t *testing.T) {
+	if got := summarizeDays(nil); got != (DaysSummary{}) {
+		t.Errorf("summary of no days = %+v, want zero", got)
+	}
+
+	days := map[string]DayStats{
+		"2026-03-10": {Total: 4, Failed: 0, WorstState: StatusUp},
+		"2026-03-08": {Total: 4, Failed: 2, WorstState: StatusDown},
+		"2026-03-09": {Total: 2, Failed: 0, WorstState: StatusUp},
+	}
+	want := DaysSummary{Days: 3, Uptime: 80, DownDays: 1, Since: "2026-03-08"}
+	if got := summarizeDays(days); got != want {
+		t.Errorf("summary = %+v, want %+v", got, want)
+	}
+}
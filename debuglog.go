@@ -0,0 +1,72 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// debugBodyBytes is how much of a failed check's response body is logged
+// with LOG_HTTP_BODIES.
+const debugBodyBytes = 200
+
+// redactedHeaders are logged without their values.
+var redactedHeaders = map[string]bool{
+	"Authorization":       true,
+	"Proxy-Authorization": true,
+	"Cookie":              true,
+	"Set-Cookie":          true,
+	"X-Api-Key":           true,
+}
+
+// headerSummary formats headers on one line, sorted by name, with
+// credentials redacted.
+func headerSummary(header http.Header) string {
+	names := make([]string, 0, len(header))
+	for name := range header {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	parts := make([]string, 0, len(names))
+	for _, name := range names {
+		value := strings.Join(header[name], ", ")
+		if redactedHeaders[http.CanonicalHeaderKey(name)] {
+			value = "[redacted]"
+		}
+		parts = append(parts, name+": "+value)
+	}
+	return strings.Join(parts, "; ")
+}
+
+// logExchange logs the headers of a check request and its response at
+// debug level, and with LOG_HTTP_BODIES the start of the body of a failed
+// response. head is the start of the body if it was already read, for UI
+// checks; otherwise it is read from resp. resp is nil if the request failed.
+func (m *Monitor) logExchange(req *http.Request, resp *http.Response, check Check, head []byte) {
+	log.Printf("Check %s request_id=%s: request headers: %s", req.URL, check.RequestID, headerSummary(req.Header))
+	if resp == nil {
+		log.Printf("Check %s request_id=%s: no response: %s", req.URL, check.RequestID, check.Error)
+		return
+	}
+	log.Printf("Check %s request_id=%s: %s, response headers: %s", req.URL, check.RequestID, resp.Status, headerSummary(resp.Header))
+
+	if !m.config.LogHTTPBodies || (resp.StatusCode >= 200 && resp.StatusCode < 300) {
+		return
+	}
+	if head == nil {
+		head, _ = io.ReadAll(io.LimitReader(resp.Body, debugBodyBytes))
+	}
+	log.Printf("Check %s request_id=%s: body: %s", req.URL, check.RequestID, bodySnippet(head))
+}
+
+// bodySnippet quotes the first debugBodyBytes of a body for the log.
+func bodySnippet(body []byte) string {
+	if len(body) > debugBodyBytes {
+		return fmt.Sprintf("%q...", body[:debugBodyBytes])
+	}
+	return fmt.Sprintf("%q", body)
+}
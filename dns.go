@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	IPFamilyAuto = "auto"
+	IPFamilyV4   = "ipv4"
+	IPFamilyV6   = "ipv6"
+	IPFamilyDual = "dual"
+)
+
+// newCheckTransports builds one transport per address family for instance
+// checks. All of them resolve through resolver.
+func newCheckTransports(resolver *net.Resolver) map[string]*http.Transport {
+	return map[string]*http.Transport{
+		IPFamilyAuto: newCheckTransport(resolver, "tcp"),
+		IPFamilyV4:   newCheckTransport(resolver, "tcp4"),
+		IPFamilyV6:   newCheckTransport(resolver, "tcp6"),
+	}
+}
+
+// newCheckTransport builds a transport that only dials the given network
+// ("tcp", "tcp4" or "tcp6").
+func newCheckTransport(resolver *net.Resolver, network string) *http.Transport {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+
+	dialer := &net.Dialer{
+		Timeout:   30 * time.Second,
+		KeepAlive: 30 * time.Second,
+		Resolver:  resolver,
+	}
+	transport.DialContext = func(ctx context.Context, _, address string) (net.Conn, error) {
+		return dialer.DialContext(ctx, network, address)
+	}
+
+	return transport
+}
+
+// newResolver returns a resolver that sends queries to the given servers in
+// round-robin order, or the system resolver if no servers are configured.
+func newResolver(servers []string) *net.Resolver {
+	if len(servers) == 0 {
+		return net.DefaultResolver
+	}
+
+	var next atomic.Uint32
+	return &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, address string) (net.Conn, error) {
+			server := servers[int(next.Add(1)-1)%len(servers)]
+			var d net.Dialer
+			return d.DialContext(ctx, network, server)
+		},
+	}
+}
+
+// addrIP returns the IP address of a TCP connection's address, or an empty
+// string for other addresses.
+func addrIP(addr net.Addr) string {
+	tcpAddr, ok := addr.(*net.TCPAddr)
+	if !ok {
+		return ""
+	}
+	return tcpAddr.IP.String()
+}
+
+func addrFamily(addr net.Addr) string {
+	tcpAddr, ok := addr.(*net.TCPAddr)
+	if !ok {
+		return ""
+	}
+	if tcpAddr.IP.To4() != nil {
+		return IPFamilyV4
+	}
+	return IPFamilyV6
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"net"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// dualStackCheck checks the instance over both IPv4 and IPv6 when it has
+// both A and AAAA records, and over whatever is available otherwise.
+func (m *Monitor) dualStackCheck(ctx context.Context, checkURL, instanceType string, requiredHeaders map[string]string) Check {
+	start := time.Now()
+
+	hasV4, hasV6 := m.addressFamilies(ctx, checkURL)
+	if !hasV4 || !hasV6 {
+		return m.performCheck(ctx, m.transports[IPFamilyAuto], start, checkURL, instanceType, requiredHeaders)
+	}
+
+	var v4, v6 Check
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		v4 = m.performCheck(ctx, m.transports[IPFamilyV4], start, checkURL, instanceType, requiredHeaders)
+	}()
+	go func() {
+		defer wg.Done()
+		v6 = m.performCheck(ctx, m.transports[IPFamilyV6], start, checkURL, instanceType, requiredHeaders)
+	}()
+	wg.Wait()
+
+	return combineDualStack(v4, v6, m.config.DualStackSuccess)
+}
+
+// combineDualStack merges per-family results. With the "both" policy the
+// check succeeds only if both families succeed, otherwise either is enough.
+// The returned check carries the details of the result that decided it.
+func combineDualStack(v4, v6 Check, policy string) Check {
+	check := v4
+	if policy == "both" {
+		if v4.Success && !v6.Success {
+			check = v6
+		}
+		check.Success = v4.Success && v6.Success
+	} else {
+		if !v4.Success && v6.Success {
+			check = v6
+		}
+		check.Success = v4.Success || v6.Success
+	}
+
+	check.IPFamily = IPFamilyDual
+	check.SuccessV4 = &v4.Success
+	check.SuccessV6 = &v6.Success
+	check.ResponseTimeV4 = v4.ResponseTime
+	check.ResponseTimeV6 = v6.ResponseTime
+	check.ResolvedIPs = append(append([]string{}, v4.ResolvedIPs...), v6.ResolvedIPs...)
+
+	return check
+}
+
+// addressFamilies reports whether the host of rawURL has IPv4 and IPv6
+// addresses.
+func (m *Monitor) addressFamilies(ctx context.Context, rawURL string) (hasV4, hasV6 bool) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return false, false
+	}
+
+	host := u.Hostname()
+	if ip := net.ParseIP(host); ip != nil {
+		return ip.To4() != nil, ip.To4() == nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, m.config.RequestTimeout)
+	defer cancel()
+
+	addrs, err := m.resolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		return false, false
+	}
+
+	for _, addr := range addrs {
+		if addr.IP.To4() != nil {
+			hasV4 = true
+		} else {
+			hasV6 = true
+		}
+	}
+	return hasV4, hasV6
+}
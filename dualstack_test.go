@@ -0,0 +1,95 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestCombineDualStack(t *testing.T) {
+	tests := []struct {
+		policy  string
+		v4, v6  bool
+		success bool
+		fromV6  bool
+	}{
+		{"either", true, true, true, false},
+		{"either", true, false, true, false},
+		{"either", false, true, true, true},
+		{"either", false, false, false, false},
+		{"both", true, true, true, false},
+		{"both", true, false, false, true},
+		{"both", false, true, false, false},
+		{"both", false, false, false, false},
+	}
+
+	for _, tt := range tests {
+		v4 := Check{Success: tt.v4, StatusCode: 204, ResponseTime: 10, ResolvedIPs: []string{"192.0.2.1"}}
+		v6 := Check{Success: tt.v6, StatusCode: 206, ResponseTime: 20, ResolvedIPs: []string{"2001:db8::1"}}
+		if !tt.v4 {
+			v4.Error = "v4 failed"
+		}
+		if !tt.v6 {
+			v6.Error = "v6 failed"
+		}
+
+		check := combineDualStack(v4, v6, tt.policy)
+		if check.Success != tt.success {
+			t.Errorf("%s v4=%v v6=%v: success %v, want %v", tt.policy, tt.v4, tt.v6, check.Success, tt.success)
+		}
+		wantStatus, wantError := v4.StatusCode, v4.Error
+		if tt.fromV6 {
+			wantStatus, wantError = v6.StatusCode, v6.Error
+		}
+		if check.StatusCode != wantStatus || check.Error != wantError {
+			t.Errorf("%s v4=%v v6=%v: details %d %q, want %d %q", tt.policy, tt.v4, tt.v6, check.StatusCode, check.Error, wantStatus, wantError)
+		}
+		if check.SuccessV4 == nil || *check.SuccessV4 != tt.v4 || check.SuccessV6 == nil || *check.SuccessV6 != tt.v6 {
+			t.Errorf("%s v4=%v v6=%v: per-family success %v %v", tt.policy, tt.v4, tt.v6, check.SuccessV4, check.SuccessV6)
+		}
+		if check.IPFamily != IPFamilyDual || check.ResponseTimeV4 != 10 || check.ResponseTimeV6 != 20 || len(check.ResolvedIPs) != 2 {
+			t.Errorf("%s v4=%v v6=%v: got %+v", tt.policy, tt.v4, tt.v6, check)
+		}
+	}
+}
+
+func TestAddressFamilies(t *testing.T) {
+	m := NewTestMonitor(nil, nil)
+	tests := []struct {
+		url          string
+		hasV4, hasV6 bool
+	}{
+		{"https://192.0.2.1/", true, false},
+		{"https://[2001:db8::1]:8443/", false, true},
+		{"://invalid", false, false},
+	}
+
+	for _, tt := range tests {
+		hasV4, hasV6 := m.addressFamilies(context.Background(), tt.url)
+		if hasV4 != tt.hasV4 || hasV6 != tt.hasV6 {
+			t.Errorf("%s: %v %v, want %v %v", tt.url, hasV4, hasV6, tt.hasV4, tt.hasV6)
+		}
+	}
+}
+
+func TestCheckTransportNetwork(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+	if !strings.HasPrefix(server.URL, "http://127.0.0.1:") {
+		t.Skipf("test server is not on IPv4: %s", server.URL)
+	}
+
+	transports := newCheckTransports(newResolver(nil))
+	for family, wantOK := range map[string]bool{IPFamilyAuto: true, IPFamilyV4: true, IPFamilyV6: false} {
+		client := &http.Client{Transport: transports[family]}
+		resp, err := client.Get(server.URL)
+		if err == nil {
+			resp.Body.Close()
+		}
+		if (err == nil) != wantOK {
+			t.Errorf("%s transport to an IPv4 address: error %v, want success %v", family, err, wantOK)
+		}
+	}
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// shape replaces the leaves of a decoded document with their kind, keeping
+// map keys and array lengths, so documents in different formats can be
+// compared field by field.
+func shape(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(v))
+		for key, value := range v {
+			out[key] = shape(value)
+		}
+		return out
+	case []interface{}:
+		out := make([]interface{}, len(v))
+		for i, value := range v {
+			out[i] = shape(value)
+		}
+		return out
+	case nil:
+		return "null"
+	default:
+		return "value"
+	}
+}
+
+func decodeMsgpack(t *testing.T, data []byte, v interface{}) {
+	t.Helper()
+
+	dec := msgpack.NewDecoder(bytes.NewReader(data))
+	dec.SetCustomStructTag("json")
+	if err := dec.Decode(v); err != nil {
+		t.Fatalf("failed to decode msgpack: %v", err)
+	}
+}
+
+func getInstances(t *testing.T, s *Server, query, accept string) *httptest.ResponseRecorder {
+	t.Helper()
+
+	req := httptest.NewRequest(http.MethodGet, "/api/instances"+query, nil)
+	if accept != "" {
+		req.Header.Set("Accept", accept)
+	}
+	rec := httptest.NewRecorder()
+	s.handleInstances(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("GET %s: status %d", query, rec.Code)
+	}
+	return rec
+}
+
+func TestInstancesMsgpackParity(t *testing.T) {
+	s := newSortTestServer()
+
+	jsonRec := getInstances(t, s, "", "")
+	if ct := jsonRec.Header().Get("Content-Type"); ct != "application/json" {
+		t.Errorf("Content-Type = %q, want application/json", ct)
+	}
+	var jsonDoc interface{}
+	if err := json.Unmarshal(jsonRec.Body.Bytes(), &jsonDoc); err != nil {
+		t.Fatalf("failed to decode JSON: %v", err)
+	}
+	var want []InstanceData
+	json.Unmarshal(jsonRec.Body.Bytes(), &want)
+
+	for _, tt := range []struct {
+		name, query, accept string
+	}{
+		{"accept header", "", "application/x-msgpack"},
+		{"format parameter", "?format=msgpack", ""},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := getInstances(t, s, tt.query, tt.accept)
+			if ct := rec.Header().Get("Content-Type"); ct != "application/x-msgpack" {
+				t.Errorf("Content-Type = %q, want application/x-msgpack", ct)
+			}
+			if vary := rec.Header().Get("Vary"); !strings.Contains(vary, "Accept") {
+				t.Errorf("Vary = %q, want Accept", vary)
+			}
+
+			var doc interface{}
+			decodeMsgpack(t, rec.Body.Bytes(), &doc)
+			if !reflect.DeepEqual(shape(doc), shape(jsonDoc)) {
+				t.Errorf("msgpack fields differ from JSON:\n got %v\nwant %v", shape(doc), shape(jsonDoc))
+			}
+
+			var got []InstanceData
+			decodeMsgpack(t, rec.Body.Bytes(), &got)
+			if len(got) != len(want) {
+				t.Fatalf("got %d instances, want %d", len(got), len(want))
+			}
+			for i := range want {
+				g, w := got[i], want[i]
+				if g.URL != w.URL || g.Group != w.Group || g.Uptime != w.Uptime || len(g.Checks) != len(w.Checks) {
+					t.Errorf("instance %d = %+v, want %+v", i, g, w)
+				}
+				for j := range w.Checks {
+					if !g.Checks[j].Timestamp.Equal(w.Checks[j].Timestamp) || g.Checks[j].ResponseTime != w.Checks[j].ResponseTime {
+						t.Errorf("instance %d check %d = %+v, want %+v", i, j, g.Checks[j], w.Checks[j])
+					}
+				}
+			}
+		})
+	}
+
+	// The parameter wins over the Accept header.
+	if ct := getInstances(t, s, "?format=json", "application/x-msgpack").Header().Get("Content-Type"); ct != "application/json" {
+		t.Errorf("format=json with msgpack Accept: Content-Type = %q, want application/json", ct)
+	}
+}
+
+func TestStreamMsgpackFrames(t *testing.T) {
+	m := newSortTestServer().monitor
+	jsonClient := make(chan []byte, 8)
+	m.RegisterClient(jsonClient, StreamFilter{}, "")
+	msgpackClient := make(chan []byte, 8)
+	m.RegisterClient(msgpackClient, StreamFilter{Format: FormatMsgpack}, "")
+
+	m.broadcastInstance(m.instances[0])
+	m.broadcastUpdate()
+
+	jsonEvents, jsonData := readFrames(t, jsonClient)
+	events, data := readFrames(t, msgpackClient)
+	if !reflect.DeepEqual(events, jsonEvents) {
+		t.Fatalf("msgpack events = %v, want %v", events, jsonEvents)
+	}
+
+	for i := range events {
+		raw, err := base64.StdEncoding.DecodeString(string(data[i]))
+		if err != nil {
+			t.Fatalf("%s: data is not base64: %v", events[i], err)
+		}
+		var doc, jsonDoc interface{}
+		decodeMsgpack(t, raw, &doc)
+		if err := json.Unmarshal(jsonData[i], &jsonDoc); err != nil {
+			t.Fatalf("%s: failed to decode JSON: %v", events[i], err)
+		}
+		if !reflect.DeepEqual(shape(doc), shape(jsonDoc)) {
+			t.Errorf("%s: msgpack fields differ from JSON:\n got %v\nwant %v", events[i], shape(doc), shape(jsonDoc))
+		}
+	}
+}
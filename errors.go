@@ -0,0 +1,103 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"net"
+	"regexp"
+	"strings"
+	"syscall"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Machine-readable categories for failed checks.
+const (
+	ErrorTypeTimeout           = "timeout"
+	ErrorTypeDNS               = "dns"
+	ErrorTypeConnectionRefused = "connection_refused"
+	ErrorTypeTLS               = "tls"
+	ErrorTypeHTTP              = "http_error"
+	ErrorTypeBodyValidation    = "body_validation"
+	ErrorTypeOther             = "other"
+)
+
+// classifyError maps a transport error to an error type by unwrapping the
+// error chain.
+func classifyError(err error) string {
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		return ErrorTypeDNS
+	}
+
+	var unknownAuthority x509.UnknownAuthorityError
+	var hostnameErr x509.HostnameError
+	var invalidCert x509.CertificateInvalidError
+	var verifyErr *tls.CertificateVerificationError
+	var recordErr tls.RecordHeaderError
+	var alertErr tls.AlertError
+	if errors.As(err, &unknownAuthority) || errors.As(err, &hostnameErr) ||
+		errors.As(err, &invalidCert) || errors.As(err, &verifyErr) ||
+		errors.As(err, &recordErr) || errors.As(err, &alertErr) {
+		return ErrorTypeTLS
+	}
+
+	if errors.Is(err, syscall.ECONNREFUSED) {
+		return ErrorTypeConnectionRefused
+	}
+
+	if errors.Is(err, context.DeadlineExceeded) {
+		return ErrorTypeTimeout
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return ErrorTypeTimeout
+	}
+
+	return ErrorTypeOther
+}
+
+// countErrorTypes returns the number of failed checks per error type.
+func countErrorTypes(checks []Check) map[string]int {
+	counts := make(map[string]int)
+	for _, check := range checks {
+		if check.Success || check.ErrorType == "" {
+			continue
+		}
+		counts[check.ErrorType] += check.weight() - check.successes()
+	}
+	return counts
+}
+
+// urlUserinfo matches the userinfo of URLs embedded in error messages.
+var urlUserinfo = regexp.MustCompile(`([a-zA-Z][a-zA-Z0-9+.-]*://)[^/?#\s"'@]+@`)
+
+// sanitizeError makes an error message safe to store and pass on: URL
+// userinfo is redacted, control characters such as newlines become spaces,
+// runs of whitespace are collapsed and the result is cut to maxLen runes.
+func sanitizeError(msg string, maxLen int) string {
+	msg = urlUserinfo.ReplaceAllString(msg, "${1}REDACTED@")
+
+	var b strings.Builder
+	space := false
+	for _, r := range msg {
+		if unicode.IsControl(r) || unicode.IsSpace(r) {
+			space = true
+			continue
+		}
+		if space && b.Len() > 0 {
+			b.WriteByte(' ')
+		}
+		space = false
+		b.WriteRune(r)
+	}
+	msg = b.String()
+
+	if maxLen > 0 && utf8.RuneCountInString(msg) > maxLen {
+		runes := []rune(msg)
+		msg = string(runes[:maxLen-1]) + "…"
+	}
+	return msg
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// Colors of badges and the favicon.
+const (
+	colorUp      = "#22c55e"
+	colorPartial = "#eab308"
+	colorDown    = "#ef4444"
+	colorUnknown = "#6b7280"
+)
+
+// statusColor is the color of an instance status.
+func statusColor(status string) string {
+	switch status {
+	case StatusUp:
+		return colorUp
+	case StatusDown:
+		return colorDown
+	default:
+		return colorUnknown
+	}
+}
+
+// fleetColor is green when every checked instance is up, red when none is
+// and yellow in between. It is gray until something has been checked.
+func fleetColor(state string, stats Stats) string {
+	switch {
+	case state == StateStarting || stats.UpInstances+stats.DownInstances == 0:
+		return colorUnknown
+	case stats.DownInstances == 0:
+		return colorUp
+	case stats.UpInstances == 0:
+		return colorDown
+	default:
+		return colorPartial
+	}
+}
+
+func generateFavicon(color string) string {
+	return fmt.Sprintf(`<svg xmlns="http://www.w3.org/2000/svg" width="16" height="16" viewBox="0 0 16 16"><circle cx="8" cy="8" r="7" fill="%s"/></svg>`, color)
+}
+
+// faviconCacheSeconds is short so that a pinned tab picks up changes even
+// without the dashboard's cache-busting parameter.
+const faviconCacheSeconds = 10
+
+// faviconKey caches the favicon with the badges. Badge keys always contain
+// a "?", so it cannot collide with one.
+const faviconKey = "favicon"
+
+func (s *Server) handleFavicon(w http.ResponseWriter, r *http.Request) {
+	version := s.monitor.DataVersion()
+	icon, ok := s.badges.get(faviconKey, version)
+	if !ok {
+		color := fleetColor(s.monitor.State(), s.monitor.Stats())
+		icon = newCachedBadge(http.StatusOK, generateFavicon(color))
+		s.badges.put(faviconKey, version, icon)
+	}
+
+	writeSVG(w, r, icon, faviconCacheSeconds)
+}
+
+// writeSVG sends a rendered badge or icon, or 304 if the client has it.
+func writeSVG(w http.ResponseWriter, r *http.Request, svg cachedBadge, maxAge int) {
+	w.Header().Set("Content-Type", "image/svg+xml")
+	if maxAge > 0 {
+		w.Header().Set("Cache-Control", fmt.Sprintf("public, max-age=%d", maxAge))
+	} else {
+		w.Header().Set("Cache-Control", "no-cache")
+	}
+	w.Header().Set("ETag", svg.etag)
+
+	if svg.status == http.StatusOK && r.Header.Get("If-None-Match") == svg.etag {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	w.WriteHeader(svg.status)
+	w.Write(svg.body)
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"encoding/json"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func FuzzExtractOrderFromJSON(f *testing.F) {
+	for _, seed := range []string{
+		`{"api": {"b": {}, "a": {}}, "ui": {"c": []}}`,
+		`{"api": {"b": {}, "a": {}`,
+		`{"api": {"a": {"b": {"c": {"d": {"e": {}}}}}}, "ui": {"x": [[[[]]]]}}`,
+		`{"api": {"a}": "{", "b": "\"}"}}`,
+		`{"api": 1, "api": {"z": 0}}`,
+		`{"api": {"a": 1, "a": 2}}`,
+		`[{"api": {"a": 1}}]`,
+		`{"api": {"a": 1}} trailing`,
+		``,
+	} {
+		f.Add(seed, "api")
+	}
+
+	f.Fuzz(func(t *testing.T, body, section string) {
+		got := extractOrderFromJSON(body, section)
+		if got == nil {
+			t.Fatal("extractOrderFromJSON returned nil")
+		}
+		seen := make(map[string]bool)
+		for _, key := range got {
+			if seen[key] {
+				t.Fatalf("key %q returned twice: %q", key, got)
+			}
+			seen[key] = true
+		}
+
+		// For a valid document the keys are the ones json.Unmarshal finds.
+		var top map[string]json.RawMessage
+		if json.Unmarshal([]byte(body), &top) != nil {
+			return
+		}
+		var object map[string]json.RawMessage
+		if json.Unmarshal(top[section], &object) != nil || object == nil {
+			return
+		}
+		want := make([]string, 0, len(object))
+		for key := range object {
+			want = append(want, key)
+		}
+		sorted := append([]string(nil), got...)
+		sort.Strings(sorted)
+		sort.Strings(want)
+		if strings.Join(sorted, "\x00") != strings.Join(want, "\x00") {
+			t.Fatalf("extractOrderFromJSON(%q, %q) = %q, want the keys %q", body, section, got, want)
+		}
+	})
+}
@@ -0,0 +1,107 @@
+package main
+
+import "slices"
+
+// GroupMeta describes a group of instances, from the "meta" object of the
+// group in the instances JSON.
+type GroupMeta struct {
+	Description string `json:"description,omitempty"`
+	Owner       string `json:"owner,omitempty"`
+	DocsURL     string `json:"docs_url,omitempty"`
+}
+
+// GroupInfo summarizes a group. API and UI groups with the same name are
+// the same group.
+type GroupInfo struct {
+	Name  string     `json:"name"`
+	Meta  *GroupMeta `json:"meta,omitempty"`
+	Types []string   `json:"types"`
+	TypeStats
+}
+
+// Groups returns every group in display order, with the status of its
+// instances.
+func (m *Monitor) Groups() []GroupInfo {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	groups := []GroupInfo{}
+	index := make(map[string]int)
+	for _, instance := range m.instances {
+		instance.mu.RLock()
+		name, instanceType := instance.Group, instance.InstanceType
+		status := instanceStatus(instance.Checks)
+		instance.mu.RUnlock()
+
+		i, ok := index[name]
+		if !ok {
+			i = len(groups)
+			index[name] = i
+			info := GroupInfo{Name: name, Types: []string{}}
+			if meta, ok := m.groupMeta[name]; ok {
+				info.Meta = &meta
+			}
+			groups = append(groups, info)
+		}
+
+		group := &groups[i]
+		if !slices.Contains(group.Types, instanceType) {
+			group.Types = append(group.Types, instanceType)
+		}
+		group.Total++
+		switch status {
+		case StatusUp:
+			group.Up++
+		case StatusDown:
+			group.Down++
+		case StatusPending:
+			group.Pending++
+		}
+	}
+	return groups
+}
+
+// Group returns the group called name, if it has any instances.
+func (m *Monitor) Group(name string) (GroupInfo, bool) {
+	for _, group := range m.Groups() {
+		if group.Name == name {
+			return group, true
+		}
+	}
+	return GroupInfo{}, false
+}
+
+// GroupOrder returns the names of the groups in display order.
+func (m *Monitor) GroupOrder() []string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	names := []string{}
+	for _, instance := range m.instances {
+		instance.mu.RLock()
+		name := instance.Group
+		instance.mu.RUnlock()
+
+		if !slices.Contains(names, name) {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// GroupURLs returns the URLs of the instances in the group called name, in
+// display order.
+func (m *Monitor) GroupURLs(name string) []string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var urls []string
+	for _, instance := range m.instances {
+		instance.mu.RLock()
+		if instance.Group == name {
+			urls = append(urls, instance.URL)
+		}
+		instance.mu.RUnlock()
+	}
+	return urls
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestParseGroupMeta(t *testing.T) {
+	body := []byte(`{
+		"api": {
+			"tidal": {
+				"urls": ["https://api.example"],
+				"meta": {"description": "Tidal proxies", "owner": "team-x", "docs_url": "https://docs.example/tidal", "ownr": "typo"}
+			},
+			"broken": {"urls": ["https://broken.example"], "meta": {"docs_url": "javascript:alert(1)"}}
+		},
+		"ui": {
+			"tidal": {"urls": ["https://ui.example"], "meta": {"owner": "team-y"}},
+			"web": ["https://web.example"]
+		}
+	}`)
+
+	specs, issues, err := parseInstanceList(body)
+	if err != nil {
+		t.Fatalf("parseInstanceList: %v", err)
+	}
+	if len(specs) != 4 {
+		t.Fatalf("%d instances, want 4: %+v", len(specs), specs)
+	}
+
+	want := GroupMeta{Description: "Tidal proxies", Owner: "team-x", DocsURL: "https://docs.example/tidal"}
+	if specs[0].GroupMeta == nil || *specs[0].GroupMeta != want {
+		t.Errorf("api.tidal meta = %+v, want %+v", specs[0].GroupMeta, want)
+	}
+	if specs[1].GroupMeta == nil || specs[1].GroupMeta.DocsURL != "" {
+		t.Errorf("api.broken meta = %+v, want docs_url dropped", specs[1].GroupMeta)
+	}
+	if specs[2].GroupMeta != nil || specs[3].GroupMeta != nil {
+		t.Errorf("ui meta = %+v, %+v, want none", specs[2].GroupMeta, specs[3].GroupMeta)
+	}
+
+	var got []string
+	for _, issue := range issues {
+		got = append(got, issue.String())
+	}
+	for _, line := range []string{
+		`api.tidal.meta: warning: unknown field "ownr"`,
+		`api.broken.meta.docs_url: warning: invalid URL "javascript:alert(1)", ignored`,
+		`ui.tidal.meta: warning: group meta already defined at api.tidal.meta, ignored`,
+	} {
+		if !strings.Contains(strings.Join(got, "\n")+"\n", line+"\n") {
+			t.Errorf("issues have no %q:\n%s", line, strings.Join(got, "\n"))
+		}
+	}
+}
+
+func TestGroupsEndpoint(t *testing.T) {
+	s := newSortTestServer()
+	s.monitor.groupMeta = map[string]GroupMeta{"alpha": {Description: "Alpha instances", Owner: "team-a"}}
+	s.monitor.instances = append(s.monitor.instances,
+		&Instance{Group: "alpha", URL: "https://e.example", InstanceType: "api", Checks: checksWith(0, 1, 100)})
+	handler := s.SetupRoutes()
+
+	rec := serveRoute(t, handler, http.MethodGet, "/api/groups")
+	var groups []GroupInfo
+	if err := json.NewDecoder(rec.Body).Decode(&groups); err != nil {
+		t.Fatalf("failed to decode: %v", err)
+	}
+	if len(groups) != 2 || groups[0].Name != "beta" || groups[1].Name != "alpha" {
+		t.Fatalf("groups = %+v, want beta then alpha", groups)
+	}
+	if groups[0].Meta != nil || groups[0].Total != 2 || groups[0].Up != 1 || groups[0].Down != 1 {
+		t.Errorf("beta = %+v", groups[0])
+	}
+
+	rec = serveRoute(t, handler, http.MethodGet, "/api/groups/alpha")
+	var alpha GroupInfo
+	if err := json.NewDecoder(rec.Body).Decode(&alpha); err != nil {
+		t.Fatalf("failed to decode: %v", err)
+	}
+	if alpha.Meta == nil || alpha.Meta.Owner != "team-a" {
+		t.Errorf("alpha meta = %+v, want owner team-a", alpha.Meta)
+	}
+	if strings.Join(alpha.Types, ",") != "ui,api" || alpha.Total != 3 || alpha.Up != 1 || alpha.Down != 1 || alpha.Pending != 1 {
+		t.Errorf("alpha = %+v", alpha)
+	}
+}
+
+func TestMetaGroupOrder(t *testing.T) {
+	rec := serveRoute(t, newSortTestServer().SetupRoutes(), http.MethodGet, "/api/meta")
+
+	var meta Meta
+	if err := json.NewDecoder(rec.Body).Decode(&meta); err != nil {
+		t.Fatalf("failed to decode: %v", err)
+	}
+	if strings.Join(meta.GroupOrder, ",") != "beta,alpha" {
+		t.Errorf("group_order = %q, want beta,alpha", meta.GroupOrder)
+	}
+}
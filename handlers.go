@@ -1,14 +1,19 @@
 package main
 
 import (
+	"context"
+	"crypto/subtle"
 	"embed"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io/fs"
 	"log"
 	"net/http"
 	"net/url"
+	"strconv"
 	"strings"
+	"sync/atomic"
 	"time"
 )
 
@@ -18,16 +23,54 @@ var staticFiles embed.FS
 type Server struct {
 	monitor *Monitor
 	config  *Config
+
+	clientIPs        clientIPResolver
+	allowlist        ipSet
+	limiter          *rateLimiter
+	instancesLimiter *rateLimiter
+	streams          *streamLimiter
+	badges           *badgeCache
+	deliveries       *deliverySet
+
+	// panics counts handler panics caught by withRecovery. Pages share the
+	// counter of the server whose middleware wraps them.
+	panics *atomic.Uint64
+
+	// basePath is the path a page is mounted under, without the trailing
+	// slash; empty for a single page served at the root.
+	basePath string
 }
 
 func NewServer(monitor *Monitor, config *Config) *Server {
-	return &Server{
+	s := &Server{
 		monitor: monitor,
 		config:  config,
+		clientIPs: clientIPResolver{
+			header:  config.ClientIPHeader,
+			trusted: newIPSet(config.TrustedProxies),
+		},
+		allowlist:  newIPSet(config.RateLimitAllowlist),
+		badges:     newBadgeCache(),
+		deliveries: newDeliverySet(maxWebhookDeliveries),
+		panics:     new(atomic.Uint64),
+	}
+	if config.RateLimitRPS > 0 {
+		s.limiter = newRateLimiter(config.RateLimitRPS, config.RateLimitBurst)
 	}
+	if config.InstancesAPIRateLimitRPS > 0 {
+		s.instancesLimiter = newRateLimiter(config.InstancesAPIRateLimitRPS, config.InstancesAPIRateLimitBurst)
+	}
+	if config.SSEMaxConnectionsPerIP > 0 {
+		s.streams = newStreamLimiter(config.SSEMaxConnectionsPerIP)
+	}
+	return s
+}
+
+func (s *Server) SetupRoutes() http.Handler {
+	return s.withMiddleware(s.routes())
 }
 
-func (s *Server) SetupRoutes() *http.ServeMux {
+func (s *Server) routes() *http.ServeMux {
 	mux := http.NewServeMux()
 
 	staticFS, err := fs.Sub(staticFiles, "static")
@@ -35,114 +78,529 @@ func (s *Server) SetupRoutes() *http.ServeMux {
 		log.Fatal(err)
 	}
 
-	mux.Handle("/", http.FileServer(http.FS(staticFS)))
-	mux.HandleFunc("/api/instances", s.handleInstances)
-	mux.HandleFunc("/api/stats", s.handleStats)
-	mux.HandleFunc("/api/badge/", s.handleBadge)
-	mux.HandleFunc("/api/stream", s.handleSSE)
-	mux.HandleFunc("/health", s.handleHealth)
-
+	mux.HandleFunc("/", allowMethods(s.serveIndex(staticFS, http.FileServer(http.FS(staticFS))), http.MethodGet))
+	mux.HandleFunc("/api/openapi.json", allowMethods(s.serveStatic(staticFS, "openapi.json", "application/json"), http.MethodGet))
+	mux.HandleFunc("/api/docs", allowMethods(s.serveStatic(staticFS, "docs.html", "text/html; charset=utf-8"), http.MethodGet))
+	mux.HandleFunc("/api/instances", allowMethods(s.rateLimitInstances(s.rateLimit(s.handleInstances)), http.MethodGet))
+	mux.HandleFunc("/api/instances/search", allowMethods(s.rateLimit(s.handleSearchInstances), http.MethodGet))
+	mux.HandleFunc("/api/search", allowMethods(s.rateLimit(s.handleSearch), http.MethodGet))
+	mux.HandleFunc("/api/instances/", s.handleInstance)
+	mux.HandleFunc("/api/groups", allowMethods(s.handleGroups, http.MethodGet))
+	mux.HandleFunc("/api/groups/", allowMethods(s.handleGroup, http.MethodGet))
+	mux.HandleFunc("/api/changes", allowMethods(s.rateLimit(s.handleChanges), http.MethodGet))
+	mux.HandleFunc("/api/archive", allowMethods(s.handleArchive, http.MethodGet))
+	mux.HandleFunc("/api/stats", allowMethods(s.rateLimit(s.handleStats), http.MethodGet))
+	mux.HandleFunc("/api/stats/histogram", allowMethods(s.handleFleetHistogram, http.MethodGet))
+	mux.HandleFunc("/api/badge/", allowMethods(s.rateLimit(s.handleBadge), http.MethodGet))
+	mux.HandleFunc("/api/badges", allowMethods(s.rateLimit(s.handleBadges), http.MethodGet))
+	mux.HandleFunc("/api/favicon.svg", allowMethods(s.rateLimit(s.handleFavicon), http.MethodGet))
+	mux.HandleFunc("/api/og-image.svg", allowMethods(s.rateLimit(s.handleOGImage), http.MethodGet))
+	mux.HandleFunc("/api/stream", allowMethods(s.limitStreams(s.handleSSE), http.MethodGet))
+	mux.HandleFunc("/api/meta", allowMethods(s.handleMeta, http.MethodGet))
+	mux.HandleFunc("/api/v2/summary.json", allowMethods(s.handleStatuspageSummary, http.MethodGet))
+	mux.HandleFunc("/metrics", allowMethods(s.handleMetrics, http.MethodGet))
+	mux.HandleFunc("/api/config", allowMethods(s.requireAPIKey(s.handleConfig), http.MethodPatch))
+	mux.HandleFunc("/api/refresh", allowMethods(s.requireAPIKey(s.handleRefresh), http.MethodPost))
+	mux.HandleFunc("/api/schedule", allowMethods(s.requireAPIKey(s.handleSchedule), http.MethodGet))
+	mux.HandleFunc("/api/clients", allowMethods(s.requireAPIKey(s.handleClients), http.MethodGet))
+	mux.HandleFunc("/api/webhook/github", allowMethods(s.handleGitHubWebhook, http.MethodPost))
+	mux.HandleFunc("/health", allowMethods(s.handleHealth, http.MethodGet))
+	mux.HandleFunc("/ready", allowMethods(s.handleReady, http.MethodGet))
 	return mux
 }
 
+// withMiddleware wraps handler in the middleware shared by every route.
+func (s *Server) withMiddleware(handler http.Handler) http.Handler {
+	// Middleware is listed outermost first.
+	middleware := []func(http.Handler) http.Handler{
+		s.withTimeouts,
+		s.withRequestID,
+		s.withClientIP,
+		s.withAccessLog,
+		s.withRecovery,
+		s.withSecurityHeaders,
+		s.withCORS,
+		withHead,
+	}
+
+	for i := len(middleware) - 1; i >= 0; i-- {
+		handler = middleware[i](handler)
+	}
+	return handler
+}
+
+// serveStatic serves a single embedded file under a different path.
+func (s *Server) serveStatic(staticFS fs.FS, name, contentType string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		data, err := fs.ReadFile(staticFS, name)
+		if err != nil {
+			writeJSONError(w, http.StatusNotFound, "not_found", "Not found")
+			return
+		}
+
+		w.Header().Set("Content-Type", contentType)
+		w.Write(data)
+	}
+}
+
 func (s *Server) handleInstances(w http.ResponseWriter, r *http.Request) {
+	w.Header().Add("Vary", "Accept")
+	format, ok := negotiateFormat(r)
+	if !ok {
+		writeJSONError(w, http.StatusBadRequest, "invalid_format", "format must be json or msgpack")
+		return
+	}
+
+	query := r.URL.Query()
+	sortKey := query.Get("sort")
+	if sortKey != "" && !validSortKey(sortKey) {
+		writeJSONError(w, http.StatusBadRequest, "invalid_sort", "Invalid sort")
+		return
+	}
+
+	order := query.Get("order")
+	if order != "" && order != "asc" && order != "desc" {
+		writeJSONError(w, http.StatusBadRequest, "invalid_order", "Invalid order")
+		return
+	}
+
+	w.Header().Set("X-Monitor-State", s.monitor.State())
+
+	data := filterInstanceData(s.monitor.GetInstancesData(), query.Get("type"), query.Get("group"))
+	if sortKey != "" {
+		sortInstanceData(data, sortKey, order == "desc")
+	}
+
+	writeEncoded(w, format, data)
+}
+
+func (s *Server) handleSearchInstances(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	query := r.URL.Query()
+	limit := 50
+	if limitStr := query.Get("limit"); limitStr != "" {
+		parsed, err := strconv.Atoi(limitStr)
+		if err != nil || parsed < 1 {
+			writeJSONError(w, http.StatusBadRequest, "invalid_limit", "Invalid limit")
+			return
+		}
+		limit = parsed
+	}
+
+	w.Header().Set("X-Monitor-State", s.monitor.State())
+	data := s.monitor.SearchInstances(query.Get("q"), query.Get("type"), query.Get("group"), limit)
+	writeJSON(w, data)
+}
+
+func (s *Server) handleSearch(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
-	w.Header().Set("Access-Control-Allow-Origin", "*")
 
-	data := s.monitor.GetInstancesData()
-	json.NewEncoder(w).Encode(data)
+	query := r.URL.Query()
+	limit := 20
+	if limitStr := query.Get("limit"); limitStr != "" {
+		parsed, err := strconv.Atoi(limitStr)
+		if err != nil || parsed < 1 || parsed > maxSearchLimit {
+			writeJSONError(w, http.StatusBadRequest, "invalid_limit", "Invalid limit")
+			return
+		}
+		limit = parsed
+	}
+
+	w.Header().Set("X-Monitor-State", s.monitor.State())
+	writeJSON(w, s.monitor.SearchSummaries(query.Get("q"), limit))
+}
+
+// handleInstance routes the subroutes of /api/instances/, each of which
+// checks its own methods.
+func (s *Server) handleInstance(w http.ResponseWriter, r *http.Request) {
+	instanceURL := strings.TrimPrefix(r.URL.Path, "/api/instances/")
+
+	if resetURL, ok := strings.CutSuffix(instanceURL, "/reset"); ok {
+		allowMethods(s.requireAPIKey(func(w http.ResponseWriter, r *http.Request) {
+			s.handleResetInstance(w, r, resetURL)
+		}), http.MethodPost)(w, r)
+		return
+	}
+	if ackURL, ok := strings.CutSuffix(instanceURL, "/content/ack"); ok {
+		allowMethods(s.requireAPIKey(func(w http.ResponseWriter, r *http.Request) {
+			s.handleAcknowledgeContent(w, r, ackURL)
+		}), http.MethodPost)(w, r)
+		return
+	}
+	if histogramURL, ok := strings.CutSuffix(instanceURL, "/histogram"); ok {
+		allowMethods(func(w http.ResponseWriter, r *http.Request) {
+			s.handleInstanceHistogram(w, r, histogramURL)
+		}, http.MethodGet)(w, r)
+		return
+	}
+	if daysURL, ok := strings.CutSuffix(instanceURL, "/days"); ok {
+		allowMethods(func(w http.ResponseWriter, r *http.Request) {
+			s.handleInstanceDays(w, r, daysURL)
+		}, http.MethodGet)(w, r)
+		return
+	}
+	if historyURL, ok := strings.CutSuffix(instanceURL, "/response-time-history"); ok {
+		allowMethods(func(w http.ResponseWriter, r *http.Request) {
+			s.handleResponseTimeHistory(w, r, historyURL)
+		}, http.MethodGet)(w, r)
+		return
+	}
+
+	if r.Method != http.MethodDelete {
+		writeJSONError(w, http.StatusNotFound, "not_found", "Not found")
+		return
+	}
+	s.requireAPIKey(func(w http.ResponseWriter, r *http.Request) {
+		s.handleDeleteInstance(w, r, instanceURL)
+	})(w, r)
+}
+
+func (s *Server) handleDeleteInstance(w http.ResponseWriter, r *http.Request, instanceURL string) {
+	if !s.monitor.RemoveInstance(instanceURL) {
+		writeJSONError(w, http.StatusNotFound, "instance_not_found", "Instance not found")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) handleResetInstance(w http.ResponseWriter, r *http.Request, instanceURL string) {
+	if err := s.monitor.Reset(instanceURL); errors.Is(err, ErrInstanceNotFound) {
+		writeJSONError(w, http.StatusNotFound, "instance_not_found", "Instance not found")
+		return
+	}
+
+	logRequestf(r, "Check history of %s reset", instanceURL)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) handleAcknowledgeContent(w http.ResponseWriter, r *http.Request, instanceURL string) {
+	if !s.monitor.AcknowledgeContent(instanceURL) {
+		writeJSONError(w, http.StatusNotFound, "instance_not_found", "Instance not found")
+		return
+	}
+
+	logRequestf(r, "Content change of %s acknowledged", instanceURL)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) handleInstanceHistogram(w http.ResponseWriter, r *http.Request, instanceURL string) {
+	since, buckets, ok := parseHistogramQuery(w, r)
+	if !ok {
+		return
+	}
+
+	histogram, found := s.monitor.ResponseTimeHistogram(instanceURL, since, buckets)
+	if !found {
+		writeJSONError(w, http.StatusNotFound, "instance_not_found", "Instance not found")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	writeJSON(w, histogram)
+}
+
+func (s *Server) handleInstanceDays(w http.ResponseWriter, r *http.Request, instanceURL string) {
+	days, found := s.monitor.InstanceDays(instanceURL)
+	if !found {
+		writeJSONError(w, http.StatusNotFound, "instance_not_found", "Instance not found")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	writeJSON(w, days)
+}
+
+func (s *Server) handleResponseTimeHistory(w http.ResponseWriter, r *http.Request, instanceURL string) {
+	window := 24 * time.Hour
+	if windowStr := r.URL.Query().Get("window"); windowStr != "" {
+		parsed, err := time.ParseDuration(windowStr)
+		if err != nil || parsed <= 0 {
+			writeJSONError(w, http.StatusBadRequest, "invalid_window", "Invalid window")
+			return
+		}
+		window = parsed
+	}
+
+	points, found := s.monitor.ResponseTimeHistory(instanceURL, time.Now().Add(-window))
+	if !found {
+		writeJSONError(w, http.StatusNotFound, "instance_not_found", "Instance not found")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	writeJSON(w, points)
+}
+
+func (s *Server) handleFleetHistogram(w http.ResponseWriter, r *http.Request) {
+	since, buckets, ok := parseHistogramQuery(w, r)
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	writeJSON(w, s.monitor.FleetResponseTimeHistogram(since, buckets))
+}
+
+// parseHistogramQuery reads the since (RFC 3339 time or duration ago) and
+// buckets parameters, writing a 400 response if either is invalid.
+func parseHistogramQuery(w http.ResponseWriter, r *http.Request) (time.Time, int, bool) {
+	query := r.URL.Query()
+
+	var since time.Time
+	if sinceStr := query.Get("since"); sinceStr != "" {
+		if t, err := time.Parse(time.RFC3339, sinceStr); err == nil {
+			since = t
+		} else if d, err := time.ParseDuration(sinceStr); err == nil && d > 0 {
+			since = time.Now().Add(-d)
+		} else {
+			writeJSONError(w, http.StatusBadRequest, "invalid_since", "Invalid since")
+			return time.Time{}, 0, false
+		}
+	}
+
+	buckets := defaultHistogramBuckets
+	if bucketsStr := query.Get("buckets"); bucketsStr != "" {
+		parsed, err := strconv.Atoi(bucketsStr)
+		if err != nil || parsed < 1 || parsed > maxHistogramBuckets {
+			writeJSONError(w, http.StatusBadRequest, "invalid_buckets", "Invalid buckets")
+			return time.Time{}, 0, false
+		}
+		buckets = parsed
+	}
+
+	return since, buckets, true
+}
+
+func (s *Server) handleMeta(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	writeJSON(w, s.meta())
 }
 
 func (s *Server) handleStats(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
-	w.Header().Set("Access-Control-Allow-Origin", "*")
 
 	stats := s.monitor.GetStatsData()
-	json.NewEncoder(w).Encode(stats)
+	writeJSON(w, stats)
 }
 
-func (s *Server) handleBadge(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "image/svg+xml")
-	w.Header().Set("Cache-Control", "no-cache, no-store, must-revalidate")
-	w.Header().Set("Access-Control-Allow-Origin", "*")
+func (s *Server) handleGroups(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	writeJSON(w, s.monitor.Groups())
+}
+
+func (s *Server) handleGroup(w http.ResponseWriter, r *http.Request) {
+	group, ok := s.monitor.Group(strings.TrimPrefix(r.URL.Path, "/api/groups/"))
+	if !ok {
+		writeJSONError(w, http.StatusNotFound, "group_not_found", "Group not found")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	writeJSON(w, group)
+}
+
+func (s *Server) handleArchive(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	writeJSON(w, s.monitor.Archive())
+}
+
+func (s *Server) handleChanges(w http.ResponseWriter, r *http.Request) {
+	since, err := strconv.ParseInt(r.URL.Query().Get("since"), 10, 64)
+	if err != nil || since < 0 {
+		writeJSONError(w, http.StatusBadRequest, "invalid_since", "since must be a Unix timestamp in seconds")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	writeJSON(w, s.monitor.ChangesSince(time.Unix(since, 0)))
+}
+
+func (s *Server) handleSchedule(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	writeJSON(w, s.monitor.ScheduleState())
+}
+
+func (s *Server) handleClients(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	writeJSON(w, s.monitor.StreamClients())
+}
+
+func (s *Server) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	metrics := s.monitor.Metrics()
+	metrics.HandlerPanics = s.panics.Load()
+
+	if strings.Contains(r.Header.Get("Accept"), "application/openmetrics-text") {
+		w.Header().Set("Content-Type", "application/openmetrics-text; version=1.0.0; charset=utf-8")
+		if err := metrics.WriteOpenMetrics(w, s.monitor.PrometheusInstanceGauges()); err != nil {
+			logRequestf(r, "Error writing metrics: %v", err)
+		}
+		return
+	}
+	if strings.Contains(r.Header.Get("Accept"), "text/plain") {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		if err := metrics.WritePrometheus(w, s.monitor.PrometheusInstanceGauges()); err != nil {
+			logRequestf(r, "Error writing metrics: %v", err)
+		}
+		return
+	}
 
+	w.Header().Set("Content-Type", "application/json")
+	writeJSON(w, metrics)
+}
+
+// meta is the config's Meta with the group order of the monitor.
+func (s *Server) meta() Meta {
+	meta := s.config.Meta()
+	meta.GroupOrder = s.monitor.GroupOrder()
+	return meta
+}
+
+func (s *Server) handleStatuspageSummary(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	summary := s.monitor.StatuspageSummary(s.pageURL(r))
+	writeJSON(w, summary)
+}
+
+// pageURL is STATUS_PAGE_URL, or else the URL the page was requested at.
+func (s *Server) pageURL(r *http.Request) string {
+	if s.config.StatusPageURL != "" {
+		return s.config.StatusPageURL
+	}
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	return scheme + "://" + r.Host + s.basePath
+}
+
+func (s *Server) handleBadge(w http.ResponseWriter, r *http.Request) {
 	urlPath := strings.TrimPrefix(r.URL.Path, "/api/badge/")
 	instanceURL, err := url.QueryUnescape(urlPath)
 	if err != nil {
-		w.WriteHeader(http.StatusBadRequest)
+		writeJSONError(w, http.StatusBadRequest, "invalid_url", "Instance URL is not validly escaped")
 		return
 	}
 
-	s.monitor.mu.RLock()
-	var instance *Instance
-	for _, inst := range s.monitor.instances {
-		if inst.URL == instanceURL {
-			instance = inst
-			break
-		}
+	badge := s.badge(instanceURL, r.URL.RawQuery)
+	if badge.matchedURL != "" {
+		w.Header().Set("X-Status-Matched-URL", badge.matchedURL)
 	}
-	s.monitor.mu.RUnlock()
+	if len(badge.suggestions) > 0 {
+		w.Header().Set("X-Status-Suggestions", strings.Join(badge.suggestions, ", "))
+	}
+	writeSVG(w, r, badge, s.config.BadgeCacheSeconds)
+}
+
+// badge returns the badge of an instance from the cache, rendering it if
+// the cache has none for the current data.
+func (s *Server) badge(instanceURL, rawQuery string) cachedBadge {
+	key := instanceURL + "?" + rawQuery
+	version := s.monitor.DataVersion()
+	badge, ok := s.badges.get(key, version)
+	if !ok {
+		badge = s.renderBadge(instanceURL)
+		s.badges.put(key, version, badge)
+	}
+	return badge
+}
 
+// renderBadge renders the status badge of an instance. A URL that is not
+// monitored as given is matched ignoring the scheme, trailing slashes and
+// "www.", as embedded badge URLs often differ from the instance list in
+// those.
+func (s *Server) renderBadge(instanceURL string) cachedBadge {
+	var matchedURL string
+	instance := s.monitor.findInstance(instanceURL)
 	if instance == nil {
-		w.WriteHeader(http.StatusNotFound)
-		fmt.Fprint(w, generateBadge("unknown", "not found", "#6b7280"))
-		return
+		var suggestions []string
+		instance, suggestions = s.monitor.matchInstance(instanceURL)
+		if instance == nil {
+			badge := newStatusBadge(http.StatusNotFound, "unknown", "not found", colorUnknown)
+			badge.suggestions = suggestions
+			return badge
+		}
+		matchedURL = instance.URL
+	}
+
+	badge := s.renderInstanceBadge(instance)
+	badge.matchedURL = matchedURL
+	return badge
+}
+
+func (s *Server) renderInstanceBadge(instance *Instance) cachedBadge {
+	if s.monitor.State() == StateStarting {
+		return newStatusBadge(http.StatusOK, "status", "starting", colorUnknown)
 	}
 
 	instance.mu.RLock()
-	uptime := calculateUptime(instance.Checks)
-	isUp := len(instance.Checks) > 0 && instance.Checks[len(instance.Checks)-1].Success
+	uptime := instance.uptimeOver(uptimeAll)
+	state := instanceStatus(instance.Checks)
 	instance.mu.RUnlock()
 
-	var status string
-	var color string
-	if isUp {
+	status := state
+	if state == StatusUp {
 		status = fmt.Sprintf("up %.1f%%", uptime)
-		color = "#22c55e"
-	} else {
-		status = "down"
-		color = "#ef4444"
 	}
 
-	fmt.Fprint(w, generateBadge("status", status, color))
+	return newStatusBadge(http.StatusOK, "status", status, statusColor(state))
 }
 
 func (s *Server) handleSSE(w http.ResponseWriter, r *http.Request) {
+	format, ok := negotiateFormat(r)
+	if !ok {
+		writeJSONError(w, http.StatusBadRequest, "invalid_format", "format must be json or msgpack")
+		return
+	}
+
+	query := r.URL.Query()
+	filter := StreamFilter{Group: query.Get("group"), Type: query.Get("type"), Format: format}
+	if checksStr := query.Get("checks"); checksStr != "" {
+		checks, err := strconv.ParseBool(checksStr)
+		if err != nil {
+			writeJSONError(w, http.StatusBadRequest, "invalid_checks", "checks must be true or false")
+			return
+		}
+		filter.NoChecks = !checks
+	}
+
 	w.Header().Set("Content-Type", "text/event-stream")
 	w.Header().Set("Cache-Control", "no-cache")
 	w.Header().Set("Connection", "keep-alive")
-	w.Header().Set("Access-Control-Allow-Origin", "*")
+
+	if r.Method == http.MethodHead {
+		return
+	}
 
 	flusher, ok := w.(http.Flusher)
 	if !ok {
-		http.Error(w, "Streaming unsupported", http.StatusInternalServerError)
+		writeJSONError(w, http.StatusInternalServerError, "streaming_unsupported", "Streaming unsupported")
 		return
 	}
 
-	messageChan := make(chan []byte, 10)
-	s.monitor.RegisterClient(messageChan)
+	messageChan := make(chan []byte, 64)
+	s.monitor.RegisterClient(messageChan, filter, s.requestClientIP(r).String())
+	// Deferred right away so the client is removed even if the handler
+	// panics; withRecovery only catches the panic further up.
 	defer s.monitor.UnregisterClient(messageChan)
 
-	data := s.monitor.GetInstancesData()
-	stats := s.monitor.GetStatsData()
-	initialUpdate := map[string]interface{}{
-		"instances": data,
-		"stats":     stats,
-		"timestamp": time.Now().Unix(),
-	}
-	initialJSON, _ := json.Marshal(initialUpdate)
-	fmt.Fprintf(w, "data: %s\n\n", initialJSON)
+	initialUpdate := s.monitor.StreamSnapshot(messageChan)
+	initialUpdate["meta"] = s.meta()
+	w.Write(encodeFrame(EventInstanceUpdate, format, initialUpdate))
 	flusher.Flush()
 
-	ticker := time.NewTicker(time.Duration(s.config.SSEKeepaliveSeconds) * time.Second)
+	ticker := time.NewTicker(s.config.CurrentSSEKeepalive())
 	defer ticker.Stop()
 
 	for {
 		select {
 		case <-r.Context().Done():
 			return
-		case msg := <-messageChan:
-			fmt.Fprintf(w, "data: %s\n\n", msg)
+		case frame := <-messageChan:
+			w.Write(frame)
 			flusher.Flush()
 		case <-ticker.C:
 			fmt.Fprintf(w, ":keepalive\n\n")
@@ -151,6 +609,101 @@ func (s *Server) handleSSE(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// requireAPIKey protects admin endpoints. The key can be sent either as a
+// bearer token or in the X-API-Key header.
+func (s *Server) requireAPIKey(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if s.config.APIKey == "" {
+			writeJSONError(w, http.StatusForbidden, "admin_disabled", "Admin API disabled")
+			return
+		}
+
+		key := r.Header.Get("X-API-Key")
+		if auth := r.Header.Get("Authorization"); strings.HasPrefix(auth, "Bearer ") {
+			key = strings.TrimPrefix(auth, "Bearer ")
+		}
+
+		if subtle.ConstantTimeCompare([]byte(key), []byte(s.config.APIKey)) != 1 {
+			writeJSONError(w, http.StatusUnauthorized, "unauthorized", "Unauthorized")
+			return
+		}
+
+		next(w, r)
+	}
+}
+
+func (s *Server) handleRefresh(w http.ResponseWriter, r *http.Request) {
+	logRequestf(r, "Instance list refresh requested via API")
+
+	// Checks of new instances continue after the response is sent.
+	result, err := s.monitor.Refresh(context.WithoutCancel(r.Context()))
+	if errors.Is(err, ErrRefreshInProgress) {
+		writeJSONError(w, http.StatusConflict, "refresh_in_progress", err.Error())
+		return
+	}
+	if err != nil {
+		logRequestf(r, "Error refreshing instances: %v", err)
+		writeJSONError(w, http.StatusBadGateway, "refresh_failed", err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	writeJSON(w, result)
+}
+
+func (s *Server) handleConfig(w http.ResponseWriter, r *http.Request) {
+	var update ConfigUpdate
+	if err := json.NewDecoder(r.Body).Decode(&update); err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			writeJSONError(w, http.StatusRequestEntityTooLarge, "body_too_large", "Request body too large")
+			return
+		}
+		writeJSONError(w, http.StatusBadRequest, "invalid_json", "Invalid JSON body")
+		return
+	}
+
+	if err := s.config.Apply(update); err != nil {
+		writeJSONError(w, http.StatusBadRequest, "invalid_config", err.Error())
+		return
+	}
+	s.monitor.NotifyConfigChanged()
+
+	logRequestf(r, "Configuration updated via API")
+
+	s.config.mu.RLock()
+	current := map[string]interface{}{
+		"check_interval_minutes":            int(s.config.CheckInterval / time.Minute),
+		"instance_refresh_interval_minutes": int(s.config.InstanceRefreshInterval / time.Minute),
+		"instance_refresh_interval_seconds": int(s.config.InstanceRefreshInterval / time.Second),
+		"max_check_history":                 s.config.MaxCheckHistory,
+		"sse_keepalive_seconds":             s.config.SSEKeepaliveSeconds,
+		"log_level":                         s.config.LogLevel,
+		"exclude_urls":                      append([]string{}, s.config.ExcludeURLs...),
+		"exclude_groups":                    append([]string{}, s.config.ExcludeGroups...),
+		"include_only_groups":               append([]string{}, s.config.IncludeOnlyGroups...),
+	}
+	s.config.mu.RUnlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	writeJSON(w, current)
+}
+
+// handleReady reports 503 until the monitor has finished starting up.
+func (s *Server) handleReady(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	state := s.monitor.State()
+	if state != StateRunning {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+
+	writeJSON(w, map[string]interface{}{
+		"state":     state,
+		"timestamp": time.Now().Unix(),
+	})
+}
+
 func (s *Server) handleHealth(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 
@@ -159,39 +712,57 @@ func (s *Server) handleHealth(w http.ResponseWriter, r *http.Request) {
 	s.monitor.mu.RUnlock()
 
 	health := map[string]interface{}{
-		"status":    "healthy",
-		"timestamp": time.Now().Unix(),
-		"instances": instanceCount,
+		"status":         "healthy",
+		"timestamp":      time.Now().Unix(),
+		"instances":      instanceCount,
+		"live_instances": s.monitor.LiveInstances(),
+		"excluded":       s.monitor.Excluded(),
+		"streams":        s.monitor.StreamTotals(),
+		"panics":         s.panics.Load(),
 	}
 
-	json.NewEncoder(w).Encode(health)
+	writeJSON(w, health)
 }
 
 func generateBadge(label, message, color string) string {
+	width := badgeWidth(label, message)
+	return fmt.Sprintf(`<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="20">
+%s
+</svg>`, width, badgeLayers(label, message, color, ""))
+}
+
+// badgeWidth returns the width of the badge showing label and message.
+func badgeWidth(label, message string) int {
+	return len(label)*7 + 10 + len(message)*7 + 10
+}
+
+// badgeLayers renders the contents of a badge. The ids of its gradient and
+// mask end in idSuffix, which must differ between badges drawn in the same
+// SVG.
+func badgeLayers(label, message, color, idSuffix string) string {
 	labelWidth := len(label)*7 + 10
 	messageWidth := len(message)*7 + 10
 	totalWidth := labelWidth + messageWidth
+	b, a := "b"+idSuffix, "a"+idSuffix
 
-	return fmt.Sprintf(`<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="20">
-  <linearGradient id="b" x2="0" y2="100%%">
+	return fmt.Sprintf(`  <linearGradient id="%s" x2="0" y2="100%%">
     <stop offset="0" stop-color="#bbb" stop-opacity=".1"/>
     <stop offset="1" stop-opacity=".1"/>
   </linearGradient>
-  <mask id="a">
+  <mask id="%s">
     <rect width="%d" height="20" rx="3" fill="#fff"/>
   </mask>
-  <g mask="url(#a)">
+  <g mask="url(#%s)">
     <path fill="#555" d="M0 0h%dv20H0z"/>
     <path fill="%s" d="M%d 0h%dv20H%dz"/>
-    <path fill="url(#b)" d="M0 0h%dv20H0z"/>
+    <path fill="url(#%s)" d="M0 0h%dv20H0z"/>
   </g>
   <g fill="#fff" text-anchor="middle" font-family="DejaVu Sans,Verdana,Geneva,sans-serif" font-size="11">
     <text x="%d" y="15" fill="#010101" fill-opacity=".3">%s</text>
     <text x="%d" y="14">%s</text>
     <text x="%d" y="15" fill="#010101" fill-opacity=".3">%s</text>
     <text x="%d" y="14">%s</text>
-  </g>
-</svg>`, totalWidth, totalWidth, labelWidth, color, labelWidth, messageWidth, labelWidth, totalWidth,
+  </g>`, b, a, totalWidth, a, labelWidth, color, labelWidth, messageWidth, labelWidth, b, totalWidth,
 		labelWidth/2, label, labelWidth/2, label,
 		labelWidth+messageWidth/2, message, labelWidth+messageWidth/2, message)
 }
@@ -0,0 +1,396 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func checksWith(successes, failures int, responseTime int64) []Check {
+	checks := make([]Check, 0, successes+failures)
+	for i := 0; i < successes; i++ {
+		checks = append(checks, Check{Timestamp: time.Now(), Success: true, ResponseTime: responseTime})
+	}
+	for i := 0; i < failures; i++ {
+		checks = append(checks, Check{Timestamp: time.Now(), ResponseTime: responseTime})
+	}
+	return checks
+}
+
+func newSortTestServer() *Server {
+	config := DefaultConfig()
+	monitor := NewTestMonitor([]*Instance{
+		{Group: "beta", URL: "https://c.example", InstanceType: "api", GroupOrder: 0, Index: 0, Checks: checksWith(1, 1, 300)},
+		{Group: "beta", URL: "https://a.example", InstanceType: "api", GroupOrder: 0, Index: 1, Checks: checksWith(2, 0, 100)},
+		{Group: "alpha", URL: "https://b.example", InstanceType: "ui", GroupOrder: 1, Index: 0, Checks: checksWith(2, 0, 200)},
+		{Group: "alpha", URL: "https://d.example", InstanceType: "ui", GroupOrder: 1, Index: 1},
+	}, config)
+	return NewServer(monitor, config)
+}
+
+func getInstanceURLs(t *testing.T, s *Server, query string) []string {
+	t.Helper()
+
+	rec := httptest.NewRecorder()
+	s.handleInstances(rec, httptest.NewRequest(http.MethodGet, "/api/instances"+query, nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("GET %s: status %d", query, rec.Code)
+	}
+
+	var data []InstanceData
+	if err := json.NewDecoder(rec.Body).Decode(&data); err != nil {
+		t.Fatalf("GET %s: failed to decode: %v", query, err)
+	}
+
+	urls := make([]string, len(data))
+	for i, d := range data {
+		urls[i] = d.URL
+	}
+	return urls
+}
+
+func TestHandleInstancesSort(t *testing.T) {
+	s := newSortTestServer()
+
+	tests := []struct {
+		query string
+		want  []string
+	}{
+		{"", []string{"https://c.example", "https://a.example", "https://b.example", "https://d.example"}},
+		// a and b tie on uptime and are ordered by index.
+		{"?sort=uptime", []string{"https://c.example", "https://b.example", "https://a.example", "https://d.example"}},
+		{"?sort=uptime&order=desc", []string{"https://b.example", "https://a.example", "https://c.example", "https://d.example"}},
+		{"?sort=response_time", []string{"https://a.example", "https://b.example", "https://c.example", "https://d.example"}},
+		{"?sort=response_time&order=desc", []string{"https://c.example", "https://b.example", "https://a.example", "https://d.example"}},
+		{"?sort=group", []string{"https://b.example", "https://d.example", "https://c.example", "https://a.example"}},
+		{"?sort=group&order=desc", []string{"https://c.example", "https://a.example", "https://b.example", "https://d.example"}},
+		{"?sort=url", []string{"https://a.example", "https://b.example", "https://c.example", "https://d.example"}},
+		{"?sort=url&order=desc", []string{"https://d.example", "https://c.example", "https://b.example", "https://a.example"}},
+		{"?sort=url&group=alpha", []string{"https://b.example", "https://d.example"}},
+		{"?sort=response_time&type=api&order=desc", []string{"https://c.example", "https://a.example"}},
+	}
+
+	for _, tt := range tests {
+		got := getInstanceURLs(t, s, tt.query)
+		if len(got) != len(tt.want) {
+			t.Errorf("GET %s = %v, want %v", tt.query, got, tt.want)
+			continue
+		}
+		for i := range got {
+			if got[i] != tt.want[i] {
+				t.Errorf("GET %s = %v, want %v", tt.query, got, tt.want)
+				break
+			}
+		}
+	}
+}
+
+func TestHandleInstancesSortInvalid(t *testing.T) {
+	s := newSortTestServer()
+
+	for _, query := range []string{"?sort=status", "?sort=url&order=up"} {
+		rec := httptest.NewRecorder()
+		s.handleInstances(rec, httptest.NewRequest(http.MethodGet, "/api/instances"+query, nil))
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("GET %s: status %d, want %d", query, rec.Code, http.StatusBadRequest)
+		}
+	}
+}
+
+func newBadgeBenchServer() *Server {
+	config := DefaultConfig()
+	monitor := NewTestMonitor([]*Instance{
+		{Group: "beta", URL: "https://a.example", InstanceType: "api", Checks: checksWith(150, 18, 120)},
+	}, config)
+	monitor.running.Store(true)
+	return NewServer(monitor, config)
+}
+
+// getBadge requests the badge of instanceURL from a server that sends
+// badges without a max-age.
+func getBadge(t *testing.T, instanceURL string) *httptest.ResponseRecorder {
+	t.Helper()
+
+	config := DefaultConfig()
+	config.BadgeCacheSeconds = 0
+	monitor := NewTestMonitor([]*Instance{
+		{Group: "g", URL: "https://up.example", InstanceType: InstanceTypeAPI, Checks: checksWith(4, 0, 100)},
+		{Group: "g", URL: "https://down.example", InstanceType: InstanceTypeAPI, Checks: checksWith(3, 1, 100)},
+	}, config)
+	monitor.running.Store(true)
+	s := NewServer(monitor, config)
+
+	rec := httptest.NewRecorder()
+	s.handleBadge(rec, httptest.NewRequest(http.MethodGet, "/api/badge/"+url.QueryEscape(instanceURL), nil))
+	if ct := rec.Header().Get("Content-Type"); ct != "image/svg+xml" {
+		t.Errorf("Content-Type = %q, want image/svg+xml", ct)
+	}
+	if cc := rec.Header().Get("Cache-Control"); cc != "no-cache" {
+		t.Errorf("Cache-Control = %q, want no-cache", cc)
+	}
+	return rec
+}
+
+func TestHandleBadge_NotFound(t *testing.T) {
+	rec := getBadge(t, "https://missing.example")
+	if body := rec.Body.String(); rec.Code != http.StatusNotFound || !strings.Contains(body, "not found") || !strings.Contains(body, colorUnknown) {
+		t.Errorf("status %d, body %s; want 404 and a gray not found badge", rec.Code, body)
+	}
+}
+
+func TestHandleBadge_InvalidURL(t *testing.T) {
+	s := newSortTestServer()
+	rec := httptest.NewRecorder()
+	s.handleBadge(rec, httptest.NewRequest(http.MethodGet, "/api/badge/%25zz", nil))
+
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("status %d, want 400", rec.Code)
+	}
+	if detail := decodeError(t, rec); detail.Code != "invalid_url" || detail.Message == "" {
+		t.Errorf("error = %+v, want code invalid_url and a message", detail)
+	}
+}
+
+func TestHandleBadge_InstanceUp(t *testing.T) {
+	rec := getBadge(t, "https://up.example")
+	if body := rec.Body.String(); rec.Code != http.StatusOK || !strings.Contains(body, "up 100.0%") || !strings.Contains(body, "#22c55e") {
+		t.Errorf("status %d, body %s; want 200 and a green up badge", rec.Code, body)
+	}
+}
+
+func TestHandleBadge_InstanceDown(t *testing.T) {
+	rec := getBadge(t, "https://down.example")
+	if body := rec.Body.String(); rec.Code != http.StatusOK || !strings.Contains(body, ">down<") || !strings.Contains(body, "#ef4444") {
+		t.Errorf("status %d, body %s; want 200 and a red down badge", rec.Code, body)
+	}
+}
+
+func TestHandleBadge_LooseMatch(t *testing.T) {
+	tests := []struct {
+		url         string
+		matched     string
+		suggestions string
+	}{
+		{"http://up.example", "https://up.example", ""},
+		{"https://up.example/", "https://up.example", ""},
+		{"https://www.up.example", "https://up.example", ""},
+		{"UP.example", "https://up.example", ""},
+		{"https://upp.example", "", "https://up.example"},
+		{"https://own.example", "", "https://down.example, https://up.example"},
+		{"https://elsewhere.example", "", ""},
+	}
+
+	for _, tt := range tests {
+		rec := getBadge(t, tt.url)
+		if tt.matched != "" && rec.Code != http.StatusOK {
+			t.Errorf("%s: status %d, want the badge of %s", tt.url, rec.Code, tt.matched)
+		}
+		if tt.matched == "" && rec.Code != http.StatusNotFound {
+			t.Errorf("%s: status %d, want 404", tt.url, rec.Code)
+		}
+		if got := rec.Header().Get("X-Status-Matched-URL"); got != tt.matched {
+			t.Errorf("%s: X-Status-Matched-URL = %q, want %q", tt.url, got, tt.matched)
+		}
+		if got := rec.Header().Get("X-Status-Suggestions"); got != tt.suggestions {
+			t.Errorf("%s: X-Status-Suggestions = %q, want %q", tt.url, got, tt.suggestions)
+		}
+	}
+}
+
+func TestHandleBadges(t *testing.T) {
+	config := DefaultConfig()
+	monitor := NewTestMonitor([]*Instance{
+		{Group: "g", URL: "https://up.example", InstanceType: InstanceTypeAPI, Checks: checksWith(4, 0, 100)},
+		{Group: "g", URL: "https://down.example", InstanceType: InstanceTypeAPI, Checks: checksWith(3, 1, 100)},
+	}, config)
+	monitor.running.Store(true)
+	s := NewServer(monitor, config)
+	handler := s.SetupRoutes()
+
+	rec := serveRoute(t, handler, http.MethodGet, "/api/badges?group=g")
+	if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != "image/svg+xml" {
+		t.Fatalf("sprite: status %d, Content-Type %q", rec.Code, rec.Header().Get("Content-Type"))
+	}
+	sprite := rec.Body.String()
+	for i, url := range []string{"https://up.example", "https://down.example"} {
+		// Each badge of the sprite is drawn as the single badge is, with ids
+		// of its own.
+		badge := s.badge(url, "")
+		if !strings.Contains(string(badge.body), badgeLayers(badge.label, badge.message, badge.color, "")) {
+			t.Errorf("badge of %s is not drawn from its layers", url)
+		}
+		if !strings.Contains(sprite, badgeLayers(badge.label, badge.message, badge.color, strconv.Itoa(i))) {
+			t.Errorf("sprite lacks the badge of %s", url)
+		}
+	}
+
+	rec = serveRoute(t, handler, http.MethodGet, "/api/badges?format=json&urls=https://up.example,%20up.example,https://missing.example")
+	var descriptors []BadgeDescriptor
+	if err := json.NewDecoder(rec.Body).Decode(&descriptors); err != nil {
+		t.Fatalf("failed to decode descriptors: %v", err)
+	}
+	if len(descriptors) != 3 {
+		t.Fatalf("got %d descriptors, want 3", len(descriptors))
+	}
+	up := s.badge("https://up.example", "")
+	if d := descriptors[0]; !d.Found || d.Message != up.message || d.Color != up.color || d.Width != badgeWidth(up.label, up.message) {
+		t.Errorf("descriptor of up.example = %+v", d)
+	}
+	if d := descriptors[1]; !d.Found || d.MatchedURL != "https://up.example" {
+		t.Errorf("descriptor of a loose match = %+v", d)
+	}
+	if d := descriptors[2]; d.Found || d.Message != "not found" {
+		t.Errorf("descriptor of an unknown instance = %+v", d)
+	}
+}
+
+func TestBadgeMatchKey(t *testing.T) {
+	for _, pair := range [][2]string{
+		{"https://a.example", "http://a.example"},
+		{"https://a.example/path", "https://a.example/path/"},
+		{"https://a.example", "https://www.a.example"},
+		{"https://a.example", "A.Example"},
+	} {
+		a, okA := badgeMatchKey(pair[0])
+		b, okB := badgeMatchKey(pair[1])
+		if !okA || !okB || a != b {
+			t.Errorf("keys of %q and %q: %q, %q; want equal", pair[0], pair[1], a, b)
+		}
+	}
+	x, _ := badgeMatchKey("https://a.example/x")
+	y, _ := badgeMatchKey("https://a.example/y")
+	if x == y {
+		t.Errorf("different paths share the key %q", x)
+	}
+}
+
+func BenchmarkHandleBadge(b *testing.B) {
+	s := newBadgeBenchServer()
+	req := httptest.NewRequest(http.MethodGet, "/api/badge/https%3A%2F%2Fa.example", nil)
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		s.handleBadge(httptest.NewRecorder(), req)
+	}
+}
+
+// BenchmarkHandleBadgeUncached renders the badge on every request, as happens
+// after each check cycle.
+func BenchmarkHandleBadgeUncached(b *testing.B) {
+	s := newBadgeBenchServer()
+	req := httptest.NewRequest(http.MethodGet, "/api/badge/https%3A%2F%2Fa.example", nil)
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		s.monitor.dataVersion.Add(1)
+		s.handleBadge(httptest.NewRecorder(), req)
+	}
+}
+
+func TestFavicon(t *testing.T) {
+	s := newSortTestServer()
+	m := s.monitor
+
+	get := func() *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		s.handleFavicon(rec, httptest.NewRequest(http.MethodGet, "/api/favicon.svg", nil))
+		if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != "image/svg+xml" {
+			t.Fatalf("status %d, Content-Type %q", rec.Code, rec.Header().Get("Content-Type"))
+		}
+		return rec
+	}
+
+	if body := get().Body.String(); !strings.Contains(body, colorUnknown) {
+		t.Errorf("favicon while starting = %s, want gray", body)
+	}
+
+	m.running.Store(true)
+	m.broadcastUpdate()
+	rec := get()
+	if !strings.Contains(rec.Body.String(), colorPartial) {
+		t.Errorf("favicon with one instance down = %s, want yellow", rec.Body.String())
+	}
+	if got := rec.Header().Get("Cache-Control"); got != "public, max-age=10" {
+		t.Errorf("Cache-Control = %q", got)
+	}
+
+	m.instances[0].Checks = checksWith(1, 0, 100)
+	m.broadcastUpdate()
+	if body := get().Body.String(); !strings.Contains(body, colorUp) {
+		t.Errorf("favicon with every instance up = %s, want green", body)
+	}
+}
+
+func TestOpenGraph(t *testing.T) {
+	s := newSortTestServer()
+	s.monitor.running.Store(true)
+	handler := s.SetupRoutes()
+
+	rec := serveRoute(t, handler, http.MethodGet, "/")
+	body := rec.Body.String()
+	for _, want := range []string{
+		`<meta property="og:image" content="http://example.com/api/og-image.svg?v=0">`,
+		`<meta property="og:description" content="Partial System Outage: 2 of 4 instances up">`,
+		`<meta name="twitter:card" content="summary_large_image">`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("index.html is missing %s", want)
+		}
+	}
+	if strings.Contains(body, ogMarker) {
+		t.Error("index.html still contains the marker")
+	}
+
+	s.config.StatusPageURL = "https://status.example/"
+	if body := serveRoute(t, handler, http.MethodGet, "/").Body.String(); !strings.Contains(body, `content="https://status.example/api/og-image.svg?v=0"`) {
+		t.Errorf("og:image does not use STATUS_PAGE_URL: %s", body)
+	}
+
+	rec = serveRoute(t, handler, http.MethodGet, "/api/og-image.svg")
+	if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != "image/svg+xml" {
+		t.Fatalf("og-image: status %d, Content-Type %q", rec.Code, rec.Header().Get("Content-Type"))
+	}
+	for _, want := range []string{"Partial System Outage", "2 of 4 instances up", colorPartial} {
+		if !strings.Contains(rec.Body.String(), want) {
+			t.Errorf("og-image is missing %q", want)
+		}
+	}
+}
+
+func TestHandleBadgeETag(t *testing.T) {
+	s := newBadgeBenchServer()
+
+	rec := httptest.NewRecorder()
+	s.handleBadge(rec, httptest.NewRequest(http.MethodGet, "/api/badge/https%3A%2F%2Fa.example", nil))
+	etag := rec.Header().Get("ETag")
+	if rec.Code != http.StatusOK || etag == "" {
+		t.Fatalf("status %d, ETag %q", rec.Code, etag)
+	}
+	if got := rec.Header().Get("Cache-Control"); got != "public, max-age=60" {
+		t.Errorf("Cache-Control = %q", got)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/api/badge/https%3A%2F%2Fa.example", nil)
+	req.Header.Set("If-None-Match", etag)
+	rec = httptest.NewRecorder()
+	s.handleBadge(rec, req)
+	if rec.Code != http.StatusNotModified {
+		t.Errorf("revalidation status %d, want %d", rec.Code, http.StatusNotModified)
+	}
+
+	// New data invalidates the cached badge.
+	instance := s.monitor.instances[0]
+	instance.Checks = append(instance.Checks, checksWith(40, 0, 120)...)
+	s.monitor.broadcastUpdate()
+
+	rec = httptest.NewRecorder()
+	s.handleBadge(rec, req)
+	if rec.Code != http.StatusOK || rec.Header().Get("ETag") == etag {
+		t.Errorf("after update: status %d, ETag %q (was %q)", rec.Code, rec.Header().Get("ETag"), etag)
+	}
+}
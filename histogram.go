@@ -0,0 +1,130 @@
+package main
+
+import (
+	"math"
+	"sort"
+	"time"
+)
+
+const (
+	defaultHistogramBuckets = 20
+	maxHistogramBuckets     = 100
+	histogramMinMs          = 1
+	histogramMaxMs          = 60000
+)
+
+// Histogram is a response-time distribution over log-spaced buckets.
+type Histogram struct {
+	Buckets []HistogramBucket `json:"buckets"`
+	Samples int               `json:"samples"`
+}
+
+// HistogramBucket counts samples in [LowerMs, UpperMs). The first bucket also
+// holds faster samples and the last one slower samples.
+type HistogramBucket struct {
+	LowerMs float64 `json:"lower_ms"`
+	UpperMs float64 `json:"upper_ms"`
+	Count   int     `json:"count"`
+}
+
+// newHistogram creates n empty buckets log-spaced between 1ms and 60s.
+func newHistogram(n int) Histogram {
+	ratio := math.Log(histogramMaxMs/histogramMinMs) / float64(n)
+	edge := func(i int) float64 {
+		switch i {
+		case 0:
+			return histogramMinMs
+		case n:
+			return histogramMaxMs
+		}
+		return math.Round(histogramMinMs*math.Exp(ratio*float64(i))*100) / 100
+	}
+
+	buckets := make([]HistogramBucket, n)
+	for i := range buckets {
+		buckets[i] = HistogramBucket{LowerMs: edge(i), UpperMs: edge(i + 1)}
+	}
+	return Histogram{Buckets: buckets}
+}
+
+func (h *Histogram) add(ms int64, count int) {
+	value := float64(ms)
+	i := sort.Search(len(h.Buckets), func(i int) bool {
+		return value < h.Buckets[i].UpperMs
+	})
+	if i == len(h.Buckets) {
+		i--
+	}
+	h.Buckets[i].Count += count
+	h.Samples += count
+}
+
+// addChecks adds the response times of successful checks taken at or after
+// since.
+func (h *Histogram) addChecks(checks []Check, since time.Time) {
+	for _, check := range checksSince(checks, since) {
+		if successes := check.successes(); successes > 0 {
+			h.add(check.ResponseTime, successes)
+		}
+	}
+}
+
+// ResponseTimeHistogram returns the response-time distribution of the instance
+// with the given URL, or false if it is not monitored.
+func (m *Monitor) ResponseTimeHistogram(url string, since time.Time, buckets int) (Histogram, bool) {
+	instance := m.findInstance(url)
+	if instance == nil {
+		return Histogram{}, false
+	}
+
+	h := newHistogram(buckets)
+	instance.mu.RLock()
+	h.addChecks(instance.Checks, since)
+	instance.mu.RUnlock()
+
+	return h, true
+}
+
+// FleetResponseTimeHistogram returns the response-time distribution across
+// all instances.
+func (m *Monitor) FleetResponseTimeHistogram(since time.Time, buckets int) Histogram {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	h := newHistogram(buckets)
+	for _, instance := range m.instances {
+		instance.mu.RLock()
+		h.addChecks(instance.Checks, since)
+		instance.mu.RUnlock()
+	}
+	return h
+}
+
+// ResponseTimePoint is one sample of a response-time chart.
+type ResponseTimePoint struct {
+	T  int64 `json:"t"`
+	Ms int64 `json:"ms"`
+}
+
+// ResponseTimeHistory returns the response times of the successful checks of
+// the instance with the given URL taken at or after since, oldest first, or
+// false if it is not monitored. A compacted check is a single point with its
+// average response time.
+func (m *Monitor) ResponseTimeHistory(url string, since time.Time) ([]ResponseTimePoint, bool) {
+	instance := m.findInstance(url)
+	if instance == nil {
+		return nil, false
+	}
+
+	instance.mu.RLock()
+	defer instance.mu.RUnlock()
+
+	checks := checksSince(instance.Checks, since)
+	points := make([]ResponseTimePoint, 0, len(checks))
+	for _, check := range checks {
+		if check.successes() > 0 {
+			points = append(points, ResponseTimePoint{T: check.Timestamp.Unix(), Ms: check.ResponseTime})
+		}
+	}
+	return points, true
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestNewHistogramBounds(t *testing.T) {
+	h := newHistogram(20)
+	if len(h.Buckets) != 20 {
+		t.Fatalf("got %d buckets, want 20", len(h.Buckets))
+	}
+	if h.Buckets[0].LowerMs != histogramMinMs || h.Buckets[19].UpperMs != histogramMaxMs {
+		t.Errorf("range = [%v, %v), want [%v, %v)", h.Buckets[0].LowerMs, h.Buckets[19].UpperMs, histogramMinMs, histogramMaxMs)
+	}
+	for i := 1; i < len(h.Buckets); i++ {
+		if h.Buckets[i].LowerMs != h.Buckets[i-1].UpperMs {
+			t.Errorf("bucket %d starts at %v, previous ends at %v", i, h.Buckets[i].LowerMs, h.Buckets[i-1].UpperMs)
+		}
+	}
+}
+
+func TestHistogramAddEdges(t *testing.T) {
+	// Two buckets split at sqrt(60000) ~ 244.95ms.
+	tests := []struct {
+		ms     int64
+		bucket int
+	}{
+		{0, 0},
+		{1, 0},
+		{244, 0},
+		{245, 1},
+		{59999, 1},
+		{60000, 1},
+		{120000, 1},
+	}
+
+	for _, tt := range tests {
+		h := newHistogram(2)
+		h.add(tt.ms, 1)
+		if h.Buckets[tt.bucket].Count != 1 || h.Samples != 1 {
+			t.Errorf("add(%d): buckets %+v, want sample in bucket %d", tt.ms, h.Buckets, tt.bucket)
+		}
+	}
+}
+
+func TestHistogramAddExactBoundary(t *testing.T) {
+	h := Histogram{Buckets: []HistogramBucket{
+		{LowerMs: 1, UpperMs: 10},
+		{LowerMs: 10, UpperMs: 100},
+		{LowerMs: 100, UpperMs: 1000},
+	}}
+
+	// Upper bounds are exclusive.
+	for _, ms := range []int64{9, 10, 99, 100} {
+		h.add(ms, 1)
+	}
+
+	want := []int{1, 2, 1}
+	for i, bucket := range h.Buckets {
+		if bucket.Count != want[i] {
+			t.Errorf("bucket %d count = %d, want %d", i, bucket.Count, want[i])
+		}
+	}
+}
+
+func TestHistogramAddChecks(t *testing.T) {
+	checks := []Check{
+		{Success: true, ResponseTime: 10},
+		{Success: false, ResponseTime: 10},
+		{Compacted: true, Count: 5, SuccessCount: 3, ResponseTime: 10},
+	}
+
+	h := newHistogram(20)
+	h.addChecks(checks, checks[0].Timestamp)
+	if h.Samples != 4 {
+		t.Errorf("samples = %d, want 4", h.Samples)
+	}
+}
+
+func TestResponseTimeHistory(t *testing.T) {
+	s := newSortTestServer()
+	now := time.Now()
+	s.monitor.instances[1].Checks = []Check{
+		{Timestamp: now.Add(-48 * time.Hour), Success: true, ResponseTime: 90},
+		{Timestamp: now.Add(-2 * time.Hour), Success: true, ResponseTime: 120},
+		{Timestamp: now.Add(-time.Hour), ResponseTime: 5000},
+		{Timestamp: now.Add(-time.Minute), Success: true, ResponseTime: 80},
+	}
+	handler := s.SetupRoutes()
+
+	tests := []struct {
+		path string
+		want []int64
+	}{
+		{"/api/instances/https%3A%2F%2Fa.example/response-time-history", []int64{120, 80}},
+		{"/api/instances/https%3A%2F%2Fa.example/response-time-history?window=30m", []int64{80}},
+		{"/api/instances/https%3A%2F%2Fa.example/response-time-history?window=72h", []int64{90, 120, 80}},
+		{"/api/instances/https%3A%2F%2Fd.example/response-time-history", []int64{}},
+	}
+
+	for _, tt := range tests {
+		rec := serveRoute(t, handler, http.MethodGet, tt.path)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("%s: status %d, want 200", tt.path, rec.Code)
+		}
+		if len(tt.want) == 0 {
+			if body := rec.Body.String(); body != "[]\n" {
+				t.Errorf("%s: body %q, want []", tt.path, body)
+			}
+			continue
+		}
+
+		var points []ResponseTimePoint
+		if err := json.NewDecoder(rec.Body).Decode(&points); err != nil {
+			t.Fatalf("%s: failed to decode: %v", tt.path, err)
+		}
+		if len(points) != len(tt.want) {
+			t.Fatalf("%s: got %v, want response times %v", tt.path, points, tt.want)
+		}
+		for i, point := range points {
+			if point.Ms != tt.want[i] || point.T == 0 {
+				t.Errorf("%s: point %d = %+v, want %dms", tt.path, i, point, tt.want[i])
+			}
+		}
+	}
+
+	for path, want := range map[string]int{
+		"/api/instances/https%3A%2F%2Fa.example/response-time-history?window=-1h": http.StatusBadRequest,
+		"/api/instances/https%3A%2F%2Fa.example/response-time-history?window=day": http.StatusBadRequest,
+		"/api/instances/https%3A%2F%2Fmissing.example/response-time-history":      http.StatusNotFound,
+	} {
+		if rec := serveRoute(t, handler, http.MethodGet, path); rec.Code != want {
+			t.Errorf("%s: status %d, want %d", path, rec.Code, want)
+		}
+	}
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"context"
+	"net"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/publicsuffix"
+)
+
+// hostLimiter bounds outbound check traffic per registrable domain so that
+// instances sharing a provider don't trigger its DDoS protection during a
+// check cycle.
+type hostLimiter struct {
+	maxConcurrent int
+	interval      time.Duration
+
+	mu    sync.Mutex
+	hosts map[string]*hostBudget
+}
+
+type hostBudget struct {
+	sem chan struct{}
+
+	mu   sync.Mutex
+	next time.Time
+}
+
+// newHostLimiter returns a limiter allowing maxConcurrent requests and rps
+// requests per second per host. Zero disables the respective limit.
+func newHostLimiter(maxConcurrent int, rps float64) *hostLimiter {
+	l := &hostLimiter{
+		maxConcurrent: maxConcurrent,
+		hosts:         make(map[string]*hostBudget),
+	}
+	if rps > 0 {
+		l.interval = time.Duration(float64(time.Second) / rps)
+	}
+	return l
+}
+
+// acquire blocks until a request to rawURL may be sent and returns the
+// function that releases the slot. It gives up with ctx's error when ctx is
+// done first.
+func (l *hostLimiter) acquire(ctx context.Context, rawURL string) (func(), error) {
+	if l.maxConcurrent <= 0 && l.interval <= 0 {
+		return func() {}, nil
+	}
+
+	budget := l.budget(hostKey(rawURL))
+	release := func() {
+		if budget.sem != nil {
+			<-budget.sem
+		}
+	}
+
+	if budget.sem != nil {
+		select {
+		case budget.sem <- struct{}{}:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+
+	if l.interval > 0 {
+		budget.mu.Lock()
+		now := time.Now()
+		slot := budget.next
+		if slot.Before(now) {
+			slot = now
+		}
+		budget.next = slot.Add(l.interval)
+		budget.mu.Unlock()
+
+		select {
+		case <-time.After(time.Until(slot)):
+		case <-ctx.Done():
+			release()
+			return nil, ctx.Err()
+		}
+	}
+
+	return release, nil
+}
+
+func (l *hostLimiter) budget(key string) *hostBudget {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	budget, ok := l.hosts[key]
+	if !ok {
+		budget = &hostBudget{}
+		if l.maxConcurrent > 0 {
+			budget.sem = make(chan struct{}, l.maxConcurrent)
+		}
+		l.hosts[key] = budget
+	}
+	return budget
+}
+
+// hostKey returns the registrable domain of rawURL, so that
+// api.example.com and www.example.com share a budget. IP addresses and
+// hosts without a public suffix are used as they are.
+func hostKey(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return rawURL
+	}
+
+	host := strings.ToLower(u.Hostname())
+	if net.ParseIP(host) != nil {
+		return host
+	}
+
+	domain, err := publicsuffix.EffectiveTLDPlusOne(host)
+	if err != nil {
+		return host
+	}
+	return domain
+}
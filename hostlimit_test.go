@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestHostLimiterSerializesChecks(t *testing.T) {
+	var mu sync.Mutex
+	var arrivals []time.Time
+	inFlight, maxInFlight := 0, 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		arrivals = append(arrivals, time.Now())
+		inFlight++
+		maxInFlight = max(maxInFlight, inFlight)
+		mu.Unlock()
+
+		time.Sleep(20 * time.Millisecond)
+
+		mu.Lock()
+		inFlight--
+		mu.Unlock()
+	}))
+	defer server.Close()
+
+	config := DefaultConfig()
+	config.HostConcurrency = 1
+	config.HostRequestsPerSecond = 10
+	m := NewTestMonitor([]*Instance{
+		{Group: "g", URL: server.URL + "/a", InstanceType: InstanceTypeUI},
+		{Group: "g", URL: server.URL + "/b", InstanceType: InstanceTypeUI},
+		{Group: "g", URL: server.URL + "/c", InstanceType: InstanceTypeUI},
+	}, config)
+	m.checkAll(context.Background())
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(arrivals) != 3 || maxInFlight != 1 {
+		t.Fatalf("%d requests with up to %d in flight, want 3 one at a time", len(arrivals), maxInFlight)
+	}
+	sort.Slice(arrivals, func(i, j int) bool { return arrivals[i].Before(arrivals[j]) })
+	for i := 1; i < len(arrivals); i++ {
+		// Allow for timer granularity below the 100ms interval.
+		if gap := arrivals[i].Sub(arrivals[i-1]); gap < 90*time.Millisecond {
+			t.Errorf("request %d came %v after the previous one, want at least 100ms", i, gap)
+		}
+	}
+}
+
+func TestHostLimiterHonorsContext(t *testing.T) {
+	l := newHostLimiter(1, 0.001)
+	release, err := l.acquire(context.Background(), "https://a.example")
+	if err != nil {
+		t.Fatalf("first acquire: %v", err)
+	}
+	release()
+
+	// The next slot is over 15 minutes away.
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if _, err := l.acquire(ctx, "https://b.a.example"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("acquire = %v, want the context deadline", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("acquire returned after %v, want it to give up with the context", elapsed)
+	}
+
+	// Giving up frees the concurrency slot it had taken.
+	select {
+	case l.budget("a.example").sem <- struct{}{}:
+	default:
+		t.Error("the concurrency slot was not released")
+	}
+}
@@ -0,0 +1,392 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"path"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Severities of problems found in the instances JSON. Entries with errors
+// are skipped; warnings do not affect monitoring.
+const (
+	SeverityError   = "error"
+	SeverityWarning = "warning"
+)
+
+// ListIssue is a problem found in the instances JSON. Path locates it, for
+// example api.tidal.urls[2].
+type ListIssue struct {
+	Severity string
+	Path     string
+	Message  string
+}
+
+func (i ListIssue) String() string {
+	return fmt.Sprintf("%s: %s: %s", i.Path, i.Severity, i.Message)
+}
+
+// Format versions of the instances JSON this build understands. A document
+// without "version" is version 1. Minor versions only add fields, so a newer
+// minor version is parsed as best it can be; a newer major version may
+// change the meaning of existing fields and is rejected.
+const (
+	instancesJSONMajor = 2
+	instancesJSONMinor = 0
+)
+
+// checkListVersion validates the "version" of the instances JSON. It returns
+// an error for versions this build cannot read, and a warning issue for a
+// newer minor version.
+func checkListVersion(version json.Number) (*ListIssue, error) {
+	if version == "" {
+		return nil, nil
+	}
+
+	majorStr, minorStr, hasMinor := strings.Cut(version.String(), ".")
+	major, err := strconv.Atoi(majorStr)
+	minor := 0
+	if err == nil && hasMinor {
+		minor, err = strconv.Atoi(minorStr)
+	}
+	if err != nil || major < 1 || minor < 0 {
+		return nil, fmt.Errorf("invalid instances JSON version %s", version)
+	}
+
+	if major > instancesJSONMajor {
+		return nil, fmt.Errorf("unsupported instances JSON version %s, this build reads up to %d.x", version, instancesJSONMajor)
+	}
+	if major == instancesJSONMajor && minor > instancesJSONMinor {
+		return &ListIssue{
+			Severity: SeverityWarning,
+			Path:     "version",
+			Message:  fmt.Sprintf("version %s is newer than %d.%d, fields added since are ignored", version, instancesJSONMajor, instancesJSONMinor),
+		}, nil
+	}
+	return nil, nil
+}
+
+// instanceSpec is an instance as described by the instances JSON.
+type instanceSpec struct {
+	Group        string
+	GroupOrder   int
+	InstanceType string
+	URL          string
+	Cors         bool
+	Metadata     map[string]interface{}
+	GroupMeta    *GroupMeta
+
+	RequiredHeaders      map[string]string
+	CheckIntervalSeconds int
+}
+
+// Keys understood in the instances JSON; anything else is reported.
+var (
+	knownListKeys      = []string{"version", "api", "ui"}
+	knownAPIGroupKeys  = []string{"urls", "cors", "check_required_headers", "check_interval_seconds", "meta"}
+	knownUIGroupKeys   = []string{"urls", "check_interval_seconds", "meta"}
+	knownGroupMetaKeys = []string{"description", "owner", "docs_url"}
+)
+
+// fetchInstanceList reads the instances JSON from source.
+func fetchInstanceList(ctx context.Context, source SourceReader, timeout time.Duration) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	reader, err := source.Open(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch instances: %w", err)
+	}
+	defer reader.Close()
+
+	body, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response body: %w", err)
+	}
+	return body, nil
+}
+
+// parseInstanceList turns the instances JSON into instances in display
+// order: API groups, then UI groups, each in the order of the file. URLs are
+// normalized, and invalid or duplicate entries are skipped and reported. An
+// error is returned only if the document cannot be parsed at all.
+func parseInstanceList(body []byte) ([]instanceSpec, []ListIssue, error) {
+	var data InstancesJSON
+	if err := json.Unmarshal(body, &data); err != nil {
+		return nil, nil, fmt.Errorf("failed to parse instances JSON: %w", err)
+	}
+	versionIssue, err := checkListVersion(data.Version)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var issues []ListIssue
+	report := func(severity, path, format string, args ...interface{}) {
+		issues = append(issues, ListIssue{Severity: severity, Path: path, Message: fmt.Sprintf(format, args...)})
+	}
+	if versionIssue != nil {
+		issues = append(issues, *versionIssue)
+	}
+	issues = append(issues, unknownListFields(body)...)
+
+	var specs []instanceSpec
+	seen := make(map[string]string)
+	add := func(path string, spec instanceSpec) {
+		normalized, err := normalizeInstanceURL(spec.URL)
+		if err != nil {
+			report(SeverityError, path, "invalid URL %q: %v", spec.URL, err)
+			return
+		}
+		if normalized != spec.URL {
+			report(SeverityWarning, path, "URL %q normalized to %q", spec.URL, normalized)
+		}
+		if first, ok := seen[normalized]; ok {
+			report(SeverityError, path, "duplicate URL %s, first listed at %s", normalized, first)
+			return
+		}
+		seen[normalized] = path
+
+		spec.URL = normalized
+		specs = append(specs, spec)
+	}
+
+	// A group name may be used for both API and UI instances; its meta is
+	// taken from the first definition.
+	metaPaths := make(map[string]string)
+	groupMeta := func(path, group string, meta *GroupMeta) *GroupMeta {
+		if meta == nil {
+			return nil
+		}
+		if first, ok := metaPaths[group]; ok {
+			report(SeverityWarning, path+".meta", "group meta already defined at %s.meta, ignored", first)
+			return nil
+		}
+		metaPaths[group] = path
+		if meta.DocsURL != "" {
+			if u, err := url.Parse(meta.DocsURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+				report(SeverityWarning, path+".meta.docs_url", "invalid URL %q, ignored", meta.DocsURL)
+				meta.DocsURL = ""
+			}
+		}
+		return meta
+	}
+
+	groupIndex := 0
+	for _, group := range extractOrderFromJSON(string(body), "api") {
+		details, ok := data.API[group]
+		if !ok {
+			continue
+		}
+		if len(details.URLs) == 0 {
+			report(SeverityWarning, "api."+group, "group has no URLs")
+		}
+		meta := groupMeta("api."+group, group, details.Meta)
+		for i, entry := range details.URLs {
+			add(fmt.Sprintf("api.%s.urls[%d]", group, i), instanceSpec{
+				Group:                group,
+				GroupOrder:           groupIndex,
+				InstanceType:         InstanceTypeAPI,
+				URL:                  entry.URL,
+				Cors:                 details.Cors,
+				Metadata:             entry.Metadata,
+				GroupMeta:            meta,
+				RequiredHeaders:      details.RequiredHeaders,
+				CheckIntervalSeconds: cmp.Or(entry.CheckIntervalSeconds, details.CheckIntervalSeconds),
+			})
+		}
+		groupIndex++
+	}
+
+	for _, group := range extractOrderFromJSON(string(body), "ui") {
+		details, ok := data.UI[group]
+		if !ok {
+			continue
+		}
+		if len(details.URLs) == 0 {
+			report(SeverityWarning, "ui."+group, "group has no URLs")
+		}
+		meta := groupMeta("ui."+group, group, details.Meta)
+		for i, entry := range details.URLs {
+			add(fmt.Sprintf("ui.%s[%d]", group, i), instanceSpec{
+				Group:        group,
+				GroupOrder:   groupIndex,
+				InstanceType: InstanceTypeUI,
+				URL:          entry.URL,
+				Metadata:     entry.Metadata,
+				GroupMeta:    meta,
+
+				CheckIntervalSeconds: cmp.Or(entry.CheckIntervalSeconds, details.CheckIntervalSeconds),
+			})
+		}
+		groupIndex++
+	}
+
+	return specs, issues, nil
+}
+
+// applyGroupOrder moves the groups named in order to the top, in that
+// order, followed by the rest in document order, and renumbers GroupOrder to
+// match. An API and a UI group of the same name keep their document order
+// relative to each other. The specs are reordered to follow.
+func applyGroupOrder(specs []instanceSpec, order []string) {
+	if len(order) == 0 {
+		return
+	}
+
+	rank := func(spec instanceSpec) int {
+		if i := slices.Index(order, spec.Group); i >= 0 {
+			return i
+		}
+		return len(order)
+	}
+	slices.SortStableFunc(specs, func(a, b instanceSpec) int {
+		return cmp.Or(cmp.Compare(rank(a), rank(b)), cmp.Compare(a.GroupOrder, b.GroupOrder))
+	})
+
+	groupOrder, previous := -1, -1
+	for i := range specs {
+		if specs[i].GroupOrder != previous {
+			previous = specs[i].GroupOrder
+			groupOrder++
+		}
+		specs[i].GroupOrder = groupOrder
+	}
+}
+
+// InstanceFilter selects the instances of the list that are monitored. Each
+// pattern is an exact name or a path.Match glob, in which * does not match
+// "/". URLs are matched in their normalized form.
+type InstanceFilter struct {
+	ExcludeURLs       []string
+	ExcludeGroups     []string
+	IncludeOnlyGroups []string
+}
+
+func (f InstanceFilter) equal(other InstanceFilter) bool {
+	return slices.Equal(f.ExcludeURLs, other.ExcludeURLs) &&
+		slices.Equal(f.ExcludeGroups, other.ExcludeGroups) &&
+		slices.Equal(f.IncludeOnlyGroups, other.IncludeOnlyGroups)
+}
+
+func (f InstanceFilter) excludes(spec instanceSpec) bool {
+	if len(f.IncludeOnlyGroups) > 0 && !matchesAny(f.IncludeOnlyGroups, spec.Group) {
+		return true
+	}
+	return matchesAny(f.ExcludeGroups, spec.Group) || matchesAny(f.ExcludeURLs, spec.URL)
+}
+
+func matchesAny(patterns []string, name string) bool {
+	for _, pattern := range patterns {
+		if matched, _ := path.Match(pattern, name); matched || pattern == name {
+			return true
+		}
+	}
+	return false
+}
+
+// validatePatterns returns an error for the first pattern path.Match cannot
+// parse.
+func validatePatterns(patterns []string) error {
+	for _, pattern := range patterns {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid pattern %q: %w", pattern, err)
+		}
+	}
+	return nil
+}
+
+// filterInstances drops the specs excluded by filter and returns the rest,
+// along with the URLs of the dropped ones.
+func filterInstances(specs []instanceSpec, filter InstanceFilter) ([]instanceSpec, []string) {
+	var excluded []string
+	kept := specs[:0]
+	for _, spec := range specs {
+		if filter.excludes(spec) {
+			excluded = append(excluded, spec.URL)
+			continue
+		}
+		kept = append(kept, spec)
+	}
+	return kept, excluded
+}
+
+// normalizeInstanceURL trims whitespace and trailing slashes and lowercases
+// the scheme and host. Only absolute http and https URLs are accepted.
+func normalizeInstanceURL(rawURL string) (string, error) {
+	u, err := url.Parse(strings.TrimSpace(rawURL))
+	if err != nil {
+		return "", err
+	}
+	u.Scheme = strings.ToLower(u.Scheme)
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return "", fmt.Errorf("scheme must be http or https")
+	}
+	if u.Host == "" {
+		return "", fmt.Errorf("missing host")
+	}
+	u.Host = strings.ToLower(u.Host)
+	u.Path = strings.TrimRight(u.Path, "/")
+	u.RawPath = ""
+	return u.String(), nil
+}
+
+// unknownListFields warns about keys the monitor ignores, which are usually
+// typos.
+func unknownListFields(body []byte) []ListIssue {
+	var issues []ListIssue
+	unknown := func(path string, fields map[string]json.RawMessage, known []string) {
+		keys := make([]string, 0, len(fields))
+		for key := range fields {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			if !slices.Contains(known, key) {
+				issues = append(issues, ListIssue{Severity: SeverityWarning, Path: path, Message: fmt.Sprintf("unknown field %q", key)})
+			}
+		}
+	}
+
+	var top map[string]json.RawMessage
+	if json.Unmarshal(body, &top) != nil {
+		return nil
+	}
+	unknown("(root)", top, knownListKeys)
+
+	// meta checks the keys of a group's meta object, if it has one.
+	meta := func(path string, group map[string]json.RawMessage) {
+		var fields map[string]json.RawMessage
+		if json.Unmarshal(group["meta"], &fields) == nil {
+			unknown(path+".meta", fields, knownGroupMetaKeys)
+		}
+	}
+
+	var api map[string]map[string]json.RawMessage
+	if json.Unmarshal(top["api"], &api) == nil {
+		for _, group := range extractOrderFromJSON(string(body), "api") {
+			unknown("api."+group, api[group], knownAPIGroupKeys)
+			meta("api."+group, api[group])
+		}
+	}
+
+	// UI groups that are plain arrays have no keys to check.
+	var ui map[string]json.RawMessage
+	if json.Unmarshal(top["ui"], &ui) == nil {
+		for _, group := range extractOrderFromJSON(string(body), "ui") {
+			var fields map[string]json.RawMessage
+			if json.Unmarshal(ui[group], &fields) == nil {
+				unknown("ui."+group, fields, knownUIGroupKeys)
+				meta("ui."+group, fields)
+			}
+		}
+	}
+	return issues
+}
@@ -0,0 +1,264 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestParseInstanceList(t *testing.T) {
+	body := []byte(`{
+		"api": {
+			"zeta": {"urls": ["https://Z.example/", {"url": "https://y.example", "country": "DE"}], "cors": true, "check_intrval_seconds": 30},
+			"alpha": {"urls": ["https://z.example", "not a url", "ftp://x.example"]},
+			"empty": {"urls": []}
+		},
+		"ui": {"web": ["https://ui.example/app/"]},
+		"extra": true
+	}`)
+
+	specs, issues, err := parseInstanceList(body)
+	if err != nil {
+		t.Fatalf("parseInstanceList: %v", err)
+	}
+
+	var urls []string
+	for _, spec := range specs {
+		urls = append(urls, spec.InstanceType+" "+spec.Group+" "+spec.URL)
+	}
+	want := []string{
+		"api zeta https://z.example",
+		"api zeta https://y.example",
+		"ui web https://ui.example/app",
+	}
+	if strings.Join(urls, "\n") != strings.Join(want, "\n") {
+		t.Errorf("instances:\n%s\nwant:\n%s", strings.Join(urls, "\n"), strings.Join(want, "\n"))
+	}
+	if specs[1].Metadata["country"] != "DE" || !specs[0].Cors || specs[2].GroupOrder != 3 {
+		t.Errorf("specs lost group options or metadata: %+v", specs)
+	}
+
+	var got []string
+	for _, issue := range issues {
+		got = append(got, issue.String())
+	}
+	for _, line := range []string{
+		`(root): warning: unknown field "extra"`,
+		`api.zeta: warning: unknown field "check_intrval_seconds"`,
+		`api.zeta.urls[0]: warning: URL "https://Z.example/" normalized to "https://z.example"`,
+		`api.alpha.urls[0]: error: duplicate URL https://z.example, first listed at api.zeta.urls[0]`,
+		`api.empty: warning: group has no URLs`,
+	} {
+		if !strings.Contains(strings.Join(got, "\n")+"\n", line+"\n") {
+			t.Errorf("issues have no %q:\n%s", line, strings.Join(got, "\n"))
+		}
+	}
+
+	var report bytes.Buffer
+	if errors := writeValidationReport(&report, "test.json", specs, issues); errors != 3 {
+		t.Errorf("%d errors, want 3:\n%s", errors, report.String())
+	}
+	if !strings.HasSuffix(report.String(), "test.json: 3 instances in 2 groups, 3 errors, 5 warnings\n") {
+		t.Errorf("report summary:\n%s", report.String())
+	}
+
+	if _, _, err := parseInstanceList([]byte(`{"api": [`)); err == nil {
+		t.Error("malformed JSON: got no error")
+	}
+}
+
+func TestParseInstanceListCheckIntervals(t *testing.T) {
+	body := []byte(`{
+		"api": {
+			"fast": {"urls": ["https://a.example", {"url": "https://b.example", "check_interval_seconds": 15, "country": "DE"}], "check_interval_seconds": 30}
+		},
+		"ui": {
+			"plain": ["https://c.example", {"url": "https://d.example", "check_interval_seconds": 45}],
+			"slow": {"urls": ["https://e.example", {"url": "https://f.example", "check_interval_seconds": 90}], "check_interval_seconds": 600}
+		}
+	}`)
+
+	specs, issues, err := parseInstanceList(body)
+	if err != nil {
+		t.Fatalf("parseInstanceList: %v", err)
+	}
+	if len(issues) != 0 {
+		t.Errorf("issues = %v, want none", issues)
+	}
+
+	want := map[string]int{
+		"https://a.example": 30,
+		"https://b.example": 15,
+		"https://c.example": 0,
+		"https://d.example": 45,
+		"https://e.example": 600,
+		"https://f.example": 90,
+	}
+	for _, spec := range specs {
+		if spec.CheckIntervalSeconds != want[spec.URL] {
+			t.Errorf("%s: check interval %ds, want %ds", spec.URL, spec.CheckIntervalSeconds, want[spec.URL])
+		}
+		if _, found := spec.Metadata["check_interval_seconds"]; found {
+			t.Errorf("%s: check_interval_seconds ended up in the metadata %v", spec.URL, spec.Metadata)
+		}
+	}
+	if len(specs) != len(want) || specs[1].Metadata["country"] != "DE" {
+		t.Errorf("specs = %+v, want all %d with b's metadata kept", specs, len(want))
+	}
+
+	if _, _, err := parseInstanceList([]byte(`{"ui": {"web": [{"url": "https://a.example", "check_interval_seconds": "30"}]}}`)); err == nil {
+		t.Error("string check_interval_seconds: got no error")
+	}
+}
+
+func TestInstanceEntryUnmarshal(t *testing.T) {
+	tests := []struct {
+		name     string
+		json     string
+		url      string
+		interval int
+		metadata string
+		err      bool
+	}{
+		{"string", `"https://a.example"`, "https://a.example", 0, "map[]", false},
+		{"object", `{"url": "https://a.example"}`, "https://a.example", 0, "map[]", false},
+		{"object with metadata", `{"url": "https://a.example", "country": "DE", "tags": ["eu"]}`, "https://a.example", 0, "map[country:DE tags:[eu]]", false},
+		{"object with interval", `{"url": "https://a.example", "check_interval_seconds": 30}`, "https://a.example", 30, "map[]", false},
+		{"fractional interval", `{"url": "https://a.example", "check_interval_seconds": 1.5}`, "", 0, "", true},
+		{"missing url", `{"country": "DE"}`, "", 0, "", true},
+		{"empty url", `{"url": ""}`, "", 0, "", true},
+		{"number", `42`, "", 0, "", true},
+	}
+
+	for _, tt := range tests {
+		var entry InstanceEntry
+		err := json.Unmarshal([]byte(tt.json), &entry)
+		if (err != nil) != tt.err {
+			t.Errorf("%s: error = %v, want error %v", tt.name, err, tt.err)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		if metadata := fmt.Sprint(entry.Metadata); entry.URL != tt.url || entry.CheckIntervalSeconds != tt.interval || metadata != tt.metadata {
+			t.Errorf("%s: got %q, %ds, %s; want %q, %ds, %s", tt.name, entry.URL, entry.CheckIntervalSeconds, metadata, tt.url, tt.interval, tt.metadata)
+		}
+	}
+
+	// Decoding into a reused entry does not keep fields of the previous one.
+	entry := InstanceEntry{URL: "https://old.example", CheckIntervalSeconds: 30, Metadata: map[string]interface{}{"country": "DE"}}
+	if err := json.Unmarshal([]byte(`"https://a.example"`), &entry); err != nil || entry.CheckIntervalSeconds != 0 || entry.Metadata != nil {
+		t.Errorf("reused entry = %+v, %v; want only the new URL", entry, err)
+	}
+}
+
+func TestInstanceListVersion(t *testing.T) {
+	tests := []struct {
+		version string
+		warning bool
+		err     bool
+	}{
+		{"", false, false},
+		{`"version": 1,`, false, false},
+		{`"version": 2,`, false, false},
+		{`"version": 2.3,`, true, false},
+		{`"version": 3,`, false, true},
+		{`"version": 0,`, false, true},
+		{`"version": 2e0,`, false, true},
+	}
+
+	for _, tt := range tests {
+		specs, issues, err := parseInstanceList([]byte(`{` + tt.version + ` "ui": {"web": ["https://ui.example"]}}`))
+		if (err != nil) != tt.err {
+			t.Errorf("%q: error = %v, want error %v", tt.version, err, tt.err)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		if len(specs) != 1 {
+			t.Errorf("%q: %d instances, want 1", tt.version, len(specs))
+		}
+		warned := len(issues) == 1 && issues[0].Path == "version"
+		if warned != tt.warning || (!tt.warning && len(issues) > 0) {
+			t.Errorf("%q: issues = %v, want version warning %v", tt.version, issues, tt.warning)
+		}
+	}
+}
+
+func TestApplyGroupOrder(t *testing.T) {
+	body := []byte(`{
+		"api": {"a": {"urls": ["https://a1.example", "https://a2.example"]}, "b": {"urls": ["https://b.example"]}, "c": {"urls": ["https://c.example"]}},
+		"ui": {"c": ["https://c-ui.example"], "d": ["https://d.example"]}
+	}`)
+
+	tests := []struct {
+		order []string
+		want  string
+	}{
+		{nil, "0 a a1, 0 a a2, 1 b b, 2 c c, 3 c c-ui, 4 d d"},
+		{[]string{"d", "c"}, "0 d d, 1 c c, 2 c c-ui, 3 a a1, 3 a a2, 4 b b"},
+		{[]string{"missing", "b"}, "0 b b, 1 a a1, 1 a a2, 2 c c, 3 c c-ui, 4 d d"},
+	}
+
+	for _, tt := range tests {
+		specs, _, err := parseInstanceList(body)
+		if err != nil {
+			t.Fatalf("parseInstanceList: %v", err)
+		}
+		applyGroupOrder(specs, tt.order)
+
+		var got []string
+		for _, spec := range specs {
+			host := strings.TrimSuffix(strings.TrimPrefix(spec.URL, "https://"), ".example")
+			got = append(got, fmt.Sprintf("%d %s %s", spec.GroupOrder, spec.Group, host))
+		}
+		if strings.Join(got, ", ") != tt.want {
+			t.Errorf("order %q: got %s, want %s", tt.order, strings.Join(got, ", "), tt.want)
+		}
+	}
+}
+
+func TestFilterInstances(t *testing.T) {
+	body := []byte(`{
+		"api": {"a": {"urls": ["https://a1.example", "https://a2.example"]}, "b": {"urls": ["https://b.example"]}},
+		"ui": {"b-ui": ["https://b-ui.example"], "c": ["https://c.example"]}
+	}`)
+
+	tests := []struct {
+		filter InstanceFilter
+		want   string
+	}{
+		{InstanceFilter{}, "a1 a2 b b-ui c"},
+		{InstanceFilter{ExcludeURLs: []string{"https://a2.example"}}, "a1 b b-ui c"},
+		{InstanceFilter{ExcludeURLs: []string{"https://*.example"}}, ""},
+		{InstanceFilter{ExcludeGroups: []string{"b*"}}, "a1 a2 c"},
+		{InstanceFilter{IncludeOnlyGroups: []string{"a", "c"}}, "a1 a2 c"},
+		{InstanceFilter{IncludeOnlyGroups: []string{"b*"}, ExcludeURLs: []string{"https://b.example"}}, "b-ui"},
+	}
+
+	for _, tt := range tests {
+		specs, _, err := parseInstanceList(body)
+		if err != nil {
+			t.Fatalf("parseInstanceList: %v", err)
+		}
+		kept, excluded := filterInstances(specs, tt.filter)
+
+		var got []string
+		for _, spec := range kept {
+			got = append(got, strings.TrimSuffix(strings.TrimPrefix(spec.URL, "https://"), ".example"))
+		}
+		if strings.Join(got, " ") != tt.want {
+			t.Errorf("filter %+v: got %q, want %q", tt.filter, strings.Join(got, " "), tt.want)
+		}
+		if len(kept)+len(excluded) != 5 {
+			t.Errorf("filter %+v: %d kept and %d excluded, want 5 in all", tt.filter, len(kept), len(excluded))
+		}
+	}
+
+	if err := validatePatterns([]string{"ok", "[bad"}); err == nil {
+		t.Error("validatePatterns accepted an unterminated class")
+	}
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+// pushKuma reports a check result to the Uptime Kuma push monitor mapped to
+// the instance, if any.
+func (m *Monitor) pushKuma(instance *Instance, check Check) {
+	pushURL, ok := m.config.KumaPushURLs[instance.URL]
+	if !ok {
+		return
+	}
+
+	if m.config.DryRun {
+		if m.config.IsDebug() {
+			log.Printf("[DRY RUN] would notify kuma push for %s: success=%v", instance.URL, check.Success)
+		}
+		return
+	}
+
+	m.dispatcher.Enqueue("kuma push for "+instance.URL, func(ctx context.Context) error {
+		return sendKumaPush(ctx, pushURL, check)
+	})
+}
+
+func sendKumaPush(ctx context.Context, pushURL string, check Check) error {
+	u, err := url.Parse(pushURL)
+	if err != nil {
+		return fmt.Errorf("invalid push URL: %w", err)
+	}
+
+	status := "up"
+	msg := "OK"
+	if !check.Success {
+		status = "down"
+		msg = check.Error
+		if msg == "" {
+			msg = fmt.Sprintf("status code %d", check.StatusCode)
+		}
+	}
+
+	query := u.Query()
+	query.Set("status", status)
+	query.Set("msg", msg)
+	query.Set("ping", strconv.FormatInt(check.ResponseTime, 10))
+	u.RawQuery = query.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return fmt.Errorf("failed to build push request: %w", err)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send push: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("push returned unexpected status code: %d", resp.StatusCode)
+	}
+
+	return nil
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestPushKuma(t *testing.T) {
+	pushes := make(chan url.Values, 2)
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/api/push/slow" {
+			<-release
+			return
+		}
+		pushes <- r.URL.Query()
+	}))
+	defer server.Close()
+	defer close(release)
+
+	config := DefaultConfig()
+	config.KumaPushURLs = map[string]string{
+		"https://slow.example": server.URL + "/api/push/slow",
+		"https://up.example":   server.URL + "/api/push/up?status=stale",
+		"https://down.example": server.URL + "/api/push/down",
+	}
+	m := NewTestMonitor(nil, config)
+
+	// The slow push is still in flight when the others are sent.
+	m.pushKuma(&Instance{URL: "https://slow.example"}, Check{Success: true})
+	m.pushKuma(&Instance{URL: "https://up.example"}, Check{Success: true, ResponseTime: 42})
+	m.pushKuma(&Instance{URL: "https://down.example"}, Check{StatusCode: 503})
+	m.pushKuma(&Instance{URL: "https://unmapped.example"}, Check{Success: true})
+
+	got := make(map[string]url.Values)
+	for range 2 {
+		select {
+		case query := <-pushes:
+			got[query.Get("status")] = query
+		case <-time.After(2 * time.Second):
+			t.Fatalf("pushes were held up, got %v", got)
+		}
+	}
+
+	if up := got["up"]; up == nil || up.Get("msg") != "OK" || up.Get("ping") != "42" {
+		t.Errorf("up push = %v, want msg=OK ping=42", up)
+	}
+	if down := got["down"]; down == nil || down.Get("msg") != "status code 503" {
+		t.Errorf("down push = %v, want msg=\"status code 503\"", down)
+	}
+}
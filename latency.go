@@ -0,0 +1,168 @@
+package main
+
+import (
+	"time"
+)
+
+// Response time statistics a LatencyRule can watch.
+const (
+	LatencyAvg = "avg"
+	LatencyP95 = "p95"
+)
+
+// latencyBaselinePeriod is how far back the baseline of a relative
+// LatencyRule reaches.
+const latencyBaselinePeriod = 7 * 24 * time.Hour
+
+// LatencyRule marks an instance as latency degraded when a statistic of the
+// response times of its last Window checks goes over a limit: ThresholdMs,
+// BaselineMultiple times the same statistic over the 7 days before the
+// window, or the lower of the two if both are set. It recovers once the
+// statistic drops below the limit by the Hysteresis fraction. Only
+// successful checks count; failures are reported as down.
+type LatencyRule struct {
+	Window           int     `yaml:"window" json:"window"`
+	Statistic        string  `yaml:"statistic" json:"statistic"`
+	ThresholdMs      int64   `yaml:"threshold_ms" json:"threshold_ms"`
+	BaselineMultiple float64 `yaml:"baseline_multiple" json:"baseline_multiple"`
+	Hysteresis       float64 `yaml:"hysteresis" json:"hysteresis"`
+}
+
+func (r LatencyRule) enabled() bool {
+	return r.ThresholdMs > 0 || r.BaselineMultiple > 0
+}
+
+// inherit fills the fields of a group rule that are not set from the global
+// rule. The limits are the group's own.
+func (r LatencyRule) inherit(global LatencyRule) LatencyRule {
+	if r.BaselineMultiple <= 1 {
+		r.BaselineMultiple = 0
+	}
+	if r.Window < 1 {
+		r.Window = global.Window
+	}
+	if r.Statistic != LatencyAvg && r.Statistic != LatencyP95 {
+		r.Statistic = global.Statistic
+	}
+	if r.Hysteresis <= 0 || r.Hysteresis >= 1 {
+		r.Hysteresis = global.Hysteresis
+	}
+	return r
+}
+
+// latencyReading is the outcome of evaluating a LatencyRule.
+type latencyReading struct {
+	valueMs    int64
+	limitMs    int64
+	baselineMs int64
+}
+
+// latencyStatistic computes statistic over the successful checks, or
+// returns false if there are none.
+func latencyStatistic(checks []Check, statistic string) (int64, bool) {
+	successful := make([]Check, 0, len(checks))
+	for _, check := range checks {
+		if check.successes() > 0 {
+			successful = append(successful, check)
+		}
+	}
+	if len(successful) == 0 {
+		return 0, false
+	}
+	if statistic == LatencyAvg {
+		return calculateAvgResponseTime(successful), true
+	}
+	return responseTimePercentile(successful, 95), true
+}
+
+// latencyBaseline computes the rule's statistic over the 7 days of checks
+// before the window. It needs at least a window's worth of successful
+// checks to be meaningful.
+func latencyBaseline(checks []Check, rule LatencyRule) (int64, bool) {
+	if len(checks) <= rule.Window {
+		return 0, false
+	}
+	before := checks[:len(checks)-rule.Window]
+	before = checksSince(before, checks[len(checks)-1].Timestamp.Add(-latencyBaselinePeriod))
+
+	successful := 0
+	for _, check := range before {
+		if check.successes() > 0 {
+			successful++
+		}
+	}
+	if successful < rule.Window {
+		return 0, false
+	}
+	return latencyStatistic(before, rule.Statistic)
+}
+
+// evaluateLatency applies rule to the checks of an instance that is
+// currently degraded or not, and returns the reading and the new state. The
+// state is kept when there is nothing to measure.
+func evaluateLatency(checks []Check, rule LatencyRule, degraded bool) (latencyReading, bool) {
+	var reading latencyReading
+	if !rule.enabled() || len(checks) == 0 {
+		return reading, false
+	}
+
+	window := checks[max(0, len(checks)-rule.Window):]
+	value, ok := latencyStatistic(window, rule.Statistic)
+	if !ok {
+		return reading, degraded
+	}
+	reading.valueMs = value
+
+	if rule.ThresholdMs > 0 {
+		reading.limitMs = rule.ThresholdMs
+	}
+	if rule.BaselineMultiple > 0 {
+		if baseline, ok := latencyBaseline(checks, rule); ok {
+			reading.baselineMs = baseline
+			relative := int64(float64(baseline) * rule.BaselineMultiple)
+			if reading.limitMs == 0 || relative < reading.limitMs {
+				reading.limitMs = relative
+			}
+		}
+	}
+	if reading.limitMs == 0 {
+		return reading, degraded
+	}
+
+	if degraded {
+		recovery := float64(reading.limitMs) * (1 - rule.Hysteresis)
+		return reading, float64(value) >= recovery
+	}
+	return reading, value > reading.limitMs
+}
+
+// updateLatency evaluates the instance's LatencyRule after a check and
+// returns the event to send if its latency state changed. The self check
+// instance is not evaluated, its response time being the cycle duration.
+// The caller holds the instance lock.
+func (m *Monitor) updateLatency(instance *Instance) *NotificationEvent {
+	if instance.InstanceType == InstanceTypeSelf {
+		return nil
+	}
+
+	rule := m.config.LatencyRuleFor(instance.Group)
+	reading, degraded := evaluateLatency(instance.Checks, rule, instance.latencyDegraded)
+	if degraded == instance.latencyDegraded {
+		return nil
+	}
+	instance.latencyDegraded = degraded
+	// A rule switched off clears the state without an event.
+	if !rule.enabled() {
+		return nil
+	}
+
+	kind := EventLatencyRecovered
+	if degraded {
+		kind = EventLatencyDegraded
+	}
+	event := m.newNotificationEvent(instance, kind)
+	event.LatencyMs = reading.valueMs
+	event.LatencyLimitMs = reading.limitMs
+	event.LatencyBaselineMs = reading.baselineMs
+	return &event
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+// latencySeries returns successful checks an hour apart with the given
+// response times, the last one now.
+func latencySeries(responseTimes ...int64) []Check {
+	now := time.Now()
+	checks := make([]Check, len(responseTimes))
+	for i, ms := range responseTimes {
+		checks[i] = Check{
+			Timestamp:    now.Add(-time.Duration(len(responseTimes)-1-i) * time.Hour),
+			ResponseTime: ms,
+			Success:      true,
+		}
+	}
+	return checks
+}
+
+func repeat(ms int64, n int) []int64 {
+	series := make([]int64, n)
+	for i := range series {
+		series[i] = ms
+	}
+	return series
+}
+
+func TestLatencyBaseline(t *testing.T) {
+	rule := LatencyRule{Window: 3, Statistic: LatencyAvg}
+
+	tests := []struct {
+		name   string
+		checks []Check
+		want   int64
+		ok     bool
+	}{
+		{"only the window", latencySeries(100, 100, 100), 0, false},
+		{"too few before the window", latencySeries(100, 100, 500, 500, 500), 0, false},
+		{"window left out", latencySeries(append(repeat(100, 5), 900, 900, 900)...), 100, true},
+		// The hourly 1000ms checks are more than 7 days old.
+		{"older than 7 days left out", latencySeries(append(repeat(1000, 24), append(repeat(200, 7*24-2), 50, 50, 50)...)...), 200, true},
+	}
+
+	for _, tt := range tests {
+		got, ok := latencyBaseline(tt.checks, rule)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("%s: baseline = %d, %v; want %d, %v", tt.name, got, ok, tt.want, tt.ok)
+		}
+	}
+
+	// Failed checks neither count towards the baseline nor shift it.
+	checks := latencySeries(append(repeat(100, 4), 900, 900, 900)...)
+	checks[0].Success, checks[0].ResponseTime = false, 30000
+	checks[1].Success, checks[1].ResponseTime = false, 30000
+	if _, ok := latencyBaseline(checks, rule); ok {
+		t.Error("baseline from 2 successful checks, want a window's worth")
+	}
+}
+
+func TestEvaluateLatencyHysteresis(t *testing.T) {
+	rule := LatencyRule{Window: 2, Statistic: LatencyAvg, ThresholdMs: 200, Hysteresis: 0.25}
+
+	// Recovery needs the average of the last two checks below 150ms.
+	series := repeat(100, 10)
+	steps := []struct {
+		ms       int64
+		degraded bool
+	}{
+		{200, false},
+		{300, true},  // avg 250
+		{180, true},  // avg 240, under the limit but not by the margin
+		{160, true},  // avg 170
+		{130, false}, // avg 145
+		{210, false}, // avg 170
+		{250, true},  // avg 230
+	}
+
+	degraded := false
+	for i, step := range steps {
+		series = append(series, step.ms)
+		var reading latencyReading
+		reading, degraded = evaluateLatency(latencySeries(series...), rule, degraded)
+		if degraded != step.degraded {
+			t.Fatalf("step %d (%dms): degraded = %v, want %v (reading %+v)", i, step.ms, degraded, step.degraded, reading)
+		}
+	}
+}
+
+func TestEvaluateLatencyThreshold(t *testing.T) {
+	rule := LatencyRule{Window: 20, Statistic: LatencyP95, ThresholdMs: 500, Hysteresis: 0.2}
+
+	// Two slow checks in twenty make the p95.
+	checks := latencySeries(append(repeat(100, 18), 900, 900)...)
+	if reading, degraded := evaluateLatency(checks, rule, false); !degraded || reading.valueMs != 900 || reading.limitMs != 500 {
+		t.Errorf("p95 over threshold: %+v, degraded %v", reading, degraded)
+	}
+	if _, degraded := evaluateLatency(latencySeries(repeat(100, 20)...), rule, false); degraded {
+		t.Error("fast checks reported degraded")
+	}
+
+	// The lower of an absolute and a relative limit applies.
+	rule.BaselineMultiple = 3
+	checks = latencySeries(append(repeat(100, 20), repeat(400, 20)...)...)
+	if reading, degraded := evaluateLatency(checks, rule, false); !degraded || reading.limitMs != 300 {
+		t.Errorf("relative limit: %+v, degraded %v; want degraded with a 300ms limit", reading, degraded)
+	}
+
+	// Without successful checks in the window the state is kept.
+	failed := latencySeries(repeat(100, 5)...)
+	for i := range failed {
+		failed[i].Success = false
+	}
+	if _, degraded := evaluateLatency(failed, rule, true); !degraded {
+		t.Error("failed checks cleared the degraded state")
+	}
+	if _, degraded := evaluateLatency(checks, LatencyRule{}, true); degraded {
+		t.Error("a disabled rule kept the degraded state")
+	}
+}
+
+func TestUpdateLatency(t *testing.T) {
+	config := DefaultConfig()
+	config.LatencyAlertGroups = map[string]LatencyRule{"slow": {ThresholdMs: 1000}}
+	config.LatencyAlert.ThresholdMs = 200
+	instance := &Instance{Group: "fast", URL: "https://a.example", Checks: latencySeries(repeat(300, 10)...)}
+	m := NewTestMonitor([]*Instance{instance}, config)
+
+	event := m.updateLatency(instance)
+	if event == nil || event.Event != EventLatencyDegraded || event.LatencyMs != 300 || event.LatencyLimitMs != 200 {
+		t.Fatalf("event = %+v, want latency_degraded at 300ms over 200ms", event)
+	}
+	if !instance.data().LatencyDegraded {
+		t.Error("instance data not tagged latency_degraded")
+	}
+	if event := m.updateLatency(instance); event != nil {
+		t.Errorf("second evaluation sent %+v, want no event", event)
+	}
+
+	// The group rule inherits the window and hysteresis but not the limit.
+	instance.Group = "slow"
+	event = m.updateLatency(instance)
+	if event == nil || event.Event != EventLatencyRecovered || event.LatencyLimitMs != 1000 {
+		t.Fatalf("event = %+v, want latency_recovered under the group's 1000ms", event)
+	}
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"io"
+	"log"
+	"os"
+	"strconv"
+	"time"
+)
+
+// Values of LOG_TIMESTAMP_FORMAT.
+const (
+	LogTimestampDefault = "default"
+	LogTimestampUnix    = "unix"
+	LogTimestampRFC3339 = "rfc3339"
+	LogTimestampNone    = "none"
+)
+
+// configureLogTimestamps sets how the standard logger timestamps its lines.
+// File and line numbers are kept in every format.
+func configureLogTimestamps(format string) {
+	switch format {
+	case LogTimestampNone:
+		log.SetFlags(log.Lshortfile)
+		log.SetOutput(os.Stderr)
+	case LogTimestampUnix, LogTimestampRFC3339:
+		log.SetFlags(log.Lshortfile)
+		log.SetOutput(&timestampWriter{w: os.Stderr, format: format})
+	default:
+		log.SetFlags(log.LstdFlags | log.Lshortfile)
+		log.SetOutput(os.Stderr)
+	}
+}
+
+// timestampWriter prefixes each log line with the time in a format the log
+// package does not offer. The logger writes every line in a single call.
+type timestampWriter struct {
+	w      io.Writer
+	format string
+}
+
+func (t *timestampWriter) Write(p []byte) (int, error) {
+	now := time.Now()
+	var line []byte
+	if t.format == LogTimestampUnix {
+		line = strconv.AppendInt(line, now.Unix(), 10)
+	} else {
+		line = now.AppendFormat(line, time.RFC3339)
+	}
+	line = append(line, ' ')
+	line = append(line, p...)
+
+	if _, err := t.w.Write(line); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
@@ -2,6 +2,8 @@ package main
 
 import (
 	"context"
+	"errors"
+	"flag"
 	"log"
 	"net/http"
 	"os"
@@ -12,32 +14,132 @@ import (
 
 func main() {
 	log.SetFlags(log.LstdFlags | log.Lshortfile)
+
+	configPath := flag.String("config", "", "path to a YAML config file")
+	once := flag.Bool("once", false, "check every instance once, print a report and exit")
+	format := flag.String("format", "json", "report format for -once: json or table")
+	dryRunConfig := flag.Bool("dry-run-config", false, "validate the config and instance list, then exit")
+	flag.Parse()
+
+	// "validate [path-or-url]" checks an instances JSON and exits.
+	validate := flag.Arg(0) == "validate"
+
+	var config *Config
+	var pages []Page
+	if *configPath != "" {
+		var err error
+		config, err = LoadConfigFromFile(*configPath)
+		if err != nil {
+			log.Fatalf("Failed to load config: %v", err)
+		}
+		pages, err = LoadPagesFromFile(*configPath)
+		if err != nil {
+			log.Fatalf("Failed to load config: %v", err)
+		}
+	} else {
+		config = LoadConfig()
+	}
+	configureLogTimestamps(config.LogTimestampFormat)
+
+	if validate {
+		os.Exit(runValidate(config, flag.Arg(1)))
+	}
 	log.Println("Starting API Monitor...")
 
-	config := LoadConfig()
-	config.LogConfig()
+	if len(pages) == 0 {
+		config.LogConfig()
+	}
+	for _, page := range pages {
+		log.Printf("Page %s:", page.Path)
+		page.Config.LogConfig()
+	}
 
-	monitor := NewMonitor(config)
-	if err := monitor.Initialize(); err != nil {
-		log.Fatalf("Failed to initialize monitor: %v", err)
+	if *dryRunConfig {
+		if len(pages) == 0 {
+			os.Exit(runDryRunConfig(os.Stdout, []*Config{config}))
+		}
+		configs := make([]*Config, 0, len(pages))
+		for _, page := range pages {
+			configs = append(configs, page.Config)
+		}
+		os.Exit(runDryRunConfig(os.Stdout, configs))
 	}
 
-	go monitor.Start()
+	if *once {
+		if len(pages) == 0 {
+			os.Exit(runOnce(os.Stdout, config, *format))
+		}
+		code := exitAllUp
+		for _, page := range pages {
+			code = max(code, runOnce(os.Stdout, page.Config, *format))
+		}
+		os.Exit(code)
+	}
+
+	// Each page has its own monitor; without pages there is a single one
+	// served at the root.
+	var monitors []*Monitor
+	var handler http.Handler
+	if len(pages) == 0 {
+		monitor := NewMonitor(config)
+		monitors = append(monitors, monitor)
+		handler = NewServer(monitor, config).SetupRoutes()
+	} else {
+		root := NewServer(nil, config)
+		servers := make([]*Server, 0, len(pages))
+		for _, page := range pages {
+			monitor := NewMonitor(page.Config)
+			monitors = append(monitors, monitor)
+			servers = append(servers, root.NewPageServer(monitor, page))
+		}
+		handler = root.SetupPageRoutes(servers)
+	}
 
-	server := NewServer(monitor, config)
-	mux := server.SetupRoutes()
+	// Under systemd, report readiness once every monitor has finished its
+	// first cycle and feed the watchdog after every cycle. Both are no-ops
+	// elsewhere.
+	onCycle := systemdOnCycle(len(monitors), systemdWatchdogEnabled())
+	for _, monitor := range monitors {
+		monitor.OnCycle = onCycle
+	}
+
+	for _, monitor := range monitors {
+		monitor.addConfiguredNotifiers()
+	}
 
-	httpServer := &http.Server{
-		Addr:         config.Port,
-		Handler:      mux,
-		ReadTimeout:  15 * time.Second,
-		WriteTimeout: 15 * time.Second,
-		IdleTimeout:  60 * time.Second,
+	// The server comes up right away and reports the "starting" state until
+	// the instance list is loaded and the first check cycle has completed.
+	for _, monitor := range monitors {
+		go func() {
+			if err := monitor.Initialize(context.Background()); err != nil {
+				if errors.Is(err, context.Canceled) {
+					return
+				}
+				// Exiting lets a supervisor restart the process rather than
+				// serve a page that never leaves the starting state.
+				log.Fatalf("Failed to initialize monitor: %v", err)
+			}
+			monitor.Start(context.Background())
+		}()
+	}
+
+	httpServer := newHTTPServer(config, handler)
+
+	listener, err := systemdListener()
+	if err != nil {
+		log.Fatalf("Failed to set up listener: %v", err)
 	}
 
 	go func() {
-		log.Printf("Server listening on %s", config.Port)
-		if err := httpServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		var err error
+		if listener != nil {
+			log.Printf("Server listening on socket from systemd (%s)", listener.Addr())
+			err = httpServer.Serve(listener)
+		} else {
+			log.Printf("Server listening on %s", config.Port)
+			err = httpServer.ListenAndServe()
+		}
+		if err != nil && err != http.ErrServerClosed {
 			log.Fatalf("Server error: %v", err)
 		}
 	}()
@@ -47,6 +149,12 @@ func main() {
 	<-quit
 
 	log.Println("Shutting down server...")
+	if err := sdNotify("STOPPING=1"); err != nil {
+		log.Printf("Warning: %v", err)
+	}
+	for _, monitor := range monitors {
+		monitor.Stop()
+	}
 
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
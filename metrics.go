@@ -0,0 +1,187 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+type Metrics struct {
+	Instances        int               `json:"instances"`
+	UpInstances      int               `json:"up_instances"`
+	PendingInstances int               `json:"pending_instances"`
+	AvgUptimePercent float64           `json:"avg_uptime_percent"`
+	SSEClients       int               `json:"sse_clients"`
+	HandlerPanics    uint64            `json:"handler_panics"`
+	InstanceMetrics  []InstanceMetrics `json:"instance_metrics"`
+}
+
+type InstanceMetrics struct {
+	URL            string  `json:"url"`
+	Group          string  `json:"group"`
+	Type           string  `json:"type"`
+	Up             bool    `json:"up"`
+	ResponseTimeMs int64   `json:"response_time_ms"`
+	UptimePercent  float64 `json:"uptime_percent"`
+}
+
+func (m *Monitor) Metrics() Metrics {
+	m.clientsMu.RLock()
+	clients := len(m.clients)
+	m.clientsMu.RUnlock()
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	metrics := Metrics{
+		Instances:       len(m.instances),
+		SSEClients:      clients,
+		InstanceMetrics: make([]InstanceMetrics, 0, len(m.instances)),
+	}
+
+	totalUptime := 0.0
+	for _, instance := range m.instances {
+		instance.mu.RLock()
+		status := instanceStatus(instance.Checks)
+		uptime := instance.uptimeOver(uptimeAll)
+		var responseTime int64
+		if len(instance.Checks) > 0 {
+			responseTime = instance.Checks[len(instance.Checks)-1].ResponseTime
+		}
+		instance.mu.RUnlock()
+
+		switch status {
+		case StatusUp:
+			metrics.UpInstances++
+		case StatusPending:
+			metrics.PendingInstances++
+		}
+		totalUptime += uptime
+
+		metrics.InstanceMetrics = append(metrics.InstanceMetrics, InstanceMetrics{
+			URL:            instance.URL,
+			Group:          instance.Group,
+			Type:           instance.InstanceType,
+			Up:             status == StatusUp,
+			ResponseTimeMs: responseTime,
+			UptimePercent:  uptime,
+		})
+	}
+
+	if metrics.Instances > 0 {
+		metrics.AvgUptimePercent = totalUptime / float64(metrics.Instances)
+	}
+
+	return metrics
+}
+
+// WriteOpenMetrics writes metrics in the OpenMetrics text exposition format,
+// followed by perInstance, the gauges of PrometheusInstanceGauges.
+func (metrics Metrics) WriteOpenMetrics(w io.Writer, perInstance string) error {
+	return metrics.writeText(w, perInstance, true)
+}
+
+// WritePrometheus writes the same metrics as WriteOpenMetrics in the
+// Prometheus text format.
+func (metrics Metrics) WritePrometheus(w io.Writer, perInstance string) error {
+	return metrics.writeText(w, perInstance, false)
+}
+
+// writeText writes the fleet metrics and perInstance in either text format.
+// They differ only in how counters are declared and in the # EOF line.
+func (metrics Metrics) writeText(w io.Writer, perInstance string, openMetrics bool) error {
+	var b strings.Builder
+
+	writeGauge := func(name, help string, value interface{}) {
+		fmt.Fprintf(&b, "# HELP %s %s\n# TYPE %s gauge\n%s %v\n", name, help, name, name, value)
+	}
+
+	writeGauge("status_instances", "Number of monitored instances.", metrics.Instances)
+	writeGauge("status_instances_up", "Number of instances whose last check succeeded.", metrics.UpInstances)
+	writeGauge("status_instances_pending", "Number of instances that have not been checked yet.", metrics.PendingInstances)
+	writeGauge("status_avg_uptime_percent", "Average uptime across all instances.", metrics.AvgUptimePercent)
+	writeGauge("status_sse_clients", "Number of connected SSE clients.", metrics.SSEClients)
+
+	// OpenMetrics declares a counter without the _total suffix of its
+	// sample, the Prometheus format with it.
+	panics := "status_handler_panics_total"
+	if openMetrics {
+		panics = "status_handler_panics"
+	}
+	fmt.Fprintf(&b, "# HELP %s Number of panics recovered in HTTP handlers.\n# TYPE %s counter\nstatus_handler_panics_total %d\n", panics, panics, metrics.HandlerPanics)
+
+	b.WriteString(perInstance)
+	if openMetrics {
+		b.WriteString("# EOF\n")
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func escapeLabelValue(value string) string {
+	value = strings.ReplaceAll(value, `\`, `\\`)
+	value = strings.ReplaceAll(value, `"`, `\"`)
+	return strings.ReplaceAll(value, "\n", `\n`)
+}
+
+// ExportPrometheusMetrics writes per-instance gauges in the Prometheus text
+// format. The output is built under a single read lock and written to w
+// after it is released, so a slow writer does not hold up checks.
+func (m *Monitor) ExportPrometheusMetrics(w io.Writer) error {
+	_, err := io.WriteString(w, m.PrometheusInstanceGauges())
+	return err
+}
+
+// PrometheusInstanceGauges returns the per-instance gauges of
+// ExportPrometheusMetrics.
+func (m *Monitor) PrometheusInstanceGauges() string {
+	type sample struct {
+		labels              string
+		up                  int
+		responseTime        int64
+		uptime              float64
+		consecutiveFailures int
+	}
+
+	m.mu.RLock()
+	samples := make([]sample, 0, len(m.instances))
+	for _, instance := range m.instances {
+		instance.mu.RLock()
+		s := sample{
+			labels: fmt.Sprintf("url=\"%s\",group=\"%s\",type=\"%s\"",
+				escapeLabelValue(instance.URL), escapeLabelValue(instance.Group), escapeLabelValue(instance.InstanceType)),
+			uptime:              instance.uptimeOver(uptimeAll),
+			consecutiveFailures: consecutiveFailures(instance.Checks),
+		}
+		if instanceStatus(instance.Checks) == StatusUp {
+			s.up = 1
+		}
+		if len(instance.Checks) > 0 {
+			s.responseTime = instance.Checks[len(instance.Checks)-1].ResponseTime
+		}
+		instance.mu.RUnlock()
+		samples = append(samples, s)
+	}
+	m.mu.RUnlock()
+
+	gauges := []struct {
+		name  string
+		help  string
+		value func(sample) interface{}
+	}{
+		{"instance_up", "Whether the last check of the instance succeeded.", func(s sample) interface{} { return s.up }},
+		{"instance_response_time_ms", "Response time of the last check in milliseconds.", func(s sample) interface{} { return s.responseTime }},
+		{"instance_uptime_percent", "Uptime of the instance over its check history.", func(s sample) interface{} { return s.uptime }},
+		{"instance_consecutive_failures", "Number of failed checks since the last success.", func(s sample) interface{} { return s.consecutiveFailures }},
+	}
+
+	var b strings.Builder
+	for _, gauge := range gauges {
+		fmt.Fprintf(&b, "# HELP %s %s\n# TYPE %s gauge\n", gauge.name, gauge.help, gauge.name)
+		for _, s := range samples {
+			fmt.Fprintf(&b, "%s{%s} %v\n", gauge.name, s.labels, gauge.value(s))
+		}
+	}
+	return b.String()
+}
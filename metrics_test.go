@@ -0,0 +1,91 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestExportPrometheusMetrics(t *testing.T) {
+	s := newSortTestServer()
+	s.monitor.instances[0].Group = `be"ta`
+
+	var buf bytes.Buffer
+	if err := s.monitor.ExportPrometheusMetrics(&buf); err != nil {
+		t.Fatalf("ExportPrometheusMetrics: %v", err)
+	}
+	out := buf.String()
+
+	for _, line := range []string{
+		"# TYPE instance_up gauge",
+		`instance_up{url="https://c.example",group="be\"ta",type="api"} 0`,
+		`instance_up{url="https://a.example",group="beta",type="api"} 1`,
+		`instance_up{url="https://d.example",group="alpha",type="ui"} 0`,
+		`instance_response_time_ms{url="https://b.example",group="alpha",type="ui"} 200`,
+		`instance_uptime_percent{url="https://c.example",group="be\"ta",type="api"} 50`,
+		`instance_consecutive_failures{url="https://c.example",group="be\"ta",type="api"} 1`,
+		`instance_consecutive_failures{url="https://a.example",group="beta",type="api"} 0`,
+	} {
+		if !strings.Contains(out, line+"\n") {
+			t.Errorf("output has no line %q:\n%s", line, out)
+		}
+	}
+}
+
+func TestMetricsPrometheusFormat(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+	req.Header.Set("Accept", "text/plain;version=0.0.4")
+	rec := httptest.NewRecorder()
+	newSortTestServer().SetupRoutes().ServeHTTP(rec, req)
+
+	if got := rec.Header().Get("Content-Type"); !strings.HasPrefix(got, "text/plain") {
+		t.Errorf("Content-Type = %q, want text/plain", got)
+	}
+	body := rec.Body.String()
+	for _, line := range []string{
+		"# TYPE status_instances gauge\n",
+		"# TYPE status_handler_panics_total counter\nstatus_handler_panics_total 0\n",
+		"# TYPE instance_up gauge\n",
+		`instance_up{url="https://a.example",group="beta",type="api"} 1` + "\n",
+	} {
+		if !strings.Contains(body, line) {
+			t.Errorf("body has no line %q:\n%s", line, body)
+		}
+	}
+	if strings.Contains(body, "# EOF") {
+		t.Errorf("Prometheus text has an # EOF line:\n%s", body)
+	}
+}
+
+func TestMetricsPrometheusScrape(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+	// The Accept header Prometheus sends on a default scrape.
+	req.Header.Set("Accept", "application/openmetrics-text;version=1.0.0,application/openmetrics-text;version=0.0.1;q=0.75,text/plain;version=0.0.4;q=0.5,*/*;q=0.1")
+	rec := httptest.NewRecorder()
+	newSortTestServer().SetupRoutes().ServeHTTP(rec, req)
+
+	if got := rec.Header().Get("Content-Type"); !strings.HasPrefix(got, "application/openmetrics-text") {
+		t.Errorf("Content-Type = %q, want OpenMetrics", got)
+	}
+	body := rec.Body.String()
+	for _, line := range []string{
+		"# TYPE status_instances gauge\n",
+		"# TYPE status_handler_panics counter\nstatus_handler_panics_total 0\n",
+		"# TYPE instance_up gauge\n",
+		`instance_up{url="https://a.example",group="beta",type="api"} 1` + "\n",
+		`instance_consecutive_failures{url="https://c.example",group="beta",type="api"} 1` + "\n",
+	} {
+		if !strings.Contains(body, line) {
+			t.Errorf("body has no line %q:\n%s", line, body)
+		}
+	}
+	// Each value is exported under one metric family only.
+	if n := strings.Count(body, `{url="https://a.example",`); n != 4 {
+		t.Errorf("a.example has %d samples, want 4:\n%s", n, body)
+	}
+	if !strings.HasSuffix(body, "\n# EOF\n") {
+		t.Errorf("body does not end with # EOF:\n%s", body)
+	}
+}
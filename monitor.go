@@ -1,13 +1,23 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
+	"maps"
+	"math"
+	"net"
 	"net/http"
+	"net/http/httptrace"
+	"reflect"
+	"slices"
+	"sort"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -19,463 +29,1766 @@ type Instance struct {
 	GroupOrder   int     `json:"group_order"`
 	Index        int     `json:"index"`
 	Checks       []Check `json:"checks"`
-	mu           sync.RWMutex
+
+	RequiredHeaders      map[string]string      `json:"-"`
+	CheckIntervalSeconds int                    `json:"check_interval_seconds,omitempty"`
+	Metadata             map[string]interface{} `json:"metadata,omitempty"`
+	Days                 map[string]DayStats    `json:"days,omitempty"`
+
+	mu sync.RWMutex
+
+	// modified is when the instance's data last changed, for /api/changes.
+	modified time.Time
+
+	// attempt is the check attempt in progress, counting retries from 1, or
+	// 0 when the instance is not being checked.
+	attempt atomic.Int32
+
+	// lastSuccessAt and lastFailureAt are the times of the latest successful
+	// and failed checks, nil until there is one. They can be read without
+	// the lock.
+	lastSuccessAt atomic.Pointer[time.Time]
+	lastFailureAt atomic.Pointer[time.Time]
+
+	// lastSucceeded is whether the latest check succeeded. The times above
+	// cannot tell, since appendCheck may give two checks the same time.
+	lastSucceeded atomic.Bool
+
+	// uptime keeps the uptime over the history and recent periods as
+	// running totals.
+	uptime uptimeWindows
+
+	// latencyDegraded is set while the instance's latency is over its
+	// LatencyRule.
+	latencyDegraded bool
+
+	// The content fingerprints of a UI instance, see updateContent.
+	contentBaseline   string
+	contentCandidate  string
+	contentMismatches int
+	contentChanged    bool
+
+	// firstSeen is when the instance was first in the list, and lifetime
+	// counts its checks since then. Both survive removal in the archive.
+	firstSeen time.Time
+	lifetime  lifetimeStats
 }
 
 type Check struct {
 	Timestamp    time.Time `json:"timestamp"`
+	InstanceType string    `json:"instance_type"`
 	StatusCode   int       `json:"status_code"`
 	ResponseTime int64     `json:"response_time"`
 	Success      bool      `json:"success"`
 	Error        string    `json:"error,omitempty"`
+	ErrorType    string    `json:"error_type,omitempty"`
+	ResolvedIPs  []string  `json:"resolved_ips,omitempty"`
+	TTFB         int64     `json:"ttfb,omitempty"`
+	DownloadTime int64     `json:"download_time,omitempty"`
+	BodySize     int64     `json:"body_size,omitempty"`
+	Fingerprint  string    `json:"fingerprint,omitempty"`
+	Compacted    bool      `json:"compacted,omitempty"`
+	Count        int       `json:"count,omitempty"`
+	SuccessCount int       `json:"success_count,omitempty"`
+
+	RequestID string `json:"request_id,omitempty"`
+	CheckURL  string `json:"check_url,omitempty"`
+
+	IPFamily       string `json:"ip_family,omitempty"`
+	SuccessV4      *bool  `json:"success_v4,omitempty"`
+	SuccessV6      *bool  `json:"success_v6,omitempty"`
+	ResponseTimeV4 int64  `json:"response_time_v4,omitempty"`
+	ResponseTimeV6 int64  `json:"response_time_v6,omitempty"`
 }
 
 type Monitor struct {
-	instances []*Instance
-	clients   map[chan []byte]bool
-	config    *Config
-	mu        sync.RWMutex
-	clientsMu sync.RWMutex
+	instances  []*Instance
+	groupMeta  map[string]GroupMeta
+	clients    map[chan []byte]*streamClient
+	archive    []ArchivedInstance
+	removals   map[string]time.Time
+	config     *Config
+	dispatcher *Dispatcher
+	notifiers  []Notifier
+	source     SourceReader
+	resolver   *net.Resolver
+	transports map[string]*http.Transport
+
+	hostLimiter *hostLimiter
+
+	schedule    schedule
+	lastCheckAt time.Time
+	lastCycle   cycleReport
+	scheduleMu  sync.Mutex
+
+	// self is the instance standing for the monitor itself, if SELF_CHECK
+	// is on.
+	self      *Instance
+	startedAt time.Time
+
+	configChanged   chan struct{}
+	scheduleChanged chan struct{}
+	refreshing      atomic.Bool
+	// refreshQueued asks the running refresh to refresh once more when it
+	// finishes.
+	refreshQueued atomic.Bool
+
+	// excluded counts the instances of the list left out by the
+	// InstanceFilter at the last refresh.
+	excluded atomic.Int64
+
+	// stopped is cancelled by Stop to end Start and cancel in-flight checks.
+	stopped context.Context
+	stop    context.CancelFunc
+
+	// running is set once the first check cycle has completed.
+	running atomic.Bool
+
+	// dataVersion changes whenever an update is broadcast.
+	dataVersion atomic.Uint64
+
+	// OnCycle, if set before Start, is called after every completed check
+	// cycle. first is true for the cycle that ends startup.
+	OnCycle func(first bool)
+
+	mu          sync.RWMutex
+	clientsMu   sync.RWMutex
+	notifiersMu sync.RWMutex
 }
 
 func NewMonitor(config *Config) *Monitor {
+	resolver := newResolver(config.DNSServers)
+	stopped, stop := context.WithCancel(context.Background())
+
 	return &Monitor{
-		instances: make([]*Instance, 0),
-		clients:   make(map[chan []byte]bool),
-		config:    config,
+		instances:  make([]*Instance, 0),
+		clients:    make(map[chan []byte]*streamClient),
+		config:     config,
+		dispatcher: NewDispatcher(100, 4, config.RequestTimeout, config.IsDebug),
+		resolver:   resolver,
+		transports: newCheckTransports(resolver),
+
+		hostLimiter: newHostLimiter(config.HostConcurrency, config.HostRequestsPerSecond),
+
+		configChanged:   make(chan struct{}, 1),
+		scheduleChanged: make(chan struct{}, 1),
+
+		stopped: stopped,
+		stop:    stop,
+
+		self:      newSelfInstance(config),
+		startedAt: time.Now(),
+	}
+}
+
+// NotifyConfigChanged makes Start pick up new check and refresh intervals.
+func (m *Monitor) NotifyConfigChanged() {
+	select {
+	case m.configChanged <- struct{}{}:
+	default:
+	}
+}
+
+// Monitor states reported by State.
+const (
+	StateStarting = "starting"
+	StateRunning  = "running"
+)
+
+// State reports whether the monitor is still starting up, that is loading the
+// instance list or running its first check cycle.
+func (m *Monitor) State() string {
+	if m.running.Load() {
+		return StateRunning
+	}
+	return StateStarting
+}
+
+const (
+	initialFetchBackoff = time.Second
+	maxFetchBackoff     = time.Minute
+)
+
+// Initialize loads the instance list, retrying with backoff until it
+// succeeds, the monitor is stopped or MaxStartupWait has passed. Only an
+// invalid INSTANCES_URL fails right away.
+func (m *Monitor) Initialize(ctx context.Context) error {
+	if err := m.openSource(); err != nil {
+		return err
+	}
+
+	ctx, cancel := m.withStop(ctx)
+	defer cancel()
+	if wait := m.config.MaxStartupWait; wait > 0 {
+		ctx, cancel = context.WithTimeout(ctx, wait)
+		defer cancel()
+	}
+
+	return m.WaitForInstancesURL(ctx)
+}
+
+// WaitForInstancesURL loads the instance list, retrying with exponential
+// backoff until it succeeds or ctx is done. The error then wraps ctx.Err().
+func (m *Monitor) WaitForInstancesURL(ctx context.Context) error {
+	backoff := initialFetchBackoff
+	for {
+		_, err := m.updateInstances(ctx)
+		if err == nil {
+			return nil
+		}
+		log.Printf("Failed to load instances, retrying in %v: %v", backoff, err)
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("failed to load instances from %s: %w (last error: %v)", m.config.InstancesURL, ctx.Err(), err)
+		case <-time.After(backoff):
+		}
+		backoff = nextFetchBackoff(backoff)
 	}
 }
 
-func (m *Monitor) Initialize() error {
-	return m.updateInstances()
+// nextFetchBackoff doubles the wait between instance list fetches up to
+// maxFetchBackoff.
+func nextFetchBackoff(backoff time.Duration) time.Duration {
+	return min(backoff*2, maxFetchBackoff)
+}
+
+// RunOnce loads the instance list, runs a single check cycle and returns the
+// results.
+func (m *Monitor) RunOnce(ctx context.Context) ([]InstanceData, error) {
+	if err := m.openSource(); err != nil {
+		return nil, err
+	}
+	if _, err := m.updateInstances(ctx); err != nil {
+		return nil, err
+	}
+
+	m.checkAll(ctx)
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	return m.GetInstancesData(), nil
+}
+
+func (m *Monitor) openSource() error {
+	source, err := NewSourceReader(m.config.InstancesURL, m.config.InstancesRequestHeaders, m.config.InstancesAuth())
+	if err != nil {
+		return err
+	}
+	m.source = source
+	return nil
+}
+
+// cycleCompleted marks the end of a check cycle, the first of which ends
+// startup.
+func (m *Monitor) cycleCompleted() {
+	first := m.running.CompareAndSwap(false, true)
+	if m.OnCycle != nil {
+		m.OnCycle(first)
+	}
+}
+
+// withStop returns a context that is also cancelled by Stop.
+func (m *Monitor) withStop(ctx context.Context) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(ctx)
+	stop := context.AfterFunc(m.stopped, cancel)
+	return ctx, func() {
+		stop()
+		cancel()
+	}
 }
 
 // --- START OF FIX ---
 
 // ApiGroupDetail defines the inner structure of an API group in the JSON.
 type ApiGroupDetail struct {
-	URLs []string `json:"urls"`
-	Cors bool     `json:"cors"`
+	URLs            []InstanceEntry   `json:"urls"`
+	Cors            bool              `json:"cors"`
+	RequiredHeaders map[string]string `json:"check_required_headers,omitempty"`
+
+	CheckIntervalSeconds int `json:"check_interval_seconds,omitempty"`
+
+	Meta *GroupMeta `json:"meta,omitempty"`
+}
+
+// UIGroupDetail is a UI group in the JSON: either a plain array of entries,
+// or an object with "urls" and an optional "meta".
+type UIGroupDetail struct {
+	URLs []InstanceEntry `json:"urls"`
+	Meta *GroupMeta      `json:"meta,omitempty"`
+
+	CheckIntervalSeconds int `json:"check_interval_seconds,omitempty"`
+}
+
+func (g *UIGroupDetail) UnmarshalJSON(data []byte) error {
+	var entries []InstanceEntry
+	if err := json.Unmarshal(data, &entries); err == nil {
+		g.URLs = entries
+		g.Meta = nil
+		return nil
+	}
+
+	type plain UIGroupDetail
+	var detail plain
+	if err := json.Unmarshal(data, &detail); err != nil {
+		return fmt.Errorf("UI group must be an array of instances or an object: %w", err)
+	}
+	*g = UIGroupDetail(detail)
+	return nil
 }
 
 // InstancesJSON defines the top-level structure of the instances.json file.
 // The `API` field is now a map of string to ApiGroupDetail, which matches the JSON.
 type InstancesJSON struct {
-	API map[string]ApiGroupDetail `json:"api"`
-	UI  map[string][]string       `json:"ui"`
+	Version json.Number               `json:"version,omitempty"`
+	API     map[string]ApiGroupDetail `json:"api"`
+	UI      map[string]UIGroupDetail  `json:"ui"`
+}
+
+// InstanceEntry is a single instance in the instances JSON. It is either a
+// plain URL string or an object with a "url" key, an optional
+// "check_interval_seconds" overriding the group's, and arbitrary metadata
+// such as country or hosting provider.
+type InstanceEntry struct {
+	URL                  string
+	CheckIntervalSeconds int
+	Metadata             map[string]interface{}
+}
+
+func (e *InstanceEntry) UnmarshalJSON(data []byte) error {
+	var url string
+	if err := json.Unmarshal(data, &url); err == nil {
+		e.URL = url
+		e.CheckIntervalSeconds = 0
+		e.Metadata = nil
+		return nil
+	}
+
+	var fields map[string]interface{}
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return fmt.Errorf("instance entry must be a URL string or an object: %w", err)
+	}
+
+	url, ok := fields["url"].(string)
+	if !ok || url == "" {
+		return fmt.Errorf("instance entry object is missing a \"url\" string")
+	}
+	delete(fields, "url")
+
+	e.CheckIntervalSeconds = 0
+	if raw, ok := fields["check_interval_seconds"]; ok {
+		seconds, ok := raw.(float64)
+		if !ok || seconds < 0 || seconds != math.Trunc(seconds) {
+			return fmt.Errorf("instance entry %s: check_interval_seconds must be a whole number of seconds", url)
+		}
+		e.CheckIntervalSeconds = int(seconds)
+		delete(fields, "check_interval_seconds")
+	}
+
+	e.URL = url
+	e.Metadata = fields
+	return nil
 }
 
 // --- END OF FIX ---
 
-func (m *Monitor) updateInstances() error {
-	resp, err := http.Get(m.config.InstancesURL)
-	if err != nil {
-		return fmt.Errorf("failed to fetch instances: %w", err)
+// RefreshResult summarizes a reload of the instance list.
+type RefreshResult struct {
+	Added   int `json:"added"`
+	Removed int `json:"removed"`
+	Total   int `json:"total"`
+}
+
+// ErrRefreshInProgress is returned by Refresh while another refresh of the
+// instance list is running.
+var ErrRefreshInProgress = errors.New("instance refresh already in progress")
+
+// Refresh reloads the instance list and reschedules checks, unless another
+// refresh is already running.
+func (m *Monitor) Refresh(ctx context.Context) (RefreshResult, error) {
+	if !m.refreshing.CompareAndSwap(false, true) {
+		return RefreshResult{}, ErrRefreshInProgress
 	}
-	defer resp.Body.Close()
+	defer m.endRefresh(ctx)
 
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("failed to fetch instances with unexpected status code: %d", resp.StatusCode)
+	return m.refresh(ctx)
+}
+
+// QueueRefresh reloads the instance list like Refresh, but if another
+// refresh is running it returns at once and that refresh runs again when it
+// finishes, so a change it may have read too early is not missed.
+func (m *Monitor) QueueRefresh(ctx context.Context) error {
+	m.refreshQueued.Store(true)
+	if !m.refreshing.CompareAndSwap(false, true) {
+		return nil
 	}
+	defer m.endRefresh(ctx)
+
+	m.refreshQueued.Store(false)
+	_, err := m.refresh(ctx)
+	return err
+}
 
-	body, err := io.ReadAll(resp.Body)
+// endRefresh runs the refreshes queued during a refresh and then lets the
+// next one start.
+func (m *Monitor) endRefresh(ctx context.Context) {
+	for {
+		for m.refreshQueued.Swap(false) {
+			log.Println("Refreshing instance list again for a queued refresh...")
+			if _, err := m.refresh(ctx); err != nil {
+				log.Printf("Error refreshing instances: %v", err)
+			}
+		}
+		m.refreshing.Store(false)
+
+		// A refresh queued just before the store above found this one still
+		// running, so it has to be picked up here.
+		if !m.refreshQueued.Load() || !m.refreshing.CompareAndSwap(false, true) {
+			return
+		}
+	}
+}
+
+func (m *Monitor) refresh(ctx context.Context) (RefreshResult, error) {
+	result, err := m.updateInstances(ctx)
 	if err != nil {
-		return fmt.Errorf("failed to read response body: %w", err)
+		return result, err
 	}
 
-	var data InstancesJSON
-	if err := json.Unmarshal(body, &data); err != nil {
-		// This is where your error was coming from.
-		// The error message will now be much more informative if the structure changes again.
-		return fmt.Errorf("failed to parse instances JSON: %w", err)
+	m.rebuildSchedule()
+	select {
+	case m.scheduleChanged <- struct{}{}:
+	default:
 	}
 
-	apiOrder := extractOrderFromJSON(string(body), "api")
-	uiOrder := extractOrderFromJSON(string(body), "ui")
+	return result, nil
+}
+
+func (m *Monitor) updateInstances(ctx context.Context) (RefreshResult, error) {
+	body, err := fetchInstanceList(ctx, m.source, m.config.InstancesRequestTimeout)
+	if err != nil {
+		return RefreshResult{}, err
+	}
+
+	specs, issues, err := parseInstanceList(body)
+	if err != nil {
+		return RefreshResult{}, err
+	}
+	specs, excluded := filterInstances(specs, m.config.CurrentInstanceFilter())
+	if previous := m.excluded.Swap(int64(len(excluded))); previous != int64(len(excluded)) {
+		log.Printf("Instance list: %d instances excluded by the config", len(excluded))
+	}
+	if m.config.IsDebug() {
+		for _, instanceURL := range excluded {
+			log.Printf("Instance list: excluding %s", instanceURL)
+		}
+	}
+	applyGroupOrder(specs, m.config.GroupOrder)
+	for _, issue := range issues {
+		// A newer format version is worth knowing about without debug logging.
+		if issue.Severity == SeverityError || issue.Path == "version" || m.config.IsDebug() {
+			log.Printf("Instance list: %s", issue)
+		}
+	}
 
 	m.mu.RLock()
 	existingInstances := make(map[string]*Instance)
 	for _, inst := range m.instances {
-		existingInstances[inst.URL] = inst
+		if inst != m.self {
+			existingInstances[inst.URL] = inst
+		}
 	}
 	m.mu.RUnlock()
 
 	var updatedInstances []*Instance
-	groupIndex := 0
-
-	// Process API instances
-	for _, group := range apiOrder {
-		if groupDetails, ok := data.API[group]; ok {
-			for _, instanceURL := range groupDetails.URLs {
-				if existing, ok := existingInstances[instanceURL]; ok {
-					existing.Group = group
-					existing.GroupOrder = groupIndex
-					existing.Cors = groupDetails.Cors
-					existing.InstanceType = "api" // Important: Update type on refresh
-					updatedInstances = append(updatedInstances, existing)
-					delete(existingInstances, instanceURL)
-				} else {
-					instance := &Instance{
-						Group:        group,
-						URL:          instanceURL,
-						InstanceType: "api",
-						Cors:         groupDetails.Cors,
-						GroupOrder:   groupIndex,
-						Checks:       make([]Check, 0, m.config.MaxCheckHistory),
-					}
-					updatedInstances = append(updatedInstances, instance)
-				}
+	var addedInstances []*Instance
+	var modifiedURLs []string
+	now := time.Now()
+	initialLoad := len(existingInstances) == 0
+
+	for _, spec := range specs {
+		if existing, ok := existingInstances[spec.URL]; ok {
+			existing.mu.Lock()
+			if existing.Group != spec.Group || existing.GroupOrder != spec.GroupOrder ||
+				existing.Cors != spec.Cors || existing.InstanceType != spec.InstanceType ||
+				existing.CheckIntervalSeconds != spec.CheckIntervalSeconds ||
+				!reflect.DeepEqual(existing.Metadata, spec.Metadata) {
+				existing.modified = now
+				modifiedURLs = append(modifiedURLs, spec.URL)
 			}
-			groupIndex++
-		}
-	}
-
-	// Process UI instances
-	for _, group := range uiOrder {
-		if urls, ok := data.UI[group]; ok {
-			for _, instanceURL := range urls {
-				if existing, ok := existingInstances[instanceURL]; ok {
-					existing.Group = group
-					existing.GroupOrder = groupIndex
-					existing.Cors = false // UI instances don't have a CORS flag
-					existing.InstanceType = "ui" // Important: Update type on refresh
-					updatedInstances = append(updatedInstances, existing)
-					delete(existingInstances, instanceURL)
-				} else {
-					instance := &Instance{
-						Group:        group,
-						URL:          instanceURL,
-						InstanceType: "ui",
-						Cors:         false,
-						GroupOrder:   groupIndex,
-						Checks:       make([]Check, 0, m.config.MaxCheckHistory),
-					}
-					updatedInstances = append(updatedInstances, instance)
-				}
+			existing.Group = spec.Group
+			existing.GroupOrder = spec.GroupOrder
+			existing.Cors = spec.Cors
+			existing.InstanceType = spec.InstanceType
+			existing.RequiredHeaders = spec.RequiredHeaders
+			existing.CheckIntervalSeconds = spec.CheckIntervalSeconds
+			existing.Metadata = spec.Metadata
+			existing.mu.Unlock()
+			updatedInstances = append(updatedInstances, existing)
+			delete(existingInstances, spec.URL)
+		} else {
+			instance := &Instance{
+				Group:        spec.Group,
+				URL:          spec.URL,
+				InstanceType: spec.InstanceType,
+				Cors:         spec.Cors,
+				GroupOrder:   spec.GroupOrder,
+				Checks:       make([]Check, 0, m.config.CurrentMaxCheckHistory()),
+
+				RequiredHeaders:      spec.RequiredHeaders,
+				CheckIntervalSeconds: spec.CheckIntervalSeconds,
+				Metadata:             spec.Metadata,
+
+				modified:  now,
+				firstSeen: now,
 			}
-			groupIndex++
+			updatedInstances = append(updatedInstances, instance)
+			addedInstances = append(addedInstances, instance)
 		}
 	}
 
-	addedCount := len(updatedInstances) - (len(m.instances) - len(existingInstances))
+	addedCount := len(addedInstances)
 	removedCount := len(existingInstances)
 
 	if addedCount > 0 || removedCount > 0 {
 		log.Printf("Instance list updated: %d added, %d removed.", addedCount, removedCount)
 	}
+	if m.config.IsDebug() {
+		for _, inst := range addedInstances {
+			log.Printf("Instance list: added %s", inst.URL)
+		}
+		for _, instanceURL := range slices.Sorted(maps.Keys(existingInstances)) {
+			log.Printf("Instance list: removed %s", instanceURL)
+		}
+		for _, instanceURL := range modifiedURLs {
+			log.Printf("Instance list: modified %s", instanceURL)
+		}
+	}
+
+	groupMeta := make(map[string]GroupMeta)
+	for _, spec := range specs {
+		if spec.GroupMeta != nil {
+			groupMeta[spec.Group] = *spec.GroupMeta
+		}
+	}
+
+	// The self check instance comes after every group of the list.
+	if m.self != nil {
+		groupOrder := 0
+		for _, spec := range specs {
+			groupOrder = max(groupOrder, spec.GroupOrder+1)
+		}
+		m.self.mu.Lock()
+		if m.self.GroupOrder != groupOrder {
+			m.self.GroupOrder = groupOrder
+			m.self.modified = now
+		}
+		m.self.mu.Unlock()
+		updatedInstances = append(updatedInstances, m.self)
+	}
 
 	m.mu.Lock()
-	for i, inst := range updatedInstances {
-		inst.Index = i + 1
+	renumberInstances(updatedInstances, now)
+	for _, inst := range addedInstances {
+		m.restoreArchived(inst)
+		delete(m.removals, inst.URL)
 	}
+	m.archiveInstances(slices.Collect(maps.Values(existingInstances)), now)
+	m.recordRemovals(slices.Collect(maps.Keys(existingInstances)), now)
 	m.instances = updatedInstances
+	m.groupMeta = groupMeta
 	m.mu.Unlock()
 
 	if addedCount > 0 || removedCount > 0 {
 		m.broadcastUpdate()
 	}
 
-	return nil
+	if len(addedInstances) > 0 && !initialLoad {
+		go m.warmUp(ctx, addedInstances)
+	}
+
+	return RefreshResult{Added: addedCount, Removed: removedCount, Total: len(updatedInstances)}, nil
 }
 
-func extractOrderFromJSON(jsonStr string, section string) []string {
-	sectionStart := strings.Index(jsonStr, "\""+section+"\"")
-	if sectionStart == -1 {
-		return []string{}
+// warmUpConcurrency bounds the number of simultaneous initial checks for
+// newly added instances.
+const warmUpConcurrency = 10
+
+// warmUp checks newly added instances right away so they don't stay pending
+// until the next check cycle. It runs in the background so that the refresh
+// loop is not delayed, and skips instances removed by a later refresh.
+func (m *Monitor) warmUp(ctx context.Context, instances []*Instance) {
+	log.Printf("Running initial check for %d new instances", len(instances))
+
+	sem := make(chan struct{}, warmUpConcurrency)
+	var wg sync.WaitGroup
+	for _, instance := range instances {
+		wg.Add(1)
+		go func(inst *Instance) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			if ctx.Err() != nil || !m.hasInstance(inst) {
+				return
+			}
+			m.checkInstance(ctx, inst)
+		}(instance)
 	}
+	wg.Wait()
+
+	m.broadcastUpdate()
+}
 
-	braceStart := strings.Index(jsonStr[sectionStart:], "{")
-	if braceStart == -1 {
-		return []string{}
+// RemoveInstance drops an instance until the next refresh of the instance
+// list brings it back. It reports whether the instance was found.
+func (m *Monitor) RemoveInstance(instanceURL string) bool {
+	m.mu.Lock()
+	removed := false
+	for i, inst := range m.instances {
+		if inst.URL == instanceURL {
+			now := time.Now()
+			m.instances = append(m.instances[:i:i], m.instances[i+1:]...)
+			renumberInstances(m.instances, now)
+			if inst != m.self {
+				m.archiveInstances([]*Instance{inst}, now)
+			}
+			m.recordRemovals([]string{inst.URL}, now)
+			removed = true
+			break
+		}
+	}
+	m.mu.Unlock()
+
+	if !removed {
+		return false
 	}
-	braceStart += sectionStart
 
-	braceCount := 1
-	braceEnd := braceStart + 1
-	for braceEnd < len(jsonStr) && braceCount > 0 {
-		if jsonStr[braceEnd] == '{' {
-			braceCount++
-		} else if jsonStr[braceEnd] == '}' {
-			braceCount--
+	log.Printf("Instance removed: %s", instanceURL)
+	m.broadcastUpdate()
+	return true
+}
+
+// renumberInstances sets the Index of each instance to its position in
+// instances, counting from 1.
+func renumberInstances(instances []*Instance, now time.Time) {
+	for i, inst := range instances {
+		inst.mu.Lock()
+		if inst.Index != i+1 {
+			inst.Index = i + 1
+			inst.modified = now
 		}
-		braceEnd++
+		inst.mu.Unlock()
 	}
+}
+
+// ErrInstanceNotFound is returned for a URL that is not monitored.
+var ErrInstanceNotFound = errors.New("instance not found")
+
+// Reset clears the check history of the instance with the given URL, along
+// with everything derived from it: its daily uptime, uptime windows, last
+// success and failure times, lifetime counters and latency state.
+// Consecutive failures and the time since it went down are computed from
+// the checks and restart with them.
+func (m *Monitor) Reset(url string) error {
+	instance := m.findInstance(url)
+	if instance == nil {
+		return ErrInstanceNotFound
+	}
+
+	instance.mu.Lock()
+	instance.Checks = make([]Check, 0, m.config.CurrentMaxCheckHistory())
+	instance.Days = nil
+	instance.uptime.reset(instance.Checks)
+	instance.lastSuccessAt.Store(nil)
+	instance.lastFailureAt.Store(nil)
+	instance.lastSucceeded.Store(false)
+	instance.latencyDegraded = false
+	instance.lifetime = lifetimeStats{}
+	instance.modified = time.Now()
+	instance.mu.Unlock()
+
+	log.Printf("Check history of %s reset", url)
+	m.broadcastUpdate()
+	return nil
+}
+
+func (m *Monitor) hasInstance(instance *Instance) bool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	for _, inst := range m.instances {
+		if inst == instance {
+			return true
+		}
+	}
+	return false
+}
 
-	sectionJSON := jsonStr[braceStart:braceEnd]
+// extractOrderFromJSON returns the keys of the top-level object section in
+// the order of the document, which is lost when decoding into a map.
+func extractOrderFromJSON(jsonStr string, section string) []string {
+	order := []string{}
 
-	var order []string
-	var groups map[string]interface{}
-	json.Unmarshal([]byte(sectionJSON), &groups)
+	dec := json.NewDecoder(strings.NewReader(jsonStr))
+	if tok, err := dec.Token(); err != nil || tok != json.Delim('{') {
+		return order
+	}
 
-	pos := 0
-	for len(order) < len(groups) {
-		earliestPos := len(sectionJSON)
-		earliestKey := ""
+	var skip json.RawMessage
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return order
+		}
+		if key, _ := tok.(string); key != section {
+			if dec.Decode(&skip) != nil {
+				return order
+			}
+			continue
+		}
 
-		for key := range groups {
-			alreadyAdded := false
-			for _, addedKey := range order {
-				if addedKey == key {
-					alreadyAdded = true
+		// As with json.Unmarshal, a repeated section replaces an earlier one.
+		order = []string{}
+		tok, err = dec.Token()
+		if err != nil {
+			return order
+		}
+		if tok != json.Delim('{') {
+			// Skip a section that is not an object, since a later one may be.
+			for depth := 0; ; {
+				switch tok {
+				case json.Delim('['), json.Delim('{'):
+					depth++
+				case json.Delim(']'), json.Delim('}'):
+					depth--
+				}
+				if depth == 0 {
 					break
 				}
+				if tok, err = dec.Token(); err != nil {
+					return order
+				}
 			}
-			if alreadyAdded {
-				continue
+			continue
+		}
+		seen := make(map[string]bool)
+		for dec.More() {
+			tok, err := dec.Token()
+			if err != nil {
+				return order
 			}
-
-			searchStr := "\"" + key + "\""
-			foundPos := strings.Index(sectionJSON[pos:], searchStr)
-			if foundPos != -1 {
-				foundPos += pos
-				if foundPos < earliestPos {
-					earliestPos = foundPos
-					earliestKey = key
-				}
+			if key, _ := tok.(string); !seen[key] {
+				seen[key] = true
+				order = append(order, key)
+			}
+			if dec.Decode(&skip) != nil {
+				return order
 			}
 		}
-
-		if earliestKey != "" {
-			order = append(order, earliestKey)
-			pos = earliestPos + len(earliestKey) + 2
-		} else {
-			break
+		if _, err := dec.Token(); err != nil {
+			return order
 		}
 	}
-
 	return order
 }
 
-func (m *Monitor) Start() {
-	m.checkAll()
+// Start runs checks until ctx is cancelled or Stop is called.
+func (m *Monitor) Start(ctx context.Context) {
+	ctx, cancel := m.withStop(ctx)
+	defer cancel()
 
-	checkTicker := time.NewTicker(m.config.CheckInterval)
-	defer checkTicker.Stop()
-	refreshTicker := time.NewTicker(m.config.InstanceRefreshInterval)
+	m.checkAll(ctx)
+	if !m.running.Load() {
+		// No instances to check, so checkInstances did not mark the end of
+		// startup.
+		m.cycleCompleted()
+		m.broadcastUpdate()
+	}
+	m.rebuildSchedule()
+
+	checkTimer := time.NewTimer(m.untilNextCheck())
+	defer checkTimer.Stop()
+	refreshInterval := m.config.CurrentInstanceRefreshInterval()
+	refreshTicker := time.NewTicker(refreshInterval)
 	defer refreshTicker.Stop()
+	filter := m.config.CurrentInstanceFilter()
+
+	var compactC <-chan time.Time
+	if m.config.CompactAfter > 0 {
+		compactTicker := time.NewTicker(time.Hour)
+		defer compactTicker.Stop()
+		compactC = compactTicker.C
+	}
 
 	for {
 		select {
-		case <-checkTicker.C:
-			m.checkAll()
+		case <-ctx.Done():
+			return
+		case <-checkTimer.C:
+			m.checkDue(ctx)
+		case <-m.configChanged:
+			log.Printf("Check interval is now %v", m.config.CurrentCheckInterval())
+			m.rebuildSchedule()
+			if interval := m.config.CurrentInstanceRefreshInterval(); interval != refreshInterval {
+				log.Printf("Instance refresh interval changed to %v", interval)
+				refreshInterval = interval
+				refreshTicker.Stop()
+				refreshTicker = time.NewTicker(interval)
+			}
+			if current := m.config.CurrentInstanceFilter(); !current.equal(filter) {
+				log.Println("Instance filter changed, refreshing instance list...")
+				filter = current
+				if _, err := m.Refresh(ctx); err != nil {
+					log.Printf("Error refreshing instances: %v", err)
+				}
+			}
 		case <-refreshTicker.C:
 			log.Println("Refreshing instance list...")
-			if err := m.updateInstances(); err != nil {
+			if _, err := m.Refresh(ctx); errors.Is(err, ErrRefreshInProgress) {
+				log.Println("Skipping instance list refresh, another one is running")
+			} else if err != nil {
 				log.Printf("Error refreshing instances: %v", err)
 			}
+		case <-m.scheduleChanged:
+			// The timer is reset to the new schedule below.
+		case <-compactC:
+			m.compactAll()
 		}
+
+		checkTimer.Reset(m.untilNextCheck())
 	}
 }
 
-func (m *Monitor) checkAll() {
+// Stop ends Start and cancels checks that are in flight.
+func (m *Monitor) Stop() {
+	m.stop()
+}
+
+func (m *Monitor) checkAll(ctx context.Context) {
 	m.mu.RLock()
 	instances := m.instances
 	m.mu.RUnlock()
 
-	log.Printf("Starting check cycle for %d instances", len(instances))
-	start := time.Now()
+	m.checkInstances(ctx, instances)
+}
 
-	var wg sync.WaitGroup
-	for _, instance := range instances {
-		wg.Add(1)
-		go func(inst *Instance) {
-			defer wg.Done()
-			m.checkInstance(inst)
-		}(instance)
+func (m *Monitor) checkInstance(ctx context.Context, instance *Instance) {
+	instance.mu.RLock()
+	instanceType := instance.InstanceType
+	requiredHeaders := instance.RequiredHeaders
+	instance.mu.RUnlock()
+
+	var check Check
+	if instanceType == InstanceTypeSelf {
+		check = m.selfCheck(instance)
+	} else {
+		var checkURL string
+		if instanceType == InstanceTypeAPI {
+			checkURL = fmt.Sprintf("%s/search/?s=kanye", instance.URL)
+		} else {
+			checkURL = instance.URL
+		}
+
+		defer instance.attempt.Store(0)
+		check = m.checkWithRetries(ctx, checkURL, instanceType, requiredHeaders, func(attempt int) {
+			instance.attempt.Store(int32(attempt))
+		})
+		check.CheckURL = checkURL
 	}
-	wg.Wait()
 
-	log.Printf("Check cycle completed in %v", time.Since(start))
-	m.broadcastUpdate()
+	// A check cut short by shutdown says nothing about the instance.
+	if ctx.Err() != nil {
+		return
+	}
+	check.InstanceType = instanceType
+
+	instance.mu.Lock()
+	previousStatus := instanceStatus(instance.Checks)
+	check = instance.appendCheck(check)
+	instance.modified = time.Now()
+	instance.recordDay(check, m.config.UptimeLocation())
+	if maxHistory := m.config.CurrentMaxCheckHistory(); len(instance.Checks) > maxHistory {
+		instance.uptime.trimmed(instance.Checks, len(instance.Checks)-maxHistory)
+		instance.Checks = instance.Checks[len(instance.Checks)-maxHistory:]
+	}
+	status := instanceStatus(instance.Checks)
+	if status == StatusDown && previousStatus != StatusDown {
+		instance.lifetime.incidents++
+	}
+
+	// The first check only ends the pending state, which is not a transition
+	// worth notifying about.
+	var event *NotificationEvent
+	if previousStatus != StatusPending && status != previousStatus {
+		kind := EventDown
+		if status == StatusUp {
+			kind = EventUp
+		}
+		e := m.newNotificationEvent(instance, kind)
+		event = &e
+	}
+	latencyEvent := m.updateLatency(instance)
+	contentEvent := m.updateContent(instance, check)
+	instance.mu.Unlock()
+
+	if event != nil {
+		log.Printf("%s (%s) is now %s (was %s)", instance.URL, instanceType, status, previousStatus)
+		m.notify(*event)
+	}
+	if latencyEvent != nil {
+		log.Printf("%s (%s) %s: %dms, limit %dms", instance.URL, instanceType,
+			latencyEvent.Event, latencyEvent.LatencyMs, latencyEvent.LatencyLimitMs)
+		m.notify(*latencyEvent)
+	}
+	if contentEvent != nil {
+		m.notify(*contentEvent)
+	}
+
+	m.pushKuma(instance, check)
+	m.broadcastInstance(instance)
+
+	if m.config.IsDebug() {
+		log.Printf("[%d] %s (%s): success=%v, status=%d, time=%dms, request_id=%s",
+			instance.Index, instance.URL, instance.InstanceType,
+			check.Success, check.StatusCode, check.ResponseTime, check.RequestID)
+	}
 }
 
-func (m *Monitor) checkInstance(instance *Instance) {
+// appendCheck adds check to the history and returns it as recorded. The
+// history is kept in time order, which window calculations rely on: a check
+// stamped before the previous one, as happens when the wall clock is stepped
+// back, is recorded at the previous check's time. The caller must hold
+// instance.mu.
+func (instance *Instance) appendCheck(check Check) Check {
+	if n := len(instance.Checks); n > 0 {
+		if previous := instance.Checks[n-1].Timestamp; check.Timestamp.Before(previous) {
+			log.Printf("Warning: check of %s started %v before the previous one, recording it at the previous time",
+				instance.URL, previous.Sub(check.Timestamp))
+			check.Timestamp = previous
+		}
+	}
+	instance.Checks = append(instance.Checks, check)
+	instance.uptime.appended(instance.Checks)
+	instance.lifetime.checks += int64(check.weight())
+	instance.lifetime.successes += int64(check.successes())
+	if check.Success {
+		instance.lastSuccessAt.Store(&check.Timestamp)
+	} else {
+		instance.lastFailureAt.Store(&check.Timestamp)
+	}
+	instance.lastSucceeded.Store(check.Success)
+	return check
+}
+
+// checkWithRetries retries a failed check up to CheckRetries times, doubling
+// the backoff between attempts. Only the final result is returned, stamped
+// with the time of the first attempt. onAttempt, if set, is called with the
+// number of each attempt, starting from 1.
+func (m *Monitor) checkWithRetries(ctx context.Context, checkURL, instanceType string, requiredHeaders map[string]string, onAttempt func(int)) Check {
 	start := time.Now()
+	backoff := m.config.CheckRetryBackoff
 
-	var checkURL string
-	if instance.InstanceType == "api" {
-		checkURL = fmt.Sprintf("%s/search/?s=kanye", instance.URL)
-	} else {
-		checkURL = instance.URL
+	for attempt := 0; ; attempt++ {
+		if onAttempt != nil {
+			onAttempt(attempt + 1)
+		}
+		var check Check
+		if m.config.IPFamily == IPFamilyDual {
+			check = m.dualStackCheck(ctx, checkURL, instanceType, requiredHeaders)
+		} else {
+			check = m.performCheck(ctx, m.transports[m.config.IPFamily], time.Now(), checkURL, instanceType, requiredHeaders)
+		}
+		check.Timestamp = start
+		check.Error = sanitizeError(check.Error, m.config.CheckErrorMaxLength)
+
+		if check.Success || attempt >= m.config.CheckRetries {
+			return check
+		}
+		if m.config.IsDebug() {
+			log.Printf("Check of %s failed, retrying in %v: %s", checkURL, backoff, check.Error)
+		}
+
+		select {
+		case <-ctx.Done():
+			return check
+		case <-time.After(backoff):
+		}
+		backoff *= 2
 	}
+}
 
-	client := &http.Client{
-		Timeout: m.config.RequestTimeout,
+// sinceMillis returns the milliseconds elapsed since start. time.Since uses
+// the monotonic clock, but a start without a monotonic reading is measured
+// on the wall clock, so a negative result is clamped to zero.
+func sinceMillis(start time.Time) int64 {
+	ms := time.Since(start).Milliseconds()
+	if ms < 0 {
+		log.Printf("Warning: negative duration of %dms, the clock was stepped back", ms)
+		return 0
 	}
+	return ms
+}
 
+// performCheck runs a single check request over transport.
+func (m *Monitor) performCheck(ctx context.Context, transport *http.Transport, start time.Time, checkURL, instanceType string, requiredHeaders map[string]string) Check {
 	check := Check{
 		Timestamp: start,
+		RequestID: newRequestID(),
 	}
 
-	resp, err := client.Get(checkURL)
+	release, err := m.hostLimiter.acquire(ctx, checkURL)
+	if err != nil {
+		check.Error = err.Error()
+		check.ErrorType = classifyError(err)
+		return check
+	}
+	defer release()
+
+	ctx, cancel := context.WithTimeout(ctx, m.config.RequestTimeout)
+	defer cancel()
+
+	client := &http.Client{Transport: transport}
+
+	// Time spent waiting for the host limiter is not part of the response
+	// time.
+	requestStart := time.Now()
+
+	// A reused keep-alive connection skips DNS, so the connected peer is
+	// recorded as well and stands in for the resolved addresses then.
+	var traceMu sync.Mutex
+	var resolved []string
+	var peer, family string
+	trace := &httptrace.ClientTrace{
+		DNSDone: func(info httptrace.DNSDoneInfo) {
+			traceMu.Lock()
+			defer traceMu.Unlock()
+			for _, addr := range info.Addrs {
+				resolved = append(resolved, addr.String())
+			}
+		},
+		GotConn: func(info httptrace.GotConnInfo) {
+			traceMu.Lock()
+			defer traceMu.Unlock()
+			peer = addrIP(info.Conn.RemoteAddr())
+			family = addrFamily(info.Conn.RemoteAddr())
+		},
+	}
+
+	var resp *http.Response
+	var head []byte
+	req, err := http.NewRequestWithContext(httptrace.WithClientTrace(ctx, trace), http.MethodGet, checkURL, nil)
+	if err == nil {
+		req.Header.Set(RequestIDHeader, check.RequestID)
+		resp, err = client.Do(req)
+	}
+
+	traceMu.Lock()
+	check.ResolvedIPs = resolved
+	if len(resolved) == 0 && peer != "" {
+		check.ResolvedIPs = []string{peer}
+	}
+	check.IPFamily = family
+	traceMu.Unlock()
+
 	if err != nil {
 		check.Success = false
 		check.Error = err.Error()
-		check.ResponseTime = time.Since(start).Milliseconds()
+		check.ResponseTime = sinceMillis(requestStart)
+		check.ErrorType = classifyError(err)
 	} else {
 		defer resp.Body.Close()
 		check.StatusCode = resp.StatusCode
-		check.ResponseTime = time.Since(start).Milliseconds()
+		check.ResponseTime = sinceMillis(requestStart)
 		check.Success = resp.StatusCode >= 200 && resp.StatusCode < 300
+		if !check.Success {
+			check.ErrorType = ErrorTypeHTTP
+		}
+
+		if instanceType == InstanceTypeUI {
+			check.TTFB = check.ResponseTime
+			var body fingerprinter
+			size, err := io.Copy(&body, io.LimitReader(resp.Body, m.config.UIBodyReadLimit))
+			check.BodySize = size
+			check.DownloadTime = sinceMillis(requestStart)
+			if err != nil && check.Success {
+				check.Success = false
+				check.Error = fmt.Sprintf("failed to read body: %v", err)
+				check.ErrorType = ErrorTypeBodyValidation
+			}
+			if check.Success {
+				check.Fingerprint = contentFingerprint(body.head, size)
+			}
+			head = body.head
+		}
+
+		if check.Success {
+			if mismatch := checkRequiredHeaders(resp.Header, requiredHeaders); mismatch != "" {
+				check.Success = false
+				check.Error = mismatch
+				check.ErrorType = ErrorTypeBodyValidation
+			}
+		}
 	}
 
-	instance.mu.Lock()
-	instance.Checks = append(instance.Checks, check)
-	if len(instance.Checks) > m.config.MaxCheckHistory {
-		instance.Checks = instance.Checks[len(instance.Checks)-m.config.MaxCheckHistory:]
+	if req != nil && m.config.IsDebug() {
+		m.logExchange(req, resp, check, head)
 	}
-	instance.mu.Unlock()
+	return check
+}
 
-	if m.config.LogLevel == "debug" {
-		log.Printf("[%d] %s (%s): success=%v, status=%d, time=%dms",
-			instance.Index, instance.URL, instance.InstanceType,
-			check.Success, check.StatusCode, check.ResponseTime)
+// checkRequiredHeaders returns a description of the first required header that
+// is missing or does not match, or an empty string if all of them match.
+func checkRequiredHeaders(header http.Header, required map[string]string) string {
+	names := make([]string, 0, len(required))
+	for name := range required {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		expected := required[name]
+		values := header.Values(name)
+		if len(values) == 0 {
+			return fmt.Sprintf("required header %s missing", name)
+		}
+		if values[0] != expected {
+			return fmt.Sprintf("required header %s mismatch: expected %q, got %q", name, expected, values[0])
+		}
 	}
+
+	return ""
 }
 
-func (m *Monitor) broadcastUpdate() {
-	data := m.GetInstancesData()
-	stats := m.GetStatsData()
+// SSE event types.
+const (
+	// EventInstanceUpdate carries every instance and the fleet stats. It is
+	// sent when a stream is opened and after each check cycle.
+	EventInstanceUpdate = "instance_update"
+	// EventInstanceCheck carries a single instance right after it was
+	// checked.
+	EventInstanceCheck = "instance_check"
+	// EventInstancesRemoved lists the URLs of instances a stream was sent
+	// that are missing from its latest instance_update, for example because
+	// their group was removed from the instance list.
+	EventInstancesRemoved = "instances_removed"
+)
 
-	update := map[string]interface{}{
-		"instances": data,
-		"stats":     stats,
+// sseFrame formats an SSE event.
+func sseFrame(event string, data []byte) []byte {
+	return []byte(fmt.Sprintf("event: %s\ndata: %s\n\n", event, data))
+}
+
+// updatePayload builds the body of an instance_update event.
+func (m *Monitor) updatePayload(instances []InstanceData) map[string]interface{} {
+	return map[string]interface{}{
+		"state":     m.State(),
+		"instances": instances,
+		"stats":     m.Stats(),
 		"timestamp": time.Now().Unix(),
 	}
+}
 
-	jsonData, err := json.Marshal(update)
-	if err != nil {
-		log.Printf("Error marshaling update: %v", err)
-		return
+// StreamSnapshot builds the instance_update a registered client receives
+// when its stream opens, filtered for the client.
+func (m *Monitor) StreamSnapshot(client chan []byte) map[string]interface{} {
+	instances := m.GetInstancesData()
+
+	m.clientsMu.Lock()
+	if c, ok := m.clients[client]; ok {
+		instances = c.filter.apply(instances)
+		c.track(instances)
+	}
+	m.clientsMu.Unlock()
+
+	return m.updatePayload(instances)
+}
+
+// Excluded is the number of instances of the list left out by the config.
+func (m *Monitor) Excluded() int {
+	return int(m.excluded.Load())
+}
+
+// LiveInstances counts the instances whose latest check succeeded, reading
+// only whether it did, so it takes no instance locks. Instances not checked
+// yet are not live. The self check is not counted.
+func (m *Monitor) LiveInstances() int {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	live := 0
+	for _, instance := range m.instances {
+		if instance == m.self {
+			continue
+		}
+		if instance.lastSucceeded.Load() {
+			live++
+		}
+	}
+	return live
+}
+
+// DataVersion changes whenever new check data has been broadcast, so it can
+// be used to invalidate anything derived from it.
+func (m *Monitor) DataVersion() uint64 {
+	return m.dataVersion.Load()
+}
+
+func (m *Monitor) broadcastUpdate() {
+	m.dataVersion.Add(1)
+	instances := m.GetInstancesData()
+	payload := m.updatePayload(instances)
+
+	// Clients with the same filter share the encoded event.
+	type filteredUpdate struct {
+		instances []InstanceData
+		frame     []byte
+	}
+	updates := make(map[StreamFilter]*filteredUpdate)
+
+	sent := m.broadcast(EventInstanceUpdate, func(c *streamClient) [][]byte {
+		update, ok := updates[c.filter]
+		if !ok {
+			update = &filteredUpdate{instances: c.filter.apply(instances)}
+			filtered := make(map[string]interface{}, len(payload))
+			for key, value := range payload {
+				filtered[key] = value
+			}
+			filtered["instances"] = update.instances
+			update.frame = encodeFrame(EventInstanceUpdate, c.filter.Format, filtered)
+			updates[c.filter] = update
+		}
+
+		var frames [][]byte
+		if removed := c.track(update.instances); len(removed) > 0 {
+			frames = append(frames, encodeFrame(EventInstancesRemoved, c.filter.Format, map[string][]string{"urls": removed}))
+		}
+		return append(frames, update.frame)
+	})
+	if sent > 0 {
+		log.Printf("Broadcast update to %d clients", sent)
 	}
+}
 
+// broadcastInstance sends the latest data of a single instance to the
+// clients whose filter selects it. It runs after every check, so it builds
+// nothing without clients and, like every broadcast, never waits for one.
+func (m *Monitor) broadcastInstance(instance *Instance) {
 	m.clientsMu.RLock()
-	clientCount := len(m.clients)
+	clients := len(m.clients)
 	m.clientsMu.RUnlock()
+	if clients == 0 {
+		return
+	}
 
-	if clientCount > 0 {
-		m.clientsMu.RLock()
-		for client := range m.clients {
-			select {
-			case client <- jsonData:
-			default:
-				log.Printf("Warning: Client channel full, skipping update")
+	data := instance.data()
+
+	// Clients that want the same checks in the same format share the
+	// encoded event.
+	type variant struct {
+		noChecks bool
+		format   string
+	}
+	frames := make(map[variant][]byte)
+
+	m.broadcast(EventInstanceCheck, func(c *streamClient) [][]byte {
+		if !c.filter.matches(data) {
+			return nil
+		}
+		key := variant{noChecks: c.filter.NoChecks, format: c.filter.Format}
+		frame, ok := frames[key]
+		if !ok {
+			d := data
+			if c.filter.NoChecks {
+				d.Checks = []Check{}
 			}
+			frame = encodeFrame(EventInstanceCheck, c.filter.Format, d)
+			frames[key] = frame
 		}
-		m.clientsMu.RUnlock()
-		log.Printf("Broadcast update to %d clients", clientCount)
+		return [][]byte{frame}
+	})
+}
+
+// encodeFrame encodes payload in format into an SSE event, or returns nil if
+// it cannot be encoded.
+func encodeFrame(event, format string, payload interface{}) []byte {
+	data, err := encodeData(format, payload)
+	if err != nil {
+		log.Printf("Error encoding %s: %v", event, err)
+		return nil
 	}
+	return sseFrame(event, data)
 }
 
-func (m *Monitor) GetInstancesData() interface{} {
+// broadcast sends the frames that build returns for each SSE client and
+// returns how many clients received theirs. build runs with clientsMu held,
+// so it may update the client.
+func (m *Monitor) broadcast(event string, build func(c *streamClient) [][]byte) int {
+	type delivery struct {
+		client *streamClient
+		frames [][]byte
+	}
+
+	m.clientsMu.Lock()
+	deliveries := make([]delivery, 0, len(m.clients))
+	for _, c := range m.clients {
+		var frames [][]byte
+		for _, frame := range build(c) {
+			if frame != nil {
+				frames = append(frames, frame)
+			}
+		}
+		if len(frames) > 0 {
+			deliveries = append(deliveries, delivery{client: c, frames: frames})
+		}
+	}
+	m.clientsMu.Unlock()
+
+	if len(deliveries) == 0 {
+		return 0
+	}
+
+	// Sends never wait: a client whose buffer is full drops the frames, so
+	// a slow one cannot hold up the others or the caller. Clients that went
+	// away since the list was built are skipped.
+	sent, skipped := 0, 0
+	for _, d := range deliveries {
+		if d.client.gone() {
+			continue
+		}
+		dropped := d.client.send(d.frames)
+		if dropped > 0 {
+			skipped++
+		} else {
+			sent++
+		}
+
+		// Only instance_update is logged per client; instance_check is
+		// sent for every check.
+		if event == EventInstanceUpdate && m.config.IsDebug() {
+			size := 0
+			for _, frame := range d.frames {
+				size += len(frame)
+			}
+			log.Printf("Broadcast %s to %s: %d frames, %d bytes, %d dropped",
+				event, d.client.remoteAddr, len(d.frames), size, dropped)
+		}
+	}
+
+	if skipped > 0 {
+		log.Printf("Warning: %d client channels full, skipping %s", skipped, event)
+	}
+	return sent
+}
+
+type InstanceData struct {
+	Group           string         `json:"group"`
+	URL             string         `json:"url"`
+	InstanceType    string         `json:"instance_type"`
+	Cors            bool           `json:"cors"`
+	GroupOrder      int            `json:"group_order"`
+	Index           int            `json:"index"`
+	Checks          []Check        `json:"checks"`
+	Status          string         `json:"status"`
+	Uptime          float64        `json:"uptime"`
+	Uptime24h       float64        `json:"uptime_24h"`
+	Uptime7d        float64        `json:"uptime_7d"`
+	Uptime30d       float64        `json:"uptime_30d"`
+	AvgResponseTime int64          `json:"avg_response_time"`
+	AvgTTFB         int64          `json:"avg_ttfb,omitempty"`
+	AvgDownloadTime int64          `json:"avg_download_time,omitempty"`
+	LastCheck       *Check         `json:"last_check"`
+	LastSuccessUnix *int64         `json:"last_success_unix"`
+	LastFailureUnix *int64         `json:"last_failure_unix"`
+	ErrorCounts     map[string]int `json:"error_counts"`
+	IPFamily        string         `json:"ip_family,omitempty"`
+	DaysSummary     DaysSummary    `json:"days_summary"`
+	LatencyDegraded bool           `json:"latency_degraded,omitempty"`
+	ContentChanged  bool           `json:"content_changed,omitempty"`
+
+	Metadata map[string]interface{} `json:"metadata,omitempty"`
+}
+
+func (m *Monitor) GetInstancesData() []InstanceData {
 	m.mu.RLock()
 	defer m.mu.RUnlock()
 
-	type InstanceData struct {
-		Group           string  `json:"group"`
-		URL             string  `json:"url"`
-		InstanceType    string  `json:"instance_type"`
-		Cors            bool    `json:"cors"`
-		GroupOrder      int     `json:"group_order"`
-		Index           int     `json:"index"`
-		Checks          []Check `json:"checks"`
-		Uptime          float64 `json:"uptime"`
-		AvgResponseTime int64   `json:"avg_response_time"`
-		LastCheck       *Check  `json:"last_check"`
+	data := make([]InstanceData, 0, len(m.instances))
+	for _, instance := range m.instances {
+		data = append(data, instance.data())
 	}
 
-	data := make([]InstanceData, 0, len(m.instances))
+	return data
+}
 
-	for _, instance := range m.instances {
-		instance.mu.RLock()
+// Sort keys accepted by sortInstanceData.
+const (
+	SortUptime       = "uptime"
+	SortResponseTime = "response_time"
+	SortGroup        = "group"
+	SortURL          = "url"
+)
 
-		uptime := calculateUptime(instance.Checks)
-		avgRT := calculateAvgResponseTime(instance.Checks)
-		var lastCheck *Check
-		if len(instance.Checks) > 0 {
-			lastCheck = &instance.Checks[len(instance.Checks)-1]
-		}
-
-		checks := make([]Check, len(instance.Checks))
-		copy(checks, instance.Checks)
-
-		data = append(data, InstanceData{
-			Group:           instance.Group,
-			URL:             instance.URL,
-			InstanceType:    instance.InstanceType,
-			Cors:            instance.Cors,
-			GroupOrder:      instance.GroupOrder,
-			Index:           instance.Index,
-			Checks:          checks,
-			Uptime:          uptime,
-			AvgResponseTime: avgRT,
-			LastCheck:       lastCheck,
-		})
+func validSortKey(key string) bool {
+	switch key {
+	case SortUptime, SortResponseTime, SortGroup, SortURL:
+		return true
+	}
+	return false
+}
 
-		instance.mu.RUnlock()
+// filterInstanceData keeps instances matching the type and group; empty
+// values match everything.
+func filterInstanceData(data []InstanceData, instanceType, group string) []InstanceData {
+	if instanceType == "" && group == "" {
+		return data
 	}
 
-	return data
+	filtered := make([]InstanceData, 0, len(data))
+	for _, d := range data {
+		if (instanceType == "" || d.InstanceType == instanceType) &&
+			(group == "" || d.Group == group) {
+			filtered = append(filtered, d)
+		}
+	}
+	return filtered
 }
 
-func (m *Monitor) GetStatsData() interface{} {
+// sortInstanceData orders data by key, breaking ties by Index. Instances
+// without checks have no uptime or response time and always sort last.
+func sortInstanceData(data []InstanceData, key string, desc bool) {
+	sort.SliceStable(data, func(i, j int) bool {
+		a, b := data[i], data[j]
+
+		if key == SortUptime || key == SortResponseTime {
+			if (len(a.Checks) == 0) != (len(b.Checks) == 0) {
+				return len(b.Checks) == 0
+			}
+		}
+
+		var cmp int
+		switch key {
+		case SortUptime:
+			cmp = compareFloat(a.Uptime, b.Uptime)
+		case SortResponseTime:
+			cmp = compareFloat(float64(a.AvgResponseTime), float64(b.AvgResponseTime))
+		case SortGroup:
+			cmp = strings.Compare(a.Group, b.Group)
+		case SortURL:
+			cmp = strings.Compare(a.URL, b.URL)
+		}
+		if desc {
+			cmp = -cmp
+		}
+		if cmp != 0 {
+			return cmp < 0
+		}
+		return a.Index < b.Index
+	})
+}
+
+func compareFloat(a, b float64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+// data builds the API representation of the instance.
+func (instance *Instance) data() InstanceData {
+	instance.mu.RLock()
+	defer instance.mu.RUnlock()
+
+	avgTTFB, avgDownload := calculateAvgDownloadTimes(instance.Checks)
+
+	checks := make([]Check, len(instance.Checks))
+	copy(checks, instance.Checks)
+
+	var lastCheck *Check
+	var ipFamily string
+	if len(checks) > 0 {
+		lastCheck = &checks[len(checks)-1]
+		ipFamily = lastCheck.IPFamily
+	}
+
+	return InstanceData{
+		Group:           instance.Group,
+		URL:             instance.URL,
+		InstanceType:    instance.InstanceType,
+		Cors:            instance.Cors,
+		GroupOrder:      instance.GroupOrder,
+		Index:           instance.Index,
+		Checks:          checks,
+		Status:          instanceStatus(checks),
+		Uptime:          instance.uptimeOver(uptimeAll),
+		Uptime24h:       instance.uptimeOver(uptime24h),
+		Uptime7d:        instance.uptimeOver(uptime7d),
+		Uptime30d:       instance.uptimeOver(uptime30d),
+		AvgResponseTime: calculateAvgResponseTime(checks),
+		AvgTTFB:         avgTTFB,
+		AvgDownloadTime: avgDownload,
+		LastCheck:       lastCheck,
+		LastSuccessUnix: unixOrNil(instance.lastSuccessAt.Load()),
+		LastFailureUnix: unixOrNil(instance.lastFailureAt.Load()),
+		ErrorCounts:     countErrorTypes(checks),
+		IPFamily:        ipFamily,
+		DaysSummary:     summarizeDays(instance.Days),
+		LatencyDegraded: instance.latencyDegraded,
+		ContentChanged:  instance.contentChanged,
+		Metadata:        instance.Metadata,
+	}
+}
+
+func unixOrNil(t *time.Time) *int64 {
+	if t == nil {
+		return nil
+	}
+	unix := t.Unix()
+	return &unix
+}
+
+// Stats holds fleet-wide operational statistics.
+type Stats struct {
+	State            string         `json:"state"`
+	TotalInstances   int            `json:"total_instances"`
+	UpInstances      int            `json:"up_instances"`
+	DownInstances    int            `json:"down_instances"`
+	PendingInstances int            `json:"pending_instances"`
+	AvgUptimePercent float64        `json:"avg_uptime"`
+	ErrorCounts      map[string]int `json:"error_counts"`
+	SSEClients       int            `json:"sse_clients"`
+	LastCheckAt      time.Time      `json:"last_check_at"`
+	NextCheckAt      time.Time      `json:"next_check_at"`
+
+	Types map[string]TypeStats `json:"types"`
+}
+
+// TypeStats counts the instances of one type by status.
+type TypeStats struct {
+	Total   int `json:"total"`
+	Up      int `json:"up"`
+	Down    int `json:"down"`
+	Pending int `json:"pending"`
+}
+
+// Instance types.
+const (
+	InstanceTypeAPI  = "api"
+	InstanceTypeUI   = "ui"
+	InstanceTypeSelf = "self"
+)
+
+// GroupByType partitions the instances into API and UI instances, keeping
+// their order. Instances of any other type are in neither.
+func (m *Monitor) GroupByType() (api, ui []*Instance) {
 	m.mu.RLock()
 	defer m.mu.RUnlock()
 
-	totalInstances := len(m.instances)
-	upInstances := 0
-	totalUptime := 0.0
-
 	for _, instance := range m.instances {
 		instance.mu.RLock()
-		if len(instance.Checks) > 0 && instance.Checks[len(instance.Checks)-1].Success {
-			upInstances++
+		instanceType := instance.InstanceType
+		instance.mu.RUnlock()
+
+		switch instanceType {
+		case InstanceTypeAPI:
+			api = append(api, instance)
+		case InstanceTypeUI:
+			ui = append(ui, instance)
+		}
+	}
+	return api, ui
+}
+
+func (m *Monitor) Stats() Stats {
+	m.clientsMu.RLock()
+	clients := len(m.clients)
+	m.clientsMu.RUnlock()
+
+	m.scheduleMu.Lock()
+	lastCheckAt := m.lastCheckAt
+	var nextCheckAt time.Time
+	if len(m.schedule) > 0 {
+		nextCheckAt = m.schedule[0].at
+	}
+	m.scheduleMu.Unlock()
+
+	m.mu.RLock()
+	instances := m.instances
+	m.mu.RUnlock()
+
+	stats := Stats{
+		State:          m.State(),
+		TotalInstances: len(instances),
+		ErrorCounts:    make(map[string]int),
+		SSEClients:     clients,
+		LastCheckAt:    lastCheckAt,
+		NextCheckAt:    nextCheckAt,
+		Types: map[string]TypeStats{
+			InstanceTypeAPI: {},
+			InstanceTypeUI:  {},
+		},
+	}
+	// Instances that were never checked are left out of the average uptime.
+	totalUptime, checked := 0.0, 0
+
+	for _, instance := range instances {
+		instance.mu.RLock()
+		typeStats := stats.Types[instance.InstanceType]
+		typeStats.Total++
+		switch instanceStatus(instance.Checks) {
+		case StatusUp:
+			stats.UpInstances++
+			typeStats.Up++
+		case StatusDown:
+			stats.DownInstances++
+			typeStats.Down++
+		case StatusPending:
+			stats.PendingInstances++
+			typeStats.Pending++
+		}
+		stats.Types[instance.InstanceType] = typeStats
+		if len(instance.Checks) > 0 {
+			totalUptime += instance.uptimeOver(uptimeAll)
+			checked++
+		}
+		for errorType, count := range countErrorTypes(instance.Checks) {
+			stats.ErrorCounts[errorType] += count
 		}
-		totalUptime += calculateUptime(instance.Checks)
 		instance.mu.RUnlock()
 	}
 
-	avgUptime := 0.0
-	if totalInstances > 0 {
-		avgUptime = totalUptime / float64(totalInstances)
+	if checked > 0 {
+		stats.AvgUptimePercent = totalUptime / float64(checked)
 	}
 
-	return map[string]interface{}{
-		"total_instances": totalInstances,
-		"up_instances":    upInstances,
-		"avg_uptime":      avgUptime,
+	return stats
+}
+
+// InstanceStats holds health statistics for a single instance.
+type InstanceStats struct {
+	URL                 string  `json:"url"`
+	Group               string  `json:"group"`
+	Type                string  `json:"instance_type"`
+	Uptime              float64 `json:"uptime"`
+	Uptime24h           float64 `json:"uptime_24h"`
+	Uptime7d            float64 `json:"uptime_7d"`
+	Uptime30d           float64 `json:"uptime_30d"`
+	AvgResponseTimeMs   int64   `json:"avg_response_time_ms"`
+	P95ResponseTimeMs   int64   `json:"p95_response_time_ms"`
+	P99ResponseTimeMs   int64   `json:"p99_response_time_ms"`
+	LastCheck           *Check  `json:"last_check"`
+	ConsecutiveFailures int     `json:"consecutive_failures"`
+	HealthScore         float64 `json:"health_score"`
+}
+
+// InstanceStats returns health statistics for the instance with the given
+// URL, or false if it is not monitored.
+func (m *Monitor) InstanceStats(url string) (InstanceStats, bool) {
+	instance := m.findInstance(url)
+	if instance == nil {
+		return InstanceStats{}, false
+	}
+
+	instance.mu.RLock()
+	defer instance.mu.RUnlock()
+
+	checks := instance.Checks
+	stats := InstanceStats{
+		URL:                 instance.URL,
+		Group:               instance.Group,
+		Type:                instance.InstanceType,
+		Uptime:              instance.uptimeOver(uptimeAll),
+		Uptime24h:           instance.uptimeOver(uptime24h),
+		Uptime7d:            instance.uptimeOver(uptime7d),
+		Uptime30d:           instance.uptimeOver(uptime30d),
+		AvgResponseTimeMs:   calculateAvgResponseTime(checks),
+		P95ResponseTimeMs:   responseTimePercentile(checks, 95),
+		P99ResponseTimeMs:   responseTimePercentile(checks, 99),
+		ConsecutiveFailures: consecutiveFailures(checks),
 	}
+	if len(checks) > 0 {
+		last := checks[len(checks)-1]
+		stats.LastCheck = &last
+	}
+	stats.HealthScore = healthScore(stats, len(checks) > 0, m.config.RequestTimeout)
+
+	return stats, true
+}
+
+func (m *Monitor) findInstance(url string) *Instance {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	for _, instance := range m.instances {
+		if instance.URL == url {
+			return instance
+		}
+	}
+	return nil
+}
+
+func (m *Monitor) GetStatsData() interface{} {
+	return m.Stats()
 }
 
-func (m *Monitor) RegisterClient(client chan []byte) {
+// RegisterClient adds an SSE client that receives the events filter
+// selects on client. remoteAddr is shown in /api/clients.
+func (m *Monitor) RegisterClient(client chan []byte, filter StreamFilter, remoteAddr string) {
 	m.clientsMu.Lock()
-	m.clients[client] = true
+	m.clients[client] = newStreamClient(client, filter, remoteAddr)
+	clientCount := len(m.clients)
 	m.clientsMu.Unlock()
-	log.Printf("Client connected, total clients: %d", len(m.clients))
+	log.Printf("Client connected, total clients: %d", clientCount)
 }
 
+// UnregisterClient removes an SSE client and stops any broadcast still
+// sending to it.
 func (m *Monitor) UnregisterClient(client chan []byte) {
 	m.clientsMu.Lock()
-	delete(m.clients, client)
+	if c, ok := m.clients[client]; ok {
+		close(c.done)
+		delete(m.clients, client)
+	}
 	clientCount := len(m.clients)
 	m.clientsMu.Unlock()
-	close(client)
 	log.Printf("Client disconnected, total clients: %d", clientCount)
 }
 
+const (
+	StatusUp      = "up"
+	StatusDown    = "down"
+	StatusPending = "pending"
+)
+
+// instanceStatus reports an instance as pending until it has completed its
+// first check, then as up or down based on the latest check.
+func instanceStatus(checks []Check) string {
+	if len(checks) == 0 {
+		return StatusPending
+	}
+	if checks[len(checks)-1].Success {
+		return StatusUp
+	}
+	return StatusDown
+}
+
 func calculateUptime(checks []Check) float64 {
 	if len(checks) == 0 {
 		return 0
 	}
 
 	successful := 0
+	total := 0
 	for _, check := range checks {
-		if check.Success {
-			successful++
-		}
+		successful += check.successes()
+		total += check.weight()
 	}
 
-	return (float64(successful) / float64(len(checks))) * 100
+	return (float64(successful) / float64(total)) * 100
 }
 
 func calculateAvgResponseTime(checks []Check) int64 {
@@ -484,9 +1797,106 @@ func calculateAvgResponseTime(checks []Check) int64 {
 	}
 
 	total := int64(0)
+	count := int64(0)
 	for _, check := range checks {
-		total += check.ResponseTime
+		total += check.ResponseTime * int64(check.weight())
+		count += int64(check.weight())
+	}
+
+	return total / count
+}
+
+// checksSince returns the suffix of checks taken at or after since.
+func checksSince(checks []Check, since time.Time) []Check {
+	i := sort.Search(len(checks), func(i int) bool {
+		return !checks[i].Timestamp.Before(since)
+	})
+	return checks[i:]
+}
+
+// responseTimePercentile returns the p-th percentile response time, counting
+// compacted checks once per raw check they represent.
+func responseTimePercentile(checks []Check, p float64) int64 {
+	if len(checks) == 0 {
+		return 0
+	}
+
+	sorted := make([]Check, len(checks))
+	copy(sorted, checks)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].ResponseTime < sorted[j].ResponseTime
+	})
+
+	total := 0
+	for _, check := range sorted {
+		total += check.weight()
+	}
+
+	rank := int(float64(total)*p/100 + 0.5)
+	if rank < 1 {
+		rank = 1
+	}
+	seen := 0
+	for _, check := range sorted {
+		seen += check.weight()
+		if seen >= rank {
+			return check.ResponseTime
+		}
+	}
+	return sorted[len(sorted)-1].ResponseTime
+}
+
+// consecutiveFailures counts failed checks since the last success.
+func consecutiveFailures(checks []Check) int {
+	failures := 0
+	for i := len(checks) - 1; i >= 0; i-- {
+		if checks[i].successes() > 0 {
+			break
+		}
+		failures += checks[i].weight()
+	}
+	return failures
+}
+
+// healthScore rates an instance from 0 to 100: 80% from its 24h uptime and
+// 20% from how far its p95 response time is below the request timeout. An
+// instance that is currently failing scores at most half.
+func healthScore(stats InstanceStats, checked bool, timeout time.Duration) float64 {
+	if !checked {
+		return 0
+	}
+
+	latency := 0.0
+	if timeout > 0 {
+		latency = 1 - float64(stats.P95ResponseTimeMs)/float64(timeout.Milliseconds())
+		if latency < 0 {
+			latency = 0
+		}
+	}
+
+	score := 0.8*stats.Uptime24h + 20*latency
+	if stats.ConsecutiveFailures > 0 {
+		score /= 2
+	}
+	return score
+}
+
+// calculateAvgDownloadTimes averages TTFB and total download time over the
+// checks that measured a full body download.
+func calculateAvgDownloadTimes(checks []Check) (ttfb int64, download int64) {
+	count := int64(0)
+	for _, check := range checks {
+		if check.DownloadTime == 0 {
+			continue
+		}
+		ttfb += check.TTFB
+		download += check.DownloadTime
+		count++
+	}
+
+	if count == 0 {
+		return 0, 0
 	}
 
-	return total / int64(len(checks))
+	return ttfb / count, download / count
 }
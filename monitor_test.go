@@ -0,0 +1,885 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// NewTestMonitor returns a monitor that already has instances, skipping
+// Initialize and the instance list. A nil config means DefaultConfig.
+func NewTestMonitor(instances []*Instance, config *Config) *Monitor {
+	if config == nil {
+		config = DefaultConfig()
+	}
+	m := NewMonitor(config)
+	if instances != nil {
+		m.instances = instances
+	}
+	return m
+}
+
+func TestCheckRetries(t *testing.T) {
+	tests := []struct {
+		retries  int
+		failures int32
+		success  bool
+		attempts int32
+	}{
+		{0, 1, false, 1},
+		{2, 2, true, 3},
+		{2, 5, false, 3},
+		{3, 0, true, 1},
+	}
+
+	for _, tt := range tests {
+		var attempts atomic.Int32
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if attempts.Add(1) <= tt.failures {
+				w.WriteHeader(http.StatusServiceUnavailable)
+			}
+		}))
+
+		config := DefaultConfig()
+		config.CheckRetries = tt.retries
+		config.CheckRetryBackoff = 10 * time.Millisecond
+		m := NewMonitor(config)
+
+		start := time.Now()
+		check := m.checkWithRetries(context.Background(), server.URL, "ui", nil, nil)
+		server.Close()
+
+		if check.Success != tt.success {
+			t.Errorf("retries=%d failures=%d: success = %v, want %v", tt.retries, tt.failures, check.Success, tt.success)
+		}
+		if got := attempts.Load(); got != tt.attempts {
+			t.Errorf("retries=%d failures=%d: %d attempts, want %d", tt.retries, tt.failures, got, tt.attempts)
+		}
+		if check.Timestamp.Before(start) || check.Timestamp.After(start.Add(5*time.Millisecond)) {
+			t.Errorf("retries=%d failures=%d: timestamp %v is not the first attempt's (%v)", tt.retries, tt.failures, check.Timestamp, start)
+		}
+	}
+}
+
+func TestGroupByType(t *testing.T) {
+	m := NewTestMonitor([]*Instance{
+		{URL: "https://a.example", InstanceType: InstanceTypeAPI},
+		{URL: "https://b.example", InstanceType: InstanceTypeUI, Checks: checksWith(1, 0, 100)},
+		{URL: "tcp://c.example:5432", InstanceType: "tcp"},
+		{URL: "https://d.example", InstanceType: InstanceTypeAPI, Checks: checksWith(0, 1, 100)},
+	}, nil)
+
+	api, ui := m.GroupByType()
+	urls := func(instances []*Instance) []string {
+		var out []string
+		for _, instance := range instances {
+			out = append(out, instance.URL)
+		}
+		return out
+	}
+	if got := urls(api); len(got) != 2 || got[0] != "https://a.example" || got[1] != "https://d.example" {
+		t.Errorf("api = %v, want a and d in order", got)
+	}
+	if got := urls(ui); len(got) != 1 || got[0] != "https://b.example" {
+		t.Errorf("ui = %v, want b", got)
+	}
+
+	stats := m.Stats()
+	if want := (TypeStats{Total: 2, Down: 1, Pending: 1}); stats.Types[InstanceTypeAPI] != want {
+		t.Errorf("api stats = %+v, want %+v", stats.Types[InstanceTypeAPI], want)
+	}
+	if want := (TypeStats{Total: 1, Up: 1}); stats.Types[InstanceTypeUI] != want {
+		t.Errorf("ui stats = %+v, want %+v", stats.Types[InstanceTypeUI], want)
+	}
+	if want := (TypeStats{Total: 1, Pending: 1}); stats.Types["tcp"] != want {
+		t.Errorf("tcp stats = %+v, want %+v", stats.Types["tcp"], want)
+	}
+	if stats.TotalInstances != 4 || stats.PendingInstances != 2 {
+		t.Errorf("total = %d with %d pending, want all 4 instances with 2 pending", stats.TotalInstances, stats.PendingInstances)
+	}
+	if stats.AvgUptimePercent != 50 {
+		t.Errorf("avg uptime = %v, want 50 without the pending instance", stats.AvgUptimePercent)
+	}
+}
+
+func TestHealthScore(t *testing.T) {
+	timeout := time.Second
+	tests := []struct {
+		name    string
+		stats   InstanceStats
+		checked bool
+		timeout time.Duration
+		want    float64
+	}{
+		{"unchecked", InstanceStats{Uptime24h: 100}, false, timeout, 0},
+		{"perfect", InstanceStats{Uptime24h: 100}, true, timeout, 100},
+		{"half uptime", InstanceStats{Uptime24h: 50}, true, timeout, 60},
+		{"p95 at half the timeout", InstanceStats{Uptime24h: 100, P95ResponseTimeMs: 500}, true, timeout, 90},
+		{"p95 over the timeout", InstanceStats{Uptime24h: 100, P95ResponseTimeMs: 5000}, true, timeout, 80},
+		{"failing now", InstanceStats{Uptime24h: 100, ConsecutiveFailures: 1}, true, timeout, 50},
+		{"all failures", InstanceStats{P95ResponseTimeMs: 1000, ConsecutiveFailures: 3}, true, timeout, 0},
+		{"no timeout", InstanceStats{Uptime24h: 100}, true, 0, 80},
+	}
+
+	for _, tt := range tests {
+		if got := healthScore(tt.stats, tt.checked, tt.timeout); math.Abs(got-tt.want) > 1e-9 {
+			t.Errorf("%s: healthScore = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestInstanceStats(t *testing.T) {
+	config := DefaultConfig()
+	config.RequestTimeout = time.Second
+	m := NewTestMonitor([]*Instance{
+		{URL: "https://new.example", InstanceType: InstanceTypeAPI},
+		{URL: "https://down.example", InstanceType: InstanceTypeAPI, Checks: checksWith(0, 4, 1000)},
+		{URL: "https://up.example", InstanceType: InstanceTypeUI, Checks: append(checksWith(0, 1, 100), checksWith(3, 0, 100)...)},
+	}, config)
+
+	if _, ok := m.InstanceStats("https://missing.example"); ok {
+		t.Error("stats of an unknown instance: got ok")
+	}
+
+	stats, _ := m.InstanceStats("https://new.example")
+	if stats.LastCheck != nil || stats.Uptime != 0 || stats.HealthScore != 0 || stats.ConsecutiveFailures != 0 {
+		t.Errorf("unchecked instance stats = %+v, want zero values and no last check", stats)
+	}
+
+	stats, _ = m.InstanceStats("https://down.example")
+	if stats.LastCheck == nil || stats.LastCheck.Success || stats.ConsecutiveFailures != 4 || stats.Uptime != 0 || stats.HealthScore != 0 {
+		t.Errorf("failing instance stats = %+v, want 4 consecutive failures and a zero score", stats)
+	}
+
+	stats, _ = m.InstanceStats("https://up.example")
+	if stats.Uptime != 75 || stats.ConsecutiveFailures != 0 || stats.AvgResponseTimeMs != 100 || stats.Type != InstanceTypeUI {
+		t.Errorf("recovered instance stats = %+v, want 75%% uptime and no consecutive failures", stats)
+	}
+	if want := 0.8*75 + 20*0.9; math.Abs(stats.HealthScore-want) > 1e-9 {
+		t.Errorf("recovered instance health score = %v, want %v", stats.HealthScore, want)
+	}
+}
+
+func TestCalculateUptime(t *testing.T) {
+	tests := []struct {
+		name   string
+		checks []Check
+		want   float64
+	}{
+		{"empty", nil, 0},
+		{"all successes", checksWith(3, 0, 100), 100},
+		{"all failures", checksWith(0, 3, 100), 0},
+		{"mixed", checksWith(3, 1, 100), 75},
+		{"one third", checksWith(1, 2, 100), 100.0 / 3},
+		{"compacted", []Check{
+			{Compacted: true, Count: 10, SuccessCount: 9},
+			{Success: false},
+		}, 9.0 / 11 * 100},
+	}
+
+	for _, tt := range tests {
+		if got := calculateUptime(tt.checks); math.Abs(got-tt.want) > 1e-9 {
+			t.Errorf("%s: calculateUptime = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestCalculateAvgResponseTime(t *testing.T) {
+	tests := []struct {
+		name   string
+		checks []Check
+		want   int64
+	}{
+		{"empty", nil, 0},
+		{"single", checksWith(1, 0, 250), 250},
+		{"failures count", append(checksWith(1, 0, 100), checksWith(0, 1, 300)...), 200},
+		{"rounds down", []Check{{ResponseTime: 100}, {ResponseTime: 101}}, 100},
+		{"rounds down near one", []Check{{ResponseTime: 1}, {ResponseTime: 1}, {ResponseTime: 0}}, 0},
+		{"compacted weighted", []Check{
+			{Compacted: true, Count: 3, ResponseTime: 100},
+			{ResponseTime: 500},
+		}, 200},
+	}
+
+	for _, tt := range tests {
+		if got := calculateAvgResponseTime(tt.checks); got != tt.want {
+			t.Errorf("%s: calculateAvgResponseTime = %d, want %d", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestAppendCheckOutOfOrder(t *testing.T) {
+	now := time.Now()
+	instance := &Instance{URL: "https://a.example"}
+
+	// The clock is stepped back 40s between the second and third checks, and
+	// again before the last one.
+	for _, check := range []Check{
+		{Timestamp: now.Add(-25 * time.Hour), Success: false},
+		{Timestamp: now.Add(-10 * time.Minute), Success: true},
+		{Timestamp: now.Add(-10*time.Minute - 40*time.Second), Success: false},
+		{Timestamp: now.Add(-5 * time.Minute), Success: true},
+		{Timestamp: now.Add(-30 * time.Hour), Success: true},
+	} {
+		recorded := instance.appendCheck(check)
+		if recorded.Timestamp.Before(check.Timestamp) {
+			t.Errorf("check at %v recorded earlier, at %v", check.Timestamp, recorded.Timestamp)
+		}
+	}
+
+	if !sort.SliceIsSorted(instance.Checks, func(i, j int) bool {
+		return instance.Checks[i].Timestamp.Before(instance.Checks[j].Timestamp)
+	}) {
+		t.Fatalf("history is out of order: %+v", instance.Checks)
+	}
+	if got := instance.Checks[2].Timestamp; !got.Equal(now.Add(-10 * time.Minute)) {
+		t.Errorf("stepped back check recorded at %v, want the previous check's time", got)
+	}
+	// The last check keeps its place as the latest, and every check but the
+	// first falls in the 24h window.
+	if uptime := calculateUptime(checksSince(instance.Checks, now.Add(-24*time.Hour))); math.Abs(uptime-75) > 1e-9 {
+		t.Errorf("uptime_24h = %v, want 75", uptime)
+	}
+	if status := instanceStatus(instance.Checks); status != StatusUp {
+		t.Errorf("status = %s, want up from the latest check", status)
+	}
+
+	data := instance.data()
+	if data.LastSuccessUnix == nil || *data.LastSuccessUnix != now.Add(-5*time.Minute).Unix() {
+		t.Errorf("last_success_unix = %v, want the latest success", data.LastSuccessUnix)
+	}
+	if data.LastFailureUnix == nil || *data.LastFailureUnix != now.Add(-10*time.Minute).Unix() {
+		t.Errorf("last_failure_unix = %v, want the stepped back failure", data.LastFailureUnix)
+	}
+}
+
+func TestRemoveInstance(t *testing.T) {
+	m := NewTestMonitor([]*Instance{
+		{URL: "https://a.example", Index: 1},
+		{URL: "https://b.example", Index: 2},
+		{URL: "https://c.example", Index: 3},
+	}, nil)
+
+	if m.RemoveInstance("https://missing.example") {
+		t.Error("removed an instance that is not monitored")
+	}
+	if !m.RemoveInstance("https://b.example") {
+		t.Fatal("RemoveInstance(b) = false, want true")
+	}
+	for i, instance := range m.instances {
+		if instance.Index != i+1 {
+			t.Errorf("%s has index %d at position %d, want %d", instance.URL, instance.Index, i, i+1)
+		}
+	}
+	if len(m.instances) != 2 || m.instances[1].URL != "https://c.example" {
+		t.Errorf("instances after removal = %v, want a and c", m.instances)
+	}
+}
+
+func TestReset(t *testing.T) {
+	instance := &Instance{Group: "g", URL: "https://a.example", InstanceType: InstanceTypeAPI}
+	m := NewTestMonitor([]*Instance{instance}, DefaultConfig())
+	for _, success := range []bool{true, false, false} {
+		check := instance.appendCheck(Check{Timestamp: time.Now(), Success: success})
+		instance.recordDay(check, time.UTC)
+	}
+
+	if err := m.Reset("https://missing.example"); !errors.Is(err, ErrInstanceNotFound) {
+		t.Errorf("Reset of an unknown instance = %v, want ErrInstanceNotFound", err)
+	}
+	if err := m.Reset(instance.URL); err != nil {
+		t.Fatalf("Reset = %v", err)
+	}
+
+	data := instance.data()
+	if len(data.Checks) != 0 || data.DaysSummary.Days != 0 || data.LastSuccessUnix != nil || data.LastFailureUnix != nil {
+		t.Errorf("after Reset: %+v", data)
+	}
+	if check := instance.appendCheck(Check{Timestamp: time.Now(), Success: true}); instance.uptimeOver(uptimeAll) != 100 {
+		t.Errorf("uptime after a success following Reset = %v, want 100", instance.uptimeOver(uptimeAll))
+	} else if data := instance.data(); data.LastSuccessUnix == nil || *data.LastSuccessUnix != check.Timestamp.Unix() {
+		t.Errorf("last_success_unix = %v after a new check", data.LastSuccessUnix)
+	}
+}
+
+func TestLiveInstances(t *testing.T) {
+	now := time.Now()
+	up := &Instance{URL: "https://up.example"}
+	up.appendCheck(Check{Timestamp: now.Add(-time.Minute), Success: false})
+	up.appendCheck(Check{Timestamp: now, Success: true})
+	down := &Instance{URL: "https://down.example"}
+	down.appendCheck(Check{Timestamp: now.Add(-time.Minute), Success: true})
+	down.appendCheck(Check{Timestamp: now, Success: false})
+	unchecked := &Instance{URL: "https://new.example"}
+	// With the clock stepped back, the success is recorded at the time of
+	// the failure before it.
+	stepped := &Instance{URL: "https://stepped.example"}
+	stepped.appendCheck(Check{Timestamp: now, Success: false})
+	stepped.appendCheck(Check{Timestamp: now.Add(-time.Second), Success: true})
+	reset := &Instance{URL: "https://reset.example"}
+	reset.appendCheck(Check{Timestamp: now, Success: true})
+
+	m := NewTestMonitor([]*Instance{up, down, unchecked, stepped, reset}, DefaultConfig())
+	if err := m.Reset(reset.URL); err != nil {
+		t.Fatal(err)
+	}
+	if live := m.LiveInstances(); live != 2 {
+		t.Errorf("LiveInstances = %d, want 2", live)
+	}
+}
+
+func TestInitializeMaxStartupWait(t *testing.T) {
+	config := DefaultConfig()
+	config.InstancesURL = "/nonexistent/instances.json"
+	config.MaxStartupWait = 50 * time.Millisecond
+	m := NewMonitor(config)
+
+	start := time.Now()
+	err := m.Initialize(context.Background())
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Initialize = %v, want the deadline exceeded", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Initialize gave up after %v, want about %v", elapsed, config.MaxStartupWait)
+	}
+}
+
+func TestFetchBackoff(t *testing.T) {
+	want := []time.Duration{
+		time.Second, 2 * time.Second, 4 * time.Second, 8 * time.Second, 16 * time.Second,
+		32 * time.Second, time.Minute, time.Minute,
+	}
+	backoff := initialFetchBackoff
+	for i, w := range want {
+		if backoff != w {
+			t.Errorf("backoff %d = %v, want %v", i, backoff, w)
+		}
+		backoff = nextFetchBackoff(backoff)
+	}
+}
+
+func TestWaitForInstancesURLRetries(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "instances.json")
+	config := DefaultConfig()
+	config.InstancesURL = path
+	m := NewMonitor(config)
+	source := &countingSource{SourceReader: &FileSource{Path: path}}
+	m.source = source
+
+	// The list appears after the first failed fetch.
+	go func() {
+		for source.opens.Load() == 0 {
+			time.Sleep(time.Millisecond)
+		}
+		os.WriteFile(path, []byte(`{"ui": {"Main": {"urls": ["https://a.example"]}}}`), 0o644)
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	start := time.Now()
+	if err := m.WaitForInstancesURL(ctx); err != nil {
+		t.Fatalf("WaitForInstancesURL = %v", err)
+	}
+	if opens := source.opens.Load(); opens != 2 {
+		t.Errorf("fetched %d times, want 2", opens)
+	}
+	if elapsed := time.Since(start); elapsed < initialFetchBackoff {
+		t.Errorf("retried after %v, want the initial backoff of %v", elapsed, initialFetchBackoff)
+	}
+	if len(m.instances) != 1 {
+		t.Errorf("loaded %d instances, want 1", len(m.instances))
+	}
+}
+
+func TestStartupState(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer backend.Close()
+
+	config := DefaultConfig()
+	m := NewTestMonitor([]*Instance{{Group: "g", URL: backend.URL, InstanceType: InstanceTypeUI}}, config)
+	var firsts []bool
+	cycles := make(chan struct{}, 1)
+	m.OnCycle = func(first bool) {
+		firsts = append(firsts, first)
+		select {
+		case cycles <- struct{}{}:
+		default:
+		}
+	}
+	handler := NewServer(m, config).SetupRoutes()
+
+	ready := func() (int, string) {
+		rec := serveRoute(t, handler, http.MethodGet, "/ready")
+		var body struct {
+			State string `json:"state"`
+		}
+		json.NewDecoder(rec.Body).Decode(&body)
+		return rec.Code, body.State
+	}
+	if code, state := ready(); code != http.StatusServiceUnavailable || state != StateStarting || m.State() != StateStarting {
+		t.Errorf("before the first cycle: /ready %d %q, want 503 %q", code, state, StateStarting)
+	}
+
+	go m.Start(context.Background())
+	defer m.Stop()
+	select {
+	case <-cycles:
+	case <-time.After(2 * time.Second):
+		t.Fatal("the first check cycle did not complete")
+	}
+
+	if code, state := ready(); code != http.StatusOK || state != StateRunning || m.State() != StateRunning {
+		t.Errorf("after the first cycle: /ready %d %q, want 200 %q", code, state, StateRunning)
+	}
+
+	// Later cycles keep the monitor running and are not reported as first.
+	m.cycleCompleted()
+	if m.State() != StateRunning || !slices.Equal(firsts, []bool{true, false}) {
+		t.Errorf("state %q after cycles reported as first %v, want running and [true false]", m.State(), firsts)
+	}
+}
+
+// countingSource counts the reads of an instance list.
+type countingSource struct {
+	SourceReader
+	opens atomic.Int32
+}
+
+func (s *countingSource) Open(ctx context.Context) (io.ReadCloser, error) {
+	s.opens.Add(1)
+	return s.SourceReader.Open(ctx)
+}
+
+func TestRefreshIntervalHotReload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "instances.json")
+	if err := os.WriteFile(path, []byte(`{"ui": {}}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	config := DefaultConfig()
+	m := NewTestMonitor(nil, config)
+	source := &countingSource{SourceReader: &FileSource{Path: path}}
+	m.source = source
+
+	go m.Start(context.Background())
+	defer m.Stop()
+	for m.State() != StateRunning {
+		time.Sleep(time.Millisecond)
+	}
+
+	rec := httptest.NewRecorder()
+	NewServer(m, config).handleConfig(rec, httptest.NewRequest(http.MethodPatch, "/api/config",
+		strings.NewReader(`{"instance_refresh_interval_seconds": 1}`)))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("PATCH /api/config: status %d: %s", rec.Code, rec.Body)
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for source.opens.Load() == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("no refresh within 2s of setting a 1s interval")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestSinceMillisClampsNegative(t *testing.T) {
+	// Round(0) strips the monotonic reading, as a timestamp read back from
+	// storage would have none.
+	if ms := sinceMillis(time.Now().Add(time.Minute).Round(0)); ms != 0 {
+		t.Errorf("sinceMillis of a future wall clock time = %d, want 0", ms)
+	}
+	if ms := sinceMillis(time.Now().Add(-time.Second)); ms < 1000 {
+		t.Errorf("sinceMillis of a second ago = %d, want at least 1000", ms)
+	}
+}
+
+func TestExtractOrderFromJSON(t *testing.T) {
+	tests := []struct {
+		name    string
+		json    string
+		section string
+		want    []string
+	}{
+		{"empty document", `{}`, "api", []string{}},
+		{"missing section", `{"ui": {"a": []}}`, "api", []string{}},
+		{"empty section", `{"api": {}}`, "api", []string{}},
+		{"file order", `{"api": {"zeta": {}, "alpha": {}, "mid": {}}}`, "api", []string{"zeta", "alpha", "mid"}},
+		{"hyphens", `{"api": {"tidal-eu": {}, "tidal-us-east": {}}}`, "api", []string{"tidal-eu", "tidal-us-east"}},
+		{"unicode", `{"ui": {"münchen": [], "東京": [], "été": []}}`, "ui", []string{"münchen", "東京", "été"}},
+		{"prefix keys", `{"api": {"ab": {}, "a": {}}}`, "api", []string{"ab", "a"}},
+		{"key in value string", `{"ui": {"b": ["c"], "a": ["https://x"], "c": []}}`, "ui", []string{"b", "a", "c"}},
+		{"key name in earlier section", `{"ui": {"api": ["x"]}, "api": {"y": {}, "x": {}}}`, "api", []string{"y", "x"}},
+		{"braces in strings", `{"api": {"a": {"urls": ["https://x/{id}"]}, "b": {"note": "}"}}}`, "api", []string{"a", "b"}},
+		{"section not an object", `{"api": ["a", "b"]}`, "api", []string{}},
+		{"malformed", `{"api": {"a": {}, "b": `, "api", []string{"a", "b"}},
+	}
+
+	for _, tt := range tests {
+		got := extractOrderFromJSON(tt.json, tt.section)
+		if strings.Join(got, ",") != strings.Join(tt.want, ",") || got == nil {
+			t.Errorf("%s: extractOrderFromJSON = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func BenchmarkExtractOrderFromJSON(b *testing.B) {
+	var sb strings.Builder
+	sb.WriteString(`{"api": {`)
+	for i := 0; i < 2000; i++ {
+		if i > 0 {
+			sb.WriteString(", ")
+		}
+		fmt.Fprintf(&sb, `"group-%d": {"urls": ["https://%d.example"]}`, i, i)
+	}
+	sb.WriteString(`}}`)
+	body := sb.String()
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		extractOrderFromJSON(body, "api")
+	}
+}
+
+// newBenchMonitor builds a monitor with n instances in groups of ten, each
+// with an hourly history of checks, one in ten of them failed.
+func newBenchMonitor(n, checks int) *Monitor {
+	start := time.Now().Add(-time.Duration(checks) * time.Hour)
+	instances := make([]*Instance, n)
+	for i := range instances {
+		history := make([]Check, checks)
+		for j := range history {
+			history[j] = Check{
+				Timestamp:    start.Add(time.Duration(j) * time.Hour),
+				Success:      j%10 != 0,
+				ResponseTime: int64(100 + (i+j)%400),
+				StatusCode:   http.StatusOK,
+				InstanceType: InstanceTypeAPI,
+			}
+		}
+		instances[i] = &Instance{
+			Group:        fmt.Sprintf("group-%d", i/10),
+			URL:          fmt.Sprintf("https://%d.example", i),
+			InstanceType: InstanceTypeAPI,
+			GroupOrder:   i / 10,
+			Index:        i % 10,
+			Checks:       history,
+		}
+	}
+	return NewTestMonitor(instances, nil)
+}
+
+func benchmarkGetInstancesData(b *testing.B, n, checks int) {
+	m := newBenchMonitor(n, checks)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		m.GetInstancesData()
+	}
+}
+
+func BenchmarkGetInstancesData_100Instances_100Checks(b *testing.B) {
+	benchmarkGetInstancesData(b, 100, 100)
+}
+
+func BenchmarkGetInstancesData_1000Instances_168Checks(b *testing.B) {
+	benchmarkGetInstancesData(b, 1000, 168)
+}
+
+func BenchmarkBroadcastUpdate_50Clients(b *testing.B) {
+	// Every broadcast is logged.
+	defer log.SetOutput(log.Writer())
+	log.SetOutput(io.Discard)
+
+	m := newBenchMonitor(100, 100)
+	clients := make([]chan []byte, 50)
+	for i := range clients {
+		clients[i] = make(chan []byte, 1)
+		m.RegisterClient(clients[i], StreamFilter{}, "")
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		m.broadcastUpdate()
+		for _, client := range clients {
+			<-client
+		}
+	}
+}
+
+func TestCheckAll(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/fail" {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer server.Close()
+
+	m := NewTestMonitor([]*Instance{
+		{Group: "g", URL: server.URL + "/ok", InstanceType: InstanceTypeUI, Index: 1},
+		{Group: "g", URL: server.URL + "/fail", InstanceType: InstanceTypeUI, Index: 2},
+	}, nil)
+	client := make(chan []byte, 8)
+	m.RegisterClient(client, StreamFilter{}, "")
+
+	m.checkAll(context.Background())
+
+	data := m.GetInstancesData()
+	if len(data) != 2 || data[0].Status != StatusUp || data[1].Status != StatusDown {
+		t.Fatalf("instances = %+v, want one up and one down", data)
+	}
+	if data[1].LastCheck == nil || data[1].LastCheck.StatusCode != http.StatusInternalServerError {
+		t.Errorf("last check = %+v, want status 500", data[1].LastCheck)
+	}
+
+	stats := m.GetStatsData().(Stats)
+	if stats.State != StateRunning || stats.UpInstances != 1 || stats.DownInstances != 1 || stats.Types[InstanceTypeUI].Total != 2 {
+		t.Errorf("stats = %+v, want running with one up and one down", stats)
+	}
+
+	if m.DataVersion() != 1 {
+		t.Errorf("data version = %d, want 1 after one broadcast", m.DataVersion())
+	}
+	var events []string
+	for len(client) > 0 {
+		frame := string(<-client)
+		events = append(events, strings.TrimPrefix(strings.SplitN(frame, "\n", 2)[0], "event: "))
+	}
+	want := []string{EventInstanceCheck, EventInstanceCheck, EventInstanceUpdate}
+	if strings.Join(events, ",") != strings.Join(want, ",") {
+		t.Errorf("events = %v, want %v", events, want)
+	}
+}
+
+// checkOnce runs checkInstance against url as a UI instance and returns the
+// recorded check.
+func checkOnce(t *testing.T, url string, config *Config) Check {
+	t.Helper()
+
+	instance := &Instance{Group: "g", URL: url, InstanceType: InstanceTypeUI}
+	m := NewTestMonitor([]*Instance{instance}, config)
+	m.checkInstance(context.Background(), instance)
+
+	if len(instance.Checks) != 1 {
+		t.Fatalf("%d checks recorded, want 1", len(instance.Checks))
+	}
+	return instance.Checks[0]
+}
+
+func TestCheckInstance_DebugLog(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.SetCookie(w, &http.Cookie{Name: "session", Value: "secret"})
+		w.WriteHeader(http.StatusServiceUnavailable)
+		w.Write([]byte(strings.Repeat("x", debugBodyBytes) + "tail"))
+	}))
+	defer server.Close()
+
+	var buf bytes.Buffer
+	defer log.SetOutput(log.Writer())
+	log.SetOutput(&buf)
+
+	config := DefaultConfig()
+	config.LogLevel = "debug"
+	checkOnce(t, server.URL, config)
+	if logged := buf.String(); !strings.Contains(logged, "503 Service Unavailable, response headers:") ||
+		!strings.Contains(logged, "Set-Cookie: [redacted]") || strings.Contains(logged, "secret") || strings.Contains(logged, "body:") {
+		t.Errorf("debug log without LOG_HTTP_BODIES:\n%s", logged)
+	}
+
+	buf.Reset()
+	config.LogHTTPBodies = true
+	checkOnce(t, server.URL, config)
+	if logged := buf.String(); !strings.Contains(logged, `body: "`+strings.Repeat("x", debugBodyBytes)+`"...`) {
+		t.Errorf("debug log with LOG_HTTP_BODIES:\n%s", logged)
+	}
+}
+
+func TestCheckInstance_Success(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(5 * time.Millisecond)
+		w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+
+	check := checkOnce(t, server.URL, nil)
+	if !check.Success || check.StatusCode != http.StatusOK || check.Error != "" || check.ErrorType != "" {
+		t.Errorf("check = %+v, want a success with status 200 and no error", check)
+	}
+	if check.ResponseTime <= 0 || check.BodySize != 2 {
+		t.Errorf("response time %dms and body size %d, want a positive time and 2 bytes", check.ResponseTime, check.BodySize)
+	}
+}
+
+func TestCheckInstance_ResolvedIPs(t *testing.T) {
+	var conns atomic.Int32
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	server.Config.ConnState = func(_ net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			conns.Add(1)
+		}
+	}
+	server.Start()
+	defer server.Close()
+
+	instanceURL := strings.Replace(server.URL, "127.0.0.1", "localhost", 1)
+	instance := &Instance{Group: "g", URL: instanceURL, InstanceType: InstanceTypeUI}
+	m := NewTestMonitor([]*Instance{instance}, nil)
+	m.checkInstance(context.Background(), instance)
+	m.checkInstance(context.Background(), instance)
+
+	if conns.Load() != 1 {
+		t.Fatalf("%d connections opened, want the second check to reuse the first", conns.Load())
+	}
+	first, second := instance.Checks[0], instance.Checks[1]
+	if !slices.Contains(first.ResolvedIPs, "127.0.0.1") {
+		t.Errorf("first check resolved %v, want 127.0.0.1 among them", first.ResolvedIPs)
+	}
+	if !slices.Equal(second.ResolvedIPs, []string{"127.0.0.1"}) {
+		t.Errorf("check over a reused connection resolved %v, want the peer 127.0.0.1", second.ResolvedIPs)
+	}
+}
+
+func TestCheckInstance_CheckURL(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	if check := checkOnce(t, server.URL, nil); check.CheckURL != server.URL {
+		t.Errorf("UI check URL = %q, want %q", check.CheckURL, server.URL)
+	}
+
+	instance := &Instance{Group: "g", URL: server.URL, InstanceType: InstanceTypeAPI}
+	NewTestMonitor([]*Instance{instance}, nil).checkInstance(context.Background(), instance)
+	if want := server.URL + "/search/?s=kanye"; len(instance.Checks) != 1 || instance.Checks[0].CheckURL != want {
+		t.Errorf("API checks = %+v, want one of %q", instance.Checks, want)
+	}
+}
+
+func TestCheckInstance_NonSuccess(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(5 * time.Millisecond)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	check := checkOnce(t, server.URL, nil)
+	if check.Success || check.StatusCode != http.StatusServiceUnavailable || check.ErrorType != ErrorTypeHTTP {
+		t.Errorf("check = %+v, want a failure with status 503", check)
+	}
+	if check.Error != "" {
+		t.Errorf("error = %q, want none since the status code describes the failure", check.Error)
+	}
+	if check.ResponseTime <= 0 {
+		t.Errorf("response time %dms, want a positive time", check.ResponseTime)
+	}
+}
+
+func TestCheckInstance_Timeout(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-time.After(time.Second):
+		case <-r.Context().Done():
+		}
+	}))
+	defer server.Close()
+
+	config := DefaultConfig()
+	config.RequestTimeout = 50 * time.Millisecond
+	check := checkOnce(t, server.URL, config)
+
+	if check.Success || check.StatusCode != 0 || check.ErrorType != ErrorTypeTimeout {
+		t.Errorf("check = %+v, want a timeout", check)
+	}
+	// The message comes from the context, so it reads "deadline exceeded";
+	// error_type is what identifies a timeout.
+	if !strings.Contains(check.Error, "deadline exceeded") {
+		t.Errorf("error = %q, want it to mention the deadline", check.Error)
+	}
+	if check.ResponseTime < 50 {
+		t.Errorf("response time %dms, want at least the 50ms timeout", check.ResponseTime)
+	}
+}
+
+func TestCheckInstance_NetworkError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	url := server.URL
+	server.Close()
+
+	check := checkOnce(t, url, nil)
+	if check.Success || check.StatusCode != 0 || check.ErrorType != ErrorTypeConnectionRefused {
+		t.Errorf("check = %+v, want a refused connection", check)
+	}
+	if !strings.Contains(check.Error, "connection refused") {
+		t.Errorf("error = %q, want it to mention the refused connection", check.Error)
+	}
+	// A refused local connection can take less than a millisecond.
+	if check.ResponseTime < 0 {
+		t.Errorf("response time %dms, want it not to be negative", check.ResponseTime)
+	}
+}
+
+func TestCheckRequiredHeaders(t *testing.T) {
+	header := http.Header{}
+	header.Set("X-Api-Version", "2")
+	header.Set("Content-Type", "application/json")
+
+	tests := []struct {
+		name     string
+		required map[string]string
+		want     string
+	}{
+		{"all match", map[string]string{"X-Api-Version": "2", "Content-Type": "application/json"}, ""},
+		{"missing", map[string]string{"X-Served-By": "edge"}, "required header X-Served-By missing"},
+		{"mismatch", map[string]string{"X-Api-Version": "3"}, `required header X-Api-Version mismatch: expected "3", got "2"`},
+		// Headers are checked in name order, so the first failure is stable.
+		{"several failing", map[string]string{"X-Served-By": "edge", "Content-Type": "text/html", "X-Api-Version": "3"},
+			`required header Content-Type mismatch: expected "text/html", got "application/json"`},
+		{"none", nil, ""},
+	}
+	for _, tt := range tests {
+		if got := checkRequiredHeaders(header, tt.required); got != tt.want {
+			t.Errorf("%s: checkRequiredHeaders = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestCheckInstance_RequiredHeaders(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Api-Version", "2")
+	}))
+	defer server.Close()
+
+	for _, tt := range []struct {
+		version string
+		success bool
+	}{{"2", true}, {"3", false}} {
+		instance := &Instance{Group: "g", URL: server.URL, InstanceType: InstanceTypeAPI,
+			RequiredHeaders: map[string]string{"X-Api-Version": tt.version}}
+		m := NewTestMonitor([]*Instance{instance}, nil)
+		m.checkInstance(context.Background(), instance)
+
+		check := instance.Checks[0]
+		if check.Success != tt.success {
+			t.Errorf("required version %s: success = %v, want %v (%s)", tt.version, check.Success, tt.success, check.Error)
+		}
+		if !tt.success && (check.ErrorType != ErrorTypeBodyValidation || !strings.Contains(check.Error, "X-Api-Version mismatch")) {
+			t.Errorf("required version %s: error %q of type %q, want a body_validation mismatch", tt.version, check.Error, check.ErrorType)
+		}
+	}
+}
@@ -0,0 +1,223 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// Notification event types.
+const (
+	EventDown = "down"
+	EventUp   = "up"
+
+	EventLatencyDegraded  = "latency_degraded"
+	EventLatencyRecovered = "latency_recovered"
+)
+
+// NotificationEvent describes an instance going down or coming back up, or
+// its latency going over or back under its LatencyRule. It
+// is built once per transition and carries everything notifiers need, so
+// they do not have to look at the monitor themselves.
+type NotificationEvent struct {
+	InstanceURL         string    `json:"instance_url"`
+	Group               string    `json:"group"`
+	Type                string    `json:"type"`
+	Event               string    `json:"event"`
+	Uptime              float64   `json:"uptime"`
+	Uptime24h           float64   `json:"uptime_24h"`
+	ConsecutiveFailures int       `json:"consecutive_failures"`
+	LastError           string    `json:"last_error,omitempty"`
+	OccurredAt          time.Time `json:"occurred_at"`
+	StatusPageURL       string    `json:"status_page_url,omitempty"`
+
+	// Set for latency events.
+	LatencyMs         int64 `json:"latency_ms,omitempty"`
+	LatencyLimitMs    int64 `json:"latency_limit_ms,omitempty"`
+	LatencyBaselineMs int64 `json:"latency_baseline_ms,omitempty"`
+}
+
+// newNotificationEvent describes the transition caused by the instance's
+// latest check. The caller holds the instance lock.
+func (m *Monitor) newNotificationEvent(instance *Instance, event string) NotificationEvent {
+	checks := instance.Checks
+	last := checks[len(checks)-1]
+
+	return NotificationEvent{
+		InstanceURL:         instance.URL,
+		Group:               instance.Group,
+		Type:                instance.InstanceType,
+		Event:               event,
+		Uptime:              instance.uptimeOver(uptimeAll),
+		Uptime24h:           instance.uptimeOver(uptime24h),
+		ConsecutiveFailures: consecutiveFailures(checks),
+		LastError:           sanitizeError(lastError(checks), m.config.CheckErrorMaxLength),
+		OccurredAt:          last.Timestamp,
+		StatusPageURL:       m.config.StatusPageURL,
+	}
+}
+
+// lastError describes the most recent failed check, which for a recovery
+// is the failure that just ended.
+func lastError(checks []Check) string {
+	for i := len(checks) - 1; i >= 0; i-- {
+		check := checks[i]
+		if check.Success || check.Compacted {
+			continue
+		}
+		if check.Error != "" {
+			return check.Error
+		}
+		return fmt.Sprintf("status code %d", check.StatusCode)
+	}
+	return ""
+}
+
+// Notifier is a notification channel such as a chat webhook. Send is called
+// for every status transition with a context that carries the timeout.
+type Notifier interface {
+	Name() string
+	Send(ctx context.Context, event NotificationEvent) error
+}
+
+// dryRunNotifier stands in for a notifier when DRY_RUN is set.
+type dryRunNotifier struct {
+	Notifier
+	debug func() bool
+}
+
+func (n dryRunNotifier) Send(ctx context.Context, event NotificationEvent) error {
+	if n.debug() {
+		log.Printf("[DRY RUN] would notify %s: %s is %s", n.Name(), event.InstanceURL, event.Event)
+	}
+	return nil
+}
+
+// AddNotifier registers a notification channel. All registered notifiers
+// receive every event. In dry-run mode, events are only logged.
+func (m *Monitor) AddNotifier(n Notifier) {
+	if m.config.DryRun {
+		n = dryRunNotifier{Notifier: n, debug: m.config.IsDebug}
+	}
+
+	m.notifiersMu.Lock()
+	defer m.notifiersMu.Unlock()
+	m.notifiers = append(m.notifiers, n)
+}
+
+// addConfiguredNotifiers registers the notifiers set up in the config.
+func (m *Monitor) addConfiguredNotifiers() {
+	for _, u := range m.config.NotifyWebhookURLs {
+		m.AddNotifier(webhookNotifier{url: u})
+	}
+}
+
+// webhookNotifier posts every event as JSON to a URL.
+type webhookNotifier struct {
+	url string
+}
+
+func (n webhookNotifier) Name() string {
+	if u, err := url.Parse(n.url); err == nil && u.Host != "" {
+		return "webhook " + u.Host
+	}
+	return "webhook"
+}
+
+func (n webhookNotifier) Send(ctx context.Context, event NotificationEvent) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to encode event: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, n.url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to build webhook request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send webhook: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook returned unexpected status code: %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// notify sends event to every notifier concurrently. A failing or slow
+// notifier does not affect the others or the check that triggered it.
+func (m *Monitor) notify(event NotificationEvent) {
+	m.notifiersMu.RLock()
+	notifiers := m.notifiers
+	m.notifiersMu.RUnlock()
+
+	for _, n := range notifiers {
+		go func(n Notifier) {
+			ctx, cancel := context.WithTimeout(context.Background(), m.config.RequestTimeout)
+			defer cancel()
+
+			if err := n.Send(ctx, event); err != nil {
+				log.Printf("Notifier %s failed for %s: %v", n.Name(), event.InstanceURL, err)
+			}
+		}(n)
+	}
+}
+
+// notificationJob is a unit of outbound notification work, e.g. a webhook
+// call or a push to an external monitor.
+type notificationJob struct {
+	name string
+	send func(ctx context.Context) error
+}
+
+// Dispatcher delivers notifications asynchronously so that slow or failing
+// receivers never delay the check cycle. Up to workers jobs run at once, so
+// one slow receiver does not hold up the others.
+type Dispatcher struct {
+	queue   chan notificationJob
+	timeout time.Duration
+	debug   func() bool
+}
+
+func NewDispatcher(queueSize, workers int, timeout time.Duration, debug func() bool) *Dispatcher {
+	d := &Dispatcher{
+		queue:   make(chan notificationJob, queueSize),
+		timeout: timeout,
+		debug:   debug,
+	}
+	for range workers {
+		go d.run()
+	}
+	return d
+}
+
+// Enqueue schedules a job without blocking. If the queue is full the job is
+// dropped.
+func (d *Dispatcher) Enqueue(name string, send func(ctx context.Context) error) {
+	select {
+	case d.queue <- notificationJob{name: name, send: send}:
+	default:
+		log.Printf("Warning: Notification queue full, dropping %s", name)
+	}
+}
+
+func (d *Dispatcher) run() {
+	for job := range d.queue {
+		ctx, cancel := context.WithTimeout(context.Background(), d.timeout)
+		err := job.send(ctx)
+		cancel()
+
+		if err != nil && d.debug() {
+			log.Printf("Notification %s failed: %v", job.name, err)
+		}
+	}
+}
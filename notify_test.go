@@ -0,0 +1,178 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeNotifier hands the events it is sent to a channel, after send if set.
+type fakeNotifier struct {
+	name   string
+	events chan NotificationEvent
+	send   func(ctx context.Context) error
+}
+
+func newFakeNotifier(name string, send func(ctx context.Context) error) *fakeNotifier {
+	return &fakeNotifier{name: name, events: make(chan NotificationEvent, 4), send: send}
+}
+
+func (n *fakeNotifier) Name() string { return n.name }
+
+func (n *fakeNotifier) Send(ctx context.Context, event NotificationEvent) error {
+	var err error
+	if n.send != nil {
+		err = n.send(ctx)
+	}
+	n.events <- event
+	return err
+}
+
+func receiveEvent(t *testing.T, n *fakeNotifier, within time.Duration) NotificationEvent {
+	t.Helper()
+	select {
+	case event := <-n.events:
+		return event
+	case <-time.After(within):
+		t.Fatalf("%s received nothing within %v", n.name, within)
+		return NotificationEvent{}
+	}
+}
+
+func TestNotifyFanOut(t *testing.T) {
+	m := NewTestMonitor(nil, nil)
+	first, second := newFakeNotifier("first", nil), newFakeNotifier("second", nil)
+	m.AddNotifier(first)
+	m.AddNotifier(second)
+
+	event := NotificationEvent{InstanceURL: "https://a.example", Event: EventDown}
+	m.notify(event)
+	for _, n := range []*fakeNotifier{first, second} {
+		if got := receiveEvent(t, n, time.Second); got != event {
+			t.Errorf("%s received %+v, want %+v", n.name, got, event)
+		}
+	}
+}
+
+func TestNotifyIsolatesNotifiers(t *testing.T) {
+	config := DefaultConfig()
+	config.RequestTimeout = 500 * time.Millisecond
+	m := NewTestMonitor(nil, config)
+
+	slowErr := make(chan error, 1)
+	slow := newFakeNotifier("slow", func(ctx context.Context) error {
+		<-ctx.Done()
+		slowErr <- ctx.Err()
+		return ctx.Err()
+	})
+	failing := newFakeNotifier("failing", func(context.Context) error { return errors.New("boom") })
+	ok := newFakeNotifier("ok", nil)
+	m.AddNotifier(slow)
+	m.AddNotifier(failing)
+	m.AddNotifier(ok)
+
+	start := time.Now()
+	m.notify(NotificationEvent{InstanceURL: "https://a.example", Event: EventUp})
+	if elapsed := time.Since(start); elapsed > 100*time.Millisecond {
+		t.Errorf("notify took %v, want it to return without waiting for notifiers", elapsed)
+	}
+
+	// The others are served while the slow one is still waiting.
+	receiveEvent(t, failing, 250*time.Millisecond)
+	receiveEvent(t, ok, 250*time.Millisecond)
+
+	// The slow one is cut off by the request timeout.
+	receiveEvent(t, slow, time.Second)
+	if err := <-slowErr; !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("slow notifier ended with %v, want the deadline", err)
+	}
+}
+
+func TestWebhookNotifier(t *testing.T) {
+	received := make(chan NotificationEvent, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var event NotificationEvent
+		if r.Method != http.MethodPost || r.Header.Get("Content-Type") != "application/json" {
+			t.Errorf("webhook request %s with content type %q", r.Method, r.Header.Get("Content-Type"))
+		}
+		if err := json.NewDecoder(r.Body).Decode(&event); err != nil {
+			t.Errorf("failed to decode webhook body: %v", err)
+		}
+		received <- event
+		if r.URL.Path == "/broken" {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer server.Close()
+
+	config := DefaultConfig()
+	config.NotifyWebhookURLs = []string{server.URL + "/hook"}
+	m := NewTestMonitor(nil, config)
+	m.addConfiguredNotifiers()
+	if len(m.notifiers) != 1 {
+		t.Fatalf("%d notifiers registered, want 1", len(m.notifiers))
+	}
+
+	event := NotificationEvent{InstanceURL: "https://a.example", Event: EventDown, ConsecutiveFailures: 3}
+	m.notify(event)
+	select {
+	case got := <-received:
+		if got.InstanceURL != event.InstanceURL || got.Event != event.Event || got.ConsecutiveFailures != 3 {
+			t.Errorf("webhook received %+v, want %+v", got, event)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("webhook received nothing")
+	}
+
+	broken := webhookNotifier{url: server.URL + "/broken"}
+	if err := broken.Send(context.Background(), event); err == nil {
+		t.Error("Send to a webhook answering 500 succeeded")
+	}
+	<-received
+}
+
+func TestDryRunNotifier(t *testing.T) {
+	var buf bytes.Buffer
+	defer log.SetOutput(log.Writer())
+	log.SetOutput(&buf)
+
+	config := DefaultConfig()
+	config.DryRun = true
+	config.LogLevel = "debug"
+	m := NewTestMonitor(nil, config)
+	fake := newFakeNotifier("chat", nil)
+	m.AddNotifier(fake)
+
+	n := m.notifiers[0]
+	if _, ok := n.(dryRunNotifier); !ok || n.Name() != "chat" {
+		t.Fatalf("registered %T %q, want the notifier wrapped for the dry run", n, n.Name())
+	}
+	event := NotificationEvent{InstanceURL: "https://a.example", Event: EventDown}
+	if err := n.Send(context.Background(), event); err != nil {
+		t.Errorf("Send = %v, want nil", err)
+	}
+	if logged := buf.String(); !strings.Contains(logged, "[DRY RUN] would notify chat: https://a.example is down") {
+		t.Errorf("log = %q, want the dry run line", logged)
+	}
+
+	// Without debug logging the event is dropped silently.
+	buf.Reset()
+	config.LogLevel = "info"
+	n.Send(context.Background(), event)
+	if buf.Len() != 0 {
+		t.Errorf("log = %q at info level, want nothing", buf.String())
+	}
+
+	select {
+	case got := <-fake.events:
+		t.Errorf("the wrapped notifier was sent %+v", got)
+	default:
+	}
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"fmt"
+	"html"
+	"io/fs"
+	"net/http"
+	"strings"
+)
+
+// pageTitle is the title of the dashboard, as in index.html.
+const pageTitle = "status"
+
+// ogMarker in index.html is replaced by the OpenGraph tags of the page.
+const ogMarker = "<!--og-->"
+
+// ogImageKey caches the preview image with the badges, see faviconKey.
+const ogImageKey = "og-image"
+
+// fleetSummary describes fleet health in the terms of fleetColor.
+func fleetSummary(state string, stats Stats) string {
+	switch {
+	case state == StateStarting:
+		return "Starting"
+	case stats.UpInstances+stats.DownInstances == 0:
+		return "No Checks Yet"
+	case stats.DownInstances == 0:
+		return "All Systems Operational"
+	case stats.UpInstances == 0:
+		return "Major System Outage"
+	default:
+		return "Partial System Outage"
+	}
+}
+
+// generateOGImage renders the 1200x630 social preview of the page.
+func generateOGImage(state string, stats Stats) string {
+	return fmt.Sprintf(`<svg xmlns="http://www.w3.org/2000/svg" width="1200" height="630" viewBox="0 0 1200 630">
+  <rect width="1200" height="630" fill="#0f172a"/>
+  <g font-family="DejaVu Sans,Verdana,Geneva,sans-serif" fill="#f8fafc">
+    <text x="80" y="150" font-size="64" font-weight="bold">%s</text>
+    <circle cx="104" cy="285" r="24" fill="%s"/>
+    <text x="150" y="305" font-size="56">%s</text>
+    <text x="80" y="460" font-size="44" fill="#cbd5e1">%d of %d instances up</text>
+    <text x="80" y="530" font-size="44" fill="#cbd5e1">%.2f%% average uptime</text>
+  </g>
+</svg>`, html.EscapeString(pageTitle), fleetColor(state, stats), fleetSummary(state, stats),
+		stats.UpInstances, stats.TotalInstances, stats.AvgUptimePercent)
+}
+
+func (s *Server) handleOGImage(w http.ResponseWriter, r *http.Request) {
+	version := s.monitor.DataVersion()
+	image, ok := s.badges.get(ogImageKey, version)
+	if !ok {
+		image = newCachedBadge(http.StatusOK, generateOGImage(s.monitor.State(), s.monitor.Stats()))
+		s.badges.put(ogImageKey, version, image)
+	}
+
+	writeSVG(w, r, image, s.config.BadgeCacheSeconds)
+}
+
+// serveIndex serves index.html with the OpenGraph tags of the page, which
+// link absolute URLs as unfurlers require, and the other static files from
+// files.
+func (s *Server) serveIndex(staticFS fs.FS, files http.Handler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/" {
+			files.ServeHTTP(w, r)
+			return
+		}
+
+		data, err := fs.ReadFile(staticFS, "index.html")
+		if err != nil {
+			writeJSONError(w, http.StatusNotFound, "not_found", "Not found")
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Write([]byte(strings.Replace(string(data), ogMarker, s.ogTags(r), 1)))
+	}
+}
+
+func (s *Server) ogTags(r *http.Request) string {
+	stats := s.monitor.Stats()
+	pageURL := strings.TrimSuffix(s.pageURL(r), "/")
+	description := fmt.Sprintf("%s: %d of %d instances up", fleetSummary(s.monitor.State(), stats), stats.UpInstances, stats.TotalInstances)
+	// The version makes unfurlers that cache by URL fetch a new image.
+	image := fmt.Sprintf("%s/api/og-image.svg?v=%d", pageURL, s.monitor.DataVersion())
+
+	var b strings.Builder
+	for _, tag := range [][2]string{
+		{"og:type", "website"},
+		{"og:title", pageTitle},
+		{"og:description", description},
+		{"og:url", pageURL + "/"},
+		{"og:image", image},
+		{"og:image:width", "1200"},
+		{"og:image:height", "630"},
+	} {
+		fmt.Fprintf(&b, "<meta property=\"%s\" content=\"%s\">\n    ", tag[0], html.EscapeString(tag[1]))
+	}
+	b.WriteString(`<meta name="twitter:card" content="summary_large_image">`)
+	return b.String()
+}
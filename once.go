@@ -0,0 +1,69 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"text/tabwriter"
+)
+
+// Exit codes of the -once mode.
+const (
+	exitAllUp    = 0
+	exitSomeDown = 1
+	exitError    = 2
+)
+
+// runOnce checks every instance once, writes a report to w and returns the
+// process exit code. A latency degraded instance is still up and does not
+// fail the run; the report flags it.
+func runOnce(w io.Writer, config *Config, format string) int {
+	if format != "json" && format != "table" {
+		log.Printf("Invalid format %q, expected json or table", format)
+		return exitError
+	}
+
+	monitor := NewMonitor(config)
+	data, err := monitor.RunOnce(context.Background())
+	if err != nil {
+		log.Printf("Check failed: %v", err)
+		return exitError
+	}
+
+	if format == "table" {
+		err = writeReportTable(w, data)
+	} else {
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		err = encoder.Encode(data)
+	}
+	if err != nil {
+		log.Printf("Failed to write report: %v", err)
+		return exitError
+	}
+
+	for _, instance := range data {
+		if instance.Status != StatusUp {
+			return exitSomeDown
+		}
+	}
+	return exitAllUp
+}
+
+func writeReportTable(w io.Writer, data []InstanceData) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "STATUS\tTYPE\tGROUP\tURL\tTIME\tERROR")
+	for _, instance := range data {
+		var responseTime int64
+		var checkErr string
+		if instance.LastCheck != nil {
+			responseTime = instance.LastCheck.ResponseTime
+			checkErr = instance.LastCheck.Error
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%dms\t%s\n",
+			instance.Status, instance.InstanceType, instance.Group, instance.URL, responseTime, checkErr)
+	}
+	return tw.Flush()
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRunOnce(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/down":
+			w.WriteHeader(http.StatusServiceUnavailable)
+		case "/slow":
+			time.Sleep(20 * time.Millisecond)
+		}
+	}))
+	defer backend.Close()
+
+	writeList := func(t *testing.T, content string) string {
+		path := filepath.Join(t.TempDir(), "instances.json")
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	list := func(paths ...string) string {
+		urls := make([]string, len(paths))
+		for i, path := range paths {
+			urls[i] = `"` + backend.URL + path + `"`
+		}
+		return `{"ui": {"Main": {"urls": [` + strings.Join(urls, ", ") + `]}}}`
+	}
+
+	tests := []struct {
+		name      string
+		list      string
+		format    string
+		threshold int64
+		want      int
+	}{
+		{"all up", list("/a", "/b"), "json", 0, exitAllUp},
+		{"one down", list("/a", "/down"), "json", 0, exitSomeDown},
+		{"latency degraded", list("/slow"), "json", 1, exitAllUp},
+		{"table", list("/a", "/down"), "table", 0, exitSomeDown},
+		{"invalid list", `{"ui": [`, "json", 0, exitError},
+		{"invalid format", list("/a"), "xml", 0, exitError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := DefaultConfig()
+			config.InstancesURL = writeList(t, tt.list)
+			config.SelfCheck = false
+			config.LatencyAlert.ThresholdMs = tt.threshold
+
+			var out bytes.Buffer
+			if code := runOnce(&out, config, tt.format); code != tt.want {
+				t.Fatalf("runOnce = %d, want %d; output: %s", code, tt.want, out.String())
+			}
+			if tt.want == exitError {
+				return
+			}
+
+			if tt.format == "table" {
+				if !strings.HasPrefix(out.String(), "STATUS") || !strings.Contains(out.String(), backend.URL+"/down") {
+					t.Errorf("table report = %q", out.String())
+				}
+				return
+			}
+			var data []InstanceData
+			if err := json.Unmarshal(out.Bytes(), &data); err != nil {
+				t.Fatalf("failed to decode report: %v", err)
+			}
+			for _, instance := range data {
+				if degraded := tt.threshold > 0; instance.LatencyDegraded != degraded {
+					t.Errorf("%s latency_degraded = %v, want %v", instance.URL, instance.LatencyDegraded, degraded)
+				}
+			}
+		})
+	}
+}
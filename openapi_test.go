@@ -0,0 +1,209 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// TestOpenAPIResponses requests every documented GET route with a JSON
+// response and checks the response against its schema: required keys are
+// present, every key is documented and values have the documented types.
+func TestOpenAPIResponses(t *testing.T) {
+	data, err := os.ReadFile("static/openapi.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var spec map[string]interface{}
+	if err := json.Unmarshal(data, &spec); err != nil {
+		t.Fatalf("failed to parse openapi.json: %v", err)
+	}
+
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/down" {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer backend.Close()
+
+	config := DefaultConfig()
+	config.APIKey = "secret"
+	upURL, downURL := backend.URL+"/up", backend.URL+"/down"
+	m := NewTestMonitor([]*Instance{
+		{Group: "main", URL: upURL, InstanceType: InstanceTypeUI, Index: 1},
+		{Group: "main", URL: downURL, InstanceType: InstanceTypeUI, Index: 2},
+		{Group: "old", URL: backend.URL + "/old", InstanceType: InstanceTypeUI, GroupOrder: 1, Index: 3},
+	}, config)
+	m.checkAll(context.Background())
+	m.RemoveInstance(backend.URL + "/old")
+	m.RegisterClient(make(chan []byte, 1), StreamFilter{}, "192.0.2.1:1234")
+
+	server := httptest.NewServer(NewServer(m, config).SetupRoutes())
+	defer server.Close()
+
+	pathParams := map[string]string{
+		"{url}":  url.QueryEscape(upURL),
+		"{name}": "main",
+	}
+	queries := map[string]string{
+		"/api/instances/search": "q=up",
+		"/api/search":           "q=up",
+		"/api/changes":          "since=0",
+		"/api/badges":           "format=json&urls=" + url.QueryEscape(upURL+",https://missing.example"),
+	}
+
+	paths := spec["paths"].(map[string]interface{})
+	tested := 0
+	for _, path := range sortedKeys(paths) {
+		get, ok := paths[path].(map[string]interface{})["get"].(map[string]interface{})
+		if !ok {
+			continue
+		}
+		ok200, _ := get["responses"].(map[string]interface{})["200"].(map[string]interface{})
+		content, _ := ok200["content"].(map[string]interface{})
+		jsonContent, _ := content["application/json"].(map[string]interface{})
+		schema, ok := jsonContent["schema"].(map[string]interface{})
+		if !ok {
+			continue
+		}
+
+		target := path
+		for param, value := range pathParams {
+			target = strings.ReplaceAll(target, param, value)
+		}
+		if query, ok := queries[path]; ok {
+			target += "?" + query
+		}
+
+		req, _ := http.NewRequest(http.MethodGet, server.URL+target, nil)
+		req.Header.Set("X-API-Key", config.APIKey)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("GET %s: %v", target, err)
+		}
+		var body interface{}
+		err = json.NewDecoder(resp.Body).Decode(&body)
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK || err != nil {
+			t.Errorf("GET %s: status %d, decode error %v", target, resp.StatusCode, err)
+			continue
+		}
+
+		checkSchema(t, spec, schema, body, path)
+		tested++
+	}
+	if tested < 15 {
+		t.Errorf("only %d routes checked, the spec was not read as expected", tested)
+	}
+}
+
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// checkSchema reports where value does not match schema. Objects with
+// properties may only have documented keys, unless additionalProperties
+// allows more.
+func checkSchema(t *testing.T, spec map[string]interface{}, schema map[string]interface{}, value interface{}, where string) {
+	t.Helper()
+
+	if value == nil {
+		if schema["nullable"] != true {
+			t.Errorf("%s is null", where)
+		}
+		return
+	}
+	if ref, ok := schema["$ref"].(string); ok {
+		schema = resolveRef(t, spec, ref)
+	}
+	if allOf, ok := schema["allOf"].([]interface{}); ok {
+		for _, sub := range allOf {
+			checkSchema(t, spec, sub.(map[string]interface{}), value, where)
+		}
+		return
+	}
+
+	switch schema["type"] {
+	case "object":
+		obj, ok := value.(map[string]interface{})
+		if !ok {
+			t.Errorf("%s = %v, want an object", where, value)
+			return
+		}
+		required, _ := schema["required"].([]interface{})
+		for _, key := range required {
+			if _, ok := obj[key.(string)]; !ok {
+				t.Errorf("%s is missing required key %q", where, key)
+			}
+		}
+		properties, hasProperties := schema["properties"].(map[string]interface{})
+		for key, v := range obj {
+			if property, ok := properties[key]; ok {
+				checkSchema(t, spec, property.(map[string]interface{}), v, where+"."+key)
+				continue
+			}
+			switch additional := schema["additionalProperties"].(type) {
+			case map[string]interface{}:
+				checkSchema(t, spec, additional, v, where+"."+key)
+			case bool:
+				if !additional {
+					t.Errorf("%s has undocumented key %q", where, key)
+				}
+			default:
+				if hasProperties {
+					t.Errorf("%s has undocumented key %q", where, key)
+				}
+			}
+		}
+	case "array":
+		arr, ok := value.([]interface{})
+		if !ok {
+			t.Errorf("%s = %v, want an array", where, value)
+			return
+		}
+		items, _ := schema["items"].(map[string]interface{})
+		for i, item := range arr {
+			if items != nil {
+				checkSchema(t, spec, items, item, where+"["+strconv.Itoa(i)+"]")
+			}
+		}
+	case "string":
+		if _, ok := value.(string); !ok {
+			t.Errorf("%s = %v, want a string", where, value)
+		}
+	case "integer", "number":
+		if _, ok := value.(float64); !ok {
+			t.Errorf("%s = %v, want a number", where, value)
+		}
+	case "boolean":
+		if _, ok := value.(bool); !ok {
+			t.Errorf("%s = %v, want a boolean", where, value)
+		}
+	}
+}
+
+func resolveRef(t *testing.T, spec map[string]interface{}, ref string) map[string]interface{} {
+	t.Helper()
+
+	var node interface{} = spec
+	for _, part := range strings.Split(strings.TrimPrefix(ref, "#/"), "/") {
+		next, ok := node.(map[string]interface{})[part]
+		if !ok {
+			t.Fatalf("unresolved $ref %s", ref)
+		}
+		node = next
+	}
+	return node.(map[string]interface{})
+}
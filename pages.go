@@ -0,0 +1,113 @@
+package main
+
+import (
+	"net/http"
+	"time"
+)
+
+// NewPageServer returns the server of one page in a multi-page setup. It
+// shares the client IP resolution, rate limits and panic counter of s, whose
+// middleware wraps every page, so limits apply per client across pages.
+func (s *Server) NewPageServer(monitor *Monitor, page Page) *Server {
+	ps := NewServer(monitor, page.Config)
+	ps.clientIPs = s.clientIPs
+	ps.allowlist = s.allowlist
+	ps.limiter = s.limiter
+	ps.instancesLimiter = s.instancesLimiter
+	ps.streams = s.streams
+	ps.panics = s.panics
+	ps.basePath = page.Path[:len(page.Path)-1]
+	return ps
+}
+
+// SetupPageRoutes mounts the routes of each page under its path, behind the
+// middleware of s. /health and /ready report on all pages, and / redirects to
+// the first page.
+func (s *Server) SetupPageRoutes(pages []*Server) http.Handler {
+	mux := http.NewServeMux()
+
+	// The prefix is stripped before the middleware runs, so it sees the
+	// same paths as on a single page.
+	for _, page := range pages {
+		mux.Handle(page.basePath+"/", http.StripPrefix(page.basePath, s.withMiddleware(page.routes())))
+	}
+
+	root := http.NewServeMux()
+	root.HandleFunc("/", allowMethods(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/" || len(pages) == 0 {
+			writeJSONError(w, http.StatusNotFound, "not_found", "Not found")
+			return
+		}
+		http.Redirect(w, r, pages[0].basePath+"/", http.StatusFound)
+	}, http.MethodGet))
+	root.HandleFunc("/health", allowMethods(s.handlePagesHealth(pages), http.MethodGet))
+	root.HandleFunc("/ready", allowMethods(s.handlePagesReady(pages), http.MethodGet))
+	mux.Handle("/", s.withMiddleware(root))
+
+	return mux
+}
+
+// PageHealth is the health of one page in the aggregated /health response.
+type PageHealth struct {
+	Instances     int    `json:"instances"`
+	LiveInstances int    `json:"live_instances"`
+	State         string `json:"state"`
+}
+
+func (s *Server) handlePagesHealth(pages []*Server) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		total, live := 0, 0
+		perPage := make(map[string]PageHealth, len(pages))
+		for _, page := range pages {
+			page.monitor.mu.RLock()
+			instanceCount := len(page.monitor.instances)
+			page.monitor.mu.RUnlock()
+
+			pageLive := page.monitor.LiveInstances()
+			total += instanceCount
+			live += pageLive
+			perPage[page.basePath+"/"] = PageHealth{
+				Instances:     instanceCount,
+				LiveInstances: pageLive,
+				State:         page.monitor.State(),
+			}
+		}
+
+		writeJSON(w, map[string]interface{}{
+			"status":         "healthy",
+			"timestamp":      time.Now().Unix(),
+			"instances":      total,
+			"live_instances": live,
+			"panics":         s.panics.Load(),
+			"pages":          perPage,
+		})
+	}
+}
+
+// handlePagesReady reports ready once every page is running.
+func (s *Server) handlePagesReady(pages []*Server) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		state := StateRunning
+		perPage := make(map[string]string, len(pages))
+		for _, page := range pages {
+			pageState := page.monitor.State()
+			if pageState != StateRunning {
+				state = pageState
+			}
+			perPage[page.basePath+"/"] = pageState
+		}
+
+		if state != StateRunning {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		writeJSON(w, map[string]interface{}{
+			"state":     state,
+			"timestamp": time.Now().Unix(),
+			"pages":     perPage,
+		})
+	}
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func newPagesTestHandler(t *testing.T) (*Server, []*Server, http.Handler) {
+	t.Helper()
+
+	root := NewServer(nil, DefaultConfig())
+
+	hifi := NewTestMonitor([]*Instance{
+		{Group: "g", URL: "https://hifi.example", InstanceType: "api", Checks: checksWith(1, 0, 100)},
+	}, nil)
+	hifi.cycleCompleted()
+
+	other := NewTestMonitor([]*Instance{
+		{Group: "g", URL: "https://other-1.example", InstanceType: "api"},
+		{Group: "g", URL: "https://other-2.example", InstanceType: "api"},
+	}, nil)
+
+	pages := []*Server{
+		root.NewPageServer(hifi, Page{Path: "/hifi/", Config: hifi.config}),
+		root.NewPageServer(other, Page{Path: "/other/", Config: other.config}),
+	}
+	return root, pages, root.SetupPageRoutes(pages)
+}
+
+func TestPagesIsolated(t *testing.T) {
+	_, _, handler := newPagesTestHandler(t)
+
+	for path, want := range map[string]int{"/hifi/api/instances": 1, "/other/api/instances": 2} {
+		rec := serveRoute(t, handler, http.MethodGet, path)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("%s: status %d, want 200", path, rec.Code)
+		}
+		var data []InstanceData
+		if err := json.NewDecoder(rec.Body).Decode(&data); err != nil {
+			t.Fatalf("%s: failed to decode: %v", path, err)
+		}
+		if len(data) != want {
+			t.Errorf("%s: %d instances, want %d", path, len(data), want)
+		}
+	}
+
+	if rec := serveRoute(t, handler, http.MethodGet, "/other/api/badge/https%3A%2F%2Fhifi.example"); rec.Code != http.StatusNotFound {
+		t.Errorf("badge of another page's instance: status %d, want 404", rec.Code)
+	}
+
+	// The middleware only exempts the stream from its headers and write
+	// deadline if it sees the path without the prefix.
+	req := httptest.NewRequest(http.MethodGet, "/hifi/api/stream", nil)
+	ctx, cancel := context.WithCancel(req.Context())
+	cancel()
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req.WithContext(ctx))
+	if got := rec.Header().Get("Content-Security-Policy"); got != "" {
+		t.Errorf("stream Content-Security-Policy = %q, want none", got)
+	}
+	if got := rec.Header().Get(RequestIDHeader); got == "" {
+		t.Error("page response has no X-Request-ID, want the shared middleware")
+	}
+
+	if rec := serveRoute(t, handler, http.MethodGet, "/"); rec.Code != http.StatusFound || rec.Header().Get("Location") != "/hifi/" {
+		t.Errorf("/: status %d, Location %q, want a redirect to /hifi/", rec.Code, rec.Header().Get("Location"))
+	}
+	if rec := serveRoute(t, handler, http.MethodGet, "/api/instances"); rec.Code != http.StatusNotFound {
+		t.Errorf("/api/instances outside a page: status %d, want 404", rec.Code)
+	}
+}
+
+func TestPagesHealth(t *testing.T) {
+	_, pages, handler := newPagesTestHandler(t)
+
+	rec := serveRoute(t, handler, http.MethodGet, "/health")
+	var health struct {
+		Instances int                   `json:"instances"`
+		Pages     map[string]PageHealth `json:"pages"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&health); err != nil {
+		t.Fatalf("failed to decode health: %v", err)
+	}
+	if health.Instances != 3 || health.Pages["/hifi/"].Instances != 1 || health.Pages["/other/"].Instances != 2 {
+		t.Errorf("health = %+v, want 3 instances split 1 and 2", health)
+	}
+
+	if rec := serveRoute(t, handler, http.MethodGet, "/ready"); rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("/ready with a starting page: status %d, want 503", rec.Code)
+	}
+	pages[1].monitor.cycleCompleted()
+	if rec := serveRoute(t, handler, http.MethodGet, "/ready"); rec.Code != http.StatusOK {
+		t.Errorf("/ready with every page running: status %d, want 200", rec.Code)
+	}
+}
+
+func TestLoadPagesFromFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	os.WriteFile(path, []byte(`
+check_interval: 10m
+max_check_history: 50
+pages:
+  - path: hifi
+    instances_url: /data/hifi.json
+  - path: /other/
+    instances_url: /data/other.json
+    check_interval: 5m
+    max_check_history: 20
+`), 0o644)
+	t.Setenv("MAX_CHECK_HISTORY", "100")
+
+	pages, err := LoadPagesFromFile(path)
+	if err != nil {
+		t.Fatalf("LoadPagesFromFile: %v", err)
+	}
+	if len(pages) != 2 {
+		t.Fatalf("%d pages, want 2", len(pages))
+	}
+
+	hifi, other := pages[0], pages[1]
+	if hifi.Path != "/hifi/" || hifi.Config.InstancesURL != "/data/hifi.json" {
+		t.Errorf("first page = %s %s", hifi.Path, hifi.Config.InstancesURL)
+	}
+	// Top-level values and the environment apply unless the page sets them.
+	if hifi.Config.CheckInterval != 10*time.Minute || hifi.Config.MaxCheckHistory != 100 {
+		t.Errorf("first page: check interval %v, history %d, want 10m and 100", hifi.Config.CheckInterval, hifi.Config.MaxCheckHistory)
+	}
+	if other.Config.CheckInterval != 5*time.Minute || other.Config.MaxCheckHistory != 20 {
+		t.Errorf("second page: check interval %v, history %d, want 5m and 20", other.Config.CheckInterval, other.Config.MaxCheckHistory)
+	}
+
+	for _, bad := range []string{"pages: [{path: /a/}, {path: a}]", "pages: [{path: /}]", "pages: [{path: /health}]", "pages: [{path: /a/, check_interval: 600}]"} {
+		os.WriteFile(path, []byte(bad), 0o644)
+		if _, err := LoadPagesFromFile(path); err == nil {
+			t.Errorf("%s: got no error", bad)
+		}
+	}
+}
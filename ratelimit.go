@@ -0,0 +1,294 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"net/netip"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// parseIPPrefix accepts a CIDR or a single address.
+func parseIPPrefix(s string) (netip.Prefix, error) {
+	if strings.Contains(s, "/") {
+		prefix, err := netip.ParsePrefix(s)
+		if err != nil {
+			return netip.Prefix{}, err
+		}
+		return prefix.Masked(), nil
+	}
+
+	addr, err := netip.ParseAddr(s)
+	if err != nil {
+		return netip.Prefix{}, err
+	}
+	addr = addr.Unmap()
+	return netip.PrefixFrom(addr, addr.BitLen()), nil
+}
+
+// ipSet matches addresses against a list of prefixes.
+type ipSet []netip.Prefix
+
+// newIPSet parses entries that were validated when the config was loaded.
+func newIPSet(entries []string) ipSet {
+	set := make(ipSet, 0, len(entries))
+	for _, entry := range entries {
+		if prefix, err := parseIPPrefix(entry); err == nil {
+			set = append(set, prefix)
+		}
+	}
+	return set
+}
+
+func (s ipSet) contains(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	for _, prefix := range s {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// cfConnectingIPHeader is set by Cloudflare to the address of the client.
+const cfConnectingIPHeader = "CF-Connecting-IP"
+
+// clientIPResolver finds the address of the client behind a request. The
+// headers are only honored when the request comes from a trusted proxy.
+type clientIPResolver struct {
+	header  string
+	trusted ipSet
+}
+
+// remoteAddr returns the address of the peer that sent the request.
+func remoteAddr(r *http.Request) netip.Addr {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	remote, err := netip.ParseAddr(host)
+	if err != nil {
+		return netip.Addr{}
+	}
+	return remote.Unmap()
+}
+
+func (c clientIPResolver) clientIP(r *http.Request) netip.Addr {
+	remote := remoteAddr(r)
+	if !remote.IsValid() || !c.trusted.contains(remote) {
+		return remote
+	}
+
+	if addr, ok := c.forwardedFor(r); ok {
+		return addr
+	}
+	if addr, err := netip.ParseAddr(strings.TrimSpace(r.Header.Get(cfConnectingIPHeader))); err == nil {
+		return addr.Unmap()
+	}
+	return remote
+}
+
+// fromTrustedProxy reports whether the request was sent by a trusted proxy,
+// whose headers describe the client.
+func (c clientIPResolver) fromTrustedProxy(r *http.Request) bool {
+	return c.trusted.contains(remoteAddr(r))
+}
+
+// forwardedFor reads the client from the configured header. Proxies append
+// to X-Forwarded-For, so the client is the rightmost address that is not one
+// of our proxies, which is the first one when every hop is trusted.
+func (c clientIPResolver) forwardedFor(r *http.Request) (netip.Addr, bool) {
+	if c.header == "" {
+		return netip.Addr{}, false
+	}
+
+	var hops []string
+	for _, value := range r.Header.Values(c.header) {
+		hops = append(hops, strings.Split(value, ",")...)
+	}
+	for i := len(hops) - 1; i >= 0; i-- {
+		addr, err := netip.ParseAddr(strings.TrimSpace(hops[i]))
+		if err != nil {
+			return netip.Addr{}, false
+		}
+		addr = addr.Unmap()
+		if !c.trusted.contains(addr) || i == 0 {
+			return addr, true
+		}
+	}
+	return netip.Addr{}, false
+}
+
+type clientIPKey struct{}
+
+// withClientIP resolves the client address once and stores it in the request
+// context for the limiters and request logging.
+func (s *Server) withClientIP(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		addr := s.clientIPs.clientIP(r)
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), clientIPKey{}, addr)))
+	})
+}
+
+// requestClientIP returns the address stored by withClientIP, resolving it
+// if the request did not pass through the middleware.
+func (s *Server) requestClientIP(r *http.Request) netip.Addr {
+	if addr, ok := r.Context().Value(clientIPKey{}).(netip.Addr); ok {
+		return addr
+	}
+	return s.clientIPs.clientIP(r)
+}
+
+// rateLimiter is a per-client token bucket.
+type rateLimiter struct {
+	rps   float64
+	burst float64
+
+	mu      sync.Mutex
+	buckets map[netip.Addr]*tokenBucket
+}
+
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// rateLimiterPruneSize is the number of tracked clients above which full
+// buckets are dropped.
+const rateLimiterPruneSize = 1024
+
+func newRateLimiter(rps float64, burst int) *rateLimiter {
+	if burst < 1 {
+		burst = 1
+	}
+	return &rateLimiter{
+		rps:     rps,
+		burst:   float64(burst),
+		buckets: make(map[netip.Addr]*tokenBucket),
+	}
+}
+
+// allow takes a token for addr. If none is left it returns false and how long
+// until the next token is available.
+func (l *rateLimiter) allow(addr netip.Addr) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	bucket, ok := l.buckets[addr]
+	if !ok {
+		if len(l.buckets) >= rateLimiterPruneSize {
+			l.prune(now)
+		}
+		bucket = &tokenBucket{tokens: l.burst, last: now}
+		l.buckets[addr] = bucket
+	}
+
+	bucket.tokens = math.Min(l.burst, bucket.tokens+now.Sub(bucket.last).Seconds()*l.rps)
+	bucket.last = now
+
+	if bucket.tokens >= 1 {
+		bucket.tokens--
+		return true, 0
+	}
+	return false, time.Duration((1 - bucket.tokens) / l.rps * float64(time.Second))
+}
+
+// prune drops buckets that have refilled completely, since a new bucket
+// would be identical. The caller must hold l.mu.
+func (l *rateLimiter) prune(now time.Time) {
+	for addr, bucket := range l.buckets {
+		if bucket.tokens+now.Sub(bucket.last).Seconds()*l.rps >= l.burst {
+			delete(l.buckets, addr)
+		}
+	}
+}
+
+// streamLimiter caps concurrent SSE connections per client.
+type streamLimiter struct {
+	max int
+
+	mu    sync.Mutex
+	count map[netip.Addr]int
+}
+
+func newStreamLimiter(max int) *streamLimiter {
+	return &streamLimiter{max: max, count: make(map[netip.Addr]int)}
+}
+
+func (l *streamLimiter) acquire(addr netip.Addr) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.count[addr] >= l.max {
+		return false
+	}
+	l.count[addr]++
+	return true
+}
+
+func (l *streamLimiter) release(addr netip.Addr) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.count[addr] <= 1 {
+		delete(l.count, addr)
+	} else {
+		l.count[addr]--
+	}
+}
+
+// rateLimit rejects clients that exceed RATE_LIMIT_RPS with 429.
+func (s *Server) rateLimit(next http.HandlerFunc) http.HandlerFunc {
+	return s.limitRate(s.limiter, next)
+}
+
+// rateLimitInstances applies the stricter INSTANCES_API_RATE_LIMIT_RPS to
+// /api/instances, which is the most expensive endpoint to serve. It goes
+// outside rateLimit, so a request it rejects spends no general token.
+func (s *Server) rateLimitInstances(next http.HandlerFunc) http.HandlerFunc {
+	return s.limitRate(s.instancesLimiter, next)
+}
+
+func (s *Server) limitRate(limiter *rateLimiter, next http.HandlerFunc) http.HandlerFunc {
+	if limiter == nil {
+		return next
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		addr := s.requestClientIP(r)
+		if !s.allowlist.contains(addr) {
+			if ok, wait := limiter.allow(addr); !ok {
+				w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+				writeJSONError(w, http.StatusTooManyRequests, "rate_limited", "Too many requests")
+				return
+			}
+		}
+		next(w, r)
+	}
+}
+
+// limitStreams rejects clients that already have SSE_MAX_CONNECTIONS_PER_IP
+// streams open.
+func (s *Server) limitStreams(next http.HandlerFunc) http.HandlerFunc {
+	if s.streams == nil {
+		return next
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		addr := s.requestClientIP(r)
+		if !s.allowlist.contains(addr) {
+			if !s.streams.acquire(addr) {
+				writeJSONError(w, http.StatusTooManyRequests, "too_many_streams", fmt.Sprintf("Too many streams, at most %d per client", s.streams.max))
+				return
+			}
+			defer s.streams.release(addr)
+		}
+		next(w, r)
+	}
+}
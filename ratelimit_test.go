@@ -0,0 +1,65 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestClientIP(t *testing.T) {
+	resolver := clientIPResolver{
+		header:  "X-Forwarded-For",
+		trusted: newIPSet([]string{"10.0.0.0/8", "::1"}),
+	}
+
+	tests := []struct {
+		remote string
+		header map[string]string
+		want   string
+	}{
+		{"203.0.113.9:1234", nil, "203.0.113.9"},
+		// Headers from untrusted clients are ignored.
+		{"203.0.113.9:1234", map[string]string{"X-Forwarded-For": "198.51.100.1", "CF-Connecting-IP": "198.51.100.2"}, "203.0.113.9"},
+		{"10.0.0.1:1234", map[string]string{"X-Forwarded-For": "198.51.100.1"}, "198.51.100.1"},
+		{"10.0.0.1:1234", map[string]string{"X-Forwarded-For": "198.51.100.1, 10.0.0.2"}, "198.51.100.1"},
+		// A spoofed first entry does not hide the address our proxy saw.
+		{"10.0.0.1:1234", map[string]string{"X-Forwarded-For": "1.1.1.1, 198.51.100.1"}, "198.51.100.1"},
+		{"10.0.0.1:1234", map[string]string{"CF-Connecting-IP": "2001:db8::1"}, "2001:db8::1"},
+		{"10.0.0.1:1234", map[string]string{"X-Forwarded-For": "198.51.100.1", "CF-Connecting-IP": "198.51.100.2"}, "198.51.100.1"},
+		{"10.0.0.1:1234", map[string]string{"X-Forwarded-For": "not-an-ip", "CF-Connecting-IP": "198.51.100.2"}, "198.51.100.2"},
+		{"10.0.0.1:1234", map[string]string{"CF-Connecting-IP": "not-an-ip"}, "10.0.0.1"},
+		{"[::1]:1234", map[string]string{"X-Forwarded-For": "::ffff:198.51.100.1"}, "198.51.100.1"},
+	}
+
+	for _, tt := range tests {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.RemoteAddr = tt.remote
+		for name, value := range tt.header {
+			r.Header.Set(name, value)
+		}
+
+		if got := resolver.clientIP(r).String(); got != tt.want {
+			t.Errorf("clientIP(%s, %v) = %s, want %s", tt.remote, tt.header, got, tt.want)
+		}
+	}
+}
+
+func TestInstancesRateLimitSparesGeneralBudget(t *testing.T) {
+	s := newSortTestServer()
+	s.limiter = newRateLimiter(0.001, 3)
+	s.instancesLimiter = newRateLimiter(0.001, 1)
+	handler := s.SetupRoutes()
+
+	for i, want := range []int{http.StatusOK, http.StatusTooManyRequests, http.StatusTooManyRequests} {
+		if rec := serveRoute(t, handler, http.MethodGet, "/api/instances"); rec.Code != want {
+			t.Errorf("/api/instances request %d: status %d, want %d", i+1, rec.Code, want)
+		}
+	}
+
+	// Only the request /api/instances served took a general token.
+	for i, want := range []int{http.StatusOK, http.StatusOK, http.StatusTooManyRequests} {
+		if rec := serveRoute(t, handler, http.MethodGet, "/api/stats"); rec.Code != want {
+			t.Errorf("/api/stats request %d: status %d, want %d", i+1, rec.Code, want)
+		}
+	}
+}
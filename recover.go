@@ -0,0 +1,37 @@
+package main
+
+import (
+	"net/http"
+	"runtime/debug"
+)
+
+// withRecovery turns a panic in a handler into a logged stack trace and a
+// JSON 500 response. Handlers still run their deferred cleanup, such as
+// unregistering a stream client, while the panic unwinds.
+func (s *Server) withRecovery(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rw := &statusWriter{ResponseWriter: w}
+
+		defer func() {
+			err := recover()
+			if err == nil {
+				return
+			}
+			// ErrAbortHandler is the documented way to abort a response.
+			if err == http.ErrAbortHandler {
+				panic(err)
+			}
+
+			s.panics.Add(1)
+			logRequestf(r, "Panic serving %s %s: %v\n%s", r.Method, r.URL.Path, err, debug.Stack())
+
+			// Headers have been sent; all that can be done is to log.
+			if rw.status != 0 {
+				return
+			}
+			writeJSONError(w, http.StatusInternalServerError, "internal_error", "Internal server error")
+		}()
+
+		next.ServeHTTP(rw, r)
+	})
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRecoveryBeforeResponse(t *testing.T) {
+	s := newSortTestServer()
+	s.clientIPs.trusted = newIPSet([]string{"192.0.2.0/24"})
+	handler := s.withRequestID(s.withRecovery(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic("boom")
+	})))
+
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/api/instances", nil)
+	req.Header.Set(RequestIDHeader, "test-id")
+	handler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusInternalServerError {
+		t.Fatalf("status %d, want 500", rec.Code)
+	}
+	if got := rec.Header().Get("Content-Type"); got != "application/json" {
+		t.Errorf("Content-Type = %q, want application/json", got)
+	}
+	var body ErrorResponse
+	if err := json.NewDecoder(rec.Body).Decode(&body); err != nil {
+		t.Fatalf("failed to decode body: %v", err)
+	}
+	if body.Error.Code != "internal_error" || body.Error.RequestID != "test-id" {
+		t.Errorf("error = %+v, want code internal_error and request_id test-id", body.Error)
+	}
+	if got := s.panics.Load(); got != 1 {
+		t.Errorf("panics = %d, want 1", got)
+	}
+}
+
+func TestRecoveryDuringStream(t *testing.T) {
+	s := newSortTestServer()
+	handler := s.withRecovery(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		messageChan := make(chan []byte, 1)
+		s.monitor.RegisterClient(messageChan, StreamFilter{}, "")
+		defer s.monitor.UnregisterClient(messageChan)
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Write([]byte(":ok\n\n"))
+		w.(http.Flusher).Flush()
+		panic("boom")
+	}))
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/stream", nil))
+
+	if rec.Code != http.StatusOK {
+		t.Errorf("status %d, want the 200 that was already sent", rec.Code)
+	}
+	if body := rec.Body.String(); body != ":ok\n\n" {
+		t.Errorf("body = %q, want only the stream output", body)
+	}
+	if clients := s.monitor.Metrics().SSEClients; clients != 0 {
+		t.Errorf("%d clients still registered, want 0", clients)
+	}
+}
+
+func TestRecoveryMetrics(t *testing.T) {
+	s := newSortTestServer()
+	s.panics.Add(2)
+
+	rec := serveRoute(t, s.SetupRoutes(), http.MethodGet, "/metrics")
+	var metrics Metrics
+	if err := json.NewDecoder(rec.Body).Decode(&metrics); err != nil {
+		t.Fatalf("failed to decode metrics: %v", err)
+	}
+	if metrics.HandlerPanics != 2 {
+		t.Errorf("handler_panics = %d, want 2", metrics.HandlerPanics)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+	req.Header.Set("Accept", "application/openmetrics-text")
+	rec = httptest.NewRecorder()
+	s.SetupRoutes().ServeHTTP(rec, req)
+	if !strings.Contains(rec.Body.String(), "\nstatus_handler_panics_total 2\n") {
+		t.Errorf("OpenMetrics output has no status_handler_panics_total 2:\n%s", rec.Body.String())
+	}
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+// RequestIDHeader carries the ID that correlates a request across services.
+const RequestIDHeader = "X-Request-ID"
+
+// maxRequestIDLength bounds inbound request IDs that are reused as-is.
+const maxRequestIDLength = 128
+
+type requestIDKey struct{}
+
+// newRequestID returns a random 128-bit hex ID.
+func newRequestID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// validRequestID reports whether an inbound ID is safe to echo and log.
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] <= ' ' || id[i] > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+// withRequestID reuses the X-Request-ID set by a trusted proxy or generates
+// one, stores it in the request context and echoes it in the response.
+func (s *Server) withRequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(RequestIDHeader)
+		if !validRequestID(id) || !s.clientIPs.fromTrustedProxy(r) {
+			id = newRequestID()
+		}
+
+		w.Header().Set(RequestIDHeader, id)
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), requestIDKey{}, id)))
+	})
+}
+
+func requestID(r *http.Request) string {
+	id, _ := r.Context().Value(requestIDKey{}).(string)
+	return id
+}
+
+// logRequestf logs a message tagged with the request's ID and, behind
+// withClientIP, the client address.
+func logRequestf(r *http.Request, format string, args ...interface{}) {
+	var tags []string
+	if id := requestID(r); id != "" {
+		tags = append(tags, id)
+	}
+	if addr, ok := r.Context().Value(clientIPKey{}).(netip.Addr); ok && addr.IsValid() {
+		tags = append(tags, addr.String())
+	}
+
+	message := fmt.Sprintf(format, args...)
+	if len(tags) > 0 {
+		message = "[" + strings.Join(tags, " ") + "] " + message
+	}
+	log.Output(2, message)
+}
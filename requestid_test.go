@@ -0,0 +1,61 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestErrorResponse(t *testing.T) {
+	handler := newSortTestServer().SetupRoutes()
+
+	rec := serveRoute(t, handler, http.MethodGet, "/api/instances?sort=bogus")
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("status %d, want 400", rec.Code)
+	}
+	if got := rec.Header().Get("Content-Type"); got != "application/json" {
+		t.Errorf("Content-Type = %q, want application/json", got)
+	}
+
+	var body ErrorResponse
+	if err := json.NewDecoder(rec.Body).Decode(&body); err != nil {
+		t.Fatalf("failed to decode error: %v", err)
+	}
+	if body.Error.Code != "invalid_sort" || body.Error.Message == "" {
+		t.Errorf("error = %+v, want code invalid_sort and a message", body.Error)
+	}
+	if id := rec.Header().Get(RequestIDHeader); id == "" || body.Error.RequestID != id {
+		t.Errorf("request_id = %q, want the X-Request-ID header %q", body.Error.RequestID, id)
+	}
+}
+
+func TestRequestIDFromTrustedProxy(t *testing.T) {
+	s := newSortTestServer()
+	s.clientIPs.trusted = newIPSet([]string{"10.0.0.0/8"})
+	handler := s.SetupRoutes()
+
+	tests := []struct {
+		remote string
+		reuse  bool
+	}{
+		{"10.0.0.1:1234", true},
+		{"203.0.113.9:1234", false},
+	}
+
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, "/health", nil)
+		req.RemoteAddr = tt.remote
+		req.Header.Set(RequestIDHeader, "proxy-id")
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+
+		id := rec.Header().Get(RequestIDHeader)
+		if tt.reuse && id != "proxy-id" {
+			t.Errorf("%s: X-Request-ID = %q, want the proxy's proxy-id", tt.remote, id)
+		}
+		if !tt.reuse && (id == "proxy-id" || id == "") {
+			t.Errorf("%s: X-Request-ID = %q, want a generated ID", tt.remote, id)
+		}
+	}
+}
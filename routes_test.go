@@ -0,0 +1,135 @@
+package main
+
+import (
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+var routeMethods = []string{
+	http.MethodGet,
+	http.MethodHead,
+	http.MethodPost,
+	http.MethodPut,
+	http.MethodPatch,
+	http.MethodDelete,
+}
+
+func TestRouteMethods(t *testing.T) {
+	tests := []struct {
+		path    string
+		allowed []string
+	}{
+		{"/", []string{http.MethodGet, http.MethodHead}},
+		{"/api/openapi.json", []string{http.MethodGet, http.MethodHead}},
+		{"/api/docs", []string{http.MethodGet, http.MethodHead}},
+		{"/api/instances", []string{http.MethodGet, http.MethodHead}},
+		{"/api/instances/search", []string{http.MethodGet, http.MethodHead}},
+		{"/api/search", []string{http.MethodGet, http.MethodHead}},
+		{"/api/instances/https%3A%2F%2Fa.example/days", []string{http.MethodGet, http.MethodHead}},
+		{"/api/instances/https%3A%2F%2Fa.example/histogram", []string{http.MethodGet, http.MethodHead}},
+		{"/api/instances/https%3A%2F%2Fa.example/response-time-history", []string{http.MethodGet, http.MethodHead}},
+		{"/api/instances/https%3A%2F%2Fa.example/reset", []string{http.MethodPost}},
+		{"/api/instances/https%3A%2F%2Fa.example/content/ack", []string{http.MethodPost}},
+		{"/api/groups", []string{http.MethodGet, http.MethodHead}},
+		{"/api/groups/beta", []string{http.MethodGet, http.MethodHead}},
+		{"/api/changes?since=0", []string{http.MethodGet, http.MethodHead}},
+		{"/api/archive", []string{http.MethodGet, http.MethodHead}},
+		{"/api/stats", []string{http.MethodGet, http.MethodHead}},
+		{"/api/stats/histogram", []string{http.MethodGet, http.MethodHead}},
+		{"/api/badge/https%3A%2F%2Fa.example", []string{http.MethodGet, http.MethodHead}},
+		{"/api/badges?group=beta", []string{http.MethodGet, http.MethodHead}},
+		{"/api/favicon.svg", []string{http.MethodGet, http.MethodHead}},
+		{"/api/og-image.svg", []string{http.MethodGet, http.MethodHead}},
+		{"/api/stream", []string{http.MethodGet, http.MethodHead}},
+		{"/api/meta", []string{http.MethodGet, http.MethodHead}},
+		{"/api/v2/summary.json", []string{http.MethodGet, http.MethodHead}},
+		{"/metrics", []string{http.MethodGet, http.MethodHead}},
+		{"/api/config", []string{http.MethodPatch}},
+		{"/api/refresh", []string{http.MethodPost}},
+		{"/api/schedule", []string{http.MethodGet, http.MethodHead}},
+		{"/api/clients", []string{http.MethodGet, http.MethodHead}},
+		{"/api/webhook/github", []string{http.MethodPost}},
+		{"/health", []string{http.MethodGet, http.MethodHead}},
+		{"/ready", []string{http.MethodGet, http.MethodHead}},
+	}
+
+	handler := newSortTestServer().SetupRoutes()
+
+	for _, tt := range tests {
+		for _, method := range routeMethods {
+			rec := serveRoute(t, handler, method, tt.path)
+			name := method + " " + tt.path
+
+			if slices.Contains(tt.allowed, method) {
+				if rec.Code == http.StatusMethodNotAllowed {
+					t.Errorf("%s: status 405, want the method to be allowed", name)
+				}
+				continue
+			}
+
+			if rec.Code != http.StatusMethodNotAllowed {
+				t.Errorf("%s: status %d, want 405", name, rec.Code)
+			}
+			allow := strings.Split(rec.Header().Get("Allow"), ", ")
+			slices.Sort(allow)
+			want := slices.Clone(tt.allowed)
+			slices.Sort(want)
+			if !slices.Equal(allow, want) {
+				t.Errorf("%s: Allow = %v, want %v", name, allow, want)
+			}
+		}
+	}
+}
+
+func TestHeadMatchesGet(t *testing.T) {
+	paths := []string{
+		"/api/openapi.json",
+		"/api/instances",
+		"/api/instances/https%3A%2F%2Fa.example/histogram",
+		"/api/stats/histogram",
+		"/api/badge/https%3A%2F%2Fa.example",
+		"/api/badge/https%3A%2F%2Fmissing.example",
+		"/health",
+		"/ready",
+		"/metrics",
+	}
+
+	handler := newSortTestServer().SetupRoutes()
+
+	for _, path := range paths {
+		get := serveRoute(t, handler, http.MethodGet, path)
+		head := serveRoute(t, handler, http.MethodHead, path)
+
+		if head.Code != get.Code {
+			t.Errorf("HEAD %s: status %d, GET gave %d", path, head.Code, get.Code)
+		}
+		if head.Body.Len() != 0 {
+			t.Errorf("HEAD %s: got a %d byte body, want none", path, head.Body.Len())
+		}
+		if got, want := head.Header().Get("Content-Length"), get.Body.Len(); got != strconv.Itoa(want) {
+			t.Errorf("HEAD %s: Content-Length = %q, want %d", path, got, want)
+		}
+		for _, name := range []string{"Content-Type", "ETag", "Cache-Control"} {
+			if got, want := head.Header().Get(name), get.Header().Get(name); got != want {
+				t.Errorf("HEAD %s: %s = %q, GET gave %q", path, name, got, want)
+			}
+		}
+	}
+}
+
+func TestHeadStream(t *testing.T) {
+	rec := serveRoute(t, newSortTestServer().SetupRoutes(), http.MethodHead, "/api/stream")
+
+	if rec.Code != http.StatusOK {
+		t.Errorf("status %d, want 200", rec.Code)
+	}
+	if got := rec.Header().Get("Content-Type"); got != "text/event-stream" {
+		t.Errorf("Content-Type = %q, want text/event-stream", got)
+	}
+	if rec.Body.Len() != 0 {
+		t.Errorf("got a %d byte body, want none", rec.Body.Len())
+	}
+}
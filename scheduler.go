@@ -0,0 +1,233 @@
+package main
+
+import (
+	"container/heap"
+	"context"
+	"log"
+	"sync"
+	"time"
+)
+
+type scheduleEntry struct {
+	instance *Instance
+	at       time.Time
+}
+
+// schedule is a min-heap of instances ordered by their next check time.
+type schedule []scheduleEntry
+
+func (s schedule) Len() int           { return len(s) }
+func (s schedule) Less(i, j int) bool { return s[i].at.Before(s[j].at) }
+func (s schedule) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+
+func (s *schedule) Push(x interface{}) { *s = append(*s, x.(scheduleEntry)) }
+
+func (s *schedule) Pop() interface{} {
+	old := *s
+	entry := old[len(old)-1]
+	*s = old[:len(old)-1]
+	return entry
+}
+
+// checkIntervalFor returns the instance's own check interval, or the global
+// one if the instance doesn't override it.
+func (m *Monitor) checkIntervalFor(instance *Instance) time.Duration {
+	instance.mu.RLock()
+	seconds := instance.CheckIntervalSeconds
+	instance.mu.RUnlock()
+
+	if seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	return m.config.CurrentCheckInterval()
+}
+
+// rebuildSchedule recomputes the next check time of every instance from its
+// last check. It must be called whenever the instance list or the check
+// intervals change.
+func (m *Monitor) rebuildSchedule() {
+	m.mu.RLock()
+	instances := m.instances
+	m.mu.RUnlock()
+
+	now := time.Now()
+	entries := make(schedule, 0, len(instances))
+	for _, instance := range instances {
+		instance.mu.RLock()
+		last := now
+		if len(instance.Checks) > 0 {
+			last = instance.Checks[len(instance.Checks)-1].Timestamp
+		}
+		instance.mu.RUnlock()
+
+		entries = append(entries, scheduleEntry{instance: instance, at: last.Add(m.checkIntervalFor(instance))})
+	}
+	heap.Init(&entries)
+
+	m.scheduleMu.Lock()
+	m.schedule = entries
+	m.scheduleMu.Unlock()
+}
+
+// untilNextCheck returns how long to wait until the earliest scheduled check.
+func (m *Monitor) untilNextCheck() time.Duration {
+	m.scheduleMu.Lock()
+	defer m.scheduleMu.Unlock()
+
+	if len(m.schedule) == 0 {
+		return m.config.CurrentCheckInterval()
+	}
+	return time.Until(m.schedule[0].at)
+}
+
+// checkDue checks every instance whose next check time has passed and
+// schedules its following check.
+func (m *Monitor) checkDue(ctx context.Context) {
+	now := time.Now()
+
+	m.scheduleMu.Lock()
+	var due []*Instance
+	for len(m.schedule) > 0 && !m.schedule[0].at.After(now) {
+		entry := heap.Pop(&m.schedule).(scheduleEntry)
+		due = append(due, entry.instance)
+	}
+	m.scheduleMu.Unlock()
+
+	if len(due) == 0 {
+		return
+	}
+
+	var checked []*Instance
+	for _, instance := range due {
+		if m.hasInstance(instance) {
+			checked = append(checked, instance)
+		}
+	}
+
+	m.checkInstances(ctx, checked)
+
+	next := make(map[*Instance]time.Time, len(checked))
+	for _, instance := range checked {
+		if m.hasInstance(instance) {
+			next[instance] = time.Now().Add(m.checkIntervalFor(instance))
+		}
+	}
+
+	// A rebuild during the checks has already put these instances back on
+	// the schedule, so replace their entries instead of adding more.
+	m.scheduleMu.Lock()
+	entries := m.schedule[:0]
+	for _, entry := range m.schedule {
+		if _, ok := next[entry.instance]; !ok {
+			entries = append(entries, entry)
+		}
+	}
+	for instance, at := range next {
+		entries = append(entries, scheduleEntry{instance: instance, at: at})
+	}
+	heap.Init(&entries)
+	m.schedule = entries
+	m.scheduleMu.Unlock()
+}
+
+// checkInstances checks the given instances concurrently and broadcasts the
+// results.
+func (m *Monitor) checkInstances(ctx context.Context, instances []*Instance) {
+	if len(instances) == 0 {
+		return
+	}
+
+	log.Printf("Starting check cycle for %d instances", len(instances))
+	start := time.Now()
+
+	// The self check reports on the rest of the cycle, so it runs last.
+	var self *Instance
+	var others []*Instance
+	var wg sync.WaitGroup
+	for _, instance := range instances {
+		if instance == m.self {
+			self = instance
+			continue
+		}
+		others = append(others, instance)
+		wg.Add(1)
+		go func(inst *Instance) {
+			defer wg.Done()
+			m.checkInstance(ctx, inst)
+		}(instance)
+	}
+	wg.Wait()
+
+	duration := time.Since(start)
+	log.Printf("Check cycle completed in %v", duration)
+
+	var report cycleReport
+	if m.self != nil && len(others) > 0 {
+		report = newCycleReport(others, start, duration)
+	}
+
+	m.scheduleMu.Lock()
+	m.lastCheckAt = time.Now()
+	if report.checked > 0 {
+		m.lastCycle = report
+	}
+	m.scheduleMu.Unlock()
+
+	if self != nil {
+		m.checkInstance(ctx, self)
+	}
+	m.cycleCompleted()
+
+	m.broadcastUpdate()
+}
+
+// ScheduledInstance is the scheduler's view of an instance.
+type ScheduledInstance struct {
+	URL             string     `json:"url"`
+	InstanceType    string     `json:"instance_type"`
+	IntervalSeconds int        `json:"interval_seconds"`
+	LastCheckAt     *time.Time `json:"last_check_at"`
+	NextCheckAt     *time.Time `json:"next_check_at"`
+	Checking        bool       `json:"checking"`
+	Attempt         int        `json:"attempt,omitempty"`
+}
+
+// ScheduleState returns the scheduling state of every instance, in index
+// order. Instances being checked have no next check until they finish.
+func (m *Monitor) ScheduleState() []ScheduledInstance {
+	m.scheduleMu.Lock()
+	next := make(map[*Instance]time.Time, len(m.schedule))
+	for _, entry := range m.schedule {
+		next[entry.instance] = entry.at
+	}
+	m.scheduleMu.Unlock()
+
+	m.mu.RLock()
+	instances := m.instances
+	m.mu.RUnlock()
+
+	state := make([]ScheduledInstance, 0, len(instances))
+	for _, instance := range instances {
+		instance.mu.RLock()
+		scheduled := ScheduledInstance{
+			URL:          instance.URL,
+			InstanceType: instance.InstanceType,
+		}
+		if len(instance.Checks) > 0 {
+			last := instance.Checks[len(instance.Checks)-1].Timestamp
+			scheduled.LastCheckAt = &last
+		}
+		instance.mu.RUnlock()
+
+		scheduled.IntervalSeconds = int(m.checkIntervalFor(instance) / time.Second)
+		if at, ok := next[instance]; ok {
+			scheduled.NextCheckAt = &at
+		}
+		if attempt := instance.attempt.Load(); attempt > 0 {
+			scheduled.Checking = true
+			scheduled.Attempt = int(attempt)
+		}
+		state = append(state, scheduled)
+	}
+	return state
+}
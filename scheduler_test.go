@@ -0,0 +1,96 @@
+package main
+
+import (
+	"container/heap"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestScheduleState(t *testing.T) {
+	m := newSortTestServer().monitor
+	m.instances[1].CheckIntervalSeconds = 30
+	m.rebuildSchedule()
+
+	// Take c.example off the schedule as checkDue does while it is checked.
+	m.scheduleMu.Lock()
+	for i, entry := range m.schedule {
+		if entry.instance == m.instances[0] {
+			heap.Remove(&m.schedule, i)
+			break
+		}
+	}
+	m.scheduleMu.Unlock()
+	m.instances[0].attempt.Store(2)
+
+	state := m.ScheduleState()
+	if len(state) != 4 {
+		t.Fatalf("%d instances, want 4", len(state))
+	}
+
+	checking := state[0]
+	if !checking.Checking || checking.Attempt != 2 || checking.NextCheckAt != nil || checking.LastCheckAt == nil {
+		t.Errorf("instance being checked: %+v", checking)
+	}
+
+	custom := state[1]
+	if custom.Checking || custom.IntervalSeconds != 30 || custom.LastCheckAt == nil || custom.NextCheckAt == nil {
+		t.Fatalf("instance with its own interval: %+v", custom)
+	}
+	if got := custom.NextCheckAt.Sub(*custom.LastCheckAt); got != 30*time.Second {
+		t.Errorf("next check %v after the last, want 30s", got)
+	}
+
+	unchecked := state[3]
+	if unchecked.LastCheckAt != nil || unchecked.NextCheckAt == nil || unchecked.IntervalSeconds != int(m.config.CheckInterval/time.Second) {
+		t.Errorf("unchecked instance: %+v", unchecked)
+	}
+}
+
+func TestCheckDueConcurrentRebuild(t *testing.T) {
+	started := make(chan struct{}, 1)
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case started <- struct{}{}:
+		default:
+		}
+		<-release
+	}))
+	defer server.Close()
+
+	m := NewTestMonitor([]*Instance{
+		{URL: server.URL, InstanceType: "api"},
+		{URL: server.URL + "/other", InstanceType: "api"},
+	}, nil)
+	m.scheduleMu.Lock()
+	m.schedule = schedule{{instance: m.instances[0], at: time.Now().Add(-time.Second)}}
+	m.scheduleMu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		m.checkDue(context.Background())
+		close(done)
+	}()
+	<-started
+	m.rebuildSchedule()
+	close(release)
+	<-done
+
+	m.scheduleMu.Lock()
+	defer m.scheduleMu.Unlock()
+	counts := make(map[*Instance]int)
+	for _, entry := range m.schedule {
+		counts[entry.instance]++
+	}
+	if len(m.schedule) != 2 || counts[m.instances[0]] != 1 || counts[m.instances[1]] != 1 {
+		t.Fatalf("schedule has %d entries for 2 instances: %v", len(m.schedule), counts)
+	}
+	for _, entry := range m.schedule {
+		if entry.instance == m.instances[0] && time.Until(entry.at) < m.config.CheckInterval-time.Minute {
+			t.Errorf("checked instance is due again in %v", time.Until(entry.at))
+		}
+	}
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"slices"
+	"strings"
+)
+
+// maxSearchLimit caps the limit parameter of /api/search.
+const maxSearchLimit = 500
+
+// Match scores for SearchSummaries, best first.
+const (
+	matchHost        = 100
+	matchHostPrefix  = 80
+	matchURL         = 60
+	matchGroup       = 50
+	matchGroupSubstr = 40
+	matchMetadata    = 20
+)
+
+// SearchResult is a compact view of an instance, without its checks.
+type SearchResult struct {
+	URL             string  `json:"url"`
+	Group           string  `json:"group"`
+	InstanceType    string  `json:"instance_type"`
+	Status          string  `json:"status"`
+	Uptime          float64 `json:"uptime"`
+	AvgResponseTime int64   `json:"avg_response_time"`
+	Score           int     `json:"score"`
+}
+
+// searchMatch is an instance matched by a search and its score.
+type searchMatch struct {
+	instance *Instance
+	score    int
+}
+
+// search matches query case-insensitively against the URL, group and
+// metadata values of the instances of instanceType in group, either of them
+// empty for any, and returns up to limit matches, best first. An empty query
+// matches everything in display order. The caller holds m.mu.
+func (m *Monitor) search(query, instanceType, group string, limit int) []searchMatch {
+	query = strings.ToLower(strings.TrimSpace(query))
+
+	matches := make([]searchMatch, 0)
+	for _, instance := range m.instances {
+		instance.mu.RLock()
+		selected := (instanceType == "" || instance.InstanceType == instanceType) &&
+			(group == "" || instance.Group == group)
+		score := 0
+		if selected {
+			score = matchScore(instance, query)
+		}
+		instance.mu.RUnlock()
+
+		if selected && (score > 0 || query == "") {
+			matches = append(matches, searchMatch{instance, score})
+		}
+	}
+
+	// The stable sort keeps display order among equal scores.
+	slices.SortStableFunc(matches, func(a, b searchMatch) int {
+		return b.score - a.score
+	})
+	if len(matches) > limit {
+		matches = matches[:limit]
+	}
+	return matches
+}
+
+// SearchSummaries returns up to limit summaries of the instances matching
+// query, best match first.
+func (m *Monitor) SearchSummaries(query string, limit int) []SearchResult {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	// Stats are computed only for the results that are returned.
+	matches := m.search(query, "", "", limit)
+	results := make([]SearchResult, len(matches))
+	for i, match := range matches {
+		instance := match.instance
+		instance.mu.RLock()
+		results[i] = SearchResult{
+			URL:             instance.URL,
+			Group:           instance.Group,
+			InstanceType:    instance.InstanceType,
+			Status:          instanceStatus(instance.Checks),
+			Uptime:          instance.uptimeOver(uptimeAll),
+			AvgResponseTime: calculateAvgResponseTime(instance.Checks),
+			Score:           match.score,
+		}
+		instance.mu.RUnlock()
+	}
+
+	return results
+}
+
+// SearchInstances returns the full data of up to limit instances matching
+// query like SearchSummaries, optionally restricted to an instance type and
+// group.
+func (m *Monitor) SearchInstances(query, instanceType, group string, limit int) []InstanceData {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	matches := m.search(query, instanceType, group, limit)
+	data := make([]InstanceData, len(matches))
+	for i, match := range matches {
+		data[i] = match.instance.data()
+	}
+	return data
+}
+
+// matchScore rates how well an instance matches a lowercase query, or
+// returns 0 if it does not match. The caller holds instance.mu.
+func matchScore(instance *Instance, query string) int {
+	if query == "" {
+		return 0
+	}
+
+	url := strings.ToLower(instance.URL)
+	host := url
+	if i := strings.Index(host, "://"); i >= 0 {
+		host = host[i+3:]
+	}
+	host = strings.TrimSuffix(host, "/")
+
+	group := strings.ToLower(instance.Group)
+
+	switch {
+	case host == query:
+		return matchHost
+	case strings.HasPrefix(host, query):
+		return matchHostPrefix
+	case strings.Contains(url, query):
+		return matchURL
+	case group == query:
+		return matchGroup
+	case strings.Contains(group, query):
+		return matchGroupSubstr
+	case metadataContains(instance.Metadata, query):
+		return matchMetadata
+	}
+	return 0
+}
+
+// metadataContains reports whether any string value in metadata, including
+// nested objects and arrays, contains query.
+func metadataContains(value interface{}, query string) bool {
+	switch v := value.(type) {
+	case string:
+		return strings.Contains(strings.ToLower(v), query)
+	case map[string]interface{}:
+		for _, item := range v {
+			if metadataContains(item, query) {
+				return true
+			}
+		}
+	case []interface{}:
+		for _, item := range v {
+			if metadataContains(item, query) {
+				return true
+			}
+		}
+	}
+	return false
+}
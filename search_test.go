@@ -0,0 +1,136 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+)
+
+func TestSearchSummaries(t *testing.T) {
+	s := newSortTestServer()
+	s.monitor.instances = append(s.monitor.instances,
+		&Instance{Group: "gamma", URL: "https://mirror.example.net", InstanceType: "api",
+			Metadata: map[string]interface{}{"region": "EU-West", "tags": []interface{}{"beta-tester"}}},
+		&Instance{Group: "delta", URL: "https://a.example.org", InstanceType: "api"},
+	)
+
+	tests := []struct {
+		query string
+		limit int
+		want  []string
+	}{
+		// Exact host, then host prefix, then the rest of the URL.
+		{"a.example", 10, []string{"https://a.example", "https://a.example.org"}},
+		{"EXAMPLE.NET", 10, []string{"https://mirror.example.net"}},
+		// Group matches rank below URL matches; metadata comes last.
+		{"beta", 10, []string{"https://c.example", "https://a.example", "https://mirror.example.net"}},
+		{"eu-west", 10, []string{"https://mirror.example.net"}},
+		{"nothing", 10, []string{}},
+		{"", 2, []string{"https://c.example", "https://a.example"}},
+	}
+
+	for _, tt := range tests {
+		results := s.monitor.SearchSummaries(tt.query, tt.limit)
+		urls := make([]string, len(results))
+		for i, r := range results {
+			urls[i] = r.URL
+		}
+		if fmt.Sprint(urls) != fmt.Sprint(tt.want) {
+			t.Errorf("SearchSummaries(%q) = %v, want %v", tt.query, urls, tt.want)
+		}
+	}
+
+	results := s.monitor.SearchSummaries("a.example", 1)
+	if r := results[0]; r.Status != StatusUp || r.Uptime != 100 || r.AvgResponseTime != 100 || r.Score != matchHost {
+		t.Errorf("result = %+v, want stats of https://a.example", r)
+	}
+}
+
+func TestSearchHandler(t *testing.T) {
+	handler := newSortTestServer().SetupRoutes()
+
+	rec := serveRoute(t, handler, http.MethodGet, "/api/search?q=alpha&limit=1")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status %d, want 200", rec.Code)
+	}
+	var raw []map[string]interface{}
+	if err := json.NewDecoder(rec.Body).Decode(&raw); err != nil {
+		t.Fatalf("failed to decode: %v", err)
+	}
+	if len(raw) != 1 || raw[0]["url"] != "https://b.example" {
+		t.Errorf("results = %v, want only https://b.example", raw)
+	}
+	if _, ok := raw[0]["checks"]; ok {
+		t.Error("result includes checks, want a summary")
+	}
+
+	for _, limit := range []string{"0", "x", "501"} {
+		if rec := serveRoute(t, handler, http.MethodGet, "/api/search?q=a&limit="+limit); rec.Code != http.StatusBadRequest {
+			t.Errorf("limit=%s: status %d, want 400", limit, rec.Code)
+		}
+	}
+}
+
+func TestSearchInstances(t *testing.T) {
+	s := newSortTestServer()
+	s.monitor.instances = append(s.monitor.instances,
+		&Instance{Group: "beta", URL: "https://mirror.example.net", InstanceType: "ui",
+			Metadata: map[string]interface{}{"region": "EU-West"}},
+	)
+
+	tests := []struct {
+		query, instanceType, group string
+		want                       []string
+	}{
+		// Ranked like SearchSummaries, metadata included.
+		{"beta", "", "", []string{"https://c.example", "https://a.example", "https://mirror.example.net"}},
+		{"eu-west", "", "", []string{"https://mirror.example.net"}},
+		{"beta", "api", "", []string{"https://c.example", "https://a.example"}},
+		{"example", "", "alpha", []string{"https://b.example", "https://d.example"}},
+		{"", "ui", "beta", []string{"https://mirror.example.net"}},
+	}
+	for _, tt := range tests {
+		data := s.monitor.SearchInstances(tt.query, tt.instanceType, tt.group, 10)
+		urls := make([]string, len(data))
+		for i, d := range data {
+			urls[i] = d.URL
+		}
+		if fmt.Sprint(urls) != fmt.Sprint(tt.want) {
+			t.Errorf("SearchInstances(%q, %q, %q) = %v, want %v", tt.query, tt.instanceType, tt.group, urls, tt.want)
+		}
+	}
+}
+
+func TestSearchRoutesRateLimited(t *testing.T) {
+	for _, path := range []string{"/api/search?q=a", "/api/instances/search?q=a"} {
+		s := newSortTestServer()
+		s.limiter = newRateLimiter(0.001, 1)
+		handler := s.SetupRoutes()
+
+		if rec := serveRoute(t, handler, http.MethodGet, path); rec.Code != http.StatusOK {
+			t.Errorf("%s: status %d, want 200", path, rec.Code)
+		}
+		if rec := serveRoute(t, handler, http.MethodGet, path); rec.Code != http.StatusTooManyRequests {
+			t.Errorf("%s over the limit: status %d, want 429", path, rec.Code)
+		}
+	}
+}
+
+func BenchmarkSearchSummaries(b *testing.B) {
+	monitor := NewMonitor(DefaultConfig())
+	for i := 0; i < 5000; i++ {
+		monitor.instances = append(monitor.instances, &Instance{
+			Group:        fmt.Sprintf("group-%d", i%50),
+			URL:          fmt.Sprintf("https://instance-%d.example.com", i),
+			InstanceType: "api",
+			Checks:       checksWith(150, 18, 120),
+			Metadata:     map[string]interface{}{"region": fmt.Sprintf("region-%d", i%7)},
+		})
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		monitor.SearchSummaries("instance-42", 20)
+	}
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+)
+
+// defaultContentSecurityPolicy fits the embedded frontend: scripts, images
+// and API calls stay on this origin and only inline styles are allowed.
+// frame-ancestors is added from Config.FrameAncestors.
+const defaultContentSecurityPolicy = "default-src 'self'; script-src 'self'; style-src 'self' 'unsafe-inline'; " +
+	"img-src 'self'; connect-src 'self'; object-src 'none'; base-uri 'self'; form-action 'self'"
+
+// securityHeaders holds the header values computed once from the config.
+type securityHeaders struct {
+	contentSecurityPolicy string
+	frameOptions          string
+	referrerPolicy        string
+}
+
+func newSecurityHeaders(config *Config) securityHeaders {
+	ancestors := strings.Join(config.FrameAncestors, " ")
+	if ancestors == "" {
+		ancestors = "'none'"
+	}
+
+	h := securityHeaders{referrerPolicy: config.ReferrerPolicy}
+
+	if policy := strings.TrimSpace(config.ContentSecurityPolicy); policy != "" {
+		policy = strings.TrimSuffix(policy, ";")
+		if !strings.Contains(policy, "frame-ancestors") {
+			policy += "; frame-ancestors " + ancestors
+		}
+		h.contentSecurityPolicy = policy
+	}
+
+	// X-Frame-Options cannot express an allowlist of origins, so it is only
+	// sent for the two cases it covers; browsers that understand
+	// frame-ancestors ignore it anyway.
+	switch ancestors {
+	case "'none'":
+		h.frameOptions = "DENY"
+	case "'self'":
+		h.frameOptions = "SAMEORIGIN"
+	}
+
+	return h
+}
+
+// withSecurityHeaders sets the security headers before the handler runs. The
+// response writer is passed through unwrapped so streaming keeps working.
+func (s *Server) withSecurityHeaders(next http.Handler) http.Handler {
+	h := newSecurityHeaders(s.config)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header := w.Header()
+		header.Set("X-Content-Type-Options", "nosniff")
+		if h.referrerPolicy != "" {
+			header.Set("Referrer-Policy", h.referrerPolicy)
+		}
+
+		// The event stream is not a document; it only gets the headers
+		// above so that nothing interferes with EventSource.
+		if r.URL.Path != "/api/stream" {
+			if h.contentSecurityPolicy != "" {
+				header.Set("Content-Security-Policy", h.contentSecurityPolicy)
+			}
+			if h.frameOptions != "" {
+				header.Set("X-Frame-Options", h.frameOptions)
+			}
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// serveRoute sends a request through the full route table. Streams are sent
+// with a cancelled context so the handler returns after the first event.
+func serveRoute(t *testing.T, handler http.Handler, method, path string) *httptest.ResponseRecorder {
+	t.Helper()
+
+	req := httptest.NewRequest(method, path, nil)
+	if path == "/api/stream" {
+		ctx, cancel := context.WithCancel(req.Context())
+		cancel()
+		req = req.WithContext(ctx)
+	}
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	return rec
+}
+
+var securityHeaderRoutes = []struct {
+	method string
+	path   string
+}{
+	{http.MethodGet, "/"},
+	{http.MethodGet, "/app.js"},
+	{http.MethodGet, "/api/openapi.json"},
+	{http.MethodGet, "/api/docs"},
+	{http.MethodGet, "/api/instances"},
+	{http.MethodGet, "/api/instances/search?q=example"},
+	{http.MethodGet, "/api/instances/https%3A%2F%2Fa.example/days"},
+	{http.MethodGet, "/api/stats"},
+	{http.MethodGet, "/api/stats/histogram"},
+	{http.MethodGet, "/api/badge/https%3A%2F%2Fa.example"},
+	{http.MethodGet, "/api/meta"},
+	{http.MethodGet, "/api/v2/summary.json"},
+	{http.MethodGet, "/metrics"},
+	{http.MethodGet, "/api/config"},
+	{http.MethodPost, "/api/refresh"},
+	{http.MethodGet, "/health"},
+	{http.MethodGet, "/ready"},
+}
+
+func TestSecurityHeadersDefaults(t *testing.T) {
+	handler := newSortTestServer().SetupRoutes()
+
+	for _, route := range securityHeaderRoutes {
+		rec := serveRoute(t, handler, route.method, route.path)
+		name := route.method + " " + route.path
+
+		if got := rec.Header().Get("X-Content-Type-Options"); got != "nosniff" {
+			t.Errorf("%s: X-Content-Type-Options = %q, want nosniff", name, got)
+		}
+		if got := rec.Header().Get("Referrer-Policy"); got != "strict-origin-when-cross-origin" {
+			t.Errorf("%s: Referrer-Policy = %q", name, got)
+		}
+		if got := rec.Header().Get("X-Frame-Options"); got != "SAMEORIGIN" {
+			t.Errorf("%s: X-Frame-Options = %q, want SAMEORIGIN", name, got)
+		}
+		csp := rec.Header().Get("Content-Security-Policy")
+		if !strings.HasPrefix(csp, defaultContentSecurityPolicy) || !strings.HasSuffix(csp, "; frame-ancestors 'self'") {
+			t.Errorf("%s: Content-Security-Policy = %q", name, csp)
+		}
+	}
+}
+
+func TestSecurityHeadersStream(t *testing.T) {
+	handler := newSortTestServer().SetupRoutes()
+	rec := serveRoute(t, handler, http.MethodGet, "/api/stream")
+
+	if got := rec.Header().Get("Content-Type"); got != "text/event-stream" {
+		t.Errorf("Content-Type = %q, want text/event-stream", got)
+	}
+	if !rec.Flushed {
+		t.Error("stream was not flushed")
+	}
+	if !strings.HasPrefix(rec.Body.String(), "event: "+EventInstanceUpdate+"\n") {
+		t.Errorf("body = %q, want an %s event", rec.Body.String(), EventInstanceUpdate)
+	}
+	if got := rec.Header().Get("X-Content-Type-Options"); got != "nosniff" {
+		t.Errorf("X-Content-Type-Options = %q, want nosniff", got)
+	}
+	for _, name := range []string{"Content-Security-Policy", "X-Frame-Options"} {
+		if got := rec.Header().Get(name); got != "" {
+			t.Errorf("%s = %q, want none on the stream", name, got)
+		}
+	}
+}
+
+func TestSecurityHeadersConfigured(t *testing.T) {
+	tests := []struct {
+		name         string
+		ancestors    []string
+		policy       string
+		referrer     string
+		wantCSP      string
+		wantFrame    string
+		wantReferrer string
+	}{
+		{
+			name:         "allowed origins",
+			ancestors:    []string{"'self'", "https://example.com"},
+			policy:       "default-src 'self'",
+			referrer:     "no-referrer",
+			wantCSP:      "default-src 'self'; frame-ancestors 'self' https://example.com",
+			wantReferrer: "no-referrer",
+		},
+		{
+			name:      "no embedding",
+			ancestors: nil,
+			policy:    "default-src 'self';",
+			wantCSP:   "default-src 'self'; frame-ancestors 'none'",
+			wantFrame: "DENY",
+		},
+		{
+			name:      "policy with its own frame-ancestors",
+			ancestors: []string{"'self'"},
+			policy:    "default-src 'none'; frame-ancestors *",
+			wantCSP:   "default-src 'none'; frame-ancestors *",
+			wantFrame: "SAMEORIGIN",
+		},
+		{
+			name:      "disabled policy",
+			ancestors: []string{"'self'"},
+			wantFrame: "SAMEORIGIN",
+		},
+	}
+
+	for _, tt := range tests {
+		s := newSortTestServer()
+		s.config.FrameAncestors = tt.ancestors
+		s.config.ContentSecurityPolicy = tt.policy
+		s.config.ReferrerPolicy = tt.referrer
+
+		rec := serveRoute(t, s.SetupRoutes(), http.MethodGet, "/")
+		if got := rec.Header().Get("Content-Security-Policy"); got != tt.wantCSP {
+			t.Errorf("%s: Content-Security-Policy = %q, want %q", tt.name, got, tt.wantCSP)
+		}
+		if got := rec.Header().Get("X-Frame-Options"); got != tt.wantFrame {
+			t.Errorf("%s: X-Frame-Options = %q, want %q", tt.name, got, tt.wantFrame)
+		}
+		if got := rec.Header().Get("Referrer-Policy"); got != tt.wantReferrer {
+			t.Errorf("%s: Referrer-Policy = %q, want %q", tt.name, got, tt.wantReferrer)
+		}
+		if got := rec.Header().Get("X-Content-Type-Options"); got != "nosniff" {
+			t.Errorf("%s: X-Content-Type-Options = %q, want nosniff", tt.name, got)
+		}
+	}
+}
+
+func TestGetFrameAncestors(t *testing.T) {
+	t.Setenv("FRAME_ANCESTORS", "self, https://example.com,'none', bad;value ,https://*.example.org")
+
+	got := getFrameAncestors(nil)
+	want := []string{"'self'", "https://example.com", "'none'", "https://*.example.org"}
+	if strings.Join(got, " ") != strings.Join(want, " ") {
+		t.Errorf("getFrameAncestors = %v, want %v", got, want)
+	}
+}
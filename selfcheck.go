@@ -0,0 +1,82 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+// selfGroup is the group of the self check instance.
+const selfGroup = "meta"
+
+// newSelfInstance returns the instance standing for the monitor itself, or
+// nil if SELF_CHECK is off. It is kept across instance list refreshes.
+func newSelfInstance(config *Config) *Instance {
+	if !config.SelfCheck {
+		return nil
+	}
+	return &Instance{
+		Group:        selfGroup,
+		URL:          config.SelfURL(),
+		InstanceType: InstanceTypeSelf,
+		Checks:       make([]Check, 0, config.CurrentMaxCheckHistory()),
+		modified:     time.Now(),
+	}
+}
+
+// cycleReport sums up a check cycle for the self check.
+type cycleReport struct {
+	duration time.Duration
+	checked  int
+	failed   int
+}
+
+// newCycleReport counts the instances checked since the cycle started, and
+// how many of those checks failed. Checks cut short by shutdown are not
+// recorded and not counted.
+func newCycleReport(instances []*Instance, start time.Time, duration time.Duration) cycleReport {
+	report := cycleReport{duration: duration}
+	for _, instance := range instances {
+		instance.mu.RLock()
+		if n := len(instance.Checks); n > 0 && !instance.Checks[n-1].Timestamp.Before(start) {
+			report.checked++
+			if !instance.Checks[n-1].Success {
+				report.failed++
+			}
+		}
+		instance.mu.RUnlock()
+	}
+	return report
+}
+
+// selfCheck reports on the last check cycle: its duration is the response
+// time, and it fails if every check in it failed, which points at the
+// monitor's own network, or if it took longer than the budget. The process
+// uptime is kept in the instance's metadata.
+func (m *Monitor) selfCheck(instance *Instance) Check {
+	m.scheduleMu.Lock()
+	report := m.lastCycle
+	m.scheduleMu.Unlock()
+
+	check := Check{
+		Timestamp:    time.Now(),
+		ResponseTime: report.duration.Milliseconds(),
+		Success:      true,
+	}
+	if budget := m.config.CurrentSelfCheckBudget(); report.duration > budget {
+		check.Success = false
+		check.ErrorType = ErrorTypeTimeout
+		check.Error = fmt.Sprintf("check cycle took %v, over the %v budget", report.duration.Round(time.Millisecond), budget)
+	} else if report.checked > 0 && report.failed == report.checked {
+		check.Success = false
+		check.ErrorType = ErrorTypeOther
+		check.Error = fmt.Sprintf("all %d checks of the last cycle failed", report.checked)
+	}
+
+	instance.mu.Lock()
+	instance.Metadata = map[string]interface{}{
+		"process_uptime_seconds": int64(time.Since(m.startedAt).Seconds()),
+	}
+	instance.mu.Unlock()
+
+	return check
+}
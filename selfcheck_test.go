@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestSelfCheck(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/fail" {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer server.Close()
+
+	path := filepath.Join(t.TempDir(), "instances.json")
+	list := `{"ui": {"first": ["` + server.URL + `/ok"], "second": ["` + server.URL + `/fail"]}}`
+	if err := os.WriteFile(path, []byte(list), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	config := DefaultConfig()
+	config.SelfCheck = true
+	config.StatusPageURL = "https://status.example"
+	m := NewTestMonitor(nil, config)
+	m.source = &FileSource{Path: path}
+
+	if _, err := m.updateInstances(context.Background()); err != nil {
+		t.Fatalf("updateInstances: %v", err)
+	}
+	// A refresh keeps the self instance last, without counting it as added
+	// or removed.
+	result, err := m.updateInstances(context.Background())
+	if err != nil || result.Added != 0 || result.Removed != 0 || result.Total != 3 {
+		t.Fatalf("second refresh = %+v, %v; want nothing added or removed of 3", result, err)
+	}
+	self := m.instances[len(m.instances)-1]
+	if self != m.self || self.URL != "https://status.example" || self.Group != selfGroup || self.GroupOrder != 2 || self.InstanceType != InstanceTypeSelf {
+		t.Fatalf("last instance = %+v, want the self instance after both groups", self)
+	}
+
+	ok, fail := m.instances[0], m.instances[1]
+
+	m.checkAll(context.Background())
+	if len(self.Checks) != 1 || !self.Checks[0].Success || self.Checks[0].InstanceType != InstanceTypeSelf {
+		t.Fatalf("self checks = %+v, want one success", self.Checks)
+	}
+	if _, found := self.Metadata["process_uptime_seconds"]; !found {
+		t.Errorf("metadata = %v, want process_uptime_seconds", self.Metadata)
+	}
+	if stats := m.Stats(); stats.TotalInstances != 3 || stats.Types[InstanceTypeSelf].Up != 1 {
+		t.Errorf("stats = %+v, want 3 instances counting the self instance", stats)
+	}
+
+	// A cycle in which every check fails points at the monitor itself.
+	m.instances = []*Instance{fail, self}
+	m.checkAll(context.Background())
+	if last := self.Checks[len(self.Checks)-1]; last.Success || last.ErrorType != ErrorTypeOther {
+		t.Errorf("self check after a failed cycle = %+v, want a failure", last)
+	}
+
+	config.SelfCheckBudget = time.Nanosecond
+	m.instances = []*Instance{ok, self}
+	m.checkAll(context.Background())
+	if last := self.Checks[len(self.Checks)-1]; last.Success || last.ErrorType != ErrorTypeTimeout {
+		t.Errorf("self check over budget = %+v, want a timeout", last)
+	}
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"net/http"
+	"time"
+)
+
+// newHTTPServer wraps handler in a server with the configured timeouts and
+// limits. It has no WriteTimeout, which would cut off event streams;
+// withTimeouts sets a write deadline per request instead.
+func newHTTPServer(config *Config, handler http.Handler) *http.Server {
+	return &http.Server{
+		Addr:              config.Port,
+		Handler:           handler,
+		ReadHeaderTimeout: config.HTTPReadHeaderTimeout,
+		ReadTimeout:       config.HTTPReadTimeout,
+		IdleTimeout:       config.HTTPIdleTimeout,
+		MaxHeaderBytes:    config.HTTPMaxHeaderBytes,
+	}
+}
+
+// withTimeouts gives each request a write deadline and caps the size of its
+// body. Event streams get no deadline so they can stay open.
+func (s *Server) withTimeouts(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rc := http.NewResponseController(w)
+		if r.URL.Path != "/api/stream" && s.config.HTTPWriteTimeout > 0 {
+			rc.SetWriteDeadline(time.Now().Add(s.config.HTTPWriteTimeout))
+		}
+
+		r.Body = http.MaxBytesReader(w, r.Body, s.config.HTTPMaxBodyBytes)
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+// startTestServer serves the full route table with the given timeouts on a
+// local port.
+func startTestServer(t *testing.T, configure func(*Config)) (*Server, string) {
+	t.Helper()
+
+	s := newSortTestServer()
+	configure(s.config)
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	srv := newHTTPServer(s.config, s.SetupRoutes())
+	go srv.Serve(ln)
+	t.Cleanup(func() { srv.Close() })
+
+	return s, ln.Addr().String()
+}
+
+// get sends a keep-alive GET on conn and reads the response headers.
+func get(t *testing.T, conn net.Conn, r *bufio.Reader, path string) *http.Response {
+	t.Helper()
+
+	if _, err := io.WriteString(conn, "GET "+path+" HTTP/1.1\r\nHost: test\r\n\r\n"); err != nil {
+		t.Fatalf("GET %s: failed to write: %v", path, err)
+	}
+	resp, err := http.ReadResponse(r, nil)
+	if err != nil {
+		t.Fatalf("GET %s: failed to read response: %v", path, err)
+	}
+	return resp
+}
+
+// waitClosed fails unless the server closes conn within limit.
+func waitClosed(t *testing.T, conn net.Conn, limit time.Duration) time.Duration {
+	t.Helper()
+
+	start := time.Now()
+	conn.SetReadDeadline(start.Add(limit))
+	_, err := conn.Read(make([]byte, 1024))
+	if errors.Is(err, os.ErrDeadlineExceeded) {
+		t.Fatalf("connection still open after %v", limit)
+	}
+	if err == nil {
+		t.Fatal("got data, want the connection to be closed")
+	}
+	return time.Since(start)
+}
+
+func TestIdleConnectionClosed(t *testing.T) {
+	_, addr := startTestServer(t, func(c *Config) {
+		c.HTTPIdleTimeout = 200 * time.Millisecond
+	})
+
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatalf("failed to dial: %v", err)
+	}
+	defer conn.Close()
+
+	resp := get(t, conn, bufio.NewReader(conn), "/health")
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+	if resp.Close {
+		t.Fatal("server closed the connection after the request, want keep-alive")
+	}
+
+	if elapsed := waitClosed(t, conn, 2*time.Second); elapsed < 100*time.Millisecond {
+		t.Errorf("connection closed after %v, before the idle timeout", elapsed)
+	}
+}
+
+func TestSlowHeadersClosed(t *testing.T) {
+	_, addr := startTestServer(t, func(c *Config) {
+		c.HTTPReadHeaderTimeout = 200 * time.Millisecond
+	})
+
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatalf("failed to dial: %v", err)
+	}
+	defer conn.Close()
+
+	io.WriteString(conn, "GET /health HTTP/1.1\r\nHost: test\r\n")
+	waitClosed(t, conn, 2*time.Second)
+}
+
+func TestLargeHeadersRejected(t *testing.T) {
+	_, addr := startTestServer(t, func(c *Config) {
+		c.HTTPMaxHeaderBytes = 1 << 10
+	})
+
+	req, _ := http.NewRequest(http.MethodGet, "http://"+addr+"/health", nil)
+	req.Header.Set("X-Padding", strings.Repeat("a", 8<<10))
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusRequestHeaderFieldsTooLarge {
+		t.Errorf("status %d, want 431", resp.StatusCode)
+	}
+}
+
+// Streams are exempt from the write deadline, including on a connection
+// that already served a request with one.
+func TestStreamOutlivesWriteTimeout(t *testing.T) {
+	s, addr := startTestServer(t, func(c *Config) {
+		c.HTTPWriteTimeout = 100 * time.Millisecond
+	})
+
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatalf("failed to dial: %v", err)
+	}
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+
+	resp := get(t, conn, r, "/health")
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+
+	// The body is not closed, as that would drain the stream; closing conn
+	// ends it.
+	resp = get(t, conn, r, "/api/stream")
+	body := bufio.NewReader(resp.Body)
+	readEvent := func() string {
+		conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+		var event string
+		for {
+			line, err := body.ReadString('\n')
+			if err != nil {
+				t.Fatalf("failed to read event: %v", err)
+			}
+			if line == "\n" {
+				return event
+			}
+			if name, ok := strings.CutPrefix(line, "event: "); ok {
+				event = strings.TrimSpace(name)
+			}
+		}
+	}
+
+	if event := readEvent(); event != EventInstanceUpdate {
+		t.Fatalf("first event = %q, want %s", event, EventInstanceUpdate)
+	}
+
+	time.Sleep(300 * time.Millisecond)
+	s.monitor.broadcastUpdate()
+	if event := readEvent(); event != EventInstanceUpdate {
+		t.Errorf("event after the write timeout = %q, want %s", event, EventInstanceUpdate)
+	}
+}
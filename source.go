@@ -0,0 +1,139 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// SourceReader opens the instances JSON document, wherever it is stored.
+type SourceReader interface {
+	Open(ctx context.Context) (io.ReadCloser, error)
+}
+
+// NewSourceReader picks a SourceReader based on the scheme of rawURL:
+// s3:// for S3-compatible object stores, file:// or a bare path for local
+// files, and HTTP(S) otherwise. Headers and Basic Auth credentials are only
+// sent to HTTP(S) sources; credentials in rawURL itself win over auth.
+func NewSourceReader(rawURL string, headers map[string]string, auth *url.Userinfo) (SourceReader, error) {
+	rawURL, urlAuth := stripURLCredentials(rawURL)
+	if urlAuth != nil {
+		auth = urlAuth
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid instances URL: %w", err)
+	}
+
+	switch u.Scheme {
+	case "http", "https":
+		return &HTTPSource{URL: rawURL, Client: http.DefaultClient, Headers: headers, Auth: auth}, nil
+	case "s3":
+		key := strings.TrimPrefix(u.Path, "/")
+		if u.Host == "" || key == "" {
+			return nil, fmt.Errorf("invalid S3 URL %q, expected s3://bucket/key", rawURL)
+		}
+		return &S3Source{Bucket: u.Host, Key: key}, nil
+	case "file":
+		return &FileSource{Path: u.Path}, nil
+	case "":
+		return &FileSource{Path: rawURL}, nil
+	default:
+		return nil, fmt.Errorf("unsupported instances URL scheme: %s", u.Scheme)
+	}
+}
+
+// stripURLCredentials removes the user info from an HTTP(S) URL and returns
+// it separately, or nil if there is none. Other URLs are returned as is.
+func stripURLCredentials(rawURL string) (string, *url.Userinfo) {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.User == nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return rawURL, nil
+	}
+	auth := u.User
+	u.User = nil
+	return u.String(), auth
+}
+
+type HTTPSource struct {
+	URL     string
+	Client  *http.Client
+	Headers map[string]string
+
+	// Auth, if set, is sent as Basic Auth.
+	Auth *url.Userinfo
+}
+
+func (s *HTTPSource) Open(ctx context.Context) (io.ReadCloser, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.URL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build request: %w", err)
+	}
+	for name, value := range s.Headers {
+		req.Header.Set(name, value)
+	}
+	if s.Auth != nil {
+		password, _ := s.Auth.Password()
+		req.SetBasicAuth(s.Auth.Username(), password)
+	}
+
+	resp, err := s.Client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	}
+
+	return resp.Body, nil
+}
+
+type FileSource struct {
+	Path string
+}
+
+func (s *FileSource) Open(ctx context.Context) (io.ReadCloser, error) {
+	return os.Open(s.Path)
+}
+
+// S3Source reads from an S3-compatible object store. Credentials and region
+// come from the standard AWS environment; AWS_ENDPOINT_URL selects a custom
+// endpoint such as MinIO.
+type S3Source struct {
+	Bucket string
+	Key    string
+}
+
+func (s *S3Source) Open(ctx context.Context) (io.ReadCloser, error) {
+	cfg, err := awsconfig.LoadDefaultConfig(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load AWS config: %w", err)
+	}
+
+	client := s3.NewFromConfig(cfg, func(o *s3.Options) {
+		if endpoint := os.Getenv("AWS_ENDPOINT_URL"); endpoint != "" {
+			o.BaseEndpoint = aws.String(endpoint)
+			o.UsePathStyle = true
+		}
+	})
+
+	out, err := client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(s.Bucket),
+		Key:    aws.String(s.Key),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return out.Body, nil
+}
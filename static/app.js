@@ -1,5 +1,7 @@
 let instances = [];
 let stats = {};
+let meta = {};
+let monitorState = 'running';
 let currentHours = 24;
 let eventSource = null;
 let expandedGroups = new Set();
@@ -9,23 +11,41 @@ function connectSSE() {
         eventSource.close();
     }
 
-    eventSource = new EventSource('/api/stream');
+    eventSource = new EventSource('api/stream');
 
     eventSource.onopen = function() {
         updateConnectionStatus(true);
     };
 
-    eventSource.onmessage = function(e) {
+    eventSource.addEventListener('instance_update', function(e) {
         try {
             const data = JSON.parse(e.data);
             instances = data.instances;
             stats = data.stats;
+            monitorState = data.state || 'running';
+            if (data.meta) {
+                meta = data.meta;
+            }
+            document.getElementById('favicon').href = 'api/favicon.svg?v=' + data.timestamp;
             renderUI();
             updateConnectionStatus(true);
         } catch (error) {
             console.error('Error parsing SSE data:', error);
         }
-    };
+    });
+
+    eventSource.addEventListener('instance_check', function(e) {
+        try {
+            const instance = JSON.parse(e.data);
+            const i = instances.findIndex(inst => inst.url === instance.url && inst.instance_type === instance.instance_type);
+            if (i !== -1) {
+                instances[i] = instance;
+                renderUI();
+            }
+        } catch (error) {
+            console.error('Error parsing SSE data:', error);
+        }
+    });
 
     eventSource.onerror = function(e) {
         console.error('SSE error:', e);
@@ -53,7 +73,7 @@ function renderUI() {
     
     document.getElementById('total-count').textContent = stats.total_instances || 0;
     document.getElementById('up-count').textContent = stats.up_instances || 0;
-    document.getElementById('down-count').textContent = (stats.total_instances - stats.up_instances) || 0;
+    document.getElementById('down-count').textContent = stats.down_instances || 0;
     document.getElementById('avg-uptime').textContent = (stats.avg_uptime || 0).toFixed(1) + '%';
 
     const apiInstances = instances.filter(i => i.instance_type === 'api');
@@ -100,7 +120,7 @@ function renderSection(sectionInstances) {
         const isExpanded = expandedGroups.has(groupId);
 
         html += '<div class="group">';
-        html += '<div class="group-header" onclick="toggleGroup(\'' + groupId + '\')">';
+        html += '<div class="group-header" data-group="' + groupId + '">';
         html += '<div class="group-title">';
         html += '<span>' + escapeHtml(groupName) + '</span>';
         html += '<span class="group-count">' + groupInstances.length + ' ' + (groupInstances.length === 1 ? 'service' : 'services') + '</span>';
@@ -129,11 +149,13 @@ function renderSection(sectionInstances) {
 }
 
 function renderInstance(instance) {
+    const starting = monitorState === 'starting';
     const uptime = instance.uptime || 0;
-    const uptimeClass = uptime > 99 ? 'good' : uptime > 95 ? 'medium' : 'bad';
-    const isUp = instance.last_check && instance.last_check.success;
-    const statusClass = isUp ? 'up' : 'down';
-    const statusText = isUp ? 'UP' : 'DOWN';
+    const degraded = meta.degraded_uptime_percent ?? 99;
+    const uptimeClass = starting ? '' : uptime > degraded ? 'good' : uptime > 95 ? 'medium' : 'bad';
+    const uptimeText = starting ? '-' : uptime.toFixed(2) + '%';
+    const statusClass = starting ? 'starting' : instance.status || 'pending';
+    const statusText = statusClass.toUpperCase();
 
     const lastCheckTime = instance.last_check 
         ? formatRelativeTime(new Date(instance.last_check.timestamp))
@@ -150,14 +172,17 @@ function renderInstance(instance) {
     html += '<div class="instance-url">' + escapeHtml(instance.url) + '</div>';
     html += '</div>';
     html += '<div class="instance-meta">';
-    html += '<span>Uptime: <span class="uptime-value ' + uptimeClass + '">' + uptime.toFixed(2) + '%</span></span>';
+    html += '<span>Uptime: <span class="uptime-value ' + uptimeClass + '">' + uptimeText + '</span></span>';
     html += '<span>Avg: <span class="meta-value">' + instance.avg_response_time + 'ms</span></span>';
     html += '<span>Last: <span class="meta-value">' + lastCheckTime + '</span></span>';
+    if (instance.status === 'down' && instance.last_success_unix) {
+        html += '<span>Last up: <span class="meta-value">' + formatRelativeTime(new Date(instance.last_success_unix * 1000)) + '</span></span>';
+    }
     html += '</div>';
     html += '</div>';
     html += '<div class="instance-right">';
     html += '<div class="status-badge ' + statusClass + '">' + statusText + '</div>';
-    html += '<button class="badge-embed" onclick="showBadgeModal(\'' + escapeHtml(instance.url).replace(/'/g, "\\'") + '\')">Badge</button>';
+    html += '<button class="badge-embed" data-url="' + escapeHtml(instance.url).replace(/"/g, '&quot;') + '">Badge</button>';
     html += '</div>';
     html += '</div>';
     html += '<div class="histogram-container">';
@@ -264,7 +289,7 @@ function toggleGroup(groupId) {
 
 function showBadgeModal(url) {
     const modal = document.getElementById('badge-modal');
-    const badgeUrl = window.location.origin + '/api/badge/' + encodeURIComponent(url);
+    const badgeUrl = new URL('api/badge/' + encodeURIComponent(url), document.baseURI).href;
     
     document.getElementById('badge-url').textContent = badgeUrl;
     document.getElementById('badge-markdown').textContent = '![Status](' + badgeUrl + ')';
@@ -278,6 +303,23 @@ function closeBadgeModal() {
     document.getElementById('badge-modal').classList.remove('show');
 }
 
+// Handlers are attached here rather than inline so the page works under a
+// Content-Security-Policy without 'unsafe-inline' scripts.
+document.getElementById('content').addEventListener('click', function(e) {
+    const header = e.target.closest('.group-header');
+    if (header) {
+        toggleGroup(header.dataset.group);
+        return;
+    }
+
+    const badgeButton = e.target.closest('.badge-embed[data-url]');
+    if (badgeButton) {
+        showBadgeModal(badgeButton.dataset.url);
+    }
+});
+
+document.querySelector('#badge-modal .modal-close').addEventListener('click', closeBadgeModal);
+
 document.getElementById('badge-modal').addEventListener('click', function(e) {
     if (e.target === this) {
         closeBadgeModal();
@@ -0,0 +1,47 @@
+function escapeHtml(text) {
+    const div = document.createElement('div');
+    div.textContent = text;
+    return div.innerHTML;
+}
+
+function renderSpec(spec) {
+    let html = '<div class="section-title">Endpoints</div>';
+
+    Object.keys(spec.paths).forEach(path => {
+        const operations = spec.paths[path];
+        Object.keys(operations).forEach(method => {
+            const op = operations[method];
+            html += '<div class="endpoint">';
+            html += '<div class="endpoint-title"><span class="method">' + method.toUpperCase() + '</span>' + escapeHtml(path) + '</div>';
+            html += '<div class="endpoint-summary">' + escapeHtml(op.summary || '') + '</div>';
+            if (op.description) {
+                html += '<div class="endpoint-detail">' + escapeHtml(op.description) + '</div>';
+            }
+            (op.parameters || []).forEach(p => {
+                html += '<div class="endpoint-detail">' + escapeHtml(p.in) + ' <b>' + escapeHtml(p.name) + '</b>' + (p.description ? ' - ' + escapeHtml(p.description) : '') + '</div>';
+            });
+            Object.keys(op.responses || {}).forEach(code => {
+                html += '<div class="endpoint-detail">' + code + ': ' + escapeHtml(op.responses[code].description) + '</div>';
+            });
+            html += '</div>';
+        });
+    });
+
+    html += '<div class="section-title">Schemas</div>';
+    Object.keys(spec.components.schemas).forEach(name => {
+        html += '<div class="endpoint">';
+        html += '<div class="endpoint-title">' + escapeHtml(name) + '</div>';
+        html += '<pre>' + escapeHtml(JSON.stringify(spec.components.schemas[name], null, 2)) + '</pre>';
+        html += '</div>';
+    });
+
+    document.getElementById('content').innerHTML = html;
+}
+
+fetch('openapi.json')
+    .then(r => r.json())
+    .then(renderSpec)
+    .catch(err => {
+        document.getElementById('content').innerHTML = '<div class="loading">Failed to load API description</div>';
+        console.error(err);
+    });
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// The types below mirror the Atlassian Statuspage v2 summary.json schema so
+// that existing widgets and browser extensions can consume our data.
+
+type StatuspageSummary struct {
+	Page                  StatuspagePage        `json:"page"`
+	Components            []StatuspageComponent `json:"components"`
+	Incidents             []interface{}         `json:"incidents"`
+	ScheduledMaintenances []interface{}         `json:"scheduled_maintenances"`
+	Status                StatuspageStatus      `json:"status"`
+}
+
+type StatuspagePage struct {
+	ID        string    `json:"id"`
+	Name      string    `json:"name"`
+	URL       string    `json:"url"`
+	TimeZone  string    `json:"time_zone"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+type StatuspageComponent struct {
+	ID                 string    `json:"id"`
+	Name               string    `json:"name"`
+	Status             string    `json:"status"`
+	CreatedAt          time.Time `json:"created_at"`
+	UpdatedAt          time.Time `json:"updated_at"`
+	Position           int       `json:"position"`
+	Description        string    `json:"description"`
+	Showcase           bool      `json:"showcase"`
+	StartDate          *string   `json:"start_date"`
+	GroupID            *string   `json:"group_id"`
+	PageID             string    `json:"page_id"`
+	Group              bool      `json:"group"`
+	OnlyShowIfDegraded bool      `json:"only_show_if_degraded"`
+}
+
+type StatuspageStatus struct {
+	Indicator   string `json:"indicator"`
+	Description string `json:"description"`
+}
+
+const statuspagePageID = "status"
+
+// StatuspageSummary maps instance groups to Statuspage components. A group
+// is operational when all of its checked instances are up, degraded when
+// some are down and a major outage when all of them are down.
+func (m *Monitor) StatuspageSummary(pageURL string) StatuspageSummary {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	type groupState struct {
+		component StatuspageComponent
+		up        int
+		down      int
+	}
+
+	var order []string
+	groups := make(map[string]*groupState)
+	var updatedAt time.Time
+
+	for _, instance := range m.instances {
+		key := instance.InstanceType + "-" + instance.Group
+		state, ok := groups[key]
+		if !ok {
+			state = &groupState{
+				component: StatuspageComponent{
+					ID:          statuspageComponentID(instance.InstanceType, instance.Group),
+					Name:        instance.Group,
+					Position:    instance.GroupOrder + 1,
+					Description: fmt.Sprintf("%s instances", strings.ToUpper(instance.InstanceType)),
+					PageID:      statuspagePageID,
+				},
+			}
+			groups[key] = state
+			order = append(order, key)
+		}
+
+		instance.mu.RLock()
+		if len(instance.Checks) > 0 {
+			last := instance.Checks[len(instance.Checks)-1]
+			if last.Success {
+				state.up++
+			} else {
+				state.down++
+			}
+			if last.Timestamp.After(state.component.UpdatedAt) {
+				state.component.UpdatedAt = last.Timestamp
+			}
+			if state.component.CreatedAt.IsZero() || instance.Checks[0].Timestamp.Before(state.component.CreatedAt) {
+				state.component.CreatedAt = instance.Checks[0].Timestamp
+			}
+		}
+		instance.mu.RUnlock()
+
+		if state.component.UpdatedAt.After(updatedAt) {
+			updatedAt = state.component.UpdatedAt
+		}
+	}
+
+	components := make([]StatuspageComponent, 0, len(order))
+	degraded, outages := 0, 0
+	for _, key := range order {
+		state := groups[key]
+		switch {
+		case state.down == 0:
+			state.component.Status = "operational"
+		case state.up == 0:
+			state.component.Status = "major_outage"
+			outages++
+		default:
+			state.component.Status = "degraded_performance"
+			degraded++
+		}
+		components = append(components, state.component)
+	}
+
+	status := StatuspageStatus{Indicator: "none", Description: "All Systems Operational"}
+	switch {
+	case outages > 0 && outages == len(components):
+		status = StatuspageStatus{Indicator: "critical", Description: "Major System Outage"}
+	case outages > 0:
+		status = StatuspageStatus{Indicator: "major", Description: "Partial System Outage"}
+	case degraded > 0:
+		status = StatuspageStatus{Indicator: "minor", Description: "Minor Service Outage"}
+	}
+
+	return StatuspageSummary{
+		Page: StatuspagePage{
+			ID:        statuspagePageID,
+			Name:      "status",
+			URL:       pageURL,
+			TimeZone:  "Etc/UTC",
+			UpdatedAt: updatedAt,
+		},
+		Components:            components,
+		Incidents:             []interface{}{},
+		ScheduledMaintenances: []interface{}{},
+		Status:                status,
+	}
+}
+
+func statuspageComponentID(instanceType, group string) string {
+	id := strings.ToLower(instanceType + "-" + group)
+	return strings.Map(func(r rune) rune {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') || r == '-' {
+			return r
+		}
+		return '-'
+	}, id)
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestStatuspageSummary(t *testing.T) {
+	config := DefaultConfig()
+	monitor := NewTestMonitor([]*Instance{
+		{Group: "Main", URL: "https://a.example", InstanceType: "api", Checks: checksWith(1, 0, 100)},
+		{Group: "Main", URL: "https://b.example", InstanceType: "api"},
+		{Group: "Mixed", URL: "https://c.example", InstanceType: "api", GroupOrder: 1, Checks: checksWith(1, 0, 100)},
+		{Group: "Mixed", URL: "https://d.example", InstanceType: "api", GroupOrder: 1, Checks: checksWith(0, 1, 100)},
+		{Group: "Main", URL: "https://e.example", InstanceType: "ui", Checks: checksWith(0, 1, 100)},
+	}, config)
+	server := httptest.NewServer(NewServer(monitor, config).SetupRoutes())
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/api/v2/summary.json")
+	if err != nil {
+		t.Fatalf("GET summary.json: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "application/json" {
+		t.Fatalf("GET summary.json: status %d, content type %q", resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+
+	var summary struct {
+		Page struct {
+			ID       string `json:"id"`
+			URL      string `json:"url"`
+			TimeZone string `json:"time_zone"`
+		} `json:"page"`
+		Components []struct {
+			ID       string  `json:"id"`
+			Name     string  `json:"name"`
+			Status   string  `json:"status"`
+			Position int     `json:"position"`
+			PageID   string  `json:"page_id"`
+			GroupID  *string `json:"group_id"`
+		} `json:"components"`
+		Incidents             []interface{}    `json:"incidents"`
+		ScheduledMaintenances []interface{}    `json:"scheduled_maintenances"`
+		Status                StatuspageStatus `json:"status"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&summary); err != nil {
+		t.Fatalf("failed to decode summary: %v", err)
+	}
+
+	if summary.Page.ID != statuspagePageID || summary.Page.URL != server.URL || summary.Page.TimeZone != "Etc/UTC" {
+		t.Errorf("page = %+v", summary.Page)
+	}
+	if summary.Incidents == nil || summary.ScheduledMaintenances == nil {
+		t.Error("incidents and scheduled_maintenances should be empty arrays, not null")
+	}
+
+	// An unchecked instance does not count against its group.
+	want := []struct{ id, name, status string }{
+		{"api-main", "Main", "operational"},
+		{"api-mixed", "Mixed", "degraded_performance"},
+		{"ui-main", "Main", "major_outage"},
+	}
+	if len(summary.Components) != len(want) {
+		t.Fatalf("got %d components, want %d: %+v", len(summary.Components), len(want), summary.Components)
+	}
+	for i, w := range want {
+		c := summary.Components[i]
+		if c.ID != w.id || c.Name != w.name || c.Status != w.status || c.PageID != statuspagePageID {
+			t.Errorf("component %d = %+v, want id %s, name %s, status %s", i, c, w.id, w.name, w.status)
+		}
+	}
+
+	if summary.Status.Indicator != "major" {
+		t.Errorf("status = %+v, want indicator major for a partial outage", summary.Status)
+	}
+}
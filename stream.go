@@ -0,0 +1,196 @@
+package main
+
+import (
+	"sort"
+	"sync/atomic"
+	"time"
+)
+
+// StreamFilter selects what an SSE client receives and how it is encoded.
+// The zero value selects every instance with its checks, as JSON.
+type StreamFilter struct {
+	Group    string
+	Type     string
+	NoChecks bool
+
+	// Format is the wire format of the events, FormatJSON if empty.
+	Format string
+}
+
+func (f StreamFilter) matches(d InstanceData) bool {
+	return (f.Type == "" || d.InstanceType == f.Type) && (f.Group == "" || d.Group == f.Group)
+}
+
+// apply returns the instances f selects, without their check history if f
+// asks for that. data is not modified.
+func (f StreamFilter) apply(data []InstanceData) []InstanceData {
+	data = filterInstanceData(data, f.Type, f.Group)
+	if !f.NoChecks {
+		return data
+	}
+
+	stripped := make([]InstanceData, len(data))
+	for i, d := range data {
+		d.Checks = []Check{}
+		stripped[i] = d
+	}
+	return stripped
+}
+
+// streamClient is a registered SSE client. filter and sent are guarded by
+// Monitor.clientsMu; the counters are updated by broadcasts without it.
+type streamClient struct {
+	ch     chan []byte
+	filter StreamFilter
+
+	// done is closed when the client is unregistered, so that a broadcast
+	// that started before skips it. ch itself is never closed, since its
+	// reader has already gone away.
+	done chan struct{}
+
+	remoteAddr  string
+	connectedAt time.Time
+
+	delivered  atomic.Int64
+	dropped    atomic.Int64
+	lastSendAt atomic.Pointer[time.Time]
+
+	// sent holds the URLs of the instances in the last instance_update
+	// sent to the client.
+	sent map[string]bool
+}
+
+func newStreamClient(ch chan []byte, filter StreamFilter, remoteAddr string) *streamClient {
+	return &streamClient{
+		ch:          ch,
+		filter:      filter,
+		done:        make(chan struct{}),
+		remoteAddr:  remoteAddr,
+		connectedAt: time.Now(),
+	}
+}
+
+// gone reports whether the client has been unregistered.
+func (c *streamClient) gone() bool {
+	select {
+	case <-c.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// send queues frames for the client without waiting. The frames that do not
+// fit in its buffer are dropped, and send returns how many there were.
+func (c *streamClient) send(frames [][]byte) int {
+	for i, frame := range frames {
+		select {
+		case c.ch <- frame:
+			now := time.Now()
+			c.delivered.Add(1)
+			c.lastSendAt.Store(&now)
+		default:
+			dropped := len(frames) - i
+			c.dropped.Add(int64(dropped))
+			return dropped
+		}
+	}
+	return 0
+}
+
+// StreamClientInfo describes a connected SSE client for /api/clients.
+type StreamClientInfo struct {
+	RemoteAddr    string `json:"remote_addr"`
+	ConnectedUnix int64  `json:"connected_unix"`
+	Group         string `json:"group,omitempty"`
+	Type          string `json:"type,omitempty"`
+	Checks        bool   `json:"checks"`
+	Format        string `json:"format"`
+
+	// Sent counts the events queued for the client and Dropped those
+	// skipped because its buffer was full.
+	Sent         int64  `json:"sent"`
+	Dropped      int64  `json:"dropped"`
+	LastSendUnix *int64 `json:"last_send_unix"`
+	Buffered     int    `json:"buffered"`
+	BufferSize   int    `json:"buffer_size"`
+}
+
+func (c *streamClient) info() StreamClientInfo {
+	format := c.filter.Format
+	if format == "" {
+		format = FormatJSON
+	}
+	return StreamClientInfo{
+		RemoteAddr:    c.remoteAddr,
+		ConnectedUnix: c.connectedAt.Unix(),
+		Group:         c.filter.Group,
+		Type:          c.filter.Type,
+		Checks:        !c.filter.NoChecks,
+		Format:        format,
+		Sent:          c.delivered.Load(),
+		Dropped:       c.dropped.Load(),
+		LastSendUnix:  unixOrNil(c.lastSendAt.Load()),
+		Buffered:      len(c.ch),
+		BufferSize:    cap(c.ch),
+	}
+}
+
+// StreamTotals sums the counters of the connected SSE clients.
+type StreamTotals struct {
+	Clients int   `json:"clients"`
+	Sent    int64 `json:"sent"`
+	Dropped int64 `json:"dropped"`
+}
+
+// StreamClients returns the connected SSE clients, longest connected first.
+func (m *Monitor) StreamClients() []StreamClientInfo {
+	m.clientsMu.RLock()
+	registered := make([]*streamClient, 0, len(m.clients))
+	for _, c := range m.clients {
+		registered = append(registered, c)
+	}
+	m.clientsMu.RUnlock()
+
+	sort.Slice(registered, func(i, j int) bool {
+		return registered[i].connectedAt.Before(registered[j].connectedAt)
+	})
+	clients := make([]StreamClientInfo, len(registered))
+	for i, c := range registered {
+		clients[i] = c.info()
+	}
+	return clients
+}
+
+// StreamTotals returns the totals over the connected SSE clients.
+func (m *Monitor) StreamTotals() StreamTotals {
+	m.clientsMu.RLock()
+	defer m.clientsMu.RUnlock()
+
+	totals := StreamTotals{Clients: len(m.clients)}
+	for _, c := range m.clients {
+		totals.Sent += c.delivered.Load()
+		totals.Dropped += c.dropped.Load()
+	}
+	return totals
+}
+
+// track records the instances of an instance_update sent to the client and
+// returns the URLs it was sent before that are no longer included.
+func (c *streamClient) track(data []InstanceData) []string {
+	current := make(map[string]bool, len(data))
+	for _, d := range data {
+		current[d.URL] = true
+	}
+
+	var removed []string
+	for url := range c.sent {
+		if !current[url] {
+			removed = append(removed, url)
+		}
+	}
+	sort.Strings(removed)
+
+	c.sent = current
+	return removed
+}
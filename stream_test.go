@@ -0,0 +1,262 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// readFrames drains the events queued for a client.
+func readFrames(t *testing.T, client chan []byte) (events []string, data []json.RawMessage) {
+	t.Helper()
+
+	for len(client) > 0 {
+		event, payload, _ := strings.Cut(strings.TrimSuffix(string(<-client), "\n\n"), "\n")
+		events = append(events, strings.TrimPrefix(event, "event: "))
+		data = append(data, json.RawMessage(strings.TrimPrefix(payload, "data: ")))
+	}
+	return events, data
+}
+
+func TestStreamFilter(t *testing.T) {
+	m := newSortTestServer().monitor
+	filtered := make(chan []byte, 8)
+	m.RegisterClient(filtered, StreamFilter{Group: "alpha", NoChecks: true}, "")
+	everything := make(chan []byte, 8)
+	m.RegisterClient(everything, StreamFilter{}, "")
+
+	snapshot := m.StreamSnapshot(filtered)["instances"].([]InstanceData)
+	if len(snapshot) != 2 || snapshot[0].URL != "https://b.example" || len(snapshot[0].Checks) != 0 || snapshot[0].LastCheck == nil {
+		t.Errorf("filtered snapshot = %+v, want the alpha instances without checks", snapshot)
+	}
+	if all := m.StreamSnapshot(everything)["instances"].([]InstanceData); len(all) != 4 || len(all[0].Checks) == 0 {
+		t.Errorf("unfiltered snapshot = %+v, want every instance with checks", all)
+	}
+
+	m.broadcastInstance(m.instances[0])
+	m.broadcastInstance(m.instances[2])
+	events, data := readFrames(t, filtered)
+	if strings.Join(events, ",") != EventInstanceCheck || !strings.Contains(string(data[0]), `"url":"https://b.example"`) || !strings.Contains(string(data[0]), `"checks":[]`) {
+		t.Errorf("filtered client got %v %s, want only the alpha check without history", events, data)
+	}
+	if events, _ := readFrames(t, everything); len(events) != 2 {
+		t.Errorf("unfiltered client got %v, want both checks", events)
+	}
+
+	// The alpha group disappears from the instance list.
+	m.instances = m.instances[:2]
+	m.broadcastUpdate()
+
+	events, data = readFrames(t, filtered)
+	if strings.Join(events, ",") != EventInstancesRemoved+","+EventInstanceUpdate {
+		t.Fatalf("filtered client got %v, want instances_removed then instance_update", events)
+	}
+	var removed struct {
+		URLs []string `json:"urls"`
+	}
+	if err := json.Unmarshal(data[0], &removed); err != nil {
+		t.Fatalf("failed to decode: %v", err)
+	}
+	if strings.Join(removed.URLs, ",") != "https://b.example,https://d.example" {
+		t.Errorf("removed = %v, want the alpha instances", removed.URLs)
+	}
+	if !strings.Contains(string(data[1]), `"instances":[]`) {
+		t.Errorf("update = %s, want an empty instances array", data[1])
+	}
+
+	events, _ = readFrames(t, everything)
+	if strings.Join(events, ",") != EventInstancesRemoved+","+EventInstanceUpdate {
+		t.Errorf("unfiltered client got %v, want instances_removed then instance_update", events)
+	}
+
+	// Nothing more is removed on the next update.
+	m.broadcastUpdate()
+	if events, _ := readFrames(t, filtered); strings.Join(events, ",") != EventInstanceUpdate {
+		t.Errorf("filtered client got %v, want just instance_update", events)
+	}
+}
+
+func TestSSEHandlerInitialPayload(t *testing.T) {
+	s := newSortTestServer()
+	s.config.SSEKeepaliveSeconds = 1
+	server := httptest.NewServer(s.SetupRoutes())
+	defer server.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, server.URL+"/api/stream", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("failed to connect: %v", err)
+	}
+	defer resp.Body.Close()
+	if ct := resp.Header.Get("Content-Type"); resp.StatusCode != http.StatusOK || ct != "text/event-stream" {
+		t.Fatalf("got status %d, Content-Type %q; want an event stream", resp.StatusCode, ct)
+	}
+
+	// readBlock reads lines up to the blank line that ends an event or
+	// comment.
+	reader := bufio.NewReader(resp.Body)
+	readBlock := func() []string {
+		var lines []string
+		for {
+			line, err := reader.ReadString('\n')
+			if err != nil {
+				t.Fatalf("stream ended after %q: %v", lines, err)
+			}
+			if line = strings.TrimSuffix(line, "\n"); line == "" {
+				return lines
+			}
+			lines = append(lines, line)
+		}
+	}
+
+	frame := readBlock()
+	if len(frame) != 2 || frame[0] != "event: "+EventInstanceUpdate || !strings.HasPrefix(frame[1], "data: ") {
+		t.Fatalf("first frame = %q, want an instance_update event", frame)
+	}
+	var update struct {
+		Instances []InstanceData `json:"instances"`
+		Stats     Stats          `json:"stats"`
+	}
+	if err := json.Unmarshal([]byte(strings.TrimPrefix(frame[1], "data: ")), &update); err != nil {
+		t.Fatalf("failed to decode: %v", err)
+	}
+	if len(update.Instances) != 4 || update.Stats.TotalInstances != 4 {
+		t.Errorf("got %d instances and total_instances %d, want 4", len(update.Instances), update.Stats.TotalInstances)
+	}
+
+	// With nothing to send, the stream stays open with keepalives.
+	if comment := readBlock(); strings.Join(comment, "\n") != ":keepalive" {
+		t.Errorf("second block = %q, want a keepalive", comment)
+	}
+}
+
+func TestConcurrentClientRegistration(t *testing.T) {
+	// Every registration and broadcast is logged.
+	defer log.SetOutput(log.Writer())
+	log.SetOutput(io.Discard)
+
+	m := newSortTestServer().monitor
+
+	done := make(chan struct{})
+	broadcasts := make(chan struct{})
+	go func() {
+		defer close(broadcasts)
+		ticker := time.NewTicker(time.Millisecond)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				m.broadcastUpdate()
+				m.broadcastInstance(m.instances[0])
+			}
+		}
+	}()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				client := make(chan []byte, 8)
+				m.RegisterClient(client, StreamFilter{NoChecks: i%2 == 0}, "")
+				m.StreamSnapshot(client)
+				m.UnregisterClient(client)
+			}
+		}(i)
+	}
+	wg.Wait()
+	close(done)
+	<-broadcasts
+
+	if stats := m.Stats(); stats.SSEClients != 0 {
+		t.Errorf("%d clients left registered, want 0", stats.SSEClients)
+	}
+}
+
+func TestStreamClientStats(t *testing.T) {
+	m := newSortTestServer().monitor
+	fast := make(chan []byte, 8)
+	m.RegisterClient(fast, StreamFilter{Group: "alpha"}, "192.0.2.1")
+	slow := make(chan []byte, 1)
+	m.RegisterClient(slow, StreamFilter{}, "192.0.2.2")
+
+	clients := m.StreamClients()
+	if len(clients) != 2 || clients[0].RemoteAddr != "192.0.2.1" || clients[0].Group != "alpha" || clients[1].BufferSize != 1 || clients[1].LastSendUnix != nil {
+		t.Fatalf("clients = %+v, want both registered with nothing sent", clients)
+	}
+
+	m.broadcastInstance(m.instances[2])
+	if info := m.clients[fast].info(); info.Sent != 1 || info.Dropped != 0 || info.Buffered != 1 || info.LastSendUnix == nil {
+		t.Errorf("fast client after a broadcast: %+v, want one event sent", info)
+	}
+
+	// The instance_check filled the slow client's buffer, so it drops what
+	// it is sent next right away and is not counted as sent to.
+	c := m.clients[slow]
+	frame := []byte("event: test\n\n")
+	start := time.Now()
+	if sent := m.broadcast(EventInstanceCheck, func(*streamClient) [][]byte { return [][]byte{frame, frame} }); sent != 1 {
+		t.Errorf("broadcast reached %d clients, want only the fast one", sent)
+	}
+	if elapsed := time.Since(start); elapsed > 100*time.Millisecond {
+		t.Errorf("broadcast to a full client took %v, want no wait", elapsed)
+	}
+	if totals := m.StreamTotals(); totals != (StreamTotals{Clients: 2, Sent: 4, Dropped: 2}) {
+		t.Errorf("totals = %+v, want 2 clients, 4 sent and 2 dropped", totals)
+	}
+
+	// A client that went away is neither sent to nor counted.
+	m.UnregisterClient(slow)
+	m.UnregisterClient(slow)
+	if !c.gone() {
+		t.Error("an unregistered client is not gone")
+	}
+	if sent := m.broadcast(EventInstanceCheck, func(*streamClient) [][]byte { return [][]byte{frame} }); sent != 1 {
+		t.Errorf("broadcast after unregistering reached %d clients, want 1", sent)
+	}
+	if totals := m.StreamTotals(); totals.Clients != 1 {
+		t.Errorf("%d clients registered, want 1", totals.Clients)
+	}
+}
+
+func TestBroadcastInstanceFullClient(t *testing.T) {
+	m := newSortTestServer().monitor
+	full := make(chan []byte)
+	m.RegisterClient(full, StreamFilter{}, "192.0.2.1")
+	other := make(chan []byte, 4)
+	m.RegisterClient(other, StreamFilter{}, "192.0.2.2")
+
+	// Every check of a busy cycle goes straight through a client that
+	// reads nothing.
+	const checks = 100
+	start := time.Now()
+	for range checks {
+		m.broadcastInstance(m.instances[0])
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("%d instance_check broadcasts took %v, want no waiting", checks, elapsed)
+	}
+
+	if info := m.clients[full].info(); info.Sent != 0 || info.Dropped != checks {
+		t.Errorf("full client: %+v, want %d dropped", info, checks)
+	}
+	if info := m.clients[other].info(); info.Sent != 4 || info.Dropped != checks-4 {
+		t.Errorf("other client: %+v, want 4 sent and the rest dropped", info)
+	}
+}
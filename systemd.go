@@ -0,0 +1,96 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"strconv"
+	"sync/atomic"
+)
+
+// systemdListenFDStart is the first file descriptor passed by systemd socket
+// activation.
+const systemdListenFDStart = 3
+
+// systemdListener returns the socket passed by systemd socket activation, or
+// nil if the process was not socket-activated.
+func systemdListener() (net.Listener, error) {
+	pid, err := strconv.Atoi(os.Getenv("LISTEN_PID"))
+	if err != nil || pid != os.Getpid() {
+		return nil, nil
+	}
+
+	fds, err := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	if err != nil || fds < 1 {
+		return nil, nil
+	}
+
+	os.Unsetenv("LISTEN_PID")
+	os.Unsetenv("LISTEN_FDS")
+	os.Unsetenv("LISTEN_FDNAMES")
+
+	file := os.NewFile(systemdListenFDStart, "LISTEN_FD_3")
+	defer file.Close()
+
+	listener, err := net.FileListener(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to use socket from systemd: %w", err)
+	}
+	return listener, nil
+}
+
+// sdNotify sends a state such as READY=1 to systemd. It does nothing when
+// NOTIFY_SOCKET is not set.
+func sdNotify(state string) error {
+	socket := os.Getenv("NOTIFY_SOCKET")
+	if socket == "" {
+		return nil
+	}
+	if socket[0] == '@' {
+		socket = "\x00" + socket[1:]
+	}
+
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: socket, Net: "unixgram"})
+	if err != nil {
+		return fmt.Errorf("failed to connect to systemd notify socket: %w", err)
+	}
+	defer conn.Close()
+
+	if _, err := conn.Write([]byte(state)); err != nil {
+		return fmt.Errorf("failed to notify systemd: %w", err)
+	}
+	return nil
+}
+
+// systemdWatchdogEnabled reports whether systemd expects WATCHDOG=1 pings
+// from this process (WatchdogSec is set on the unit).
+func systemdWatchdogEnabled() bool {
+	if _, err := strconv.Atoi(os.Getenv("WATCHDOG_USEC")); err != nil {
+		return false
+	}
+	if pidStr := os.Getenv("WATCHDOG_PID"); pidStr != "" {
+		pid, err := strconv.Atoi(pidStr)
+		return err == nil && pid == os.Getpid()
+	}
+	return true
+}
+
+// systemdOnCycle returns the Monitor.OnCycle of each of monitors monitors:
+// it sends READY=1 once all of them have completed their first cycle and,
+// with watchdog set, WATCHDOG=1 after every cycle.
+func systemdOnCycle(monitors int, watchdog bool) func(first bool) {
+	var started atomic.Int32
+	return func(first bool) {
+		if first && int(started.Add(1)) == monitors {
+			if err := sdNotify("READY=1"); err != nil {
+				log.Printf("Warning: %v", err)
+			}
+		}
+		if watchdog {
+			if err := sdNotify("WATCHDOG=1"); err != nil {
+				log.Printf("Warning: %v", err)
+			}
+		}
+	}
+}
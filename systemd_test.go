@@ -0,0 +1,83 @@
+package main
+
+import (
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// listenNotify listens on a unixgram socket set as NOTIFY_SOCKET.
+func listenNotify(t *testing.T) *net.UnixConn {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "notify.sock")
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: path, Net: "unixgram"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	t.Setenv("NOTIFY_SOCKET", path)
+	return conn
+}
+
+// readNotify returns the states sent to conn until none arrives for a
+// short while.
+func readNotify(t *testing.T, conn *net.UnixConn) []string {
+	t.Helper()
+	var states []string
+	buf := make([]byte, 64)
+	for {
+		conn.SetReadDeadline(time.Now().Add(50 * time.Millisecond))
+		n, err := conn.Read(buf)
+		if err != nil {
+			return states
+		}
+		states = append(states, string(buf[:n]))
+	}
+}
+
+func TestSdNotify(t *testing.T) {
+	conn := listenNotify(t)
+	if err := sdNotify("READY=1"); err != nil {
+		t.Fatalf("sdNotify = %v", err)
+	}
+	if states := readNotify(t, conn); len(states) != 1 || states[0] != "READY=1" {
+		t.Errorf("received %q, want READY=1", states)
+	}
+
+	// Without NOTIFY_SOCKET nothing is sent.
+	t.Setenv("NOTIFY_SOCKET", "")
+	if err := sdNotify("READY=1"); err != nil {
+		t.Errorf("sdNotify without a socket = %v", err)
+	}
+	if states := readNotify(t, conn); len(states) != 0 {
+		t.Errorf("received %q without NOTIFY_SOCKET, want nothing", states)
+	}
+}
+
+func TestSystemdOnCycle(t *testing.T) {
+	conn := listenNotify(t)
+
+	// READY=1 waits for the first cycle of both monitors.
+	onCycle := systemdOnCycle(2, true)
+	onCycle(true)
+	if states := readNotify(t, conn); len(states) != 1 || states[0] != "WATCHDOG=1" {
+		t.Errorf("after one monitor started: received %q, want WATCHDOG=1", states)
+	}
+	onCycle(true)
+	if states := readNotify(t, conn); len(states) != 2 || states[0] != "READY=1" || states[1] != "WATCHDOG=1" {
+		t.Errorf("after both monitors started: received %q, want READY=1 and WATCHDOG=1", states)
+	}
+	onCycle(false)
+	if states := readNotify(t, conn); len(states) != 1 || states[0] != "WATCHDOG=1" {
+		t.Errorf("after a later cycle: received %q, want WATCHDOG=1", states)
+	}
+
+	// Without the watchdog only READY=1 is sent.
+	onCycle = systemdOnCycle(1, false)
+	onCycle(true)
+	onCycle(false)
+	if states := readNotify(t, conn); len(states) != 1 || states[0] != "READY=1" {
+		t.Errorf("without the watchdog: received %q, want READY=1", states)
+	}
+}
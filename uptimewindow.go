@@ -0,0 +1,119 @@
+package main
+
+import (
+	"time"
+)
+
+// Running uptime windows kept for every instance, indexes into
+// uptimePeriods.
+const (
+	uptimeAll = iota
+	uptime24h
+	uptime7d
+	uptime30d
+)
+
+// uptimePeriods are the lengths of the running uptime windows. A zero
+// period covers the whole stored history.
+var uptimePeriods = [...]time.Duration{0, 24 * time.Hour, 7 * 24 * time.Hour, 30 * 24 * time.Hour}
+
+// uptimeWindow counts the raw checks from Checks[first] on.
+type uptimeWindow struct {
+	first     int
+	total     int
+	successes int
+}
+
+func (w *uptimeWindow) drop(check Check) {
+	w.total -= check.weight()
+	w.successes -= check.successes()
+}
+
+// uptimeWindows keeps the uptime of an instance over each of uptimePeriods
+// as running totals, so that reading it does not go through the history.
+// The windows end at the latest check. Until reset, uptime falls back to
+// computing from the history, which is how instances built with a history
+// are handled.
+type uptimeWindows struct {
+	valid   bool
+	windows [len(uptimePeriods)]uptimeWindow
+}
+
+// reset recomputes the windows from checks, after the history was changed
+// other than by appending or trimming.
+func (u *uptimeWindows) reset(checks []Check) {
+	*u = uptimeWindows{valid: true}
+	for i := range u.windows {
+		w := &u.windows[i]
+		w.first = len(checks) - len(windowChecks(checks, uptimePeriods[i]))
+		for _, check := range checks[w.first:] {
+			w.total += check.weight()
+			w.successes += check.successes()
+		}
+	}
+}
+
+// appended adds the last of checks to the windows and drops the checks that
+// have left them.
+func (u *uptimeWindows) appended(checks []Check) {
+	if !u.valid {
+		u.reset(checks)
+		return
+	}
+
+	check := checks[len(checks)-1]
+	for i := range u.windows {
+		w := &u.windows[i]
+		w.total += check.weight()
+		w.successes += check.successes()
+		if period := uptimePeriods[i]; period > 0 {
+			since := check.Timestamp.Add(-period)
+			for ; w.first < len(checks) && checks[w.first].Timestamp.Before(since); w.first++ {
+				w.drop(checks[w.first])
+			}
+		}
+	}
+}
+
+// trimmed accounts for the n oldest of checks being removed from the
+// history.
+func (u *uptimeWindows) trimmed(checks []Check, n int) {
+	if !u.valid {
+		return
+	}
+	for i := range u.windows {
+		w := &u.windows[i]
+		for ; w.first < n; w.first++ {
+			w.drop(checks[w.first])
+		}
+		w.first -= n
+	}
+}
+
+// uptime returns the uptime percentage of window i of checks, the history
+// the windows were kept for.
+func (u *uptimeWindows) uptime(checks []Check, i int) float64 {
+	if !u.valid {
+		return calculateUptime(windowChecks(checks, uptimePeriods[i]))
+	}
+	w := u.windows[i]
+	if w.total == 0 {
+		return 0
+	}
+	return (float64(w.successes) / float64(w.total)) * 100
+}
+
+// uptimeOver returns the uptime percentage of window i, see uptimeWindows.
+// The caller holds the instance lock.
+func (instance *Instance) uptimeOver(i int) float64 {
+	return instance.uptime.uptime(instance.Checks, i)
+}
+
+// windowChecks returns the checks within period of the latest one, or all
+// of them for a zero period.
+func windowChecks(checks []Check, period time.Duration) []Check {
+	if period == 0 || len(checks) == 0 {
+		return checks
+	}
+	return checksSince(checks, checks[len(checks)-1].Timestamp.Add(-period))
+}
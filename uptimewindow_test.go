@@ -0,0 +1,46 @@
+package main
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestUptimeWindows(t *testing.T) {
+	const maxHistory = 300
+	start := time.Now().Add(-60 * 24 * time.Hour)
+	instance := &Instance{URL: "https://a.example"}
+
+	compare := func(step string) {
+		t.Helper()
+		for i, period := range uptimePeriods {
+			want := calculateUptime(windowChecks(instance.Checks, period))
+			if got := instance.uptimeOver(i); math.Abs(got-want) > 1e-9 {
+				t.Fatalf("%s: uptime over %v = %v, recomputed %v", step, period, got, want)
+			}
+		}
+	}
+
+	// Checks every 3 hours for 60 days, failing in irregular runs, with the
+	// history trimmed as checkInstance does and compacted halfway.
+	for i := 0; i < 480; i++ {
+		instance.appendCheck(Check{Timestamp: start.Add(time.Duration(i) * 3 * time.Hour), Success: i%7 != 0 && i%11 != 3})
+		if n := len(instance.Checks) - maxHistory; n > 0 {
+			instance.uptime.trimmed(instance.Checks, n)
+			instance.Checks = instance.Checks[n:]
+		}
+		compare("append")
+
+		if i == 240 {
+			instance.Checks = compactChecks(instance.Checks, instance.Checks[len(instance.Checks)-1].Timestamp.Add(-20*24*time.Hour))
+			instance.uptime.reset(instance.Checks)
+			compare("compact")
+		}
+	}
+
+	// An instance given a history falls back to computing from it.
+	given := &Instance{Checks: checksWith(3, 1, 100)}
+	if got := given.uptimeOver(uptime24h); got != 75 {
+		t.Errorf("uptime of a given history = %v, want 75", got)
+	}
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"os"
+)
+
+// exitInvalidList is the exit code of validate when the list has errors.
+const exitInvalidList = 1
+
+// runValidate checks an instances JSON with the same parsing as the monitor,
+// prints every problem found to stdout and returns the process exit code:
+// exitInvalidList if there are errors, exitError if the list cannot be read
+// or parsed at all.
+func runValidate(config *Config, location string) int {
+	if location == "" {
+		location = config.InstancesURL
+	}
+
+	source, err := NewSourceReader(location, config.InstancesRequestHeaders, config.InstancesAuth())
+	if err != nil {
+		log.Printf("Invalid instances location: %v", err)
+		return exitError
+	}
+	// The report names the location without its credentials.
+	location, _ = stripURLCredentials(location)
+
+	body, err := fetchInstanceList(context.Background(), source, config.InstancesRequestTimeout)
+	if err != nil {
+		log.Printf("Validation failed: %v", err)
+		return exitError
+	}
+
+	specs, issues, err := parseInstanceList(body)
+	if err != nil {
+		fmt.Fprintf(os.Stdout, "%s: error: %v\n", location, err)
+		return exitError
+	}
+
+	if writeValidationReport(os.Stdout, location, specs, issues) > 0 {
+		return exitInvalidList
+	}
+	return 0
+}
+
+// writeValidationReport prints the issues and a summary line, and returns
+// the number of errors.
+func writeValidationReport(w io.Writer, location string, specs []instanceSpec, issues []ListIssue) int {
+	errors, warnings := 0, 0
+	for _, issue := range issues {
+		fmt.Fprintln(w, issue)
+		if issue.Severity == SeverityError {
+			errors++
+		} else {
+			warnings++
+		}
+	}
+
+	groups := make(map[string]bool)
+	for _, spec := range specs {
+		groups[spec.InstanceType+"."+spec.Group] = true
+	}
+	fmt.Fprintf(w, "%s: %d instances in %d groups, %d errors, %d warnings\n",
+		location, len(specs), len(groups), errors, warnings)
+	return errors
+}
+
+// runDryRunConfig loads the instance list of every config the way a monitor
+// would on startup, without checking any instance, and writes a report like
+// validate's to w. Config values have already been checked and logged when
+// they were loaded. It returns exitInvalidList if any list cannot be loaded
+// or has errors. The list is fetched once rather than through Initialize,
+// which would retry an unreachable list for up to MaxStartupWait and does
+// not report the list's issues.
+func runDryRunConfig(w io.Writer, configs []*Config) int {
+	code := 0
+	for _, config := range configs {
+		monitor := NewMonitor(config)
+		if err := monitor.openSource(); err != nil {
+			log.Printf("Invalid instances location: %v", err)
+			code = exitInvalidList
+			continue
+		}
+
+		body, err := fetchInstanceList(context.Background(), monitor.source, config.InstancesRequestTimeout)
+		if err != nil {
+			log.Printf("Validation failed: %v", err)
+			code = exitInvalidList
+			continue
+		}
+
+		specs, issues, err := parseInstanceList(body)
+		if err != nil {
+			fmt.Fprintf(w, "%s: error: %v\n", config.InstancesURL, err)
+			code = exitInvalidList
+			continue
+		}
+
+		specs, excluded := filterInstances(specs, config.CurrentInstanceFilter())
+		for _, instanceURL := range excluded {
+			fmt.Fprintf(w, "%s: excluded by the config\n", instanceURL)
+		}
+		if writeValidationReport(w, config.InstancesURL, specs, issues) > 0 {
+			code = exitInvalidList
+		}
+	}
+	return code
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRunDryRunConfig(t *testing.T) {
+	dir := t.TempDir()
+	writeList := func(name, content string) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	valid := writeList("valid.json", `{"ui": {"Main": {"urls": ["https://a.example", "https://b.example"]}}}`)
+	invalidJSON := writeList("invalid.json", `{"ui": [`)
+	withErrors := writeList("errors.json", `{"ui": {"Main": {"urls": ["https://a.example", "https://a.example"]}}}`)
+	missing := filepath.Join(dir, "missing.json")
+
+	tests := []struct {
+		name   string
+		lists  []string
+		want   int
+		output string
+	}{
+		{"valid list", []string{valid}, 0, "2 instances in 1 groups, 0 errors"},
+		{"unreadable list", []string{missing}, exitInvalidList, ""},
+		{"parse error", []string{invalidJSON}, exitInvalidList, invalidJSON + ": error:"},
+		{"list with errors", []string{withErrors}, exitInvalidList, "duplicate URL"},
+		{"unsupported location", []string{"ftp://lists.example/instances.json"}, exitInvalidList, ""},
+		{"one bad page", []string{valid, missing}, exitInvalidList, "2 instances in 1 groups"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			configs := make([]*Config, len(tt.lists))
+			for i, list := range tt.lists {
+				configs[i] = DefaultConfig()
+				configs[i].InstancesURL = list
+			}
+
+			var out bytes.Buffer
+			if code := runDryRunConfig(&out, configs); code != tt.want {
+				t.Errorf("runDryRunConfig = %d, want %d; output: %s", code, tt.want, out.String())
+			}
+			if !strings.Contains(out.String(), tt.output) {
+				t.Errorf("output = %q, want it to contain %q", out.String(), tt.output)
+			}
+		})
+	}
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// maxWebhookDeliveries is how many GitHub delivery IDs are remembered to
+// reject replays.
+const maxWebhookDeliveries = 1000
+
+// deliverySet remembers the most recent webhook delivery IDs.
+type deliverySet struct {
+	mu    sync.Mutex
+	seen  map[string]bool
+	order []string
+	next  int
+}
+
+func newDeliverySet(size int) *deliverySet {
+	return &deliverySet{seen: make(map[string]bool), order: make([]string, size)}
+}
+
+// add records id and reports whether it was new. The oldest ID is forgotten
+// once the set is full.
+func (d *deliverySet) add(id string) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.seen[id] {
+		return false
+	}
+	if old := d.order[d.next]; old != "" {
+		delete(d.seen, old)
+	}
+	d.order[d.next] = id
+	d.next = (d.next + 1) % len(d.order)
+	d.seen[id] = true
+	return true
+}
+
+// githubPush holds the parts of a GitHub push event that decide whether the
+// instance list changed.
+type githubPush struct {
+	Ref        string `json:"ref"`
+	Repository struct {
+		DefaultBranch string `json:"default_branch"`
+	} `json:"repository"`
+	Commits []struct {
+		Added    []string `json:"added"`
+		Modified []string `json:"modified"`
+		Removed  []string `json:"removed"`
+	} `json:"commits"`
+}
+
+// touches reports whether the push changed path on the default branch.
+func (p githubPush) touches(path string) bool {
+	if p.Repository.DefaultBranch != "" && p.Ref != "refs/heads/"+p.Repository.DefaultBranch {
+		return false
+	}
+	for _, commit := range p.Commits {
+		for _, files := range [][]string{commit.Added, commit.Modified, commit.Removed} {
+			for _, file := range files {
+				if file == path {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// WebhookResult is the response to a webhook delivery that was accepted or
+// deliberately ignored.
+type WebhookResult struct {
+	Status string `json:"status"`
+	Reason string `json:"reason,omitempty"`
+}
+
+// validGitHubSignature checks an X-Hub-Signature-256 header against body.
+func validGitHubSignature(secret string, body []byte, signature string) bool {
+	hexSum, ok := strings.CutPrefix(signature, "sha256=")
+	if !ok {
+		return false
+	}
+	sum, err := hex.DecodeString(hexSum)
+	if err != nil {
+		return false
+	}
+
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return hmac.Equal(sum, mac.Sum(nil))
+}
+
+// handleGitHubWebhook refreshes the instance list when a signed push changes
+// the instances file. The hourly refresh still runs as a fallback.
+func (s *Server) handleGitHubWebhook(w http.ResponseWriter, r *http.Request) {
+	if s.config.GitHubWebhookSecret == "" {
+		writeJSONError(w, http.StatusForbidden, "webhook_disabled", "GitHub webhook disabled")
+		return
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			writeJSONError(w, http.StatusRequestEntityTooLarge, "body_too_large", "Request body too large")
+			return
+		}
+		writeJSONError(w, http.StatusBadRequest, "invalid_body", "Failed to read request body")
+		return
+	}
+
+	if !validGitHubSignature(s.config.GitHubWebhookSecret, body, r.Header.Get("X-Hub-Signature-256")) {
+		logRequestf(r, "Rejected GitHub webhook with an invalid signature")
+		writeJSONError(w, http.StatusUnauthorized, "invalid_signature", "Invalid signature")
+		return
+	}
+
+	delivery := r.Header.Get("X-GitHub-Delivery")
+	if delivery == "" {
+		writeJSONError(w, http.StatusBadRequest, "missing_delivery_id", "Missing X-GitHub-Delivery header")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	if !s.deliveries.add(delivery) {
+		writeJSON(w, WebhookResult{Status: "ignored", Reason: "duplicate delivery"})
+		return
+	}
+
+	switch event := r.Header.Get("X-GitHub-Event"); event {
+	case "ping":
+		writeJSON(w, WebhookResult{Status: "ok", Reason: "ping"})
+		return
+	case "push":
+	default:
+		writeJSON(w, WebhookResult{Status: "ignored", Reason: "event " + event})
+		return
+	}
+
+	var push githubPush
+	if err := json.Unmarshal(body, &push); err != nil {
+		writeJSONError(w, http.StatusBadRequest, "invalid_json", "Invalid JSON body")
+		return
+	}
+	if !push.touches(s.config.GitHubWebhookPath) {
+		writeJSON(w, WebhookResult{Status: "ignored", Reason: "instance list unchanged"})
+		return
+	}
+
+	logRequestf(r, "GitHub push changed %s, refreshing instances", s.config.GitHubWebhookPath)
+	ctx := context.WithoutCancel(r.Context())
+	go func() {
+		// A refresh already running may have read the list before this
+		// push, so it is queued to run again rather than skipped.
+		if err := s.monitor.QueueRefresh(ctx); err != nil {
+			logRequestf(r, "Error refreshing instances after GitHub push: %v", err)
+		}
+	}()
+
+	w.WriteHeader(http.StatusAccepted)
+	writeJSON(w, WebhookResult{Status: "refreshing"})
+}
@@ -0,0 +1,201 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// signalSource serves an empty instance list and signals each read.
+type signalSource struct {
+	opened chan struct{}
+}
+
+func (s signalSource) Open(ctx context.Context) (io.ReadCloser, error) {
+	s.opened <- struct{}{}
+	return io.NopCloser(strings.NewReader("{}")), nil
+}
+
+func signGitHub(secret, body string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(body))
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func TestGitHubWebhook(t *testing.T) {
+	push := func(ref, file string) string {
+		return `{"ref": "` + ref + `", "repository": {"default_branch": "main"}, "commits": [{"added": [], "modified": ["` + file + `"], "removed": []}]}`
+	}
+
+	tests := []struct {
+		name      string
+		secret    string
+		event     string
+		delivery  string
+		body      string
+		signature string
+		status    int
+		result    string
+		refresh   bool
+	}{
+		{"disabled", "", "push", "d1", push("refs/heads/main", "instances.json"), "", http.StatusForbidden, "", false},
+		{"bad signature", "secret", "push", "d2", push("refs/heads/main", "instances.json"), signGitHub("other", "x"), http.StatusUnauthorized, "", false},
+		{"missing signature", "secret", "push", "d3", push("refs/heads/main", "instances.json"), "-", http.StatusUnauthorized, "", false},
+		{"missing delivery", "secret", "push", "", push("refs/heads/main", "instances.json"), "", http.StatusBadRequest, "", false},
+		{"ping", "secret", "ping", "d4", `{"zen": "Keep it simple."}`, "", http.StatusOK, "ok", false},
+		{"other event", "secret", "issues", "d5", `{}`, "", http.StatusOK, "ignored", false},
+		{"other file", "secret", "push", "d6", push("refs/heads/main", "readme.md"), "", http.StatusOK, "ignored", false},
+		{"other branch", "secret", "push", "d7", push("refs/heads/dev", "instances.json"), "", http.StatusOK, "ignored", false},
+		{"instances changed", "secret", "push", "d8", push("refs/heads/main", "instances.json"), "", http.StatusAccepted, "refreshing", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newSortTestServer()
+			s.config.GitHubWebhookSecret = tt.secret
+			source := signalSource{opened: make(chan struct{}, 1)}
+			s.monitor.source = source
+
+			req := httptest.NewRequest(http.MethodPost, "/api/webhook/github", strings.NewReader(tt.body))
+			req.Header.Set("X-GitHub-Event", tt.event)
+			req.Header.Set("X-GitHub-Delivery", tt.delivery)
+			switch tt.signature {
+			case "":
+				req.Header.Set("X-Hub-Signature-256", signGitHub(tt.secret, tt.body))
+			case "-":
+			default:
+				req.Header.Set("X-Hub-Signature-256", tt.signature)
+			}
+
+			rec := httptest.NewRecorder()
+			s.handleGitHubWebhook(rec, req)
+			if rec.Code != tt.status {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.status, rec.Body)
+			}
+			if tt.result != "" {
+				var result WebhookResult
+				if err := json.NewDecoder(rec.Body).Decode(&result); err != nil {
+					t.Fatalf("failed to decode: %v", err)
+				}
+				if result.Status != tt.result {
+					t.Errorf("status = %q, want %q", result.Status, tt.result)
+				}
+			}
+
+			select {
+			case <-source.opened:
+				if !tt.refresh {
+					t.Error("instance list refreshed, want no refresh")
+				}
+			case <-time.After(100 * time.Millisecond):
+				if tt.refresh {
+					t.Error("instance list not refreshed")
+				}
+			}
+		})
+	}
+}
+
+func TestGitHubWebhookReplay(t *testing.T) {
+	s := newSortTestServer()
+	s.config.GitHubWebhookSecret = "secret"
+	source := signalSource{opened: make(chan struct{}, 2)}
+	s.monitor.source = source
+
+	body := `{"ref": "refs/heads/main", "repository": {"default_branch": "main"}, "commits": [{"removed": ["instances.json"]}]}`
+	deliver := func() WebhookResult {
+		req := httptest.NewRequest(http.MethodPost, "/api/webhook/github", strings.NewReader(body))
+		req.Header.Set("X-GitHub-Event", "push")
+		req.Header.Set("X-GitHub-Delivery", "72d3162e-cc78-11e3-81ab-4c9367dc0958")
+		req.Header.Set("X-Hub-Signature-256", signGitHub("secret", body))
+
+		rec := httptest.NewRecorder()
+		s.handleGitHubWebhook(rec, req)
+		var result WebhookResult
+		if err := json.NewDecoder(rec.Body).Decode(&result); err != nil {
+			t.Fatalf("failed to decode: %v", err)
+		}
+		return result
+	}
+
+	if got := deliver(); got.Status != "refreshing" {
+		t.Fatalf("first delivery: status = %q, want refreshing", got.Status)
+	}
+	<-source.opened
+	if got := deliver(); got.Status != "ignored" {
+		t.Errorf("replayed delivery: status = %q, want ignored", got.Status)
+	}
+	select {
+	case <-source.opened:
+		t.Error("replayed delivery refreshed the instance list")
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestDeliverySetEvictsOldest(t *testing.T) {
+	d := newDeliverySet(2)
+	for _, id := range []string{"a", "b", "c"} {
+		if !d.add(id) {
+			t.Fatalf("add(%q) = false on first delivery", id)
+		}
+	}
+	if d.add("c") {
+		t.Error("add(c) = true for a recent delivery")
+	}
+	if !d.add("a") {
+		t.Error("add(a) = false after it was evicted")
+	}
+}
+
+func TestGitHubWebhookDuringRefresh(t *testing.T) {
+	s := newSortTestServer()
+	s.config.GitHubWebhookSecret = "secret"
+	source := signalSource{opened: make(chan struct{})}
+	s.monitor.source = source
+
+	refreshed := make(chan error)
+	go func() {
+		_, err := s.monitor.Refresh(context.Background())
+		refreshed <- err
+	}()
+	for !s.monitor.refreshing.Load() {
+		time.Sleep(time.Millisecond)
+	}
+
+	body := `{"ref": "refs/heads/main", "repository": {"default_branch": "main"}, "commits": [{"modified": ["instances.json"]}]}`
+	req := httptest.NewRequest(http.MethodPost, "/api/webhook/github", strings.NewReader(body))
+	req.Header.Set("X-GitHub-Event", "push")
+	req.Header.Set("X-GitHub-Delivery", "d1")
+	req.Header.Set("X-Hub-Signature-256", signGitHub("secret", body))
+	rec := httptest.NewRecorder()
+	s.handleGitHubWebhook(rec, req)
+	if rec.Code != http.StatusAccepted {
+		t.Fatalf("status = %d, want 202: %s", rec.Code, rec.Body)
+	}
+	for !s.monitor.refreshQueued.Load() {
+		time.Sleep(time.Millisecond)
+	}
+
+	// The running refresh reads the list, then reads it again for the push.
+	for i := 0; i < 2; i++ {
+		select {
+		case <-source.opened:
+		case <-time.After(time.Second):
+			t.Fatalf("instance list read %d times, want 2", i)
+		}
+	}
+	if err := <-refreshed; err != nil {
+		t.Errorf("Refresh: %v", err)
+	}
+	if s.monitor.refreshing.Load() {
+		t.Error("refresh still marked as running")
+	}
+}